@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/ui"
+)
+
+// twoHunkMsg is a diff of file with two hunks, each a hunk header, a context
+// line and an added line.
+func twoHunkMsg(m model, file string) diffLoadedMsg {
+	var rows []diff.Row
+	for i := 0; i < 2; i++ {
+		old, new := 10*i+1, 10*i+1
+		added := new + 1
+		rows = append(rows,
+			diff.Row{Old: "@@", New: "@@", Kind: diff.HunkHeader},
+			diff.Row{OldNo: &old, NewNo: &new, Old: "x", New: "x", Kind: diff.Context},
+			diff.Row{NewNo: &added, New: "y", Kind: diff.Add},
+		)
+	}
+	return diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: file, rows: rows, hunks: []diff.Hunk{{RowStart: 0, RowEnd: 3}, {RowStart: 3, RowEnd: 6}}}
+}
+
+// advanceModel shows a.go of three files with auto-advance on and the NEW
+// pane focused.
+func advanceModel(t *testing.T) model {
+	m := reviewModel()
+	m.autoAdvance = true
+	m.focus = ui.FocusNew
+	return update(t, m, twoHunkMsg(m, "a.go"))
+}
+
+func TestAutoAdvance_PastTheEndOpensTheNextFile(t *testing.T) {
+	m := advanceModel(t)
+	m = update(t, m, runeKeys("G")...)
+	m = update(t, m, runeKeys("j")...)
+	if m.selectedFile() != "b.go" || m.loadedReq == m.diffReq {
+		t.Fatalf("selected %s, loading %v; want b.go loading", m.selectedFile(), m.loadedReq != m.diffReq)
+	}
+	// Motions wait for the load instead of skipping ahead again.
+	m = update(t, m, runeKeys("j")...)
+	if m.selectedFile() != "b.go" {
+		t.Fatalf("selected %s while b.go loads", m.selectedFile())
+	}
+	m = update(t, m, twoHunkMsg(m, "b.go"))
+	if m.cursor != m.changeStarts[0] {
+		t.Fatalf("b.go opened on row %d, want its first change %d", m.cursor, m.changeStarts[0])
+	}
+}
+
+func TestAutoAdvance_PastTheTopOpensThePreviousFileOnItsLastHunk(t *testing.T) {
+	m := advanceModel(t)
+	m = update(t, m, runeKeys("Gj")...)
+	m = update(t, m, twoHunkMsg(m, "b.go"))
+	m = update(t, m, runeKeys("ggk")...)
+	if m.selectedFile() != "a.go" {
+		t.Fatalf("k at the top selected %s, want a.go", m.selectedFile())
+	}
+	m = update(t, m, twoHunkMsg(m, "a.go"))
+	if want := m.hunks[1].RowStart; m.cursor != want {
+		t.Fatalf("a.go opened on row %d, want its last hunk at %d even though it was seen before", m.cursor, want)
+	}
+}
+
+func TestAutoAdvance_OffStaysInTheFile(t *testing.T) {
+	m := advanceModel(t)
+	m = update(t, m, runeKeys("R")...)
+	if m.autoAdvance {
+		t.Fatal("R left auto-advance on")
+	}
+	m = update(t, m, runeKeys("Gjn")...)
+	if m.selectedFile() != "a.go" || m.cursor != len(m.rows)-1 {
+		t.Fatalf("selected %s at row %d, want a.go's last row", m.selectedFile(), m.cursor)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// algoSummaries say what each diff algorithm is good at, for the picker.
+var algoSummaries = map[git.DiffAlgo]string{
+	git.DiffDefault:   "git's Myers diff, or diff.algorithm when it is set",
+	git.DiffHistogram: "patience that copes with repeated lines, often the clearest",
+	git.DiffPatience:  "matches unique lines first, keeping moved blocks whole",
+}
+
+// showAlgos opens the list of diff algorithms to switch to (A in a diff pane).
+func (m model) showAlgos() (tea.Model, tea.Cmd) {
+	lines := make([]string, len(git.DiffAlgos))
+	selected := 0
+	for i, algo := range git.DiffAlgos {
+		mark := "  "
+		if algo == m.diffAlgo {
+			mark, selected = "* ", i
+		}
+		lines[i] = fmt.Sprintf("%s%-10s %s", mark, algo.String(), algoSummaries[algo])
+	}
+	m.algoPicker = true
+	m.overlay = &ui.Overlay{
+		Title:      "DIFF ALGORITHM  enter: use  or press its first letter",
+		Lines:      lines,
+		Selectable: true,
+		Selected:   selected,
+	}
+	cmd := m.dismissImages()
+	return m, cmd
+}
+
+// handleAlgosKey moves through the algorithm list and switches to the one
+// chosen with enter or by its first letter.
+func (m model) handleAlgosKey(key string) (tea.Model, tea.Cmd) {
+	switch key {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc", "q", "A":
+		m.overlay, m.algoPicker = nil, false
+		return m, m.drawImagesCmd()
+	case "enter":
+		algo := git.DiffAlgos[m.overlay.Selected]
+		m.overlay, m.algoPicker = nil, false
+		return m.pickAlgo(algo)
+	}
+	for _, algo := range git.DiffAlgos {
+		if key == algo.String()[:1] {
+			m.overlay, m.algoPicker = nil, false
+			return m.pickAlgo(algo)
+		}
+	}
+	m.selectListItem(listSelection(key, m.overlay.Selected, len(git.DiffAlgos), ui.OverlayVisibleLines(m.bodyHeight())))
+	return m, nil
+}
+
+// pickAlgo switches to algo from the picker, leaving the diff alone when it
+// already uses it.
+func (m model) pickAlgo(algo git.DiffAlgo) (tea.Model, tea.Cmd) {
+	if algo == m.diffAlgo {
+		return m, m.drawImagesCmd()
+	}
+	return m.useDiffAlgo(algo)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestAlgos_PickerMarksTheCurrentAlgorithm(t *testing.T) {
+	m := reviewModel()
+	m.focus = ui.FocusNew
+	m.diffAlgo = git.DiffHistogram
+	m = update(t, m, runeKeys("A")...)
+	if !m.algoPicker || m.overlay == nil || len(m.overlay.Lines) != len(git.DiffAlgos) || m.overlay.Selected != 1 {
+		t.Fatalf("picker %+v", m.overlay)
+	}
+	if !strings.HasPrefix(m.overlay.Lines[1], "* histogram") || !strings.HasPrefix(m.overlay.Lines[0], "  default") {
+		t.Fatalf("lines %q", m.overlay.Lines)
+	}
+
+	m = update(t, m, runeKeys("j")[0], tea.KeyMsg{Type: tea.KeyEnter})
+	if m.overlay != nil || m.algoPicker || m.diffAlgo != git.DiffPatience {
+		t.Fatalf("enter: overlay %v, algo %v", m.overlay, m.diffAlgo)
+	}
+}
+
+func TestAlgos_FirstLetterPicks(t *testing.T) {
+	m := reviewModel()
+	m.focus = ui.FocusNew
+	m.diffAlgo = git.DiffPatience
+	req := m.diffReq
+	m = update(t, m, runeKeys("A")...)
+	m = update(t, m, runeKeys("d")...)
+	if m.overlay != nil || m.diffAlgo != git.DiffDefault || m.diffReq == req {
+		t.Fatalf("d: overlay %v, algo %v, req %d -> %d", m.overlay, m.diffAlgo, req, m.diffReq)
+	}
+
+	// Picking the algorithm in use closes the list without reloading.
+	req = m.diffReq
+	m = update(t, m, runeKeys("A")...)
+	m = update(t, m, runeKeys("d")...)
+	if m.overlay != nil || m.diffReq != req {
+		t.Fatalf("same algorithm: overlay %v, req %d -> %d", m.overlay, req, m.diffReq)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// binarySummaryRows swaps the parser's generic "(binary file changed)" row for a
+// size-delta summary. Any other rows (e.g. an encoded GIT binary patch length)
+// are kept after it.
+func binarySummaryRows(file string, sizes git.FileSizes, parsed []diff.Row) []diff.Row {
+	summary := binarySummary(file, sizes)
+	rows := make([]diff.Row, 0, len(parsed)+1)
+	rows = append(rows, diff.Row{Old: summary, New: summary, Kind: diff.Meta})
+	for _, row := range parsed {
+		if row.Kind == diff.Meta && row.Old == diff.BinaryChangedText {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func binarySummary(file string, sizes git.FileSizes) string {
+	label := "binary"
+	if kind := fileTypeLabel(file); kind != "" {
+		label += " (" + kind + ")"
+	}
+
+	switch {
+	case sizes.HasOld && sizes.HasNew:
+		return fmt.Sprintf("%s: %s → %s (%s)", label, formatSize(sizes.Old), formatSize(sizes.New), formatSizeDelta(sizes.New-sizes.Old))
+	case sizes.HasNew:
+		return fmt.Sprintf("%s: new file, %s", label, formatSize(sizes.New))
+	case sizes.HasOld:
+		return fmt.Sprintf("%s: deleted, was %s", label, formatSize(sizes.Old))
+	default:
+		return label + " file changed"
+	}
+}
+
+// binarySniffLen is how much of a file is searched for a NUL byte to tell
+// binary from text, as git does.
+const binarySniffLen = 8000
+
+// untrackedBinarySize reports the size of untracked file when its content
+// is binary, judged from its start without asking git.
+func untrackedBinarySize(file string) (int64, bool) {
+	f, err := os.Open(git.WorktreePath(file))
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	head := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, false
+	}
+	return info.Size(), bytes.IndexByte(head[:n], 0) >= 0
+}
+
+// binaryNewFile labels an untracked binary file with its type and size.
+func binaryNewFile(file string, size int64) string {
+	label := "new binary file"
+	if kind := fileTypeLabel(file); kind != "" {
+		label += " (" + kind + ")"
+	}
+	return label + ", " + formatSize(size)
+}
+
+// fileTypeLabel names the file type from its extension, preferring the MIME
+// type when one is registered.
+func fileTypeLabel(file string) string {
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext == "" {
+		return ""
+	}
+	if mimeType := mime.TypeByExtension(ext); mimeType != "" {
+		if idx := strings.Index(mimeType, ";"); idx >= 0 {
+			mimeType = mimeType[:idx]
+		}
+		return mimeType
+	}
+	return strings.TrimPrefix(ext, ".") + " file"
+}
+
+// formatSize renders a byte count with binary units, e.g. 12697 -> "12.4 KB".
+func formatSize(n int64) string {
+	if n < 0 {
+		return "-" + formatSize(-n)
+	}
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	units := []string{"KB", "MB", "GB", "TB"}
+	value := float64(n) / 1024
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+func formatSizeDelta(delta int64) string {
+	switch {
+	case delta > 0:
+		return "+" + formatSize(delta)
+	case delta < 0:
+		return formatSize(delta)
+	default:
+		return "same size"
+	}
+}
+
+// lfsSummaryRows replaces the raw pointer diff of an LFS-tracked file with a
+// one-line summary of what changed in the referenced object.
+func lfsSummaryRows(change diff.LFSChange) []diff.Row {
+	summary := lfsSummary(change)
+	return []diff.Row{{Old: summary, New: summary, Kind: diff.Meta}}
+}
+
+func lfsSummary(change diff.LFSChange) string {
+	switch {
+	case change.Old != nil && change.New != nil:
+		return fmt.Sprintf("LFS object changed: %s → %s, oid %s → %s",
+			formatSize(change.Old.Size), formatSize(change.New.Size), change.Old.ShortOID(), change.New.ShortOID())
+	case change.New != nil:
+		return fmt.Sprintf("LFS object added: %s, oid %s", formatSize(change.New.Size), change.New.ShortOID())
+	default:
+		return fmt.Sprintf("LFS object removed: %s, oid %s", formatSize(change.Old.Size), change.Old.ShortOID())
+	}
+}
+
+// loadLFSImagePreview smudges both pointers of an LFS-tracked image so the
+// objects can go through the regular image preview.
+func loadLFSImagePreview(protocol ui.ImageProtocol, change diff.LFSChange, file string) *imagePreview {
+	if protocol == ui.ImageNone || !ui.IsImageFile(file) || !git.HasLFS() {
+		return nil
+	}
+
+	preview := &imagePreview{}
+	if change.Old != nil {
+		preview.old = smudgeForPreview(protocol, change.Old, file)
+	}
+	if change.New != nil {
+		preview.new = smudgeForPreview(protocol, change.New, file)
+	}
+	if preview.old == nil && preview.new == nil {
+		return nil
+	}
+	return preview
+}
+
+func smudgeForPreview(protocol ui.ImageProtocol, pointer *diff.LFSPointer, file string) []byte {
+	data, err := git.LFSSmudge(pointer.Text, file)
+	if err != nil {
+		return nil
+	}
+	prepared, err := ui.PrepareImage(protocol, data)
+	if err != nil {
+		return nil
+	}
+	return prepared
+}
+
+// imagePreview holds both sides of a changed image, already converted for the
+// terminal's graphics protocol. A nil side means that version does not exist.
+type imagePreview struct {
+	old []byte
+	new []byte
+}
+
+type drawImagesMsg struct {
+	req int
+}
+
+// imageDrawDelay lets the renderer flush the frame underneath before images are
+// drawn over it; otherwise the repaint would erase them again.
+const imageDrawDelay = 50 * time.Millisecond
+
+// loadImagePreview reads and prepares both versions of an image file. It returns
+// nil when the terminal cannot show images or neither side could be decoded, in
+// which case the plain size-delta row is all that is shown.
+func loadImagePreview(protocol ui.ImageProtocol, mode git.Mode, file string) *imagePreview {
+	if protocol == ui.ImageNone || !ui.IsImageFile(file) {
+		return nil
+	}
+
+	versions := git.LoadFileVersions(mode, file)
+	preview := &imagePreview{}
+	if versions.HasOld {
+		if data, err := ui.PrepareImage(protocol, versions.Old); err == nil {
+			preview.old = data
+		}
+	}
+	if versions.HasNew {
+		if data, err := ui.PrepareImage(protocol, versions.New); err == nil {
+			preview.new = data
+		}
+	}
+	if preview.old == nil && preview.new == nil {
+		return nil
+	}
+	return preview
+}
+
+func (m *model) previewActive() bool {
+	return m.showImages && m.preview != nil && m.overlay == nil
+}
+
+// drawImagesCmd schedules drawing the current preview once the next frame has
+// been rendered.
+func (m *model) drawImagesCmd() tea.Cmd {
+	if !m.previewActive() {
+		return nil
+	}
+	req := m.diffReq
+	return tea.Tick(imageDrawDelay, func(time.Time) tea.Msg {
+		return drawImagesMsg{req: req}
+	})
+}
+
+func (m model) handleDrawImages(msg drawImagesMsg) (tea.Model, tea.Cmd) {
+	if msg.req != m.diffReq || !m.previewActive() {
+		return m, nil
+	}
+	if ui.TooSmall(m.width, m.height) {
+		cmd := m.dismissImages()
+		return m, cmd
+	}
+
+	oldRect, newRect := ui.PaneRowRects(m.renderModel())
+	// The first row keeps the size summary; the image fills the rest.
+	for _, rect := range []*ui.Rect{&oldRect, &newRect} {
+		rect.Y++
+		rect.Height--
+	}
+
+	out := ui.ClearImagesEscape(m.imageProtocol) +
+		ui.ImageEscape(m.imageProtocol, m.preview.old, oldRect) +
+		ui.ImageEscape(m.imageProtocol, m.preview.new, newRect)
+	// Graphics escapes bypass the renderer, which would truncate them as text.
+	_, _ = io.WriteString(m.screen, out)
+	m.imagesShown = true
+	return m, nil
+}
+
+// dismissImages removes drawn images and forces a full repaint so no stale
+// pixels remain under the next diff.
+func (m *model) dismissImages() tea.Cmd {
+	if !m.imagesShown {
+		return nil
+	}
+	m.imagesShown = false
+	_, _ = io.WriteString(m.screen, ui.ClearImagesEscape(m.imageProtocol))
+	return tea.ClearScreen
+}
+
+// toggleImagePreview switches between the inline preview and the plain binary
+// notice for image files.
+func (m model) toggleImagePreview() (tea.Model, tea.Cmd) {
+	m.showImages = !m.showImages
+	if m.showImages {
+		return m, m.drawImagesCmd()
+	}
+	cmd := m.dismissImages()
+	return m, cmd
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+)
+
+// loggedGit puts a git on PATH that writes each command line to the file it
+// returns before running the real one.
+func loggedGit(t *testing.T) string {
+	t.Helper()
+	real, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	log := filepath.Join(dir, "git.log")
+	script := "#!/bin/sh\necho \"$@\" >> '" + log + "'\nexec '" + real + "' \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "git"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+func TestLoadDiff_UntrackedBinaryNeedsNoGitDiff(t *testing.T) {
+	repo := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "icon.png"), []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git.SetWorktree(repo)
+	t.Cleanup(func() { git.SetWorktree("") })
+	log := loggedGit(t)
+
+	msg := loadDiffCmd(diffJob{mode: git.Worktree, file: "icon.png", status: "?"})().(diffLoadedMsg)
+	if msg.err != nil || len(msg.rows) != 1 || msg.rows[0].Kind != diff.Meta {
+		t.Fatalf("rows %+v, err %v", msg.rows, msg.err)
+	}
+	if got := msg.rows[0].New; got != "new binary file (image/png), 16 B" {
+		t.Fatalf("summary %q", got)
+	}
+	calls, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("the logged git never ran: %v", err)
+	}
+	for _, call := range strings.Split(strings.TrimSpace(string(calls)), "\n") {
+		if strings.HasPrefix(strings.TrimPrefix(call, "-C "+repo+" "), "diff") {
+			t.Fatalf("ran git %s", call)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/PedroElizalde01/tdiff/git"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// blameKey is the file content a blame describes: the worktree file or, in
+// staged mode, its index copy.
+type blameKey struct {
+	file string
+	mode git.Mode
+}
+
+// blameLoadedMsg carries git blame for one file.
+type blameLoadedMsg struct {
+	key   blameKey
+	lines map[int]git.BlameLine
+	err   error
+}
+
+func loadBlameCmd(key blameKey) tea.Cmd {
+	return guardCmd(func() tea.Msg {
+		lines, err := git.Blame(key.mode, key.file)
+		return blameLoadedMsg{key: key, lines: lines, err: err}
+	}, func(err error) tea.Msg {
+		return blameLoadedMsg{key: key, err: err}
+	})
+}
+
+// toggleBlame shows or hides who last changed the cursor's NEW line (b).
+func (m model) toggleBlame() (tea.Model, tea.Cmd) {
+	m.showBlame = !m.showBlame
+	cmd := m.requestBlame()
+	return m, cmd
+}
+
+// requestBlame fetches blame for the selected file while blame is shown,
+// unless it is cached or already on its way.
+func (m *model) requestBlame() tea.Cmd {
+	file := m.selectedFile()
+	if !m.showBlame || file == "" {
+		return nil
+	}
+	key := blameKey{file: file, mode: m.diffMode(file)}
+	if _, ok := m.blame[key]; ok || m.blameInFlight[key] {
+		return nil
+	}
+	m.blameInFlight[key] = true
+	return loadBlameCmd(key)
+}
+
+func (m model) handleBlameLoaded(msg blameLoadedMsg) (tea.Model, tea.Cmd) {
+	delete(m.blameInFlight, msg.key)
+	if msg.err != nil {
+		m.flash = "blame failed: " + firstLine(git.FriendlyError(msg.err))
+		return m, nil
+	}
+	m.blame[msg.key] = msg.lines
+	return m, nil
+}
+
+// forgetBlame drops cached blame once the files may have changed.
+func (m *model) forgetBlame() {
+	m.blame = map[blameKey]map[int]git.BlameLine{}
+}
+
+// cursorBlame describes the cursor's NEW line for the NEW pane title, e.g.
+// "a1b2c3d Jane Doe 2026-09-30", or "" when blame is off or the row has no
+// NEW line.
+func (m *model) cursorBlame() string {
+	file := m.selectedFile()
+	if !m.showBlame || file == "" || m.diffLoading() || m.cursor < 0 || m.cursor >= len(m.rows) {
+		return ""
+	}
+	no := m.rows[m.cursor].NewNo
+	if no == nil {
+		return ""
+	}
+	lines, ok := m.blame[blameKey{file: file, mode: m.diffMode(file)}]
+	if !ok {
+		return "blame..."
+	}
+	line, ok := lines[*no]
+	if !ok || line.NotCommitted {
+		return "not committed"
+	}
+	return line.Commit + " " + line.Author + " " + line.Date
+}
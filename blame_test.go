@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+)
+
+func TestBlame_CursorLineFollowsNewTitle(t *testing.T) {
+	m := loadedModel(2)
+	m.loadedReq = m.diffReq
+	one, two := 1, 2
+	m.rows = []diff.Row{
+		{OldNo: &one, NewNo: &one, Old: "a", New: "a", Kind: diff.Context},
+		{NewNo: &two, New: "b", Kind: diff.Add},
+		{OldNo: &two, Old: "c", Kind: diff.Del},
+	}
+	next, cmd := m.toggleBlame()
+	m = next.(model)
+	if cmd == nil {
+		t.Fatal("b did not fetch blame")
+	}
+	if _, cmd := m.toggleBlame(); cmd != nil {
+		t.Fatal("hiding blame fetched it again")
+	}
+	if got := m.cursorBlame(); got != "blame..." {
+		t.Fatalf("blame while loading = %q", got)
+	}
+	key := blameKey{file: m.selectedFile(), mode: m.mode}
+	next, _ = m.handleBlameLoaded(blameLoadedMsg{key: key, lines: map[int]git.BlameLine{
+		1: {Commit: "1a2b3c4", Author: "Jane Doe", Date: "2026-09-30"},
+		2: {NotCommitted: true},
+	}})
+	m = next.(model)
+	for cursor, want := range []string{"1a2b3c4 Jane Doe 2026-09-30", "not committed", ""} {
+		m.cursor = cursor
+		if got := m.cursorBlame(); got != want {
+			t.Errorf("row %d: blame %q, want %q", cursor, got, want)
+		}
+	}
+	if cmd := m.requestBlame(); cmd != nil {
+		t.Fatal("cached blame was fetched again")
+	}
+}
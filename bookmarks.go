@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// bookmark marks one line of a file: its NEW line number, or its OLD one
+// for rows only the OLD side has, with the line's text when it was marked.
+type bookmark struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Old  bool   `json:"old,omitempty"`
+	Text string `json:"text"`
+}
+
+type bookmarkKey struct {
+	file string
+	line int
+	old  bool
+}
+
+func (b bookmark) key() bookmarkKey {
+	return bookmarkKey{b.File, b.Line, b.Old}
+}
+
+// lineNumbers are the row numbers jumpTo looks b up by.
+func (b bookmark) lineNumbers() (oldNo, newNo *int) {
+	line := b.Line
+	if b.Old {
+		return &line, nil
+	}
+	return nil, &line
+}
+
+// rowBookmark is the bookmark row would have in file, or false for rows
+// without a line.
+func rowBookmark(file string, row diff.Row) (bookmark, bool) {
+	switch {
+	case row.Kind == diff.Meta || row.Kind == diff.HunkHeader:
+		return bookmark{}, false
+	case row.NewNo != nil:
+		return bookmark{File: file, Line: *row.NewNo, Text: strings.TrimSpace(row.New)}, true
+	case row.OldNo != nil:
+		return bookmark{File: file, Line: *row.OldNo, Old: true, Text: strings.TrimSpace(row.Old)}, true
+	}
+	return bookmark{}, false
+}
+
+// toggleBookmark marks or unmarks the cursor row (m).
+func (m model) toggleBookmark() (tea.Model, tea.Cmd) {
+	file := m.rowFile(m.cursor)
+	if file == "" || m.diffLoading() || m.cursor < 0 || m.cursor >= len(m.rows) {
+		return m, nil
+	}
+	b, ok := rowBookmark(file, m.rows[m.cursor])
+	if !ok {
+		return m, nil
+	}
+	if m.bookmarks == nil {
+		m.bookmarks = map[bookmarkKey]bookmark{}
+	}
+	if _, marked := m.bookmarks[b.key()]; marked {
+		delete(m.bookmarks, b.key())
+	} else {
+		m.bookmarks[b.key()] = b
+	}
+	cmd := m.saveSession()
+	return m, cmd
+}
+
+// bookmarkRows marks the rows of the shown diff that are bookmarked.
+func (m *model) bookmarkRows() map[int]bool {
+	if len(m.bookmarks) == 0 || m.diffLoading() {
+		return nil
+	}
+	var rows map[int]bool
+	for idx, row := range m.rows {
+		b, ok := rowBookmark(m.rowFile(idx), row)
+		if !ok {
+			continue
+		}
+		if _, marked := m.bookmarks[b.key()]; marked {
+			if rows == nil {
+				rows = map[int]bool{}
+			}
+			rows[idx] = true
+		}
+	}
+	return rows
+}
+
+// sortedBookmarks is every bookmark, by file and then line.
+func (m *model) sortedBookmarks() []bookmark {
+	bookmarks := make([]bookmark, 0, len(m.bookmarks))
+	for _, b := range m.bookmarks {
+		bookmarks = append(bookmarks, b)
+	}
+	sort.Slice(bookmarks, func(i, j int) bool {
+		a, b := bookmarks[i], bookmarks[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return !a.Old && b.Old
+	})
+	return bookmarks
+}
+
+// bookmarkPos orders bookmarks as the sidebar and the diff show them: by
+// sidebar row and then by row in the shown diff, or by line in other files.
+type bookmarkPos struct {
+	file, at int
+}
+
+func (p bookmarkPos) before(q bookmarkPos) bool {
+	return p.file < q.file || p.file == q.file && p.at < q.at
+}
+
+func (m *model) bookmarkPos(b bookmark) (bookmarkPos, bool) {
+	idx := m.pathIndex(b.File)
+	if idx < 0 {
+		return bookmarkPos{}, false
+	}
+	if rows, offset, ok := m.fileRows(b.File); ok {
+		oldNo, newNo := b.lineNumbers()
+		return bookmarkPos{idx, offset + diff.FindLine(rows, oldNo, newNo)}, true
+	}
+	return bookmarkPos{idx, b.Line}, true
+}
+
+// cycleBookmark jumps to the next bookmark after the cursor, or the one
+// before it when direction is negative, wrapping around at either end and
+// crossing into other files ('n and 'p).
+func (m *model) cycleBookmark(direction int) tea.Cmd {
+	type placed struct {
+		pos bookmarkPos
+		b   bookmark
+	}
+	var marks []placed
+	for _, b := range m.bookmarks {
+		if pos, ok := m.bookmarkPos(b); ok {
+			marks = append(marks, placed{pos, b})
+		}
+	}
+	if len(marks) == 0 {
+		m.flash = "no bookmarks: m marks the cursor line"
+		return nil
+	}
+	sort.Slice(marks, func(i, j int) bool { return marks[i].pos.before(marks[j].pos) })
+	here := bookmarkPos{m.selected, m.cursor}
+	target := marks[0]
+	if direction < 0 {
+		target = marks[len(marks)-1]
+		for i := len(marks) - 1; i >= 0; i-- {
+			if marks[i].pos.before(here) {
+				target = marks[i]
+				break
+			}
+		}
+	} else {
+		for _, mark := range marks {
+			if here.before(mark.pos) {
+				target = mark
+				break
+			}
+		}
+	}
+	oldNo, newNo := target.b.lineNumbers()
+	return m.jumpTo(target.b.File, oldNo, newNo)
+}
+
+// handleBookmarkSequence runs the bookmark keys that follow ' or `: n and p
+// cycle and a second ' or ` lists them. It reports false for other
+// sequences.
+func (m model) handleBookmarkSequence(seq string) (tea.Model, tea.Cmd, bool) {
+	if len(seq) != 2 || (seq[0] != '\'' && seq[0] != '`') {
+		return m, nil, false
+	}
+	switch seq[1] {
+	case 'n':
+		cmd := m.cycleBookmark(1)
+		return m, cmd, true
+	case 'p':
+		cmd := m.cycleBookmark(-1)
+		return m, cmd, true
+	case '\'', '`':
+		next, cmd := m.showBookmarks()
+		return next, cmd, true
+	}
+	return m, nil, false
+}
+
+// bookmarkLines are the bookmarks list's lines, one per bookmark.
+func bookmarkLines(bookmarks []bookmark) []string {
+	lines := make([]string, len(bookmarks))
+	for i, b := range bookmarks {
+		side := ""
+		if b.Old {
+			side = " (old)"
+		}
+		lines[i] = fmt.Sprintf("%s:%d%s  %s", b.File, b.Line, side, b.Text)
+	}
+	return lines
+}
+
+func bookmarksTitle(count int) string {
+	return fmt.Sprintf("BOOKMARKS (%d)  enter: jump  d: delete  D: clear all", count)
+}
+
+// showBookmarks opens the list of bookmarks to jump to (”).
+func (m model) showBookmarks() (tea.Model, tea.Cmd) {
+	if len(m.bookmarks) == 0 {
+		m.flash = "no bookmarks: m marks the cursor line"
+		return m, nil
+	}
+	m.bookmarkList = m.sortedBookmarks()
+	m.overlay = &ui.Overlay{Title: bookmarksTitle(len(m.bookmarkList)), Lines: bookmarkLines(m.bookmarkList), Selectable: true}
+	cmd := m.dismissImages()
+	return m, cmd
+}
+
+// handleBookmarksKey moves through the bookmarks list, jumps to one or
+// deletes them.
+func (m model) handleBookmarksKey(key string) (tea.Model, tea.Cmd) {
+	selected := m.overlay.Selected
+	switch key {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc", "q":
+		m.overlay, m.bookmarkList = nil, nil
+		return m, m.drawImagesCmd()
+	case "enter":
+		b := m.bookmarkList[selected]
+		m.overlay, m.bookmarkList = nil, nil
+		oldNo, newNo := b.lineNumbers()
+		return m, tea.Batch(m.jumpTo(b.File, oldNo, newNo), m.drawImagesCmd())
+	case "D":
+		m.bookmarks = nil
+		m.overlay, m.bookmarkList = nil, nil
+		m.flash = "bookmarks cleared"
+		return m, tea.Batch(m.saveSession(), m.drawImagesCmd())
+	case "d":
+		delete(m.bookmarks, m.bookmarkList[selected].key())
+		if len(m.bookmarks) == 0 {
+			m.overlay, m.bookmarkList = nil, nil
+			return m, tea.Batch(m.saveSession(), m.drawImagesCmd())
+		}
+		m.bookmarkList = m.sortedBookmarks()
+		overlay := *m.overlay
+		overlay.Title, overlay.Lines = bookmarksTitle(len(m.bookmarkList)), bookmarkLines(m.bookmarkList)
+		m.overlay = &overlay
+		m.selectListItem(clamp(selected, 0, len(m.bookmarkList)-1))
+		cmd := m.saveSession()
+		return m, cmd
+	}
+	m.selectListItem(listSelection(key, selected, len(m.bookmarkList), ui.OverlayVisibleLines(m.bodyHeight())))
+	return m, nil
+}
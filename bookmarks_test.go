@@ -0,0 +1,122 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func bookmarkTestRows() []diff.Row {
+	one, two, three := 1, 2, 3
+	return []diff.Row{
+		{Old: "@@ -1,2 +1,2 @@", New: "@@ -1,2 +1,2 @@", Kind: diff.HunkHeader},
+		{OldNo: &one, NewNo: &one, Old: "a", New: "a", Kind: diff.Context},
+		{OldNo: &two, Old: " gone", Kind: diff.Del},
+		{NewNo: &three, New: "new", Kind: diff.Add},
+	}
+}
+
+func TestBookmarks_ToggleMarksRows(t *testing.T) {
+	m := loadedModel(2)
+	m.loadedReq = m.diffReq
+	m.rows = bookmarkTestRows()
+	runes := func(s string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)} }
+
+	m.cursor = 0
+	m = typeKeys(t, m, runes("m"))
+	if len(m.bookmarks) != 0 {
+		t.Fatal("a hunk header was bookmarked")
+	}
+	m.cursor = 2
+	m = typeKeys(t, m, runes("m"))
+	m.cursor = 3
+	m = typeKeys(t, m, runes("m"))
+	file := m.selectedFile()
+	want := map[bookmarkKey]bookmark{
+		{file, 2, true}:  {File: file, Line: 2, Old: true, Text: "gone"},
+		{file, 3, false}: {File: file, Line: 3, Text: "new"},
+	}
+	for k, b := range want {
+		if m.bookmarks[k] != b {
+			t.Fatalf("bookmark %v = %+v, want %+v", k, m.bookmarks[k], b)
+		}
+	}
+	if rows := m.bookmarkRows(); len(rows) != 2 || !rows[2] || !rows[3] {
+		t.Fatalf("bookmark rows %v", rows)
+	}
+	m = typeKeys(t, m, runes("m"))
+	if len(m.bookmarks) != 1 {
+		t.Fatal("m did not unmark the row")
+	}
+}
+
+func TestBookmarks_CycleAcrossFiles(t *testing.T) {
+	m := loadedModel(3)
+	m.loadedReq = m.diffReq
+	m.rows = bookmarkTestRows()
+	first, last := m.files[0], m.files[2]
+	m.bookmarks = map[bookmarkKey]bookmark{
+		{first, 3, false}: {File: first, Line: 3},
+		{last, 1, false}:  {File: last, Line: 1},
+	}
+	runes := func(s string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)} }
+
+	m.cursor = 0
+	m = typeKeys(t, m, runes("'"), runes("n"))
+	if m.selectedFile() != first || m.cursor != 3 {
+		t.Fatalf("'n went to %s row %d, want row 3 of %s", m.selectedFile(), m.cursor, first)
+	}
+	req := m.diffReq
+	m = typeKeys(t, m, runes("`"), runes("n"))
+	if m.selectedFile() != last || m.diffReq == req || m.anchor == nil || *m.anchor.NewNo != 1 {
+		t.Fatalf("`n did not open line 1 of %s", last)
+	}
+	m.loadedReq = m.diffReq
+	m.anchor = nil
+	m.rows = bookmarkTestRows()
+	m.cursor = 3
+	m = typeKeys(t, m, runes("'"), runes("p"))
+	if m.selectedFile() != last || m.cursor != 1 {
+		t.Fatalf("'p went to %s row %d, want row 1 of %s", m.selectedFile(), m.cursor, last)
+	}
+	m = typeKeys(t, m, runes("'"), runes("p"))
+	if m.selectedFile() != first {
+		t.Fatalf("'p went to %s, want %s", m.selectedFile(), first)
+	}
+
+	m = typeKeys(t, m, runes("'"), runes("'"))
+	if m.overlay == nil || len(m.bookmarkList) != 2 {
+		t.Fatal("'' did not list the bookmarks")
+	}
+	m = typeKeys(t, m, runes("d"))
+	if len(m.bookmarks) != 1 || len(m.overlay.Lines) != 1 {
+		t.Fatalf("d left %d bookmarks", len(m.bookmarks))
+	}
+	m = typeKeys(t, m, runes("D"))
+	if len(m.bookmarks) != 0 || m.overlay != nil {
+		t.Fatal("D did not clear the bookmarks")
+	}
+}
+
+func TestSession_BookmarksPersist(t *testing.T) {
+	store := &stateStore{path: filepath.Join(t.TempDir(), "state.json")}
+	open := func() model {
+		m := loadedModel(1)
+		m.state = store
+		m.repo = &git.RepoInfo{Root: "/src/tdiff", Branch: "main"}
+		next, _ := m.handleSessionLoaded(m.openSession()().(sessionLoadedMsg))
+		return next.(model)
+	}
+	m := open()
+	b := bookmark{File: "a.go", Line: 4, Old: true, Text: "x"}
+	m.bookmarks[b.key()] = b
+	if msg := m.saveSession()(); msg != nil {
+		t.Fatalf("save: %v", msg.(stateSavedMsg).err)
+	}
+	if got := open().bookmarks; len(got) != 1 || got[b.key()] != b {
+		t.Fatalf("bookmarks not restored: %v", got)
+	}
+}
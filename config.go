@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/PedroElizalde01/tdiff/ui"
+)
+
+// config is the contents of config.toml. Every setting is optional; nil
+// means the file leaves it at the built-in default.
+type config struct {
+	Mode           *string `toml:"mode"`
+	Algorithm      *string `toml:"algorithm"`
+	Context        *int    `toml:"context"`
+	ShowWhitespace *bool   `toml:"show-whitespace"`
+	SidebarWidth   *int    `toml:"sidebar-width"`
+	PaneOrder      *string `toml:"pane-order"`
+	Split          *int    `toml:"split"`
+	ShowUntracked  *bool   `toml:"show-untracked"`
+	TabWidth       *int    `toml:"tab-width"`
+	MaxDiffLines   *int    `toml:"max-diff-lines"`
+	MaxFileSize    *string `toml:"max-file-size"`
+	AutoAdvance    *bool   `toml:"auto-advance"`
+	Hints          *bool   `toml:"hints"`
+	Ignored        *bool   `toml:"ignored"`
+	Skipped        *bool   `toml:"skipped"`
+	Theme          *string `toml:"theme"`
+	ASCII          *bool   `toml:"ascii"`
+	Banner         *bool   `toml:"banner"`
+	// Keys binds extra keys to built-in ones: "ctrl+n" = "j" makes ctrl+n
+	// act as j everywhere. The built-in keys keep working.
+	Keys map[string]string `toml:"keys"`
+	// Themes defines color themes by name; each table may name the built-in
+	// theme it starts from with "base" and overrides palette colors.
+	Themes map[string]map[string]string `toml:"themes"`
+}
+
+// defaultConfigPath is $XDG_CONFIG_HOME/tdiff/config.toml, falling back to
+// ~/.config when XDG_CONFIG_HOME is unset.
+func defaultConfigPath(getenv func(string) string) string {
+	dir := getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := getenv("HOME")
+		if home == "" {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "tdiff", "config.toml")
+}
+
+// loadConfig reads the config file at path. A missing file is only an error
+// when required is set, i.e. the path was given with --config.
+func loadConfig(path string, required bool) (config, []string, error) {
+	var cfg config
+	if path == "" {
+		return cfg, nil, nil
+	}
+	meta, err := toml.DecodeFile(path, &cfg)
+	if err != nil {
+		if !required && errors.Is(err, fs.ErrNotExist) {
+			return config{}, nil, nil
+		}
+		var pathErr *fs.PathError
+		if !errors.As(err, &pathErr) {
+			// Parse errors carry the line but not the file.
+			err = fmt.Errorf("%s: %w", path, err)
+		}
+		return config{}, nil, err
+	}
+	var unknown []string
+	for _, key := range meta.Undecoded() {
+		unknown = append(unknown, key.String())
+	}
+	return cfg, unknown, nil
+}
+
+// addThemes appends the themes the file defines to opts.themes, replacing
+// built-in themes of the same name. A theme with a bad color is skipped.
+func addThemes(opts *options, cfg config, path string) []string {
+	var warnings []string
+	names := make([]string, 0, len(cfg.Themes))
+	for name := range cfg.Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		colors := map[string]string{}
+		for key, value := range cfg.Themes[name] {
+			colors[key] = value
+		}
+		base := colors["base"]
+		delete(colors, "base")
+		theme, err := ui.CustomTheme(name, base, colors)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v; skipping it", path, err))
+			continue
+		}
+		if i := opts.themeIndex(name); i >= 0 {
+			opts.themes[i] = theme
+		} else {
+			opts.themes = append(opts.themes, theme)
+		}
+	}
+	return warnings
+}
+
+// applyConfig overrides opts with the settings the file sets. Invalid values
+// are reported and leave the option as it was.
+func applyConfig(opts *options, cfg config, path string) []string {
+	var warnings []string
+	invalid := func(key string, value interface{}, want string) {
+		warnings = append(warnings, invalidSetting(path+": "+key, fmt.Sprint(value), want))
+	}
+
+	if cfg.Mode != nil && !opts.setMode(*cfg.Mode) {
+		invalid("mode", *cfg.Mode, wantMode)
+	}
+	if cfg.Algorithm != nil && !opts.setAlgo(*cfg.Algorithm) {
+		invalid("algorithm", *cfg.Algorithm, wantAlgo)
+	}
+	if cfg.Theme != nil && !opts.setTheme(*cfg.Theme) {
+		invalid("theme", *cfg.Theme, opts.themeNames())
+	}
+	if cfg.Context != nil && !opts.setContext(*cfg.Context) {
+		invalid("context", *cfg.Context, wantCount)
+	}
+	if cfg.ShowWhitespace != nil {
+		opts.showWhitespace = *cfg.ShowWhitespace
+	}
+	if cfg.SidebarWidth != nil {
+		if *cfg.SidebarWidth >= 0 {
+			opts.sidebarWidth = *cfg.SidebarWidth
+		} else {
+			invalid("sidebar-width", *cfg.SidebarWidth, wantCount)
+		}
+	}
+	if cfg.PaneOrder != nil {
+		switch *cfg.PaneOrder {
+		case "old-new":
+			opts.swapPanes = false
+		case "new-old":
+			opts.swapPanes = true
+		default:
+			invalid("pane-order", *cfg.PaneOrder, wantPaneOrder)
+		}
+	}
+	if cfg.Split != nil {
+		if *cfg.Split >= ui.MinSplit && *cfg.Split <= ui.MaxSplit {
+			opts.split = *cfg.Split
+		} else {
+			invalid("split", *cfg.Split, fmt.Sprintf("a percentage from %d to %d", ui.MinSplit, ui.MaxSplit))
+		}
+	}
+	if cfg.ShowUntracked != nil {
+		opts.hideUntracked = !*cfg.ShowUntracked
+	}
+	if cfg.TabWidth != nil {
+		if *cfg.TabWidth > 0 {
+			opts.tabWidth = *cfg.TabWidth
+		} else {
+			invalid("tab-width", *cfg.TabWidth, "a positive number")
+		}
+	}
+	if cfg.MaxDiffLines != nil {
+		if *cfg.MaxDiffLines >= 0 {
+			opts.largeDiffLines = *cfg.MaxDiffLines
+		} else {
+			invalid("max-diff-lines", *cfg.MaxDiffLines, wantCount)
+		}
+	}
+	if cfg.MaxFileSize != nil && !opts.setMaxFileSize(*cfg.MaxFileSize) {
+		invalid("max-file-size", *cfg.MaxFileSize, wantSize)
+	}
+	if cfg.AutoAdvance != nil {
+		opts.autoAdvance = *cfg.AutoAdvance
+	}
+	if cfg.Hints != nil {
+		opts.noHints = !*cfg.Hints
+	}
+	if cfg.Ignored != nil {
+		opts.ignored = *cfg.Ignored
+	}
+	if cfg.Skipped != nil {
+		opts.skipped = *cfg.Skipped
+	}
+	if cfg.ASCII != nil {
+		opts.ascii = *cfg.ASCII
+	}
+	if cfg.Banner != nil {
+		opts.noBanner = !*cfg.Banner
+	}
+	for key, target := range cfg.Keys {
+		if key == "" || target == "" {
+			invalid("key binding", fmt.Sprintf("%s = %s", key, target), "a key and its target")
+			continue
+		}
+		if opts.keys == nil {
+			opts.keys = map[string]string{}
+		}
+		opts.keys[key] = target
+	}
+	return warnings
+}
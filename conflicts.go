@@ -0,0 +1,41 @@
+package main
+
+import "github.com/PedroElizalde01/tdiff/diff"
+
+// noteConflicts records whether file's loaded diff adds conflict markers, so
+// files the listing does not check, such as untracked ones, are flagged once
+// their diff is seen.
+func (m *model) noteConflicts(file string, rows []diff.Row) {
+	if !diff.HasConflictMarkers(rows) {
+		delete(m.conflictFiles, file)
+		return
+	}
+	if m.conflictFiles == nil {
+		m.conflictFiles = map[string]bool{}
+	}
+	m.conflictFiles[file] = true
+}
+
+// jumpConflict moves count conflict marker rows on from the cursor, forward
+// or back by direction, stopping at the last one there is (]x and [x).
+func (m *model) jumpConflict(direction, count int) {
+	if count < 1 {
+		count = 1
+	}
+	target := -1
+	for idx := m.cursor + direction; idx >= 0 && idx < len(m.rows) && count > 0; idx += direction {
+		if m.rows[idx].ConflictMarker {
+			target = idx
+			count--
+		}
+	}
+	if target < 0 {
+		if !diff.HasConflictMarkers(m.rows) {
+			m.flash = "no conflict markers"
+		}
+		return
+	}
+	m.cursor = target
+	m.saveCursor()
+	m.ensureCursorVisible()
+}
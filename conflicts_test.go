@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/ui"
+)
+
+func TestConflicts_JumpBetweenMarkers(t *testing.T) {
+	m := reviewModel()
+	rows, hunks := diff.ParseHunks("@@ -1 +1,6 @@\n a\n+<<<<<<< HEAD\n+ours\n+=======\n+theirs\n+>>>>>>> topic\n")
+	m = update(t, m, diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: "a.go", rows: rows, hunks: hunks})
+	if !m.conflictFiles["a.go"] || !m.renderModel().ConflictMarkers {
+		t.Fatalf("a.go not flagged: %v", m.conflictFiles)
+	}
+	m.focus = ui.FocusNew
+	m.cursor = 0
+	m = update(t, m, runeKeys("]x")...)
+	if m.cursor != 2 {
+		t.Fatalf("]x went to row %d, want the <<<<<<< line", m.cursor)
+	}
+	m = update(t, m, runeKeys("2]x")...)
+	if m.cursor != 6 {
+		t.Fatalf("2]x went to row %d, want the >>>>>>> line", m.cursor)
+	}
+	m = update(t, m, runeKeys("[x")...)
+	if m.cursor != 4 {
+		t.Fatalf("[x went to row %d, want the ======= line", m.cursor)
+	}
+
+	// A clean diff of the same file drops the flag.
+	m = update(t, m, sectionDiffMsg(m, "a.go", m.diffReq, 1))
+	if m.conflictFiles["a.go"] {
+		t.Fatal("a.go still flagged after a clean diff")
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// continuousView is the state of the continuous view (V): the panes show
+// every listed file one after another, each under a header row, and load
+// each file's diff once it scrolls near the screen.
+type continuousView struct {
+	// sections are where each file's rows start and end in m.rows, header
+	// included, in sidebar order.
+	sections []fileSection
+	// loaded holds the diffs that arrived under key, and pending the request
+	// of each one on its way.
+	loaded  map[string]sectionDiff
+	pending map[string]int
+	key     sectionsKey
+	// at is the cursor's file and row within it, so rebuilding the rows
+	// around it leaves it where it was.
+	at sectionPlace
+	// anchor is a line to move the cursor to once its file has loaded.
+	anchor *sectionAnchor
+}
+
+type fileSection struct {
+	file       string
+	start, end int
+}
+
+type sectionDiff struct {
+	rows   []diff.Row
+	hunks  []diff.Hunk
+	syntax []ui.RowSyntax
+}
+
+// sectionsKey is what the loaded diffs depend on; changing any of it
+// reloads them all.
+type sectionsKey struct {
+	mode     git.Mode
+	opts     git.DiffOptions
+	fullFile bool
+	syntax   bool
+}
+
+type sectionPlace struct {
+	file string
+	// offset is the cursor's row counted from the file's header, and above
+	// the lines shown over it.
+	offset, above int
+}
+
+type sectionAnchor struct {
+	file         string
+	oldNo, newNo *int
+}
+
+func jobSectionsKey(job diffJob) sectionsKey {
+	return sectionsKey{mode: job.mode, opts: job.opts, fullFile: job.fullFile, syntax: job.syntax}
+}
+
+// sectionHeader is the row above a file's diff, e.g.
+// "(file ui/ui.go: M, +12 -3)".
+func (m *model) sectionHeader(file string) diff.Row {
+	stat := m.fileStats[file]
+	header := fmt.Sprintf("(file %s: %s, +%d -%d)", file, m.fileStatuses[file], stat.Added, stat.Deleted)
+	return diff.Row{Old: header, New: header, Kind: diff.Meta}
+}
+
+// toggleContinuous switches between one file at a time and every file in a
+// single scroll (V), keeping the cursor on the line it is on.
+func (m model) toggleContinuous() (tea.Model, tea.Cmd) {
+	if m.continuous != nil {
+		return m.leaveContinuous()
+	}
+	if m.merge != nil {
+		m.flash = "--merge shows one file: there are no other files to scroll through"
+		return m, nil
+	}
+	if !m.hasRealFiles() {
+		return m, nil
+	}
+	cv := &continuousView{
+		loaded:  map[string]sectionDiff{},
+		pending: map[string]int{},
+		key:     jobSectionsKey(m.newDiffJob("")),
+	}
+	if file := m.selectedFile(); file != "" {
+		cv.at = sectionPlace{file: file}
+		if !m.diffLoading() && m.shownFile == file && len(m.rows) > 0 {
+			// The shown diff is the first section loaded.
+			cv.loaded[file] = sectionDiff{rows: m.rows, hunks: m.hunks, syntax: m.syntax}
+			cv.at.offset, cv.at.above = m.cursor+1, m.cursor-m.diffScroll
+		}
+	} else if entry, ok := m.selectedDir(); ok {
+		cv.at = sectionPlace{file: entry.Path + "/"}
+	}
+	// Whatever single diff is still on its way is dropped when it arrives.
+	m.anchor = nil
+	m.diffReq++
+	m.loadedReq = m.diffReq
+	m.preview = nil
+	m.guardedLines, m.guardedSize = 0, 0
+	m.whitespaceErrors, m.invisibleChanges = 0, 0
+	m.continuous = cv
+	m.rebuildSections()
+	m.flash = "continuous view: V goes back to one file at a time"
+	return m, tea.Batch(m.dismissImages(), m.loadVisibleSections(), m.requestBlame())
+}
+
+// leaveContinuous opens the cursor's file on its own, at the cursor's line.
+func (m model) leaveContinuous() (tea.Model, tea.Cmd) {
+	file := m.rowFile(m.cursor)
+	var row diff.Row
+	if m.cursor >= 0 && m.cursor < len(m.rows) {
+		row = m.rows[m.cursor]
+	}
+	m.continuous = nil
+	m.shownFile = ""
+	if file != "" {
+		m.selectPath(file)
+	}
+	cmd := m.showSelection()
+	if file != "" && m.selectedFile() == file && (row.OldNo != nil || row.NewNo != nil) {
+		m.anchor = &diff.Row{OldNo: row.OldNo, NewNo: row.NewNo}
+		m.anchorAbove = ui.NewRowMetrics(m.renderModel()).Lines() / 4
+	}
+	return m, cmd
+}
+
+// sectionFiles are the files shown in the continuous view, in sidebar order
+// with those in collapsed directories included.
+func (m *model) sectionFiles() []string {
+	if !m.hasRealFiles() {
+		return nil
+	}
+	if m.entries == nil {
+		return m.files
+	}
+	collapsed := m.collapsed
+	m.collapsed = nil
+	entries := m.buildTree(m.files)
+	m.collapsed = collapsed
+	files := make([]string, 0, len(m.files))
+	for _, entry := range entries {
+		if !entry.Dir {
+			files = append(files, entry.Path)
+		}
+	}
+	return files
+}
+
+// rebuildSections lays out m.rows from the sections loaded so far and puts
+// the cursor back on its file's row.
+func (m *model) rebuildSections() {
+	cv := m.continuous
+	var rows []diff.Row
+	var hunks []diff.Hunk
+	var syntax []ui.RowSyntax
+	var sections []fileSection
+	for _, file := range m.sectionFiles() {
+		start := len(rows)
+		rows = append(rows, m.sectionHeader(file))
+		syntax = append(syntax, ui.RowSyntax{})
+		d, ok := cv.loaded[file]
+		if !ok {
+			d = sectionDiff{rows: loadingRows("loading diff...")}
+		}
+		for _, h := range d.hunks {
+			h.RowStart += len(rows)
+			h.RowEnd += len(rows)
+			hunks = append(hunks, h)
+		}
+		if len(d.syntax) == len(d.rows) {
+			syntax = append(syntax, d.syntax...)
+		} else {
+			syntax = append(syntax, make([]ui.RowSyntax, len(d.rows))...)
+		}
+		rows = append(rows, d.rows...)
+		sections = append(sections, fileSection{file: file, start: start, end: len(rows)})
+	}
+	cv.sections = sections
+	if len(rows) == 0 {
+		rows = noDiffRows()
+		syntax = nil
+	}
+	m.rows, m.hunks, m.syntax = rows, hunks, syntax
+	m.changeStarts = diff.ChangeStarts(rows)
+
+	above := cv.at.above
+	m.cursor = clamp(m.cursor, 0, len(rows)-1)
+	if s, ok := m.placeSection(cv.at.file); ok {
+		m.cursor = clamp(s.start+cv.at.offset, s.start, s.end-1)
+	}
+	if a := cv.anchor; a != nil {
+		if s, ok := m.section(a.file); ok {
+			if _, loaded := cv.loaded[a.file]; loaded {
+				m.cursor = s.start + 1 + diff.FindLine(rows[s.start+1:s.end], a.oldNo, a.newNo)
+				above = ui.NewRowMetrics(m.renderModel()).Lines() / 4
+				cv.anchor = nil
+			}
+		} else {
+			cv.anchor = nil
+		}
+	}
+	m.diffScroll = scrollStart(ui.NewRowMetrics(m.renderModel()), m.cursor, above)
+	m.ensureCursorVisible()
+	m.rememberPlace()
+}
+
+// section is file's section in the continuous view.
+func (m *model) section(file string) (fileSection, bool) {
+	for _, s := range m.continuous.sections {
+		if s.file == file {
+			return s, true
+		}
+	}
+	return fileSection{}, false
+}
+
+// placeSection is the section for path: the file's own, or the first one
+// under it when path names a directory ("dir/").
+func (m *model) placeSection(path string) (fileSection, bool) {
+	if s, ok := m.section(path); ok {
+		return s, true
+	}
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	for _, s := range m.continuous.sections {
+		if strings.HasPrefix(s.file, prefix) {
+			return s, true
+		}
+	}
+	return fileSection{}, false
+}
+
+// sectionAt is the index of the section holding row, or -1.
+func (m *model) sectionAt(row int) int {
+	sections := m.continuous.sections
+	i := sort.Search(len(sections), func(i int) bool { return sections[i].end > row })
+	if i == len(sections) || row < sections[i].start {
+		return -1
+	}
+	return i
+}
+
+// rowFile is the file row belongs to: the selected one, or in the
+// continuous view the one whose section holds it.
+func (m *model) rowFile(row int) string {
+	if m.continuous == nil {
+		return m.selectedFile()
+	}
+	if i := m.sectionAt(row); i >= 0 {
+		return m.continuous.sections[i].file
+	}
+	return ""
+}
+
+// fileRows are the loaded rows of file's diff and the row of m.rows they
+// start at, or false while they are not on screen.
+func (m *model) fileRows(file string) (rows []diff.Row, offset int, ok bool) {
+	if m.continuous == nil {
+		if file != m.selectedFile() || m.diffLoading() {
+			return nil, 0, false
+		}
+		return m.rows, 0, true
+	}
+	s, found := m.section(file)
+	if _, loaded := m.continuous.loaded[file]; !found || !loaded {
+		return nil, 0, false
+	}
+	return m.rows[s.start+1 : s.end], s.start + 1, true
+}
+
+// sectionHunks are the hunks of the cursor's file, so the header counts
+// hunks within it.
+func (m *model) sectionHunks() []diff.Hunk {
+	i := m.sectionAt(m.cursor)
+	if i < 0 {
+		return nil
+	}
+	s := m.continuous.sections[i]
+	from := sort.Search(len(m.hunks), func(i int) bool { return m.hunks[i].RowStart >= s.start })
+	to := sort.Search(len(m.hunks), func(i int) bool { return m.hunks[i].RowStart >= s.end })
+	return m.hunks[from:to]
+}
+
+// rememberPlace records where the cursor is for the next rebuild.
+func (m *model) rememberPlace() {
+	i := m.sectionAt(m.cursor)
+	if i < 0 {
+		return
+	}
+	s := m.continuous.sections[i]
+	above := 0
+	metrics := ui.NewRowMetrics(m.renderModel())
+	for row := m.diffScroll; row < m.cursor; row++ {
+		above += metrics.Height(row)
+	}
+	m.continuous.at = sectionPlace{file: s.file, offset: m.cursor - s.start, above: above}
+}
+
+// showSection moves the cursor to the header of path's section, for a file
+// or directory selected in the sidebar.
+func (m *model) showSection(path string) tea.Cmd {
+	if s, ok := m.placeSection(path); ok {
+		m.cursor = s.start
+		m.placeCursor(placeTop)
+		m.rememberPlace()
+	}
+	return m.loadVisibleSections()
+}
+
+// jumpToSection moves the cursor to a line of file, once it has loaded.
+func (m *model) jumpToSection(file string, oldNo, newNo *int) tea.Cmd {
+	s, ok := m.section(file)
+	if !ok {
+		m.flash = file + " has no changes listed now"
+		return nil
+	}
+	m.cursor = s.start
+	m.continuous.anchor = &sectionAnchor{file: file, oldNo: oldNo, newNo: newNo}
+	m.rememberPlace()
+	m.rebuildSections()
+	return tea.Batch(m.loadVisibleSections(), m.requestBlame())
+}
+
+// loadVisibleSections requests the diffs of the files on screen and a
+// screen above and below it that have not loaded yet.
+func (m *model) loadVisibleSections() tea.Cmd {
+	cv := m.continuous
+	page := ui.NewRowMetrics(m.renderModel()).Lines()
+	from, to := m.diffScroll-page, m.diffScroll+2*page
+	var cmds []tea.Cmd
+	for _, s := range cv.sections {
+		if s.end <= from || s.start >= to {
+			continue
+		}
+		if _, ok := cv.loaded[s.file]; ok {
+			continue
+		}
+		if _, ok := cv.pending[s.file]; ok {
+			continue
+		}
+		job := m.newDiffJob(s.file)
+		job.protocol = ui.ImageNone
+		m.diffReq++
+		m.loadedReq = m.diffReq
+		job.req = m.diffReq
+		cv.pending[s.file] = job.req
+		m.inFlight[s.file] = job.req
+		cmds = append(cmds, loadDiffCmd(job))
+	}
+	return tea.Batch(cmds...)
+}
+
+// handleSectionLoaded puts an arrived diff into its section. Errors stay in
+// the section rather than taking over the header, as one file failing does
+// not stop the others from showing.
+func (m model) handleSectionLoaded(msg diffLoadedMsg) (tea.Model, tea.Cmd) {
+	m.finishLoad(msg.file, msg.req)
+	cv := m.continuous
+	if req, ok := cv.pending[msg.file]; !ok || req != msg.req || msg.mode != m.mode || msg.algo != m.diffAlgo {
+		return m, nil
+	}
+	delete(cv.pending, msg.file)
+	d := sectionDiff{rows: msg.rows, hunks: msg.hunks, syntax: msg.syntax}
+	switch {
+	case msg.err != nil:
+		text := "(cannot load diff: " + firstLine(git.FriendlyError(msg.err)) + ")"
+		d = sectionDiff{rows: []diff.Row{{Old: text, New: text, Kind: diff.Meta}}}
+	case msg.vanished:
+		text := "(" + vanishedNotice(msg.file) + ")"
+		d = sectionDiff{rows: []diff.Row{{Old: text, New: text, Kind: diff.Meta}}}
+	case len(d.rows) == 0:
+		d = sectionDiff{rows: noDiffRows()}
+	}
+	cv.loaded[msg.file] = d
+	m.noteConflicts(msg.file, d.rows)
+	m.rebuildSections()
+	return m, tea.Batch(m.loadVisibleSections(), m.requestBlame())
+}
+
+// refreshSections reloads what job changed: every section when it asks for
+// another view of the diffs, or else only job's file.
+func (m *model) refreshSections(job diffJob) tea.Cmd {
+	cv := m.continuous
+	if key := jobSectionsKey(job); key != cv.key {
+		cv.key = key
+		cv.loaded = map[string]sectionDiff{}
+		cv.pending = map[string]int{}
+	} else {
+		delete(cv.loaded, job.file)
+		delete(cv.pending, job.file)
+	}
+	m.anchor = nil
+	m.rebuildSections()
+	return m.loadVisibleSections()
+}
+
+// followCursor keeps the continuous view in step after a key: the sidebar
+// selects the file under the cursor and the sections coming into view load.
+func followCursor(next tea.Model, cmd tea.Cmd) (tea.Model, tea.Cmd) {
+	m, ok := next.(model)
+	if !ok || m.continuous == nil || !m.hasRealFiles() || len(m.continuous.sections) == 0 {
+		return next, cmd
+	}
+	m.rememberPlace()
+	if file := m.rowFile(m.cursor); file != "" {
+		m.shownFile = file
+		entry, dir := m.selectedDir()
+		if !(dir && m.focus == ui.FocusFiles && strings.HasPrefix(file, entry.Path+"/")) && m.selectedFile() != file {
+			m.selectPath(file)
+		}
+	}
+	return m, tea.Batch(cmd, m.loadVisibleSections(), m.requestBlame())
+}
+
+// unloadedSectionBefore is the section that has not loaded between the
+// cursor and row, nearest the cursor, so hunk jumps stop at files whose hunks
+// are not known yet.
+func (m *model) unloadedSectionBefore(direction, row int) (fileSection, bool) {
+	cv := m.continuous
+	sections := cv.sections
+	if direction < 0 {
+		for i := len(sections) - 1; i >= 0; i-- {
+			s := sections[i]
+			if _, ok := cv.loaded[s.file]; !ok && s.start < m.cursor && s.start > row {
+				return s, true
+			}
+		}
+		return fileSection{}, false
+	}
+	for _, s := range sections {
+		if _, ok := cv.loaded[s.file]; !ok && s.start > m.cursor && s.start < row {
+			return s, true
+		}
+	}
+	return fileSection{}, false
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// sectionDiffMsg is a two-line diff of file: a hunk header and one added
+// line numbered line.
+func sectionDiffMsg(m model, file string, req, line int) diffLoadedMsg {
+	rows := []diff.Row{
+		{Old: "@@", New: "@@", Kind: diff.HunkHeader},
+		{NewNo: &line, New: file, Kind: diff.Add},
+	}
+	return diffLoadedMsg{req: req, mode: m.mode, algo: m.diffAlgo, file: file, rows: rows, hunks: []diff.Hunk{{RowStart: 0, RowEnd: 2}}}
+}
+
+func update(t *testing.T, m model, msgs ...tea.Msg) model {
+	t.Helper()
+	for _, msg := range msgs {
+		next, _ := m.Update(msg)
+		m = next.(model)
+	}
+	return m
+}
+
+func TestContinuous_FilesFollowOneAnother(t *testing.T) {
+	m := reviewModel()
+	m = update(t, m, sectionDiffMsg(m, "a.go", m.diffReq, 1))
+	m.cursor = 1
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("V")})
+	cv := m.continuous
+	if cv == nil || len(cv.sections) != 3 {
+		t.Fatalf("sections %+v", cv)
+	}
+	// a.go's diff was shown, so only b.go and c.go are loaded.
+	if _, ok := cv.loaded["a.go"]; !ok || len(cv.pending) != 2 {
+		t.Fatalf("loaded %v, pending %v", cv.loaded, cv.pending)
+	}
+	if m.cursor != 2 || m.rows[m.cursor].New != "a.go" {
+		t.Fatalf("cursor %d moved off its line", m.cursor)
+	}
+	m = update(t, m, sectionDiffMsg(m, "c.go", cv.pending["c.go"], 5), sectionDiffMsg(m, "b.go", cv.pending["b.go"], 3))
+	if len(m.rows) != 9 || len(m.hunks) != 3 || m.hunks[2].RowStart != 7 {
+		t.Fatalf("rows %d hunks %+v", len(m.rows), m.hunks)
+	}
+	if rm := m.renderModel(); rm.HunkIndex != 0 || rm.HunkCount != 1 {
+		t.Fatalf("hunk %d/%d, want the cursor file's 1/1", rm.HunkIndex, rm.HunkCount)
+	}
+
+	// Moving down crosses into b.go, which the sidebar follows.
+	m.focus = ui.FocusNew
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	if m.rowFile(m.cursor) != "b.go" || m.selectedFile() != "b.go" {
+		t.Fatalf("cursor in %s, selected %s", m.rowFile(m.cursor), m.selectedFile())
+	}
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+	if m.cursor != 4 {
+		t.Fatalf("n went to row %d, want b.go's hunk", m.cursor)
+	}
+
+	// Selecting a file in the sidebar goes to its header.
+	m.focus = ui.FocusFiles
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	if m.selectedFile() != "c.go" || m.cursor != 6 {
+		t.Fatalf("selected %s, cursor %d", m.selectedFile(), m.cursor)
+	}
+
+	// Leaving opens the cursor's file alone, at the same line.
+	m.cursor = 8
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("V")})
+	if m.continuous != nil || m.selectedFile() != "c.go" {
+		t.Fatal("V did not leave the continuous view")
+	}
+	if m.anchor == nil || m.anchor.NewNo == nil || *m.anchor.NewNo != 5 {
+		t.Fatalf("anchor %+v, want c.go line 5", m.anchor)
+	}
+}
+
+func TestContinuous_HunkJumpStopsAtLoadingFile(t *testing.T) {
+	m := reviewModel()
+	m = update(t, m, sectionDiffMsg(m, "a.go", m.diffReq, 1), tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("V")})
+	cv := m.continuous
+	m = update(t, m, sectionDiffMsg(m, "c.go", cv.pending["c.go"], 5))
+	m.focus = ui.FocusNew
+	m.cursor = 1
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+	if s, _ := m.section("b.go"); m.cursor != s.start {
+		t.Fatalf("n went to row %d past b.go, still loading at %d", m.cursor, s.start)
+	}
+}
+
+func TestContinuous_NotesAndBookmarksUseTheRowsFile(t *testing.T) {
+	m := reviewModel()
+	m = update(t, m, sectionDiffMsg(m, "a.go", m.diffReq, 1), tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("V")})
+	cv := m.continuous
+	m = update(t, m, sectionDiffMsg(m, "b.go", cv.pending["b.go"], 3))
+	m.notes = map[noteKey]note{{"b.go", 3}: {File: "b.go", Line: 3, Text: "here"}}
+	if rows := m.noteRows(); len(rows) != 1 || !rows[5] {
+		t.Fatalf("note rows %v, want b.go's line", rows)
+	}
+	m.focus = ui.FocusNew
+	m.cursor = 5
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("m")})
+	if _, ok := m.bookmarks[bookmarkKey{"b.go", 3, false}]; !ok {
+		t.Fatalf("bookmarks %v, want b.go:3", m.bookmarks)
+	}
+	if rows := m.bookmarkRows(); len(rows) != 1 || !rows[5] {
+		t.Fatalf("bookmark rows %v", rows)
+	}
+}
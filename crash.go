@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// crashReport is a panic caught in Update or View, held until Bubble Tea has
+// given the terminal back so it can be printed readably.
+type crashReport struct {
+	value interface{}
+	stack []byte
+}
+
+// crashGuard is shared by every copy of the model. It keeps the first panic
+// and quits the program, which restores the terminal.
+type crashGuard struct {
+	mu     sync.Mutex
+	report *crashReport
+	// quit stops the program from outside the event loop; View cannot
+	// return tea.Quit.
+	quit func()
+}
+
+// record keeps r as the crash unless one is already kept.
+func (g *crashGuard) record(r interface{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.report == nil {
+		g.report = &crashReport{value: r, stack: debug.Stack()}
+	}
+}
+
+func (g *crashGuard) crashed() *crashReport {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.report
+}
+
+// catchUpdatePanic is deferred by Update: a panic there is recorded and
+// the program quits instead of dying with the terminal still in raw mode.
+func (m model) catchUpdatePanic(next *tea.Model, cmd *tea.Cmd) {
+	if r := recover(); r != nil {
+		m.crash.record(r)
+		*next, *cmd = m, tea.Quit
+	}
+}
+
+// catchViewPanic is deferred by View, which draws nothing more once it has
+// panicked.
+func (m model) catchViewPanic(view *string) {
+	if r := recover(); r != nil {
+		m.crash.record(r)
+		*view = ""
+		if m.crash.quit != nil {
+			// Quit sends on the channel the event loop calling View reads.
+			go m.crash.quit()
+		}
+	}
+}
+
+// panicError is a panic in a load command, which reaches the model as that
+// load's error: the header shows the first line and e the stack.
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("internal error: %v (please report this; e shows the stack)\n\n%s", e.value, e.stack)
+}
+
+// guardCmd runs load and turns a panic in it into the message failed builds
+// from the error, so a bug in one load does not take tdiff down.
+func guardCmd(load func() tea.Msg, failed func(error) tea.Msg) tea.Cmd {
+	return func() (msg tea.Msg) {
+		defer func() {
+			if r := recover(); r != nil {
+				msg = failed(&panicError{value: r, stack: debug.Stack()})
+			}
+		}()
+		return load()
+	}
+}
+
+// reportCrash prints report to w with a request to report it, and copies it
+// to a crash file in the temporary directory when it can.
+func reportCrash(w io.Writer, report *crashReport) {
+	text := fmt.Sprintf("tdiff crashed: %v\n\n%s\n%s\n", report.value, versionString(), report.stack)
+	fmt.Fprint(w, text)
+	if path, err := writeCrashFile(text); err == nil {
+		fmt.Fprintf(w, "Please report this at https://github.com/PedroElizalde01/tdiff/issues with %s attached.\n", path)
+		return
+	}
+	fmt.Fprintln(w, "Please report this at https://github.com/PedroElizalde01/tdiff/issues with the output above.")
+}
+
+// writeCrashFile saves text to a new file in the temporary directory and
+// returns its path. CreateTemp picks a name nobody can have put there first.
+func writeCrashFile(text string) (string, error) {
+	f, err := os.CreateTemp("", "tdiff-crash-*.txt")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.WriteString(text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestCatchUpdatePanic_RecordsAndQuits(t *testing.T) {
+	m := loadedModel(2)
+	next, cmd := func() (next tea.Model, cmd tea.Cmd) {
+		defer m.catchUpdatePanic(&next, &cmd)
+		panic("boom")
+	}()
+	if next == nil || cmd == nil {
+		t.Fatal("a panic in Update did not quit")
+	}
+	if report := m.crash.crashed(); report == nil || report.value != "boom" || len(report.stack) == 0 {
+		t.Fatalf("crash report = %+v", report)
+	}
+}
+
+func TestGuardCmd_TurnsPanicIntoError(t *testing.T) {
+	cmd := guardCmd(func() tea.Msg { panic("index out of range") }, func(err error) tea.Msg {
+		return filesLoadedMsg{req: 3, err: err}
+	})
+	msg, ok := cmd().(filesLoadedMsg)
+	if !ok || msg.req != 3 || msg.err == nil {
+		t.Fatalf("got %#v", msg)
+	}
+	m := loadedModel(2)
+	m.setError(msg.err)
+	if !strings.HasPrefix(m.errMsg, "internal error: index out of range") || strings.Contains(m.errMsg, "\n") {
+		t.Fatalf("header error = %q", m.errMsg)
+	}
+	detail := strings.Join(errorDetail(msg.err), "\n")
+	if !strings.Contains(detail, "goroutine") {
+		t.Fatalf("error detail has no stack: %q", detail)
+	}
+}
+
+func TestReportCrash_EachCrashGetsItsOwnFile(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	var first, second bytes.Buffer
+	reportCrash(&first, &crashReport{value: "boom", stack: []byte("stack")})
+	reportCrash(&second, &crashReport{value: "boom", stack: []byte("stack")})
+	files, _ := filepath.Glob(filepath.Join(os.TempDir(), "tdiff-crash-*.txt"))
+	if len(files) != 2 {
+		t.Fatalf("crash files %v, want one per crash", files)
+	}
+	for _, file := range files {
+		if !strings.Contains(first.String()+second.String(), file+" attached") {
+			t.Errorf("%s is not named in the reports", file)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package diff
+
+import "strings"
+
+// conflictMarkerSize is how many times a merge repeats a conflict marker's
+// character, git's default conflict-marker-size.
+const conflictMarkerSize = 7
+
+// IsConflictMarker reports whether line is one a merge leaves around a
+// conflict: seven '<', '|', '=' or '>' at its start, followed by whitespace or
+// nothing, as git diff --check finds them.
+func IsConflictMarker(line string) bool {
+	if len(line) < conflictMarkerSize {
+		return false
+	}
+	c := line[0]
+	if c != '<' && c != '|' && c != '=' && c != '>' {
+		return false
+	}
+	for i := 1; i < conflictMarkerSize; i++ {
+		if line[i] != c {
+			return false
+		}
+	}
+	return len(line) == conflictMarkerSize || line[conflictMarkerSize] == ' ' || line[conflictMarkerSize] == '\t'
+}
+
+// CountConflictRegions counts the conflicts a merge left in content, one for
+// each opening '<' marker.
+func CountConflictRegions(content string) int {
+	regions := 0
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.HasPrefix(line, "<") && IsConflictMarker(line) {
+			regions++
+		}
+	}
+	return regions
+}
+
+// HasConflictMarkers reports whether any row adds a conflict marker.
+func HasConflictMarkers(rows []Row) bool {
+	for _, row := range rows {
+		if row.ConflictMarker {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package diff
 
 import (
+	"fmt"
 	"regexp"
 	"sort"
 	"strconv"
@@ -11,10 +12,13 @@ type Kind int
 
 const (
 	Meta Kind = iota
-	Hunk
+	HunkHeader
 	Del
 	Add
 	Context
+	// HiddenMeta is a line of git's file header ("diff --git", "index",
+	// "---", "+++"), which the panes leave out unless asked to show it.
+	HiddenMeta
 )
 
 type Row struct {
@@ -23,9 +27,47 @@ type Row struct {
 	Old   string
 	New   string
 	Kind  Kind
+	// NoNewlineOld and NoNewlineNew mark lines that git reported with
+	// "\ No newline at end of file" on that side.
+	NoNewlineOld bool
+	NoNewlineNew bool
+	// CRLFOld and CRLFNew mark lines that ended in "\r\n" on that side. The
+	// carriage return is kept out of Old/New so it neither shows on screen nor
+	// hides a line-ending-only change from the word diff.
+	CRLFOld bool
+	CRLFNew bool
+	// WhitespaceErrors marks byte ranges of New that break core.whitespace;
+	// it is filled in by MarkWhitespaceErrors.
+	WhitespaceErrors []Range
+	// ConflictMarker marks an added line that is a leftover conflict marker
+	// such as "<<<<<<< HEAD".
+	ConflictMarker bool
+	// InvisibleChange marks an edit pair whose lines look the same on screen;
+	// InvisibleOld and InvisibleNew are the byte ranges of the invisible
+	// characters that differ. They are filled in by MarkInvisibleChanges.
+	InvisibleChange bool
+	InvisibleOld    []Range
+	InvisibleNew    []Range
+	// BaseOld and BaseNew mark a side of a merge conflict row whose line is
+	// BASE's, kept as it was by that side of the merge.
+	BaseOld bool
+	BaseNew bool
 }
 
-var hunkHeaderRE = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+// Hunk describes one @@ section of a parsed diff and the rows it produced.
+// RowStart is the index of the hunk header row; RowEnd is exclusive.
+type Hunk struct {
+	OldStart    int
+	OldLines    int
+	NewStart    int
+	NewLines    int
+	Header      string
+	FuncContext string
+	RowStart    int
+	RowEnd      int
+}
+
+var hunkHeaderRE = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
 
 const (
 	editPairSimilarityThreshold = 0.45
@@ -44,21 +86,138 @@ type pairCandidate struct {
 	distance int
 }
 
+// BinaryChangedText is the placeholder row text for "Binary files ... differ".
+const BinaryChangedText = "(binary file changed)"
+
+// IsBinary reports whether a raw diff describes a binary change, either as a
+// "Binary files ... differ" notice or a "GIT binary patch".
+func IsBinary(input string) bool {
+	return hasBinaryFilesLine(input) || strings.Contains(input, "\nGIT binary patch\n") || strings.HasPrefix(input, "GIT binary patch\n")
+}
+
+func hasBinaryFilesLine(input string) bool {
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "Binary files ") && strings.HasSuffix(line, " differ") {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseUnified parses a unified diff into side-by-side rows and the row indices
+// where each hunk starts. Use ParseHunks when hunk ranges or headers are needed.
 func ParseUnified(input string) ([]Row, []int) {
-	input = strings.ReplaceAll(input, "\r\n", "\n")
+	rows, hunks := ParseHunks(input)
+	return rows, HunkStarts(hunks)
+}
+
+// HunkStarts returns the header row index of each hunk.
+func HunkStarts(hunks []Hunk) []int {
+	if len(hunks) == 0 {
+		return nil
+	}
+	starts := make([]int, len(hunks))
+	for i := range hunks {
+		starts[i] = hunks[i].RowStart
+	}
+	return starts
+}
+
+// HunkAt returns the index of the hunk containing row, or -1 when row falls
+// outside every hunk (e.g. on leading meta rows). Hunks are in row order, so
+// this is a binary search and cheap enough to run on every cursor move.
+func HunkAt(hunks []Hunk, row int) int {
+	i := sort.Search(len(hunks), func(i int) bool { return hunks[i].RowStart > row }) - 1
+	if i >= 0 && row < hunks[i].RowEnd {
+		return i
+	}
+	return -1
+}
+
+// IsChange reports whether row adds, deletes or edits a line, as opposed to
+// context and meta rows.
+func IsChange(row Row) bool {
+	switch row.Kind {
+	case Add, Del:
+		return true
+	case Context:
+		return row.OldNo != nil && row.NewNo != nil && !isContextRow(row)
+	default:
+		return false
+	}
+}
+
+// ChangeStarts returns the index of the first row of every run of consecutive
+// change rows, in order.
+func ChangeStarts(rows []Row) []int {
+	var starts []int
+	inRun := false
+	for i, row := range rows {
+		change := IsChange(row)
+		if change && !inRun {
+			starts = append(starts, i)
+		}
+		inRun = change
+	}
+	return starts
+}
+
+// FindLine returns the index of the row showing the given new (preferred) or
+// old line number, falling back to the first row past it. It lets a cursor keep
+// its place when the same file is re-rendered differently. Nil numbers are
+// ignored; with neither set it returns 0.
+func FindLine(rows []Row, oldNo, newNo *int) int {
+	if newNo != nil {
+		if idx := findLineSide(rows, *newNo, false); idx >= 0 {
+			return idx
+		}
+	}
+	if oldNo != nil {
+		if idx := findLineSide(rows, *oldNo, true); idx >= 0 {
+			return idx
+		}
+	}
+	return 0
+}
+
+func findLineSide(rows []Row, no int, old bool) int {
+	best := -1
+	for i, row := range rows {
+		n := row.NewNo
+		if old {
+			n = row.OldNo
+		}
+		if n == nil {
+			continue
+		}
+		if *n == no {
+			return i
+		}
+		if *n > no && best < 0 {
+			best = i
+		}
+	}
+	return best
+}
+
+// ParseHunks parses a unified diff into side-by-side rows plus structured hunk
+// metadata.
+func ParseHunks(input string) ([]Row, []Hunk) {
+	input = normalizeLineEndings(input)
 	trimmed := strings.TrimSpace(input)
 	if trimmed == "" {
 		return nil, nil
 	}
 
-	if strings.Contains(input, "Binary files") && strings.Contains(input, " differ") {
-		msg := "(binary file changed)"
+	if hasBinaryFilesLine(input) {
+		msg := BinaryChangedText
 		return []Row{{Old: msg, New: msg, Kind: Meta}}, nil
 	}
 
 	lines := strings.Split(strings.TrimRight(input, "\n"), "\n")
 	rows := make([]Row, 0, len(lines))
-	hunkStarts := make([]int, 0, 8)
+	hunks := make([]Hunk, 0, 8)
 
 	var oldLine int
 	var newLine int
@@ -66,6 +225,18 @@ func ParseUnified(input string) ([]Row, []int) {
 
 	dels := make([]string, 0, 8)
 	adds := make([]string, 0, 8)
+	delCRLF := make([]bool, 0, 8)
+	addCRLF := make([]bool, 0, 8)
+	// delNoNewline/addNoNewline flag the last pending line on each side; the
+	// marker is folded into whichever row that line lands on once aligned.
+	delNoNewline := false
+	addNoNewline := false
+	var lastPrefix byte
+	// binaryRow is the summary row of an in-progress "GIT binary patch", whose
+	// base85 payload is counted instead of being shown.
+	binaryRow := -1
+	binaryBytes := 0
+	pendingOldMode := ""
 
 	flushEdits := func() {
 		if len(dels) == 0 && len(adds) == 0 {
@@ -78,11 +249,16 @@ func ParseUnified(input string) ([]Row, []int) {
 			if p.delIdx >= 0 {
 				row.OldNo = intPtr(oldLine)
 				row.Old = dels[p.delIdx]
+				row.CRLFOld = delCRLF[p.delIdx]
+				row.NoNewlineOld = delNoNewline && p.delIdx == len(dels)-1
 				oldLine++
 			}
 			if p.addIdx >= 0 {
 				row.NewNo = intPtr(newLine)
 				row.New = adds[p.addIdx]
+				row.CRLFNew = addCRLF[p.addIdx]
+				row.NoNewlineNew = addNoNewline && p.addIdx == len(adds)-1
+				row.ConflictMarker = IsConflictMarker(row.New)
 				newLine++
 			}
 			if row.OldNo != nil && row.NewNo == nil {
@@ -95,20 +271,70 @@ func ParseUnified(input string) ([]Row, []int) {
 		}
 		dels = dels[:0]
 		adds = adds[:0]
+		delCRLF = delCRLF[:0]
+		addCRLF = addCRLF[:0]
+		delNoNewline = false
+		addNoNewline = false
 	}
 
 	for _, line := range lines {
+		// A trailing \r here is part of the file's line, not of git's output.
+		crlf := strings.HasSuffix(line, "\r")
+		line = strings.TrimSuffix(line, "\r")
+		if binaryRow >= 0 {
+			if !strings.HasPrefix(line, "diff --git ") {
+				if line != "" && !strings.HasPrefix(line, "literal ") && !strings.HasPrefix(line, "delta ") {
+					binaryBytes += len(line)
+				}
+				msg := fmt.Sprintf("(GIT binary patch: %d bytes encoded)", binaryBytes)
+				rows[binaryRow].Old, rows[binaryRow].New = msg, msg
+				continue
+			}
+			binaryRow = -1
+		}
+
 		switch {
+		case line == "GIT binary patch":
+			flushEdits()
+			closeHunk(hunks, len(rows))
+			inHunk = false
+			binaryRow = len(rows)
+			binaryBytes = 0
+			msg := "(GIT binary patch: 0 bytes encoded)"
+			rows = append(rows, Row{Old: msg, New: msg, Kind: Meta})
+		case strings.HasPrefix(line, "diff --git ") && inHunk:
+			// A second file header ends the hunk: a type change diffs the
+			// old file and the new one one after the other.
+			flushEdits()
+			closeHunk(hunks, len(rows))
+			inHunk = false
+			rows = append(rows, Row{Old: line, New: line, Kind: HiddenMeta})
 		case strings.HasPrefix(line, "@@ "):
 			flushEdits()
-			oldLine, newLine = parseHunkHeader(line)
+			closeHunk(hunks, len(rows))
+			hunk := parseHunkHeader(line)
+			hunk.RowStart = len(rows)
+			oldLine, newLine = hunk.OldStart, hunk.NewStart
 			inHunk = true
-			rows = append(rows, Row{Old: line, New: line, Kind: Hunk})
-			hunkStarts = append(hunkStarts, len(rows)-1)
+			rows = append(rows, Row{Old: line, New: line, Kind: HunkHeader})
+			hunks = append(hunks, hunk)
 		case !inHunk && isMetaLine(line):
 			flushEdits()
 			inHunk = false
 			if isHiddenFileHeaderMeta(line) {
+				rows = append(rows, Row{Old: line, New: line, Kind: HiddenMeta})
+				continue
+			}
+			if strings.HasPrefix(line, "old mode ") {
+				pendingOldMode = strings.TrimPrefix(line, "old mode ")
+				continue
+			}
+			if strings.HasPrefix(line, "new mode ") && pendingOldMode != "" {
+				// Fold the mode pair into one readable row; chmods are easy to miss.
+				change := ModeChange{Old: pendingOldMode, New: strings.TrimPrefix(line, "new mode ")}
+				pendingOldMode = ""
+				msg := change.Summary()
+				rows = append(rows, Row{Old: msg, New: msg, Kind: Meta})
 				continue
 			}
 			rows = append(rows, Row{Old: line, New: line, Kind: Meta})
@@ -120,36 +346,163 @@ func ParseUnified(input string) ([]Row, []int) {
 			if line == "" {
 				flushEdits()
 				rows = append(rows, Row{Old: "", New: "", Kind: Context})
+				lastPrefix = 0
 				continue
 			}
-			switch line[0] {
+			prefix := line[0]
+			switch prefix {
 			case '-':
 				dels = append(dels, line[1:])
+				delCRLF = append(delCRLF, crlf)
 			case '+':
 				adds = append(adds, line[1:])
+				addCRLF = append(addCRLF, crlf)
 			case ' ':
 				flushEdits()
 				rows = append(rows, Row{
-					OldNo: intPtr(oldLine),
-					NewNo: intPtr(newLine),
-					Old:   line[1:],
-					New:   line[1:],
-					Kind:  Context,
+					OldNo:   intPtr(oldLine),
+					NewNo:   intPtr(newLine),
+					Old:     line[1:],
+					New:     line[1:],
+					Kind:    Context,
+					CRLFOld: crlf,
+					CRLFNew: crlf,
 				})
 				oldLine++
 				newLine++
 			case '\\':
-				flushEdits()
-				rows = append(rows, Row{Old: line, New: line, Kind: Meta})
+				markNoNewline(lastPrefix, rows, &delNoNewline, &addNoNewline)
+				continue
 			default:
 				flushEdits()
 				rows = append(rows, Row{Old: line, New: line, Kind: Meta})
 			}
+			lastPrefix = prefix
 		}
 	}
 
 	flushEdits()
-	return rows, hunkStarts
+	closeHunk(hunks, len(rows))
+	rows, hunks = addLineEndingSummary(rows, hunks)
+	if !strings.Contains(input, "\ndeleted file mode ") {
+		return rows, hunks
+	}
+	if change, ok := ParseTypeChange(input); ok {
+		msg := change.Summary()
+		rows, hunks = prependRows([]Row{{Old: msg, New: msg, Kind: Meta}}, rows, hunks)
+	}
+	return rows, hunks
+}
+
+// normalizeLineEndings undoes CRLF conversion of the whole diff text, which
+// shows up as a carriage return on git's own header lines. Otherwise input is
+// returned untouched so carriage returns inside content lines survive.
+func normalizeLineEndings(input string) string {
+	first := input
+	if idx := strings.IndexByte(input, '\n'); idx >= 0 {
+		first = input[:idx]
+	}
+	if !strings.HasSuffix(first, "\r") || strings.HasPrefix(first, " ") || strings.HasPrefix(first, "+") || strings.HasPrefix(first, "-") {
+		return input
+	}
+	return strings.ReplaceAll(input, "\r\n", "\n")
+}
+
+// LineEndingChanged reports whether row's sides differ only in their line
+// ending.
+func LineEndingChanged(row Row) bool {
+	return row.Kind == Context && row.OldNo != nil && row.NewNo != nil &&
+		row.Old == row.New && row.CRLFOld != row.CRLFNew
+}
+
+// addLineEndingSummary prepends a meta row per direction of line-ending-only
+// changes, e.g. "line endings changed LF→CRLF on 312 lines", and shifts the
+// hunk ranges past it.
+func addLineEndingSummary(rows []Row, hunks []Hunk) ([]Row, []Hunk) {
+	toCRLF, toLF := 0, 0
+	for _, row := range rows {
+		if !LineEndingChanged(row) {
+			continue
+		}
+		if row.CRLFNew {
+			toCRLF++
+		} else {
+			toLF++
+		}
+	}
+
+	var summary []Row
+	for _, change := range []struct {
+		from, to string
+		count    int
+	}{{"LF", "CRLF", toCRLF}, {"CRLF", "LF", toLF}} {
+		if change.count == 0 {
+			continue
+		}
+		msg := fmt.Sprintf("line endings changed %s→%s on %d %s", change.from, change.to, change.count, pluralLines(change.count))
+		summary = append(summary, Row{Old: msg, New: msg, Kind: Meta})
+	}
+	return prependRows(summary, rows, hunks)
+}
+
+// prependRows puts summary rows before rows, shifting the hunk ranges past
+// them.
+func prependRows(summary, rows []Row, hunks []Hunk) ([]Row, []Hunk) {
+	if len(summary) == 0 {
+		return rows, hunks
+	}
+	for i := range hunks {
+		hunks[i].RowStart += len(summary)
+		hunks[i].RowEnd += len(summary)
+	}
+	return append(summary, rows...), hunks
+}
+
+func pluralLines(n int) string {
+	if n == 1 {
+		return "line"
+	}
+	return "lines"
+}
+
+// markNoNewline applies a "\ No newline at end of file" marker to the line
+// that preceded it: a pending deletion or addition, or the last context row.
+func markNoNewline(lastPrefix byte, rows []Row, delNoNewline, addNoNewline *bool) {
+	switch lastPrefix {
+	case '-':
+		*delNoNewline = true
+	case '+':
+		*addNoNewline = true
+	case ' ':
+		if len(rows) > 0 {
+			rows[len(rows)-1].NoNewlineOld = true
+			rows[len(rows)-1].NoNewlineNew = true
+		}
+	}
+}
+
+// DeletedFileRows turns a removed file's content into deletion rows numbered
+// from 1, so it can be read in full on the old side.
+func DeletedFileRows(content string) []Row {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if content == "" {
+		return nil
+	}
+	noNewline := !strings.HasSuffix(content, "\n")
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	rows := make([]Row, 0, len(lines))
+	for i, line := range lines {
+		rows = append(rows, Row{OldNo: intPtr(i + 1), Old: line, Kind: Del})
+	}
+	rows[len(rows)-1].NoNewlineOld = noNewline
+	return rows
+}
+
+func closeHunk(hunks []Hunk, end int) {
+	if len(hunks) == 0 || hunks[len(hunks)-1].RowEnd != 0 {
+		return
+	}
+	hunks[len(hunks)-1].RowEnd = end
 }
 
 func alignEditRows(dels, adds []string) []blockRow {
@@ -321,20 +674,29 @@ func minInt(a, b int) int {
 	return b
 }
 
-func parseHunkHeader(line string) (int, int) {
+func parseHunkHeader(line string) Hunk {
+	hunk := Hunk{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1, Header: line}
 	m := hunkHeaderRE.FindStringSubmatch(line)
-	if len(m) < 3 {
-		return 1, 1
+	if len(m) < 6 {
+		return hunk
 	}
-	oldStart, err := strconv.Atoi(m[1])
-	if err != nil {
-		oldStart = 1
+	hunk.OldStart = atoiDefault(m[1], 1)
+	hunk.OldLines = atoiDefault(m[2], 1)
+	hunk.NewStart = atoiDefault(m[3], 1)
+	hunk.NewLines = atoiDefault(m[4], 1)
+	hunk.FuncContext = strings.TrimSpace(m[5])
+	return hunk
+}
+
+func atoiDefault(s string, fallback int) int {
+	if s == "" {
+		return fallback
 	}
-	newStart, err := strconv.Atoi(m[2])
+	n, err := strconv.Atoi(s)
 	if err != nil {
-		newStart = 1
+		return fallback
 	}
-	return oldStart, newStart
+	return n
 }
 
 func isMetaLine(line string) bool {
@@ -1,6 +1,9 @@
 package diff
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestParseUnified_PairsSimpleReplacement(t *testing.T) {
 	input := "@@ -1 +1 @@\n-foo()\n+foo2()\n"
@@ -73,10 +76,392 @@ func TestParseUnified_RefactorLikePairsClosestLine(t *testing.T) {
 	assertAddition(t, content[3], "metrics.Inc()")
 }
 
+func TestParseHunks_PopulatesHunkMetadata(t *testing.T) {
+	input := "@@ -1,2 +1,2 @@ func main() {\n a\n-b\n+c\n@@ -10 +10,2 @@\n x\n+y\n"
+	rows, hunks := ParseHunks(input)
+
+	if len(hunks) != 2 {
+		t.Fatalf("expected 2 hunks, got %d", len(hunks))
+	}
+	first := hunks[0]
+	if first.OldStart != 1 || first.OldLines != 2 || first.NewStart != 1 || first.NewLines != 2 {
+		t.Fatalf("unexpected first hunk ranges: %+v", first)
+	}
+	if first.FuncContext != "func main() {" {
+		t.Fatalf("expected func context, got %q", first.FuncContext)
+	}
+	if first.RowStart != 0 || first.RowEnd != 4 {
+		t.Fatalf("expected first hunk rows [0,4), got [%d,%d)", first.RowStart, first.RowEnd)
+	}
+
+	second := hunks[1]
+	if second.OldLines != 1 || second.NewLines != 2 || second.FuncContext != "" {
+		t.Fatalf("unexpected second hunk: %+v", second)
+	}
+	if second.RowStart != 4 || second.RowEnd != len(rows) {
+		t.Fatalf("expected second hunk rows [4,%d), got [%d,%d)", len(rows), second.RowStart, second.RowEnd)
+	}
+	if got := HunkAt(hunks, 5); got != 1 {
+		t.Fatalf("expected row 5 in hunk 1, got %d", got)
+	}
+}
+
+func TestHunkAt_OutsideHunks(t *testing.T) {
+	hunks := []Hunk{{RowStart: 2, RowEnd: 5}, {RowStart: 7, RowEnd: 9}}
+	want := map[int]int{0: -1, 1: -1, 2: 0, 4: 0, 5: -1, 6: -1, 7: 1, 8: 1, 9: -1, 20: -1}
+	for row, hunk := range want {
+		if got := HunkAt(hunks, row); got != hunk {
+			t.Fatalf("HunkAt(row %d) = %d, want %d", row, got, hunk)
+		}
+	}
+	if got := HunkAt(nil, 0); got != -1 {
+		t.Fatalf("HunkAt(nil) = %d, want -1", got)
+	}
+}
+
+func TestParseUnified_RemovedTrailingNewline(t *testing.T) {
+	input := "@@ -1,2 +1,2 @@\n a\n-last\n+last\n\\ No newline at end of file\n"
+	rows, _ := ParseUnified(input)
+	content := contentRows(rows)
+
+	if len(content) != 2 {
+		t.Fatalf("expected marker folded into 2 content rows, got %d", len(content))
+	}
+	if content[1].NoNewlineOld || !content[1].NoNewlineNew {
+		t.Fatalf("expected only the new side to lack a newline, got old=%v new=%v", content[1].NoNewlineOld, content[1].NoNewlineNew)
+	}
+	for _, row := range rows {
+		if row.Kind == Meta {
+			t.Fatalf("expected no standalone marker row, got %q", row.Old)
+		}
+	}
+}
+
+func TestParseUnified_AddedTrailingNewline(t *testing.T) {
+	input := "@@ -1,2 +1,2 @@\n a\n-last\n\\ No newline at end of file\n+last\n"
+	rows, _ := ParseUnified(input)
+	content := contentRows(rows)
+
+	if len(content) != 2 {
+		t.Fatalf("expected marker folded into 2 content rows, got %d", len(content))
+	}
+	if !content[1].NoNewlineOld || content[1].NoNewlineNew {
+		t.Fatalf("expected only the old side to lack a newline, got old=%v new=%v", content[1].NoNewlineOld, content[1].NoNewlineNew)
+	}
+}
+
+func TestParseUnified_ContextWithoutTrailingNewline(t *testing.T) {
+	input := "@@ -1,2 +1,3 @@\n+first\n a\n b\n\\ No newline at end of file\n"
+	rows, _ := ParseUnified(input)
+	content := contentRows(rows)
+
+	last := content[len(content)-1]
+	if last.Old != "b" || !last.NoNewlineOld || !last.NoNewlineNew {
+		t.Fatalf("expected context row b flagged on both sides, got %+v", last)
+	}
+}
+
+func TestParseUnified_CollapsesGitBinaryPatch(t *testing.T) {
+	input := "diff --git a/img.png b/img.png\nindex 1111111..2222222 100644\nGIT binary patch\nliteral 12\nTcmZ?wbhEHbRA6LK0093V\n\nliteral 3\nKcmZ?wbhEHb\n\n"
+	if !IsBinary(input) {
+		t.Fatalf("expected GIT binary patch to be detected as binary")
+	}
+	rows, hunks := ParseUnified(input)
+
+	// The diff --git and index lines come first, hidden.
+	if len(rows) != 3 || len(hunks) != 0 || rows[0].Kind != HiddenMeta || rows[1].Kind != HiddenMeta {
+		t.Fatalf("expected a single summary row after the header, got %+v and %d hunks", rows, len(hunks))
+	}
+	if rows[2].Old != "(GIT binary patch: 32 bytes encoded)" {
+		t.Fatalf("unexpected binary patch summary %q", rows[2].Old)
+	}
+}
+
+func TestIsBinary_IgnoresTextMentioningBinaryFiles(t *testing.T) {
+	input := "@@ -1 +1 @@\n-Binary files may differ\n+Binary files now differ\n"
+	if IsBinary(input) {
+		t.Fatalf("expected text diff not to be treated as binary")
+	}
+}
+
+func TestDetectLFSChange_SummarizesPointerDiff(t *testing.T) {
+	input := "@@ -1,3 +1,3 @@\n version https://git-lfs.github.com/spec/v1\n-oid sha256:ab12aaaa\n-size 4300000\n+oid sha256:cd34bbbb\n+size 4500000\n"
+	rows, _ := ParseUnified(input)
+
+	change, ok := DetectLFSChange(rows)
+	if !ok {
+		t.Fatalf("expected LFS pointer diff to be detected")
+	}
+	if change.Old == nil || change.New == nil {
+		t.Fatalf("expected both pointer sides, got %+v", change)
+	}
+	if change.Old.Size != 4300000 || change.New.ShortOID() != "cd34…" {
+		t.Fatalf("unexpected pointer data old=%+v new=%+v", change.Old, change.New)
+	}
+
+	plain, _ := ParseUnified("@@ -1 +1 @@\n-version 1\n+version 2\n")
+	if _, ok := DetectLFSChange(plain); ok {
+		t.Fatalf("expected ordinary diff not to be treated as LFS")
+	}
+}
+
+func TestParseUnified_FoldsModeChangeIntoOneRow(t *testing.T) {
+	input := "diff --git a/run.sh b/run.sh\nold mode 100644\nnew mode 100755\n"
+	rows, _ := ParseUnified(input)
+
+	if len(rows) != 2 || rows[0].Kind != HiddenMeta {
+		t.Fatalf("expected the hidden diff --git line and one mode row, got %+v", rows)
+	}
+	if rows[1].Old != "mode changed: rw-r--r-- → rwxr-xr-x (+x)" {
+		t.Fatalf("unexpected mode row %q", rows[1].Old)
+	}
+
+	change, ok := ParseModeChange(input)
+	if !ok || change.ExecHint() != "+x" {
+		t.Fatalf("expected structured +x mode change, got %+v ok=%v", change, ok)
+	}
+}
+
+func TestParseHunks_TypeChangeFileToSymlink(t *testing.T) {
+	input := "diff --git a/f b/f\ndeleted file mode 100644\nindex 45b983b..0000000\n--- a/f\n+++ /dev/null\n@@ -1 +0,0 @@\n-hi\n" +
+		"diff --git a/f b/f\nnew file mode 120000\nindex 0000000..7013e0d\n--- /dev/null\n+++ b/f\n@@ -0,0 +1 @@\n+../foo\n\\ No newline at end of file\n"
+	rows, hunks := ParseHunks(input)
+	if len(rows) == 0 || rows[0].Kind != Meta || rows[0].Old != "type changed: regular file → symlink to ../foo" {
+		t.Fatalf("first row %+v, want the type change", rows[0])
+	}
+	if len(hunks) != 2 {
+		t.Fatalf("got %d hunks, want the old file's and the new one's", len(hunks))
+	}
+	var dels, adds []string
+	for _, row := range rows {
+		switch row.Kind {
+		case Del:
+			dels = append(dels, row.Old)
+		case Add:
+			adds = append(adds, row.New)
+		}
+	}
+	if len(dels) != 1 || dels[0] != "hi" || len(adds) != 1 || adds[0] != "../foo" {
+		t.Fatalf("deleted %q, added %q: the second header leaked into the lines", dels, adds)
+	}
+	if got := rows[hunks[1].RowStart+1]; got.New != "../foo" || !got.NoNewlineNew {
+		t.Fatalf("second hunk starts %+v", got)
+	}
+}
+
+func TestParseHunks_TypeChangeSymlinkToFile(t *testing.T) {
+	input := "diff --git a/l b/l\ndeleted file mode 120000\nindex 7013e0d..0000000\n--- a/l\n+++ /dev/null\n@@ -1 +0,0 @@\n-../foo\n\\ No newline at end of file\n" +
+		"diff --git a/l b/l\nnew file mode 100644\nindex 0000000..8e27be7\n--- /dev/null\n+++ b/l\n@@ -0,0 +1 @@\n+text\n"
+	rows, _ := ParseHunks(input)
+	if rows[0].Old != "type changed: symlink to ../foo → regular file" {
+		t.Fatalf("first row %q", rows[0].Old)
+	}
+	change, ok := ParseTypeChange("diff --git a/m b/m\ndeleted file mode 160000\n--- a/m\n+++ /dev/null\n@@ -1 +0,0 @@\n-Subproject commit 1a2b\ndiff --git a/m b/m\nnew file mode 100644\n")
+	if !ok || change.Summary() != "type changed: submodule → regular file" {
+		t.Fatalf("submodule change %+v ok=%v", change, ok)
+	}
+	if _, ok := ParseTypeChange("diff --git a/f b/f\ndeleted file mode 100644\n--- a/f\n+++ /dev/null\n@@ -1 +0,0 @@\n-hi\n"); ok {
+		t.Fatal("a deleted file is not a type change")
+	}
+}
+
+func TestFullFileRows_InterleavesHunksIntoWholeFile(t *testing.T) {
+	input := "@@ -2,3 +2,3 @@\n b\n-c\n+C\n d\n"
+	rows, hunks := ParseHunks(input)
+	full, fullHunks := FullFileRows("a\nb\nC\nd\ne\n", rows, hunks)
+
+	var got []string
+	for _, row := range full {
+		got = append(got, row.Old+"|"+row.New)
+	}
+	want := []string{"a|a", "b|b", "c|", "|C", "d|d", "e|e"}
+	if len(got) != len(want) {
+		t.Fatalf("expected rows %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("row %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+	if *full[5].OldNo != 5 || *full[5].NewNo != 5 {
+		t.Fatalf("expected trailing context numbered 5/5, got %d/%d", *full[5].OldNo, *full[5].NewNo)
+	}
+	if len(fullHunks) != 1 || fullHunks[0].RowStart != 1 || fullHunks[0].RowEnd != 5 {
+		t.Fatalf("expected one changed region [1,5), got %+v", fullHunks)
+	}
+	if idx := FindLine(full, nil, intPtr(4)); idx != 4 {
+		t.Fatalf("expected new line 4 at row 4, got %d", idx)
+	}
+}
+
+func TestMarkWhitespaceErrors_FlagsAddedLinesOnly(t *testing.T) {
+	input := "@@ -1,2 +1,3 @@\n keep  \n-value = 1\n+value = 2  \n+ \tindent\n"
+	rows, _ := ParseHunks(input)
+	count := MarkWhitespaceErrors(rows, DefaultWhitespaceRule())
+
+	if count != 2 {
+		t.Fatalf("expected 2 lines with whitespace errors, got %d", count)
+	}
+	if rows[1].WhitespaceErrors != nil {
+		t.Fatalf("expected context line to be ignored, got %+v", rows[1].WhitespaceErrors)
+	}
+	if got := rows[2].WhitespaceErrors; len(got) != 1 || got[0] != (Range{Start: 9, End: 11}) {
+		t.Fatalf("expected trailing-space range [9,11), got %+v", got)
+	}
+	if got := rows[3].WhitespaceErrors; len(got) != 1 || got[0] != (Range{Start: 0, End: 2}) {
+		t.Fatalf("expected space-before-tab range [0,2), got %+v", got)
+	}
+}
+
+func TestMarkInvisibleChanges_BOM(t *testing.T) {
+	rows, _ := ParseHunks("@@ -1,2 +1,2 @@\n-package main\n+\ufeffpackage main\n-func main() {}\n+func main() { }\n")
+	if count := MarkInvisibleChanges(rows); count != 1 {
+		t.Fatalf("expected 1 flagged row, got %d", count)
+	}
+	if row := rows[1]; !row.InvisibleChange || row.InvisibleOld != nil || len(row.InvisibleNew) != 1 || row.InvisibleNew[0] != (Range{Start: 0, End: 3}) {
+		t.Fatalf("expected the BOM flagged on the new side, got %+v", row)
+	}
+	if rows[2].InvisibleChange {
+		t.Fatalf("a visible change was flagged: %+v", rows[2])
+	}
+	if got := EscapeInvisible(rows[1].New); got != "<U+FEFF>package main" {
+		t.Fatalf("escaped %q", got)
+	}
+}
+
+func TestMarkInvisibleChanges_ZWSP(t *testing.T) {
+	rows, _ := ParseHunks("@@ -1 +1 @@\n-const name = \"a\u200bb\"\n+const name = \"ab\"\n")
+	if count := MarkInvisibleChanges(rows); count != 1 {
+		t.Fatalf("expected 1 flagged row, got %d", count)
+	}
+	row := rows[1]
+	if len(row.InvisibleOld) != 1 || row.InvisibleOld[0] != (Range{Start: 15, End: 18}) || row.InvisibleNew != nil {
+		t.Fatalf("expected the removed ZWSP flagged, got %+v", row)
+	}
+	if got := EscapeInvisible(row.Old); got != "const name = \"a<U+200B>b\"" {
+		t.Fatalf("escaped %q", got)
+	}
+}
+
+func TestMarkInvisibleChanges_Lookalike(t *testing.T) {
+	rows, _ := ParseHunks("@@ -1,2 +1,2 @@\n-if user.isAdmin {\n+if user.is\u0410dmin {\n-ΤΟΚΕΝ = 1\n+TOKEN = 1\n")
+	if count := MarkInvisibleChanges(rows); count != 2 {
+		t.Fatalf("expected 2 flagged rows, got %d", count)
+	}
+	row := rows[1]
+	if row.InvisibleOld != nil || len(row.InvisibleNew) != 1 || row.InvisibleNew[0] != (Range{Start: 10, End: 12}) {
+		t.Fatalf("expected the Cyrillic А flagged, got %+v", row)
+	}
+	if got := EscapeLookalike(row.New); got != "if user.is<U+0410>dmin {" {
+		t.Fatalf("escaped %q", got)
+	}
+	if got := len(rows[2].InvisibleOld); got != 5 || len(rows[2].InvisibleNew) != 0 {
+		t.Fatalf("expected the five Greek capitals flagged, got %+v", rows[2])
+	}
+	// Text in Cyrillic is left alone when the edit shows.
+	rows, _ = ParseHunks("@@ -1 +1 @@\n-привет\n+пока\n")
+	if count := MarkInvisibleChanges(rows); count != 0 {
+		t.Fatalf("expected no flagged rows, got %d", count)
+	}
+}
+
+func TestMarkInvisibleChanges_NBSP(t *testing.T) {
+	rows, _ := ParseHunks("@@ -1 +1 @@\n-if a && b {\n+if a &&\u00a0b {\n")
+	if count := MarkInvisibleChanges(rows); count != 1 {
+		t.Fatalf("expected 1 flagged row, got %d", count)
+	}
+	row := rows[1]
+	if row.InvisibleOld != nil || len(row.InvisibleNew) != 1 || row.InvisibleNew[0] != (Range{Start: 7, End: 9}) {
+		t.Fatalf("expected the no-break space flagged, got %+v", row)
+	}
+	// A no-break space next to a visible edit is not worth a warning.
+	rows, _ = ParseHunks("@@ -1 +1 @@\n-if a && b {\n+if a ||\u00a0b {\n")
+	if count := MarkInvisibleChanges(rows); count != 0 {
+		t.Fatalf("expected no flagged rows, got %d", count)
+	}
+}
+
+func TestParseWhitespaceRule_AppliesCoreWhitespace(t *testing.T) {
+	rule := ParseWhitespaceRule("-space-before-tab,tab-in-indent,cr-at-eol,tabwidth=4")
+	if rule.SpaceBeforeTab || !rule.TabInIndent || !rule.CRAtEOL || !rule.BlankAtEOL || rule.TabWidth != 4 {
+		t.Fatalf("unexpected rule %+v", rule)
+	}
+	if got := WhitespaceErrors("\tx\r", rule); len(got) != 1 || got[0] != (Range{Start: 0, End: 1}) {
+		t.Fatalf("expected only the tab indent flagged, got %+v", got)
+	}
+	if got := WhitespaceErrors("    x", ParseWhitespaceRule("indent-with-non-tab,tabwidth=4")); len(got) != 1 || got[0] != (Range{Start: 0, End: 4}) {
+		t.Fatalf("expected space indent flagged, got %+v", got)
+	}
+}
+
+func TestParseHunks_DetectsLineEndingOnlyChanges(t *testing.T) {
+	input := "@@ -1,3 +1,3 @@\n keep\r\n-a\n-b\n+a\r\n+b\r\n"
+	rows, hunks := ParseHunks(input)
+
+	// rows: 0 summary, 1 header, 2 keep, 3 a, 4 b
+	if len(rows) != 5 || rows[0].Kind != Meta || rows[0].Old != "line endings changed LF→CRLF on 2 lines" {
+		t.Fatalf("expected a line ending summary row first, got %+v", rows)
+	}
+	if hunks[0].RowStart != 1 || hunks[0].RowEnd != 5 {
+		t.Fatalf("expected hunk shifted past the summary, got %+v", hunks[0])
+	}
+	if rows[2].Old != "keep" || !rows[2].CRLFOld || !rows[2].CRLFNew || LineEndingChanged(rows[2]) {
+		t.Fatalf("expected CRLF context row without a change, got %+v", rows[2])
+	}
+	for _, row := range rows[3:] {
+		if !LineEndingChanged(row) || row.CRLFOld || !row.CRLFNew {
+			t.Fatalf("expected LF→CRLF row, got %+v", row)
+		}
+	}
+}
+
+func TestParseHunks_NormalizesFullyConvertedOutput(t *testing.T) {
+	rows, _ := ParseHunks("@@ -1 +1 @@\r\n-a\r\n+b\r\n")
+	for _, row := range rows {
+		if row.CRLFOld || row.CRLFNew {
+			t.Fatalf("expected CRLF transport to be undone, got %+v", row)
+		}
+	}
+}
+
+func TestEscapeControl_MakesControlCharactersVisible(t *testing.T) {
+	cases := map[string]string{
+		"plain\ttext":        "plain\ttext",
+		"\x1b[31mred\x1b[0m": "^[[31mred^[[0m",
+		"bell\a del\x7f":     "bell^G del^?",
+		"c1 \u009b1m":        "c1 <U+009B>1m",
+		"héllo":              "héllo",
+	}
+	for input, want := range cases {
+		if got := EscapeControl(input); got != want {
+			t.Fatalf("EscapeControl(%q) = %q, want %q", input, got, want)
+		}
+	}
+
+	rows, _ := ParseHunks("@@ -1 +1 @@\n-\x1b[1mold\n+new\n")
+	if rows[1].Old != "\x1b[1mold" {
+		t.Fatalf("expected raw text kept in row, got %q", rows[1].Old)
+	}
+}
+
+func TestChangeStarts_SkipsContextBetweenRuns(t *testing.T) {
+	input := "@@ -1,6 +1,6 @@\n a\n-b\n+B\n c\n d\n-e\n f\n"
+	rows, _ := ParseHunks(input)
+
+	// rows: 0 header, 1 a, 2 -b, 3 +B, 4 c, 5 d, 6 -e, 7 f
+	got := ChangeStarts(rows)
+	if len(got) != 2 || got[0] != 2 || got[1] != 6 {
+		t.Fatalf("expected change runs at [2 6], got %v", got)
+	}
+	if IsChange(rows[0]) || IsChange(rows[1]) {
+		t.Fatalf("expected header and context rows not to count as changes")
+	}
+}
+
 func contentRows(rows []Row) []Row {
 	out := make([]Row, 0, len(rows))
 	for _, row := range rows {
-		if row.Kind == Meta || row.Kind == Hunk {
+		if row.Kind == Meta || row.Kind == HunkHeader {
 			continue
 		}
 		out = append(out, row)
@@ -119,3 +504,90 @@ func assertAddition(t *testing.T, row Row, newText string) {
 		t.Fatalf("expected Add kind, got %v", row.Kind)
 	}
 }
+
+func TestParseHunks_FlagsAddedConflictMarkers(t *testing.T) {
+	input := "@@ -1 +1,6 @@\n a\n+<<<<<<< HEAD\n+ours\n+=======\n+theirs\n+>>>>>>> topic\n-<<<<<<< old\n"
+	rows, _ := ParseHunks(input)
+	var flagged []string
+	for _, row := range rows {
+		if row.ConflictMarker {
+			flagged = append(flagged, row.New)
+		}
+	}
+	if got := strings.Join(flagged, "|"); got != "<<<<<<< HEAD|=======|>>>>>>> topic" {
+		t.Fatalf("flagged %q", got)
+	}
+	for _, line := range []string{"<<<<<<<", "|||||||\tbase", "======="} {
+		if !IsConflictMarker(line) {
+			t.Errorf("%q is a marker", line)
+		}
+	}
+	for _, line := range []string{"<<<<<<", "========", "<<<<<<<x", "=== heading"} {
+		if IsConflictMarker(line) {
+			t.Errorf("%q is not a marker", line)
+		}
+	}
+}
+
+func TestCountConflictRegions(t *testing.T) {
+	content := "<<<<<<< HEAD\r\nX\r\n=======\r\nA\r\n>>>>>>> other\r\nb\n<<<<<<< HEAD\nY\n|||||||\n=======\nG\n>>>>>>> other\n<<<<<< nope\n"
+	if got := CountConflictRegions(content); got != 2 {
+		t.Fatalf("regions %d, want 2", got)
+	}
+	if got := CountConflictRegions("clean\n"); got != 0 {
+		t.Fatalf("regions %d in a clean file", got)
+	}
+}
+
+func TestParseMerge_ResolvesAndWritesBack(t *testing.T) {
+	text := "a\n<<<<<<< LOCAL\nours\n||||||| BASE\nbase\n=======\ntheirs\nmore\n>>>>>>> REMOTE\nz"
+	merge := ParseMerge(text)
+	if len(merge.Chunks) != 3 || merge.Conflicts() != 1 || !merge.NoNewline {
+		t.Fatalf("chunks %+v", merge.Chunks)
+	}
+	if got := merge.Text(); got != text {
+		t.Fatalf("unresolved text %q, want the markers back", got)
+	}
+	rows, hunks := merge.Rows()
+	if len(hunks) != 1 || rows[hunks[0].RowStart].Kind != HunkHeader || rows[1].New != "@@ conflict 1/1: unresolved; BASE→LOCAL +1 -1, BASE→REMOTE +2 -1 @@" {
+		t.Fatalf("rows %+v hunks %+v", rows, hunks)
+	}
+	if end := hunks[0].RowEnd; end != 5 || rows[end-1].Old != "" || rows[end-1].New != "more" || rows[end].New != "z" || *rows[end].OldNo != 3 || *rows[end].NewNo != 4 {
+		t.Fatalf("conflict rows %+v", rows)
+	}
+
+	conflict := merge.Conflict(0)
+	conflict.Resolve(append(append([]string(nil), conflict.Ours...), conflict.Theirs...))
+	if merge.Unresolved() != 0 || merge.Text() != "a\nours\ntheirs\nmore\nz" {
+		t.Fatalf("resolved text %q", merge.Text())
+	}
+	if rows, _ := merge.Rows(); rows[1].Old != "@@ conflict 1/1: took both @@" {
+		t.Fatalf("header %q", rows[1].Old)
+	}
+	if merge.Conflict(1) != nil {
+		t.Fatal("found a second conflict")
+	}
+}
+
+func TestMergeRows_MarkLinesEachSideKeptFromBase(t *testing.T) {
+	text := "<<<<<<< LOCAL\nkeep\nlocal edit\n||||||| BASE\nkeep\nbase line\n=======\nremote edit\nbase line\n>>>>>>> REMOTE\n"
+	rows, _ := ParseMerge(text).Rows()
+	if rows[0].Old != "@@ conflict 1/1: unresolved; BASE→LOCAL +1 -1, BASE→REMOTE +1 -1 @@" {
+		t.Fatalf("header %q", rows[0].Old)
+	}
+	kept := map[string]bool{}
+	for _, row := range rows[1:] {
+		if row.OldNo != nil {
+			kept["LOCAL "+row.Old] = row.BaseOld
+		}
+		if row.NewNo != nil {
+			kept["REMOTE "+row.New] = row.BaseNew
+		}
+	}
+	want := map[string]bool{"LOCAL keep": true, "LOCAL local edit": false, "REMOTE remote edit": false, "REMOTE base line": true}
+	for line, base := range want {
+		if got, ok := kept[line]; !ok || got != base {
+			t.Errorf("%s: kept from BASE %v (shown %v), want %v", line, got, ok, base)
+		}
+	}
+}
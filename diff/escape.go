@@ -0,0 +1,43 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EscapeControl makes control characters in s visible so they cannot move the
+// cursor or restyle the terminal: C0 controls and DEL use caret notation (ESC
+// becomes "^[", so an embedded CSI sequence shows up as plain "^[[31m"), and
+// C1 controls are written as "<U+009B>". Tabs are left alone. Callers escape
+// at render time so Row text stays raw for patches and copies.
+func EscapeControl(s string) string {
+	idx := strings.IndexFunc(s, isControl)
+	if idx < 0 {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	b.WriteString(s[:idx])
+	for _, r := range s[idx:] {
+		switch {
+		case !isControl(r):
+			b.WriteRune(r)
+		case r == 0x7f:
+			b.WriteString("^?")
+		case r < 0x20:
+			b.WriteByte('^')
+			b.WriteByte(byte(r) + '@')
+		default:
+			fmt.Fprintf(&b, "<U+%04X>", r)
+		}
+	}
+	return b.String()
+}
+
+func isControl(r rune) bool {
+	if r == '\t' {
+		return false
+	}
+	return r < 0x20 || r == 0x7f || (r >= 0x80 && r <= 0x9f)
+}
@@ -0,0 +1,79 @@
+package diff
+
+import "strings"
+
+// FullFileRows expands a parsed diff to the whole new version of the file.
+// Lines outside the hunks become context rows, hunk rows are kept as parsed
+// (so deletions stay interleaved at their original positions), and the
+// returned hunks point at each changed region so hunk navigation still works.
+// Leading meta rows such as a mode change are kept at the top.
+func FullFileRows(newContent string, rows []Row, hunks []Hunk) ([]Row, []Hunk) {
+	newContent = strings.ReplaceAll(newContent, "\r\n", "\n")
+	var lines []string
+	if newContent != "" {
+		lines = strings.Split(strings.TrimSuffix(newContent, "\n"), "\n")
+	}
+
+	out := make([]Row, 0, len(lines)+len(rows))
+	outHunks := make([]Hunk, 0, len(hunks))
+	for i := range rows {
+		if len(hunks) > 0 && i >= hunks[0].RowStart {
+			break
+		}
+		if rows[i].Kind == Meta || rows[i].Kind == HiddenMeta {
+			out = append(out, rows[i])
+		}
+	}
+
+	oldPos, newPos := 1, 1
+	emitContext := func(until int) {
+		for ; newPos < until && newPos <= len(lines); newPos++ {
+			text := lines[newPos-1]
+			out = append(out, Row{OldNo: intPtr(oldPos), NewNo: intPtr(newPos), Old: text, New: text, Kind: Context})
+			oldPos++
+		}
+	}
+
+	for _, hunk := range hunks {
+		emitContext(firstLine(hunk.NewStart, hunk.NewLines))
+		oldPos = firstLine(hunk.OldStart, hunk.OldLines)
+
+		region := hunk
+		region.RowStart = len(out)
+		end := hunk.RowEnd
+		if end > len(rows) {
+			end = len(rows)
+		}
+		for i := hunk.RowStart; i < end; i++ {
+			if rows[i].Kind == HunkHeader || rows[i].Kind == Meta {
+				continue
+			}
+			out = append(out, rows[i])
+		}
+		region.RowEnd = len(out)
+		if region.RowEnd > region.RowStart {
+			outHunks = append(outHunks, region)
+		}
+
+		oldPos = firstLine(hunk.OldStart, hunk.OldLines) + hunk.OldLines
+		newPos = firstLine(hunk.NewStart, hunk.NewLines) + hunk.NewLines
+	}
+	emitContext(len(lines) + 1)
+	if len(lines) > 0 && !strings.HasSuffix(newContent, "\n") && len(out) > 0 {
+		last := &out[len(out)-1]
+		if last.NewNo != nil && *last.NewNo == len(lines) && last.Kind == Context && last.Old == last.New {
+			last.NoNewlineOld = true
+			last.NoNewlineNew = true
+		}
+	}
+	return out, outHunks
+}
+
+// firstLine converts a hunk range start to the first line it covers; ranges
+// with a zero count name the line before the change.
+func firstLine(start, count int) int {
+	if count == 0 {
+		return start + 1
+	}
+	return start
+}
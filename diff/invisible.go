@@ -0,0 +1,162 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// IsInvisible reports whether r draws as nothing, or as a plain space, in a
+// terminal: the byte order mark, zero-width spaces and joiners, the soft
+// hyphen, line and paragraph separators, bidirectional controls and the
+// no-break space.
+func IsInvisible(r rune) bool {
+	switch {
+	case r == 0x00a0, r == 0x00ad, r == 0x061c, r == 0x180e, r == 0xfeff:
+		return true
+	case r >= 0x200b && r <= 0x200f:
+		return true
+	case r >= 0x2028 && r <= 0x202e:
+		return true
+	case r >= 0x2060 && r <= 0x2064:
+		return true
+	case r >= 0x2066 && r <= 0x2069:
+		return true
+	}
+	return false
+}
+
+// lookalikes are the Cyrillic and Greek letters most fonts draw the same as
+// an ASCII letter, with the letter each passes for.
+var lookalikes = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j',
+	'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'ԝ': 'w', 'х': 'x', 'у': 'y',
+	'А': 'A', 'В': 'B', 'С': 'C', 'Е': 'E', 'Н': 'H', 'І': 'I', 'Ј': 'J',
+	'К': 'K', 'М': 'M', 'О': 'O', 'Р': 'P', 'Ѕ': 'S', 'Т': 'T', 'Х': 'X',
+	// Greek
+	'ο': 'o', 'ν': 'v',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K',
+	'Μ': 'M', 'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+}
+
+// IsLookalike reports whether r is a Cyrillic or Greek letter drawn like an
+// ASCII one, such as Cyrillic а for a.
+func IsLookalike(r rune) bool {
+	_, ok := lookalikes[r]
+	return ok
+}
+
+// EscapeInvisible writes each invisible character in s as its codepoint, e.g.
+// "<U+200B>", the way EscapeControl writes C1 controls.
+func EscapeInvisible(s string) string {
+	return escapeRunes(s, IsInvisible)
+}
+
+// EscapeLookalike writes each invisible character and each lookalike letter
+// in s as its codepoint, for the characters MarkInvisibleChanges records.
+func EscapeLookalike(s string) string {
+	return escapeRunes(s, hidesChange)
+}
+
+func escapeRunes(s string, escape func(rune) bool) string {
+	idx := strings.IndexFunc(s, escape)
+	if idx < 0 {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	b.WriteString(s[:idx])
+	for _, r := range s[idx:] {
+		if escape(r) {
+			fmt.Fprintf(&b, "<U+%04X>", r)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// hidesChange reports whether r can make two lines differ without looking it.
+func hidesChange(r rune) bool {
+	return IsInvisible(r) || IsLookalike(r)
+}
+
+// visibleText is line as a terminal shows it: no-break spaces read as spaces,
+// lookalike letters as the ASCII ones they pass for, and the other invisible
+// characters are gone.
+func visibleText(line string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == 0x00a0:
+			return ' '
+		case IsInvisible(r):
+			return -1
+		}
+		if ascii, ok := lookalikes[r]; ok {
+			return ascii
+		}
+		return r
+	}, line)
+}
+
+// MarkInvisibleChanges flags the edit pairs in rows whose two lines look the
+// same but are not, recording on each side the invisible characters and
+// lookalike letters between the bytes the lines share at either end. It
+// returns how many rows it flagged.
+func MarkInvisibleChanges(rows []Row) int {
+	count := 0
+	for i := range rows {
+		row := &rows[i]
+		row.InvisibleChange, row.InvisibleOld, row.InvisibleNew = false, nil, nil
+		if (row.Kind != Add && row.Kind != Context) || row.OldNo == nil || row.NewNo == nil || row.Old == row.New {
+			continue
+		}
+		if visibleText(row.Old) != visibleText(row.New) {
+			continue
+		}
+		start, oldEnd, newEnd := changedSpan(row.Old, row.New)
+		row.InvisibleChange = true
+		row.InvisibleOld = invisibleRanges(row.Old, start, oldEnd)
+		row.InvisibleNew = invisibleRanges(row.New, start, newEnd)
+		count++
+	}
+	return count
+}
+
+// changedSpan finds where old and new stop sharing bytes from the front and
+// from the back, keeping whole runes on both sides: old[start:oldEnd] was
+// replaced by new[start:newEnd].
+func changedSpan(old, new string) (start, oldEnd, newEnd int) {
+	for start < len(old) && start < len(new) {
+		r, size := utf8.DecodeRuneInString(old[start:])
+		if !strings.HasPrefix(new[start:], string(r)) {
+			break
+		}
+		start += size
+	}
+	oldEnd, newEnd = len(old), len(new)
+	for oldEnd > start && newEnd > start {
+		r, size := utf8.DecodeLastRuneInString(old[start:oldEnd])
+		if !strings.HasSuffix(new[start:newEnd], string(r)) {
+			break
+		}
+		oldEnd -= size
+		newEnd -= size
+	}
+	return start, oldEnd, newEnd
+}
+
+// invisibleRanges returns the byte ranges of the invisible characters and
+// lookalike letters in line[start:end].
+func invisibleRanges(line string, start, end int) []Range {
+	var ranges []Range
+	for i, r := range line[start:end] {
+		if hidesChange(r) {
+			at := start + i
+			ranges = append(ranges, Range{Start: at, End: at + utf8.RuneLen(r)})
+		}
+	}
+	return ranges
+}
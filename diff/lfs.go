@@ -0,0 +1,104 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+)
+
+const lfsVersionPrefix = "version https://git-lfs."
+
+// LFSPointer is the parsed content of a Git LFS pointer file.
+type LFSPointer struct {
+	OID  string
+	Size int64
+	// Text is the pointer file content, suitable for `git lfs smudge`.
+	Text string
+}
+
+// LFSChange describes a diff between two LFS pointers. A side is nil when that
+// version of the file does not exist.
+type LFSChange struct {
+	Old *LFSPointer
+	New *LFSPointer
+}
+
+// DetectLFSChange reports whether rows are the diff of an LFS pointer file. Each
+// side that has content must parse as a pointer, and at least one side must
+// exist.
+func DetectLFSChange(rows []Row) (LFSChange, bool) {
+	var oldLines, newLines []string
+	for _, row := range rows {
+		if row.Kind == Meta || row.Kind == HiddenMeta || row.Kind == HunkHeader {
+			continue
+		}
+		if row.OldNo != nil {
+			oldLines = append(oldLines, row.Old)
+		}
+		if row.NewNo != nil {
+			newLines = append(newLines, row.New)
+		}
+	}
+
+	var change LFSChange
+	if len(oldLines) > 0 {
+		pointer, ok := parseLFSPointer(oldLines)
+		if !ok {
+			return LFSChange{}, false
+		}
+		change.Old = pointer
+	}
+	if len(newLines) > 0 {
+		pointer, ok := parseLFSPointer(newLines)
+		if !ok {
+			return LFSChange{}, false
+		}
+		change.New = pointer
+	}
+	if change.Old == nil && change.New == nil {
+		return LFSChange{}, false
+	}
+	return change, true
+}
+
+func parseLFSPointer(lines []string) (*LFSPointer, bool) {
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], lfsVersionPrefix) {
+		return nil, false
+	}
+
+	pointer := &LFSPointer{Text: strings.Join(lines, "\n") + "\n"}
+	hasSize := false
+	for _, line := range lines[1:] {
+		key, value, found := strings.Cut(line, " ")
+		if !found {
+			return nil, false
+		}
+		switch key {
+		case "oid":
+			pointer.OID = value
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, false
+			}
+			pointer.Size = size
+			hasSize = true
+		}
+	}
+	if pointer.OID == "" || !hasSize {
+		return nil, false
+	}
+	return pointer, true
+}
+
+// ShortOID abbreviates an LFS oid such as "sha256:ab12cd…" to its first hex
+// characters.
+func (p LFSPointer) ShortOID() string {
+	oid := p.OID
+	if idx := strings.Index(oid, ":"); idx >= 0 {
+		oid = oid[idx+1:]
+	}
+	if len(oid) > 4 {
+		return oid[:4] + "…"
+	}
+	return oid
+}
@@ -0,0 +1,285 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Merge is a three-way merge as git merge-file --diff3 writes it: the
+// stretches both sides agree on, or that only one side changed, and the
+// conflicts between them.
+type Merge struct {
+	Chunks []MergeChunk
+	// NoNewline reports that the merged text does not end in a newline.
+	NoNewline bool
+}
+
+// MergeChunk is a stretch of merged lines, or a conflict with each side's
+// lines and the markers around them. A conflict is Resolved once Result is
+// chosen for it.
+type MergeChunk struct {
+	Lines []string
+
+	Conflict           bool
+	Ours, Base, Theirs []string
+	// Markers are the conflict's marker lines as the merge wrote them, to
+	// write back while it is unresolved: <<<<<<<, |||||||, ======= and >>>>>>>.
+	Markers  [4]string
+	Resolved bool
+	Result   []string
+}
+
+// ParseMerge splits merged text with diff3-style conflict markers into
+// chunks. A conflict left open at the end of the text is kept as merged lines.
+func ParseMerge(text string) Merge {
+	var merge Merge
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if text == "" {
+		return merge
+	}
+	merge.NoNewline = !strings.HasSuffix(text, "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+
+	var clean []string
+	flush := func() {
+		if len(clean) > 0 {
+			merge.Chunks = append(merge.Chunks, MergeChunk{Lines: clean})
+			clean = nil
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		if !isMarker(lines[i], '<') {
+			clean = append(clean, lines[i])
+			continue
+		}
+		chunk, next, ok := parseConflict(lines, i)
+		if !ok {
+			clean = append(clean, lines[i:]...)
+			break
+		}
+		flush()
+		merge.Chunks = append(merge.Chunks, chunk)
+		i = next
+	}
+	flush()
+	return merge
+}
+
+// parseConflict reads the conflict whose <<<<<<< marker is lines[start],
+// returning the index of its >>>>>>> marker.
+func parseConflict(lines []string, start int) (MergeChunk, int, bool) {
+	chunk := MergeChunk{Conflict: true}
+	chunk.Markers[0] = lines[start]
+	side := &chunk.Ours
+	for i := start + 1; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case side == &chunk.Ours && isMarker(line, '|'):
+			chunk.Markers[1] = line
+			side = &chunk.Base
+		case side != &chunk.Theirs && isMarker(line, '='):
+			chunk.Markers[2] = line
+			side = &chunk.Theirs
+		case side == &chunk.Theirs && isMarker(line, '>'):
+			chunk.Markers[3] = line
+			return chunk, i, true
+		default:
+			*side = append(*side, line)
+		}
+	}
+	return MergeChunk{}, 0, false
+}
+
+func isMarker(line string, c byte) bool {
+	return len(line) > 0 && line[0] == c && IsConflictMarker(line)
+}
+
+// Conflicts counts the merge's conflicts, and Unresolved those still open.
+func (m Merge) Conflicts() int {
+	n := 0
+	for _, chunk := range m.Chunks {
+		if chunk.Conflict {
+			n++
+		}
+	}
+	return n
+}
+
+func (m Merge) Unresolved() int {
+	n := 0
+	for _, chunk := range m.Chunks {
+		if chunk.Conflict && !chunk.Resolved {
+			n++
+		}
+	}
+	return n
+}
+
+// Conflict is the chunk of the merge's conflict n, counting from zero.
+func (m Merge) Conflict(n int) *MergeChunk {
+	for i := range m.Chunks {
+		if !m.Chunks[i].Conflict {
+			continue
+		}
+		if n == 0 {
+			return &m.Chunks[i]
+		}
+		n--
+	}
+	return nil
+}
+
+// Resolve settles the conflict with result.
+func (c *MergeChunk) Resolve(result []string) {
+	c.Resolved = true
+	c.Result = append([]string(nil), result...)
+}
+
+// Text is the merged file: each resolved conflict replaced by its result
+// and the open ones written back with their markers.
+func (m Merge) Text() string {
+	var b strings.Builder
+	for _, chunk := range m.Chunks {
+		for _, line := range chunk.text() {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	text := b.String()
+	if m.NoNewline {
+		text = strings.TrimSuffix(text, "\n")
+	}
+	return text
+}
+
+func (c MergeChunk) text() []string {
+	switch {
+	case !c.Conflict:
+		return c.Lines
+	case c.Resolved:
+		return c.Result
+	}
+	lines := append([]string{c.Markers[0]}, c.Ours...)
+	if c.Markers[1] != "" {
+		lines = append(append(lines, c.Markers[1]), c.Base...)
+	}
+	lines = append(append(lines, c.Markers[2]), c.Theirs...)
+	return append(lines, c.Markers[3])
+}
+
+// Rows lays the merge out for the panes: merged lines as context on both
+// sides, and each conflict as a hunk under a header saying how it stands,
+// with our lines on the OLD side and theirs on the NEW side, paired up as a
+// diff pairs edits. Each side is diffed against BASE: the lines it kept are
+// marked BaseOld or BaseNew, and the header of an open conflict counts
+// what each side changed.
+func (m Merge) Rows() ([]Row, []Hunk) {
+	var rows []Row
+	var hunks []Hunk
+	oldNo, newNo := 1, 1
+	total, n := m.Conflicts(), 0
+	for _, chunk := range m.Chunks {
+		if !chunk.Conflict {
+			for _, line := range chunk.Lines {
+				rows = append(rows, Row{OldNo: intPtr(oldNo), NewNo: intPtr(newNo), Old: line, New: line, Kind: Context})
+				oldNo++
+				newNo++
+			}
+			continue
+		}
+		n++
+		ours, oursAdded, oursRemoved := chunk.fromBase(chunk.Ours)
+		theirs, theirsAdded, theirsRemoved := chunk.fromBase(chunk.Theirs)
+		state := chunk.state()
+		if !chunk.Resolved && chunk.hasBase() {
+			state += fmt.Sprintf("; BASE→LOCAL +%d -%d, BASE→REMOTE +%d -%d", oursAdded, oursRemoved, theirsAdded, theirsRemoved)
+		}
+		header := fmt.Sprintf("@@ conflict %d/%d: %s @@", n, total, state)
+		hunk := Hunk{OldStart: oldNo, OldLines: len(chunk.Ours), NewStart: newNo, NewLines: len(chunk.Theirs), Header: header, RowStart: len(rows)}
+		rows = append(rows, Row{Old: header, New: header, Kind: HunkHeader})
+		for _, pair := range alignEditRows(chunk.Ours, chunk.Theirs) {
+			row := Row{Kind: Add}
+			if pair.delIdx >= 0 {
+				row.OldNo, row.Old = intPtr(oldNo+pair.delIdx), chunk.Ours[pair.delIdx]
+				row.BaseOld = ours[pair.delIdx]
+			}
+			if pair.addIdx >= 0 {
+				row.NewNo, row.New = intPtr(newNo+pair.addIdx), chunk.Theirs[pair.addIdx]
+				row.BaseNew = theirs[pair.addIdx]
+			}
+			switch {
+			case row.NewNo == nil:
+				row.Kind = Del
+			case row.OldNo != nil && row.Old == row.New:
+				row.Kind = Context
+			}
+			rows = append(rows, row)
+		}
+		oldNo += len(chunk.Ours)
+		newNo += len(chunk.Theirs)
+		hunk.RowEnd = len(rows)
+		hunks = append(hunks, hunk)
+	}
+	return rows, hunks
+}
+
+// hasBase reports whether the conflict came with BASE's lines, as diff3
+// markers give them.
+func (c MergeChunk) hasBase() bool {
+	return c.Markers[1] != ""
+}
+
+// fromBase diffs BASE's lines against side's, returning which of side's
+// lines BASE already had and how many side added and removed. Conflicts too
+// long to compare line by line count as rewritten.
+func (c MergeChunk) fromBase(side []string) (kept []bool, added, removed int) {
+	kept = make([]bool, len(side))
+	if !c.hasBase() {
+		return kept, 0, 0
+	}
+	if len(c.Base)*len(side) > editPairComparisonLimit {
+		return kept, len(side), len(c.Base)
+	}
+	i := 0
+	for _, op := range DiffTokens(c.Base, side) {
+		switch op.Kind {
+		case Equal:
+			kept[i] = true
+			i++
+		case Insert:
+			added++
+			i++
+		case Delete:
+			removed++
+		}
+	}
+	return kept, added, removed
+}
+
+// state says how a conflict stands, for its header.
+func (c MergeChunk) state() string {
+	if !c.Resolved {
+		return "unresolved"
+	}
+	switch {
+	case equalLines(c.Result, c.Ours):
+		return "took LOCAL"
+	case equalLines(c.Result, c.Theirs):
+		return "took REMOTE"
+	case equalLines(c.Result, append(append([]string(nil), c.Ours...), c.Theirs...)):
+		return "took both"
+	}
+	return fmt.Sprintf("edited, %d %s", len(c.Result), pluralLines(len(c.Result)))
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
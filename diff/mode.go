@@ -0,0 +1,135 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ModeChange is a file permission change reported by git's "old mode" and
+// "new mode" header lines, e.g. 100644 -> 100755.
+type ModeChange struct {
+	Old string
+	New string
+}
+
+// ParseModeChange extracts the mode change from a single file's raw diff.
+func ParseModeChange(input string) (ModeChange, bool) {
+	var change ModeChange
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "old mode "):
+			change.Old = strings.TrimPrefix(line, "old mode ")
+		case strings.HasPrefix(line, "new mode "):
+			change.New = strings.TrimPrefix(line, "new mode ")
+		case strings.HasPrefix(line, "@@ "):
+			return change, change.Old != "" && change.New != ""
+		}
+	}
+	return change, change.Old != "" && change.New != ""
+}
+
+// TypeChange is a path that became another kind of file, such as a regular
+// file replaced by a symlink. git diffs it as the old file deleted and the
+// new one added, each under its own diff --git header. Targets are the
+// symlink targets of symlink sides.
+type TypeChange struct {
+	Old, New             string
+	OldTarget, NewTarget string
+}
+
+// ParseTypeChange extracts the type change from a single file's raw diff.
+func ParseTypeChange(input string) (TypeChange, bool) {
+	var change TypeChange
+	side := ""
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "deleted file mode "):
+			change.Old, side = strings.TrimPrefix(line, "deleted file mode "), "old"
+		case strings.HasPrefix(line, "new file mode "):
+			change.New, side = strings.TrimPrefix(line, "new file mode "), "new"
+		case strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ "):
+		case side == "old" && change.Old == "120000" && strings.HasPrefix(line, "-"):
+			change.OldTarget = line[1:]
+		case side == "new" && change.New == "120000" && strings.HasPrefix(line, "+"):
+			change.NewTarget = line[1:]
+		}
+	}
+	return change, change.Old != "" && change.New != ""
+}
+
+// Summary renders the change as "type changed: regular file → symlink to
+// ../foo".
+func (c TypeChange) Summary() string {
+	return "type changed: " + fileType(c.Old, c.OldTarget) + " → " + fileType(c.New, c.NewTarget)
+}
+
+func fileType(mode, target string) string {
+	switch mode {
+	case "120000":
+		if target == "" {
+			return "symlink"
+		}
+		return "symlink to " + target
+	case "160000":
+		return "submodule"
+	}
+	return "regular file"
+}
+
+// Summary renders the change as "mode changed: rw-r--r-- → rwxr-xr-x (+x)".
+func (c ModeChange) Summary() string {
+	text := "mode changed: " + PermissionString(c.Old) + " → " + PermissionString(c.New)
+	if hint := c.ExecHint(); hint != "" {
+		text += " (" + hint + ")"
+	}
+	return text
+}
+
+// ExecHint returns "+x" or "-x" when the change toggles the executable bit.
+func (c ModeChange) ExecHint() string {
+	oldExec, okOld := execBit(c.Old)
+	newExec, okNew := execBit(c.New)
+	if !okOld || !okNew || oldExec == newExec {
+		return ""
+	}
+	if newExec {
+		return "+x"
+	}
+	return "-x"
+}
+
+// PermissionString renders a git file mode like 100755 as "rwxr-xr-x". Modes
+// that are not regular files are named instead.
+func PermissionString(mode string) string {
+	switch mode {
+	case "120000":
+		return "symlink"
+	case "160000":
+		return "submodule"
+	}
+	bits, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return mode
+	}
+
+	const letters = "rwxrwxrwx"
+	var b strings.Builder
+	for i := 0; i < 9; i++ {
+		if bits&(1<<uint(8-i)) != 0 {
+			b.WriteByte(letters[i])
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+func execBit(mode string) (bool, bool) {
+	bits, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return false, false
+	}
+	return bits&0o100 != 0, true
+}
@@ -0,0 +1,226 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RowRange selects rows by index; End is exclusive.
+type RowRange struct {
+	Start int
+	End   int
+}
+
+// Range returns the rows covered by the hunk, header included.
+func (h Hunk) Range() RowRange {
+	return RowRange{Start: h.RowStart, End: h.RowEnd}
+}
+
+func (r RowRange) contains(idx int) bool {
+	return idx >= r.Start && idx < r.End
+}
+
+// ErrEmptySelection is returned by BuildPatch when the selection holds no
+// added or deleted lines.
+var ErrEmptySelection = errors.New("selection contains no changes")
+
+const noNewlineMarker = `\ No newline at end of file`
+
+// BuildPatch reconstructs a unified patch for filePath containing only the
+// changes inside selection. Unselected deletions are kept as context and
+// unselected additions are dropped, so the result applies to the old side of
+// the diff. Hunk line counts are recomputed for what was kept.
+func BuildPatch(filePath string, hunks []Hunk, rows []Row, selection RowRange) (string, error) {
+	var body strings.Builder
+	offset := 0
+	newFile := hasMetaPrefix(rows, "new file mode ")
+	deletedFile := hasMetaPrefix(rows, "deleted file mode ")
+	emitted := 0
+	keptNew := 0
+
+	for _, hunk := range hunks {
+		lines, oldCount, newCount, changed := buildHunkLines(hunk, rows, selection)
+		if !changed {
+			continue
+		}
+
+		newStart := patchNewStart(hunk.OldStart, oldCount, newCount, offset)
+		fmt.Fprintf(&body, "@@ -%s +%s @@", formatHunkRange(hunk.OldStart, oldCount), formatHunkRange(newStart, newCount))
+		if hunk.FuncContext != "" {
+			body.WriteString(" " + hunk.FuncContext)
+		}
+		body.WriteString("\n")
+		for _, line := range lines {
+			body.WriteString(line)
+			body.WriteString("\n")
+		}
+
+		keptNew += newCount
+		offset += newCount - oldCount
+		emitted++
+	}
+	if emitted == 0 {
+		return "", ErrEmptySelection
+	}
+
+	oldName := "a/" + filePath
+	newName := "b/" + filePath
+	if newFile {
+		oldName = "/dev/null"
+	}
+	if deletedFile && keptNew == 0 {
+		// Only a selection that removes every line deletes the file outright.
+		newName = "/dev/null"
+	}
+	return "--- " + oldName + "\n+++ " + newName + "\n" + body.String(), nil
+}
+
+// buildHunkLines renders the body lines of one hunk restricted to selection and
+// reports the old/new line counts and whether any change survived.
+func buildHunkLines(hunk Hunk, rows []Row, selection RowRange) ([]string, int, int, bool) {
+	lines := make([]string, 0, hunk.RowEnd-hunk.RowStart)
+	dels := make([]string, 0, 8)
+	adds := make([]string, 0, 8)
+	oldCount, newCount := 0, 0
+	changed := false
+
+	flush := func() {
+		lines = append(lines, dels...)
+		lines = append(lines, adds...)
+		dels = dels[:0]
+		adds = adds[:0]
+	}
+	context := func(text string, crlf, noNewline bool) {
+		flush()
+		lines = append(lines, " "+text+lineEnding(crlf))
+		if noNewline {
+			lines = append(lines, noNewlineMarker)
+		}
+		oldCount++
+		newCount++
+	}
+
+	end := hunk.RowEnd
+	if end > len(rows) {
+		end = len(rows)
+	}
+	for idx := hunk.RowStart; idx < end; idx++ {
+		row := rows[idx]
+		if row.Kind == HunkHeader || row.Kind == Meta {
+			continue
+		}
+		if isContextRow(row) {
+			context(row.Old, row.CRLFOld, row.NoNewlineOld)
+			continue
+		}
+
+		selected := selection.contains(idx)
+		if row.OldNo != nil {
+			if selected {
+				dels = append(dels, "-"+row.Old+lineEnding(row.CRLFOld))
+				if row.NoNewlineOld {
+					dels = append(dels, noNewlineMarker)
+				}
+				oldCount++
+				changed = true
+			} else {
+				context(row.Old, row.CRLFOld, row.NoNewlineOld)
+			}
+		}
+		if row.NewNo != nil && selected {
+			adds = append(adds, "+"+row.New+lineEnding(row.CRLFNew))
+			if row.NoNewlineNew {
+				adds = append(adds, noNewlineMarker)
+			}
+			newCount++
+			changed = true
+		}
+	}
+	flush()
+	return lines, oldCount, newCount, changed
+}
+
+func hasMetaPrefix(rows []Row, prefix string) bool {
+	for _, row := range rows {
+		if row.Kind == Meta && strings.HasPrefix(row.Old, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isContextRow reports whether row is unchanged on both sides, including its
+// line ending and trailing newline.
+func isContextRow(row Row) bool {
+	return row.Kind == Context && row.OldNo != nil && row.NewNo != nil &&
+		row.Old == row.New && row.CRLFOld == row.CRLFNew && row.NoNewlineOld == row.NoNewlineNew
+}
+
+// lineEnding returns the carriage return a CRLF line needs in a patch.
+func lineEnding(crlf bool) string {
+	if crlf {
+		return "\r"
+	}
+	return ""
+}
+
+// patchNewStart computes the +start of a rebuilt hunk. Ranges with a zero count
+// point at the line before the change, so both sides are normalised to the
+// first affected line before applying the offset from earlier hunks.
+func patchNewStart(oldStart, oldCount, newCount, offset int) int {
+	first := oldStart
+	if oldCount == 0 {
+		first++
+	}
+	start := first + offset
+	if newCount == 0 {
+		start--
+	}
+	return start
+}
+
+func formatHunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// UnifiedLines writes rows out as unified diff lines for reading rather than
+// applying: meta rows, git's file header included, and hunk header rows as
+// shown, removed lines with "-", added lines with "+" and context with " ".
+// A run of changed rows lists its removed lines before its added ones, as git
+// does.
+func UnifiedLines(rows []Row) []string {
+	lines := make([]string, 0, len(rows))
+	var dels, adds []string
+	flush := func() {
+		lines = append(lines, dels...)
+		lines = append(lines, adds...)
+		dels, adds = dels[:0], adds[:0]
+	}
+	for _, row := range rows {
+		switch {
+		case row.Kind == Meta || row.Kind == HiddenMeta || row.Kind == HunkHeader:
+			flush()
+			text := row.Old
+			if text == "" {
+				text = row.New
+			}
+			lines = append(lines, text)
+		case isContextRow(row):
+			flush()
+			lines = append(lines, " "+row.Old)
+		default:
+			if row.OldNo != nil {
+				dels = append(dels, "-"+row.Old)
+			}
+			if row.NewNo != nil {
+				adds = append(adds, "+"+row.New)
+			}
+		}
+	}
+	flush()
+	return lines
+}
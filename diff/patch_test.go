@@ -0,0 +1,208 @@
+package diff
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBuildPatch_WholeHunk(t *testing.T) {
+	input := "diff --git a/f.txt b/f.txt\n--- a/f.txt\n+++ b/f.txt\n@@ -1,3 +1,3 @@ func main() {\n a\n-b\n+B\n c\n"
+	rows, hunks := ParseHunks(input)
+
+	got, err := BuildPatch("f.txt", hunks, rows, hunks[0].Range())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "--- a/f.txt\n+++ b/f.txt\n@@ -1,3 +1,3 @@ func main() {\n a\n-b\n+B\n c\n"
+	assertPatch(t, got, want)
+}
+
+func TestBuildPatch_KeepsCarriageReturns(t *testing.T) {
+	input := "@@ -1,2 +1,2 @@\n keep\r\n-a\n+a\r\n"
+	rows, hunks := ParseHunks(input)
+
+	got, err := BuildPatch("f.txt", hunks, rows, hunks[0].Range())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "--- a/f.txt\n+++ b/f.txt\n@@ -1,2 +1,2 @@\n keep\r\n-a\n+a\r\n"
+	assertPatch(t, got, want)
+}
+
+func TestBuildPatch_SelectionOmitsSomeAdditions(t *testing.T) {
+	input := "@@ -1,2 +1,4 @@\n a\n+one\n+two\n b\n"
+	rows, hunks := ParseHunks(input)
+
+	// rows: 0 header, 1 a, 2 +one, 3 +two, 4 b
+	got, err := BuildPatch("f.txt", hunks, rows, RowRange{Start: 2, End: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "--- a/f.txt\n+++ b/f.txt\n@@ -1,2 +1,3 @@\n a\n+one\n b\n"
+	assertPatch(t, got, want)
+}
+
+func TestBuildPatch_UnselectedDeletionBecomesContext(t *testing.T) {
+	input := "@@ -1,3 +1,1 @@\n-x\n-y\n z\n"
+	rows, hunks := ParseHunks(input)
+
+	// rows: 0 header, 1 -x, 2 -y, 3 z
+	got, err := BuildPatch("f.txt", hunks, rows, RowRange{Start: 2, End: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "--- a/f.txt\n+++ b/f.txt\n@@ -1,3 +1,2 @@\n x\n-y\n z\n"
+	assertPatch(t, got, want)
+}
+
+func TestBuildPatch_UnselectedPairKeepsOldLine(t *testing.T) {
+	input := "@@ -1,2 +1,2 @@\n-foo(a)\n-bar(a)\n+foo(b)\n+bar(b)\n"
+	rows, hunks := ParseHunks(input)
+
+	// rows: 0 header, 1 foo pair, 2 bar pair
+	got, err := BuildPatch("f.txt", hunks, rows, RowRange{Start: 2, End: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "--- a/f.txt\n+++ b/f.txt\n@@ -1,2 +1,2 @@\n foo(a)\n-bar(a)\n+bar(b)\n"
+	assertPatch(t, got, want)
+}
+
+func TestBuildPatch_SpanningHunksRecomputesOffsets(t *testing.T) {
+	input := "@@ -1,2 +1,3 @@\n a\n+new1\n b\n@@ -10,2 +11,3 @@\n x\n+new2\n y\n"
+	rows, hunks := ParseHunks(input)
+
+	// Selecting only the second hunk must not count the first hunk's addition.
+	got, err := BuildPatch("f.txt", hunks, rows, hunks[1].Range())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "--- a/f.txt\n+++ b/f.txt\n@@ -10,2 +10,3 @@\n x\n+new2\n y\n"
+	assertPatch(t, got, want)
+
+	got, err = BuildPatch("f.txt", hunks, rows, RowRange{Start: 0, End: len(rows)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = "--- a/f.txt\n+++ b/f.txt\n@@ -1,2 +1,3 @@\n a\n+new1\n b\n@@ -10,2 +11,3 @@\n x\n+new2\n y\n"
+	assertPatch(t, got, want)
+}
+
+func TestBuildPatch_ContextOnlySelectionIsEmpty(t *testing.T) {
+	input := "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"
+	rows, hunks := ParseHunks(input)
+
+	_, err := BuildPatch("f.txt", hunks, rows, RowRange{Start: 0, End: 2})
+	if !errors.Is(err, ErrEmptySelection) {
+		t.Fatalf("expected ErrEmptySelection for header+context selection, got %v", err)
+	}
+	// rows: 0 header, 1 a, 2 -b, 3 +B, 4 c
+	_, err = BuildPatch("f.txt", hunks, rows, RowRange{Start: 4, End: 5})
+	if !errors.Is(err, ErrEmptySelection) {
+		t.Fatalf("expected ErrEmptySelection for trailing context, got %v", err)
+	}
+}
+
+func TestBuildPatch_NoTrailingNewline(t *testing.T) {
+	input := "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n"
+	rows, hunks := ParseHunks(input)
+
+	got, err := BuildPatch("f.txt", hunks, rows, hunks[0].Range())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "--- a/f.txt\n+++ b/f.txt\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n"
+	assertPatch(t, got, want)
+}
+
+func TestBuildPatch_NoTrailingNewlineOnDroppedAddition(t *testing.T) {
+	input := "@@ -1 +1,2 @@\n a\n+b\n\\ No newline at end of file\n"
+	rows, hunks := ParseHunks(input)
+
+	_, err := BuildPatch("f.txt", hunks, rows, RowRange{Start: 0, End: 2})
+	if !errors.Is(err, ErrEmptySelection) {
+		t.Fatalf("expected ErrEmptySelection, got %v", err)
+	}
+
+	got, err := BuildPatch("f.txt", hunks, rows, hunks[0].Range())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "--- a/f.txt\n+++ b/f.txt\n@@ -1 +1,2 @@\n a\n+b\n\\ No newline at end of file\n"
+	assertPatch(t, got, want)
+}
+
+func TestBuildPatch_NewFileUsesDevNull(t *testing.T) {
+	input := "diff --git a/n.txt b/n.txt\nnew file mode 100644\nindex 0000000..1111111\n--- /dev/null\n+++ b/n.txt\n@@ -0,0 +1,3 @@\n+one\n+two\n+three\n"
+	rows, hunks := ParseHunks(input)
+
+	got, err := BuildPatch("n.txt", hunks, rows, hunks[0].Range())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "--- /dev/null\n+++ b/n.txt\n@@ -0,0 +1,3 @@\n+one\n+two\n+three\n"
+	assertPatch(t, got, want)
+
+	// rows: 0 diff --git, 1 new file mode, 2 index, 3 ---, 4 +++, 5 header,
+	// 6 one, 7 two, 8 three
+	got, err = BuildPatch("n.txt", hunks, rows, RowRange{Start: 7, End: 8})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = "--- /dev/null\n+++ b/n.txt\n@@ -0,0 +1 @@\n+two\n"
+	assertPatch(t, got, want)
+}
+
+func TestBuildPatch_DeletedFile(t *testing.T) {
+	input := "diff --git a/d.txt b/d.txt\ndeleted file mode 100644\n--- a/d.txt\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-one\n-two\n"
+	rows, hunks := ParseHunks(input)
+
+	got, err := BuildPatch("d.txt", hunks, rows, hunks[0].Range())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "--- a/d.txt\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-one\n-two\n"
+	assertPatch(t, got, want)
+
+	// rows: 0 diff --git, 1 deleted file mode, 2 ---, 3 +++, 4 header, 5 one,
+	// 6 two
+	got, err = BuildPatch("d.txt", hunks, rows, RowRange{Start: 5, End: 6})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = "--- a/d.txt\n+++ b/d.txt\n@@ -1,2 +1 @@\n-one\n two\n"
+	assertPatch(t, got, want)
+}
+
+func assertPatch(t *testing.T, got, want string) {
+	t.Helper()
+	if got != want {
+		t.Fatalf("unexpected patch\n--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+}
+
+func TestUnifiedLines_GroupsChangedRuns(t *testing.T) {
+	rows, _ := ParseHunks("@@ -1,4 +1,4 @@\n a\n-b\n-c\n+B\n+C\n d\n+e\n")
+	got := strings.Join(UnifiedLines(rows), "\n")
+	want := "@@ -1,4 +1,4 @@\n a\n-b\n-c\n+B\n+C\n d\n+e"
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnifiedLines_KeepsFileHeader(t *testing.T) {
+	input := "diff --git a/f b/f\nindex 1111111..2222222 100644\n--- a/f\n+++ b/f\n@@ -1 +1 @@\n-a\n+b\n"
+	rows, hunks := ParseHunks(input)
+	for i := 0; i < 4; i++ {
+		if rows[i].Kind != HiddenMeta {
+			t.Fatalf("row %d %+v, want a hidden header line", i, rows[i])
+		}
+	}
+	if hunks[0].RowStart != 4 {
+		t.Fatalf("hunk starts at row %d, want 4", hunks[0].RowStart)
+	}
+	if got := strings.Join(UnifiedLines(rows), "\n") + "\n"; got != input {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, input)
+	}
+}
@@ -0,0 +1,149 @@
+package diff
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Range selects bytes [Start, End) of a line.
+type Range struct {
+	Start int
+	End   int
+}
+
+// WhitespaceRule is the set of whitespace problems checked on added lines, as
+// configured by git's core.whitespace.
+type WhitespaceRule struct {
+	BlankAtEOL       bool
+	SpaceBeforeTab   bool
+	IndentWithNonTab bool
+	TabInIndent      bool
+	// CRAtEOL allows a trailing carriage return without reporting it.
+	CRAtEOL  bool
+	TabWidth int
+}
+
+// DefaultWhitespaceRule matches git's behavior when core.whitespace is unset.
+func DefaultWhitespaceRule() WhitespaceRule {
+	return WhitespaceRule{BlankAtEOL: true, SpaceBeforeTab: true, TabWidth: 8}
+}
+
+// ParseWhitespaceRule applies a core.whitespace value such as
+// "trailing-space,-space-before-tab,tabwidth=4" on top of git's defaults.
+// blank-at-eof is accepted but not checked, since it is not tied to one line.
+func ParseWhitespaceRule(value string) WhitespaceRule {
+	rule := DefaultWhitespaceRule()
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.HasPrefix(item, "tabwidth=") {
+			if width, err := strconv.Atoi(strings.TrimPrefix(item, "tabwidth=")); err == nil && width > 0 {
+				rule.TabWidth = width
+			}
+			continue
+		}
+		enabled := !strings.HasPrefix(item, "-")
+		switch strings.TrimPrefix(item, "-") {
+		case "blank-at-eol", "trailing-space":
+			rule.BlankAtEOL = enabled
+		case "space-before-tab":
+			rule.SpaceBeforeTab = enabled
+		case "indent-with-non-tab":
+			rule.IndentWithNonTab = enabled
+		case "tab-in-indent":
+			rule.TabInIndent = enabled
+		case "cr-at-eol":
+			rule.CRAtEOL = enabled
+		}
+	}
+	return rule
+}
+
+// MarkWhitespaceErrors records the whitespace errors of every added line in
+// rows and returns how many lines have at least one, like git diff --check.
+func MarkWhitespaceErrors(rows []Row, rule WhitespaceRule) int {
+	count := 0
+	for i := range rows {
+		row := &rows[i]
+		row.WhitespaceErrors = nil
+		if row.NewNo == nil || (row.Kind != Add && row.Kind != Context) || isContextRow(*row) {
+			continue
+		}
+		line := row.New
+		if row.CRLFNew {
+			line += "\r"
+		}
+		if ranges := WhitespaceErrors(line, rule); len(ranges) > 0 {
+			row.WhitespaceErrors = ranges
+			count++
+		}
+	}
+	return count
+}
+
+// WhitespaceErrors returns the sorted, non-overlapping byte ranges of line that
+// break rule.
+func WhitespaceErrors(line string, rule WhitespaceRule) []Range {
+	var ranges []Range
+
+	indentEnd := 0
+	for indentEnd < len(line) && (line[indentEnd] == ' ' || line[indentEnd] == '\t') {
+		indentEnd++
+	}
+	indent := line[:indentEnd]
+
+	if rule.BlankAtEOL {
+		end := len(line)
+		if rule.CRAtEOL && strings.HasSuffix(line, "\r") {
+			end--
+		}
+		start := end
+		for start > 0 && isBlank(line[start-1]) {
+			start--
+		}
+		if start < end {
+			ranges = append(ranges, Range{Start: start, End: end})
+		}
+	}
+	if rule.SpaceBeforeTab {
+		if lastTab := strings.LastIndexByte(indent, '\t'); lastTab > 0 {
+			if first := strings.IndexByte(indent[:lastTab], ' '); first >= 0 {
+				ranges = append(ranges, Range{Start: first, End: lastTab + 1})
+			}
+		}
+	}
+	if rule.IndentWithNonTab && rule.TabWidth > 0 && strings.Contains(indent, strings.Repeat(" ", rule.TabWidth)) {
+		ranges = append(ranges, Range{Start: 0, End: indentEnd})
+	}
+	if rule.TabInIndent && strings.Contains(indent, "\t") {
+		ranges = append(ranges, Range{Start: 0, End: indentEnd})
+	}
+
+	return mergeRanges(ranges)
+}
+
+func isBlank(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\f' || b == '\v'
+}
+
+func mergeRanges(ranges []Range) []Range {
+	if len(ranges) < 2 {
+		return ranges
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End {
+			if r.End > last.End {
+				last.End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
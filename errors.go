@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// setError shows the first line of err in the header and keeps err itself
+// for the detail overlay.
+func (m *model) setError(err error) {
+	m.lastErr = err
+	m.errMsg = firstLine(git.FriendlyError(err))
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[:i])
+	}
+	return s
+}
+
+func (m *model) clearError() {
+	m.lastErr = nil
+	m.errMsg = ""
+	m.errSeen = false
+	m.failed = nil
+}
+
+// lockRetryDelay is how long to wait before retrying a load that failed on
+// index.lock; whoever holds the lock usually lets go almost at once.
+const lockRetryDelay = 500 * time.Millisecond
+
+// failedLoad is the load whose error is shown: the file listing or a diff,
+// with the parameters it was sent with.
+type failedLoad struct {
+	files *filesJob
+	diff  *diffJob
+}
+
+// retryMsg asks to send failed again, unless another error has replaced it.
+type retryMsg struct {
+	failed *failedLoad
+}
+
+// retryLockedCmd retries the failed load once after lockRetryDelay when err
+// is index.lock being held. A failure of that retry is left on screen.
+func (m *model) retryLockedCmd(err error) tea.Cmd {
+	if m.lockRetried || !git.IsIndexLocked(err) {
+		m.lockRetried = false
+		return nil
+	}
+	m.lockRetried = true
+	failed := m.failed
+	return tea.Tick(lockRetryDelay, func(time.Time) tea.Msg {
+		return retryMsg{failed: failed}
+	})
+}
+
+func (m model) handleRetry(msg retryMsg) (tea.Model, tea.Cmd) {
+	if msg.failed == nil || msg.failed != m.failed {
+		return m, nil
+	}
+	cmd := m.resend()
+	return m, cmd
+}
+
+// retryFailed sends the failed load again (r).
+func (m model) retryFailed() (tea.Model, tea.Cmd) {
+	m.lockRetried = false
+	cmd := m.resend()
+	return m, cmd
+}
+
+// resend runs the failed load again under a fresh request id. A diff is only
+// resent while its file is still selected.
+func (m *model) resend() tea.Cmd {
+	failed := m.failed
+	switch {
+	case failed == nil:
+		return nil
+	case failed.files != nil:
+		if failed.files.mode != m.mode {
+			return nil
+		}
+		m.clearError()
+		m.noChanges = false
+		m.files = []string{"(loading...)"}
+		m.rows = loadingRows("loading...")
+		m.filesReq++
+		job := *failed.files
+		job.req = m.filesReq
+		return tea.Batch(loadFilesCmd(job), m.startFilesTimer())
+	default:
+		if failed.diff.file != m.selectedFile() || failed.diff.mode != m.mode {
+			return nil
+		}
+		m.clearError()
+		m.rows = loadingRows("loading diff...")
+		m.hunks = nil
+		return m.sendDiff(*failed.diff)
+	}
+}
+
+// errorDetail is what the overlay shows for err: the git command that failed,
+// its exit status and complete output, and a hint when the cause is a common
+// one.
+func errorDetail(err error) []string {
+	var lines []string
+	var cmdErr *git.CommandError
+	if errors.As(err, &cmdErr) {
+		lines = append(lines, "$ git "+quoteArgs(cmdErr.Args))
+		if cmdErr.Err != nil {
+			lines = append(lines, cmdErr.Err.Error())
+		}
+		lines = append(lines, "")
+		output := strings.TrimSpace(cmdErr.Output)
+		if output == "" {
+			output = "(no output)"
+		}
+		lines = append(lines, strings.Split(output, "\n")...)
+	} else {
+		lines = append(lines, strings.Split(err.Error(), "\n")...)
+	}
+	if hint := git.ErrorHint(err); hint != "" {
+		lines = append(lines, "", "hint: "+hint)
+	}
+	return lines
+}
+
+// quoteArgs joins args as a shell would need them typed.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`") {
+			quoted[i] = strconv.Quote(arg)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// showErrorDetail opens the overlay on the last error, if there is one.
+func (m model) showErrorDetail() (tea.Model, tea.Cmd) {
+	if m.lastErr == nil {
+		return m, nil
+	}
+	m.overlay = &ui.Overlay{Title: "GIT ERROR", Lines: errorDetail(m.lastErr)}
+	cmd := m.dismissImages()
+	return m, cmd
+}
+
+// handleOverlayKey scrolls or closes the overlay; other keys are ignored
+// while it is open. Scrolling to the end of a line's history loads more of
+// it.
+func (m model) handleOverlayKey(key string) (tea.Model, tea.Cmd) {
+	switch {
+	case m.noteList != nil:
+		return m.handleNotesKey(key)
+	case m.bookmarkList != nil:
+		return m.handleBookmarksKey(key)
+	case m.resolving != nil:
+		return m.handleResolveKey(key)
+	case m.stashConfirm != nil:
+		return m.handleStashConfirmKey(key)
+	case m.stashShown != nil:
+		return m.handleStashShownKey(key)
+	case m.stashList != nil:
+		return m.handleStashesKey(key)
+	case m.worktreeList != nil:
+		return m.handleWorktreesKey(key)
+	case m.algoPicker:
+		return m.handleAlgosKey(key)
+	}
+	switch key {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc", "q", "e", "h":
+		m.overlay, m.history = nil, nil
+		return m, m.drawImagesCmd()
+	case "r":
+		if m.history != nil {
+			return m, nil
+		}
+		m.overlay = nil
+		return m.retryFailed()
+	}
+	m.scrollOverlay(key)
+	cmd := m.moreHistory()
+	return m, cmd
+}
+
+// scrollOverlay moves a text overlay by a line, a page or to either end for
+// key, and leaves it where it is for other keys.
+func (m *model) scrollOverlay(key string) {
+	page := ui.OverlayVisibleLines(m.bodyHeight())
+	maxScroll := m.overlay.MaxScroll(m.width, m.bodyHeight())
+	scroll := m.overlay.Scroll
+	switch key {
+	case "up", "k":
+		scroll--
+	case "down", "j":
+		scroll++
+	case "pgup", "ctrl+u", "ctrl+b":
+		scroll -= page
+	case "pgdown", "ctrl+d", "ctrl+f", " ":
+		scroll += page
+	case "home", "g":
+		scroll = 0
+	case "end", "G":
+		scroll = maxScroll
+	}
+	overlay := *m.overlay
+	overlay.Scroll = clamp(scroll, 0, maxScroll)
+	m.overlay = &overlay
+}
+
+// listSelection is the item of a selectable overlay's count items that key
+// moves the selection from selected to, a page being page items.
+func listSelection(key string, selected, count, page int) int {
+	switch key {
+	case "up", "k":
+		selected--
+	case "down", "j":
+		selected++
+	case "pgup", "ctrl+u", "ctrl+b":
+		selected -= page
+	case "pgdown", "ctrl+d", "ctrl+f", " ":
+		selected += page
+	case "home", "g":
+		selected = 0
+	case "end", "G":
+		selected = count - 1
+	}
+	return clamp(selected, 0, count-1)
+}
+
+// selectListItem selects item i of the overlay and scrolls it into view.
+func (m *model) selectListItem(i int) {
+	overlay := *m.overlay
+	overlay.Selected = i
+	overlay.Scroll = overlay.ScrollToSelected(m.width, m.bodyHeight())
+	m.overlay = &overlay
+}
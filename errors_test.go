@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestErrorDetail_ShowsCommandAndFullOutput(t *testing.T) {
+	m := loadedModel(3)
+	var output []string
+	output = append(output, "fatal: Unable to create '/repo/.git/index.lock': File exists.")
+	for i := 0; i < 40; i++ {
+		output = append(output, fmt.Sprintf("detail line %d", i))
+	}
+	m.setError(&git.CommandError{
+		Args:   []string{"diff", "--", "my file.go"},
+		Output: strings.Join(output, "\n"),
+		Err:    errors.New("exit status 128"),
+	})
+	if m.errMsg != output[0] {
+		t.Fatalf("header error = %q, want only the first line", m.errMsg)
+	}
+
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	m = next.(model)
+	if m.overlay == nil {
+		t.Fatal("e did not open the error overlay")
+	}
+	detail := strings.Join(m.overlay.Lines, "\n")
+	for _, want := range []string{`$ git diff -- "my file.go"`, "exit status 128", "detail line 39", "hint: Another git process"} {
+		if !strings.Contains(detail, want) {
+			t.Fatalf("overlay missing %q:\n%s", want, detail)
+		}
+	}
+
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("G")})
+	m = next.(model)
+	maxScroll := m.overlay.MaxScroll(m.width, m.bodyHeight())
+	if maxScroll == 0 || m.overlay.Scroll != maxScroll {
+		t.Fatalf("G scrolled to %d, want %d", m.overlay.Scroll, maxScroll)
+	}
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	m = next.(model)
+	if m.overlay.Scroll != maxScroll {
+		t.Fatalf("j scrolled past the end to %d", m.overlay.Scroll)
+	}
+	if !strings.Contains(m.View(), "detail line 39") {
+		t.Fatal("scrolled overlay does not show the last line")
+	}
+
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = next.(model)
+	if m.overlay != nil {
+		t.Fatal("esc did not close the overlay")
+	}
+}
+
+func TestErrorDetail_NothingToShow(t *testing.T) {
+	m := loadedModel(3)
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	if next.(model).overlay != nil {
+		t.Fatal("e opened an overlay without an error")
+	}
+}
+
+func TestRetry_IndexLockOnceThenByHand(t *testing.T) {
+	m := loadedModel(3)
+	locked := &git.CommandError{Args: []string{"diff"}, Output: "fatal: Unable to create '/repo/.git/index.lock': File exists."}
+	fail := func(m model) (model, tea.Cmd) {
+		next, cmd := m.handleDiffLoaded(diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: m.selectedFile(), err: locked})
+		return next.(model), cmd
+	}
+
+	m, cmd := fail(m)
+	if m.failed == nil || m.failed.diff == nil || cmd == nil {
+		t.Fatal("index.lock failure was not scheduled for a retry")
+	}
+	req := m.diffReq
+	next, _ := m.handleRetry(retryMsg{failed: m.failed})
+	m = next.(model)
+	if m.diffReq == req || m.errMsg != "" || !m.diffLoading() {
+		t.Fatal("automatic retry did not resend the diff")
+	}
+
+	m, cmd = fail(m)
+	if cmd != nil {
+		t.Fatal("failed retry was retried again")
+	}
+	req = m.diffReq
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = next.(model)
+	if m.diffReq == req || m.diffJob.file != m.selectedFile() {
+		t.Fatal("r did not resend the failed diff")
+	}
+}
+
+func TestRetry_FileListing(t *testing.T) {
+	m := loadedModel(3)
+	m.filesReq++
+	next, _ := m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, err: errors.New("fatal: bad object HEAD")})
+	m = next.(model)
+	if m.failed == nil || m.failed.files == nil || m.lockRetried {
+		t.Fatal("listing failure not recorded, or retried without index.lock")
+	}
+	req := m.filesReq
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = next.(model)
+	if m.filesReq == req || cmd == nil || m.errMsg != "" || m.files[0] != "(loading...)" {
+		t.Fatal("r did not list the files again")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/PedroElizalde01/tdiff/git"
+)
+
+// Exit statuses. Under --exit-code they follow diff(1): 1 means there are
+// changes and trouble gets 2 so scripts can tell the two apart.
+const (
+	exitOK      = 0
+	exitChanges = 1
+	exitError   = 1
+	exitTrouble = 2
+	// exitCrash follows a panic, reported on stderr.
+	exitCrash = 2
+)
+
+// countChanges counts the files among files that are changes: ignored files
+// are not, and neither are untracked ones while they are hidden.
+func countChanges(files []string, statuses map[string]string, hideUntracked bool) int {
+	n := 0
+	for _, file := range files {
+		switch statuses[file] {
+		case "I":
+			continue
+		case "?":
+			if hideUntracked {
+				continue
+			}
+		}
+		n++
+	}
+	return n
+}
+
+// exitStatus is what tdiff exits with once the session in m has ended: an
+// error when git's last report was one the user saw or that kept the files
+// from ever being listed, or when --merge quit before the file was marked
+// resolved, and with exitCode set, whether the files listed had changes. An
+// error that lands as tdiff quits, such as a refresh failing, does not count.
+func (m *model) exitStatus(exitCode bool) int {
+	failed := m.lastErr != nil && (m.errSeen || !m.listed)
+	switch {
+	case failed && exitCode:
+		return exitTrouble
+	case failed:
+		return exitError
+	case m.pick && m.picked == "":
+		return exitError
+	case m.merge != nil:
+		if m.merge.done {
+			return exitOK
+		}
+		return exitError
+	case exitCode && countChanges(m.allFiles, m.fileStatuses, m.hideUntracked) > 0:
+		return exitChanges
+	}
+	return exitOK
+}
+
+// checkChanges is --quiet: it lists the changed files in mode without the
+// TUI and reports, as the exit status, whether there are any.
+func checkChanges(opts options, stderr io.Writer) int {
+	files, err := git.ListChangedFiles(opts.mode, !opts.hideUntracked)
+	if err != nil {
+		fmt.Fprintf(stderr, "tdiff: %s\n", git.FriendlyError(err))
+		return exitTrouble
+	}
+	statuses, err := git.FileStatuses(opts.mode, !opts.hideUntracked)
+	if err != nil {
+		statuses = map[string]string{}
+	}
+	if countChanges(files, statuses, opts.hideUntracked) > 0 {
+		return exitChanges
+	}
+	return exitOK
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExitStatus(t *testing.T) {
+	clean := initialModel(defaultOptions())
+	clean.applyNoChangesState()
+	changed := loadedModel(3)
+	failed := initialModel(defaultOptions())
+	failed.setError(errors.New("fatal: not a git repository"))
+	transient := loadedModel(3)
+	transient.setError(errors.New("fatal: Unable to create '.git/index.lock': File exists."))
+	seen := update(t, transient, runeKeys("j")...)
+	cancelled := loadedModel(3)
+	cancelled.pick = true
+	picked := cancelled
+	picked.picked = picked.files[0]
+
+	for _, tc := range []struct {
+		name     string
+		m        model
+		exitCode bool
+		want     int
+	}{
+		{"changes viewed", changed, false, exitOK},
+		{"git error", failed, false, exitError},
+		{"error as tdiff quits", transient, false, exitOK},
+		{"error seen", seen, false, exitError},
+		{"pick cancelled", cancelled, false, exitError},
+		{"file picked", picked, false, exitOK},
+		{"exit-code with changes", changed, true, exitChanges},
+		{"exit-code without changes", clean, true, exitOK},
+		{"exit-code on error", failed, true, exitTrouble},
+	} {
+		if got := tc.m.exitStatus(tc.exitCode); got != tc.want {
+			t.Errorf("%s: exit status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCountChanges_SkipsIgnoredAndHiddenUntracked(t *testing.T) {
+	files := []string{"a.go", "new.go", "build/out"}
+	statuses := map[string]string{"a.go": "M", "new.go": "?", "build/out": "I"}
+	if got := countChanges(files, statuses, false); got != 2 {
+		t.Fatalf("countChanges = %d, want 2", got)
+	}
+	if got := countChanges(files, statuses, true); got != 1 {
+		t.Fatalf("countChanges hiding untracked = %d, want 1", got)
+	}
+}
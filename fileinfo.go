@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+)
+
+// fileInfo describes file for the line under the header: its size and
+// modification time on disk, its language and executable bit, and in staged
+// mode the size of its blob in the index.
+func fileInfo(mode git.Mode, file string) string {
+	var parts []string
+	info, err := os.Stat(git.WorktreePath(file))
+	onDisk := err == nil && !info.IsDir()
+	if onDisk {
+		parts = append(parts, formatSize(info.Size()), "modified "+info.ModTime().Format("2006-01-02 15:04"))
+	} else {
+		parts = append(parts, "not on disk")
+	}
+	if lang := ui.Language(file); lang != "" {
+		parts = append(parts, lang)
+	}
+	if onDisk && info.Mode()&0o111 != 0 {
+		parts = append(parts, "executable")
+	}
+	if mode == git.Staged {
+		if sizes := git.BlobSizes(mode, file); sizes.HasNew {
+			parts = append(parts, "index blob "+formatSize(sizes.New))
+		} else {
+			parts = append(parts, "not in the index")
+		}
+	}
+	return strings.Join(parts, " · ")
+}
+
+// fileInfoLine is the info line of the shown file, "" in the continuous view
+// where the panes hold more than one.
+func (m *model) fileInfoLine() string {
+	if m.continuous != nil {
+		return ""
+	}
+	return m.fileInfo
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/git"
+)
+
+func TestFileInfo(t *testing.T) {
+	info, err := os.Stat("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := formatSize(info.Size()) + " · modified " + info.ModTime().Format("2006-01-02 15:04") + " · Go"
+	if got := fileInfo(git.Worktree, "main.go"); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got := fileInfo(git.Worktree, "gone/missing.go"); got != "not on disk · Go" {
+		t.Fatalf("missing file: %q", got)
+	}
+}
+
+func TestFileInfo_HiddenInContinuousView(t *testing.T) {
+	m := reviewModel()
+	m.fileInfo = "1 KB · Go"
+	body := m.bodyHeight()
+	m.continuous = &continuousView{}
+	if m.fileInfoLine() != "" || m.bodyHeight() != body+1 {
+		t.Fatalf("continuous view kept the info line: %q, body %d", m.fileInfoLine(), m.bodyHeight())
+	}
+}
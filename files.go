@@ -0,0 +1,626 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// fileSort is the order of the sidebar's file list.
+type fileSort int
+
+const (
+	sortPath fileSort = iota
+	sortStatus
+	sortChurn
+)
+
+func (s fileSort) String() string {
+	switch s {
+	case sortStatus:
+		return "status"
+	case sortChurn:
+		return "churn"
+	default:
+		return "path"
+	}
+}
+
+// Next returns the sort after s in the order path, status, churn.
+func (s fileSort) Next() fileSort {
+	switch s {
+	case sortPath:
+		return sortStatus
+	case sortStatus:
+		return sortChurn
+	default:
+		return sortPath
+	}
+}
+
+// statusOrder groups files by status when sorting by status: conflicted,
+// added, modified, type-changed, deleted, renamed, untracked, skipped,
+// ignored, then anything else.
+var statusOrder = map[string]int{"C": 0, "A": 1, "M": 2, "T": 3, "D": 4, "R": 5, "?": 6, "S": 7, "I": 8}
+
+// sortFiles orders files by m.fileSort. Ties fall back to path order so the
+// list is stable however git emitted it.
+func (m *model) sortFiles(files []string) {
+	less := func(i, j int) bool { return pathLess(files[i], files[j]) }
+	switch m.fileSort {
+	case sortStatus:
+		less = func(i, j int) bool {
+			a, b := statusRank(m.fileStatuses[files[i]]), statusRank(m.fileStatuses[files[j]])
+			if a != b {
+				return a < b
+			}
+			return pathLess(files[i], files[j])
+		}
+	case sortChurn:
+		less = func(i, j int) bool {
+			a, b := m.fileStats[files[i]], m.fileStats[files[j]]
+			if churnA, churnB := a.Added+a.Deleted, b.Added+b.Deleted; churnA != churnB {
+				return churnA > churnB
+			}
+			return pathLess(files[i], files[j])
+		}
+	}
+	if len(m.reviewed) > 0 {
+		// Reviewed files go last, each part in the chosen order.
+		byOrder := less
+		less = func(i, j int) bool {
+			if a, b := m.isReviewed(files[i]), m.isReviewed(files[j]); a != b {
+				return b
+			}
+			return byOrder(i, j)
+		}
+	}
+	// Conflicted files go first in every order, reviewed or not: the merge
+	// waits on them.
+	byConflict := less
+	less = func(i, j int) bool {
+		if a, b := m.fileStatuses[files[i]] == "C", m.fileStatuses[files[j]] == "C"; a != b {
+			return a
+		}
+		return byConflict(i, j)
+	}
+	// Every order ends in path order, so no two files tie and an unstable
+	// sort gives the same list with fewer comparisons.
+	sort.Slice(files, less)
+}
+
+func statusRank(status string) int {
+	if rank, ok := statusOrder[status]; ok {
+		return rank
+	}
+	return len(statusOrder)
+}
+
+// pathLess orders paths the way a file tree lists them: component by
+// component, with a directory's contents before the files next to it. It
+// walks both paths in place, since sorting calls it for every comparison.
+func pathLess(a, b string) bool {
+	for {
+		i, j := strings.IndexByte(a, '/'), strings.IndexByte(b, '/')
+		partA, partB := a, b
+		if i >= 0 {
+			partA = a[:i]
+		}
+		if j >= 0 {
+			partB = b[:j]
+		}
+		if partA != partB {
+			if dirA, dirB := i >= 0, j >= 0; dirA != dirB {
+				return dirA
+			}
+			return partA < partB
+		}
+		if i < 0 || j < 0 {
+			return i < 0 && j >= 0
+		}
+		a, b = a[i+1:], b[j+1:]
+	}
+}
+
+// cycleFileSort switches to the next sort and keeps the selected file
+// selected wherever it lands.
+func (m model) cycleFileSort() (tea.Model, tea.Cmd) {
+	m.fileSort = m.fileSort.Next()
+	if !m.hasRealFiles() {
+		return m, nil
+	}
+	path := m.selectedPath()
+	m.sortFiles(m.files)
+	m.rebuildEntries()
+	m.selectPath(path)
+	return m, nil
+}
+
+// sidebarTitle names the file list, its current order and active filter.
+func (m *model) sidebarTitle() string {
+	title := ui.FilesTitle + " · " + m.fileSort.String()
+	if m.statusFilter != "" {
+		title += " · " + statusFilterLabel(m.statusFilter)
+	}
+	if progress := m.reviewProgress(); progress != "" {
+		title += " · " + progress
+	}
+	return title
+}
+
+// statusFilterLabel shows the untracked status "?" as the sidebar's "U".
+func statusFilterLabel(status string) string {
+	if status == "?" {
+		return "U"
+	}
+	return status
+}
+
+// filterLabel describes the active filters, e.g. "D" or "D, no untracked".
+func (m *model) filterLabel() string {
+	var parts []string
+	if m.statusFilter != "" {
+		parts = append(parts, statusFilterLabel(m.statusFilter))
+	}
+	if m.hideUntracked {
+		parts = append(parts, "no untracked")
+	}
+	if m.hiddenGenerated > 0 {
+		parts = append(parts, "no generated")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// toggleIgnored lists or drops ignored files. Unlike the filters this has to
+// ask git again, since ignored files are not listed otherwise.
+func (m model) toggleIgnored() (tea.Model, tea.Cmd) {
+	m.showIgnored = !m.showIgnored
+	m.ignoredCapped = false
+	if m.mode != git.Worktree {
+		return m, nil
+	}
+	m.filesReq++
+	return m, m.loadFiles()
+}
+
+// toggleSkipped lists or drops the files marked skip-worktree or
+// assume-unchanged that differ on disk, which costs git a look at each of
+// them on every listing.
+func (m model) toggleSkipped() (tea.Model, tea.Cmd) {
+	m.showSkipped = !m.showSkipped
+	if m.mode != git.Worktree {
+		return m, nil
+	}
+	m.filesReq++
+	return m, m.loadFiles()
+}
+
+// notice is a warning for the header, such as ignored files being capped.
+func (m *model) notice() string {
+	if m.flash != "" {
+		return m.flash
+	}
+	if hint := m.slowScanHint(); hint != "" {
+		return hint
+	}
+	if m.showIgnored && m.ignoredCapped {
+		return fmt.Sprintf("ignored files capped at %d", maxIgnoredFiles)
+	}
+	if m.statsErr != nil {
+		return "line counts incomplete: " + firstLine(git.FriendlyError(m.statsErr))
+	}
+	if m.pick {
+		return pickHint
+	}
+	return ""
+}
+
+// toggleUntracked hides or shows untracked files in the worktree list.
+// Hidden ones are no longer looked for, so showing them asks git again, as
+// does hiding them during a slow first scan.
+func (m model) toggleUntracked() (tea.Model, tea.Cmd) {
+	m.hideUntracked = !m.hideUntracked
+	cmd := m.refilter()
+	if (!m.hideUntracked || m.filesLoading()) && m.mode == git.Worktree && m.merge == nil {
+		m.filesReq++
+		cmd = tea.Batch(cmd, m.loadFiles())
+	}
+	return m, cmd
+}
+
+// applyFileFilters derives files from allFiles: the files the filters let
+// through in the current sort, or a placeholder when none do. Further
+// filters compose here.
+func (m *model) applyFileFilters() {
+	files := make([]string, 0, len(m.allFiles))
+	m.hiddenGenerated = 0
+	for _, file := range m.allFiles {
+		if !m.showGenerated && m.generated[file] {
+			m.hiddenGenerated++
+			continue
+		}
+		if m.statusFilter != "" && m.fileStatuses[file] != m.statusFilter {
+			continue
+		}
+		if m.hideUntracked && m.fileStatuses[file] == "?" {
+			continue
+		}
+		files = append(files, file)
+	}
+	m.noMatches = len(files) == 0
+	if m.noMatches {
+		files = []string{fmt.Sprintf("(no files match filter: %s)", m.filterLabel())}
+	}
+	m.files = files
+	m.totals, m.allTotals = m.diffTotals(m.files), m.diffTotals(m.allFiles)
+	m.sortFiles(m.files)
+	m.rebuildEntries()
+}
+
+// setStatusFilter shows only files with status, or every file when status
+// is empty.
+func (m model) setStatusFilter(status string) (tea.Model, tea.Cmd) {
+	m.statusFilter = status
+	return m, m.refilter()
+}
+
+// refilter reapplies the filters. When the selected file is filtered out the
+// selection moves to the nearest file still listed and its diff loads.
+func (m *model) refilter() tea.Cmd {
+	if m.noChanges || m.allFiles == nil {
+		return nil
+	}
+	path, file := m.selectedPath(), m.selectedFile()
+	prev := m.files
+	m.saveCursor()
+	m.applyFileFilters()
+	if m.continuous != nil {
+		m.rebuildSections()
+		m.selectPath(m.rowFile(m.cursor))
+		return m.loadVisibleSections()
+	}
+	if !m.hasRealFiles() {
+		m.selected = 0
+		m.sidebarScroll = 0
+		return m.showNoDiff()
+	}
+	if m.pathIndex(path) < 0 {
+		path = m.nearestListed(prev, file)
+	}
+	m.selectPath(path)
+	if file != "" && m.selectedFile() == file {
+		return nil
+	}
+	return m.showSelection()
+}
+
+// nearestListed returns the file closest to file in prev that is still
+// listed, looking after it first, or "" when there is none.
+func (m *model) nearestListed(prev []string, file string) string {
+	start := indexOf(file, prev)
+	if start < 0 {
+		return ""
+	}
+	listed := make(map[string]bool, len(m.files))
+	for _, f := range m.files {
+		listed[f] = true
+	}
+	for d := 1; d < len(prev); d++ {
+		for _, i := range []int{start + d, start - d} {
+			if i >= 0 && i < len(prev) && listed[prev[i]] {
+				return prev[i]
+			}
+		}
+	}
+	return ""
+}
+
+// vanishedNotice tells that file, listed before, has no changes left.
+func vanishedNotice(file string) string {
+	return diff.EscapeControl(file) + " no longer has changes"
+}
+
+// showNoDiff empties the diff panes when no file is selected.
+func (m *model) showNoDiff() tea.Cmd {
+	m.diffReq++
+	m.loadedReq = m.diffReq
+	m.shownFile = ""
+	m.rows = noDiffRows()
+	m.hunks = nil
+	m.changeStarts = nil
+	m.syntax = nil
+	m.whitespaceErrors, m.invisibleChanges = 0, 0
+	m.guardedLines, m.guardedSize = 0, 0
+	m.preview = nil
+	m.fileInfo = ""
+	m.cursor = 0
+	m.diffScroll = 0
+	return m.dismissImages()
+}
+
+// treeNode is a directory or file while the sidebar tree is being built.
+type treeNode struct {
+	name     string
+	path     string
+	dir      bool
+	children []*treeNode
+	byName   map[string]*treeNode
+}
+
+// buildTree groups files by directory. Children keep the order their first
+// file has in files, so the current sort still applies within a directory.
+func (m *model) buildTree(files []string) []ui.SidebarEntry {
+	root := &treeNode{dir: true, byName: map[string]*treeNode{}}
+	for _, file := range files {
+		node := root
+		parts := strings.Split(file, "/")
+		for i, part := range parts {
+			child, ok := node.byName[part]
+			if !ok {
+				child = &treeNode{name: part, path: strings.Join(parts[:i+1], "/"), dir: i < len(parts)-1}
+				if child.dir {
+					child.byName = map[string]*treeNode{}
+				}
+				node.byName[part] = child
+				node.children = append(node.children, child)
+			}
+			node = child
+		}
+	}
+
+	var entries []ui.SidebarEntry
+	m.appendTreeEntries(&entries, root, 0)
+	return entries
+}
+
+func (m *model) appendTreeEntries(entries *[]ui.SidebarEntry, node *treeNode, depth int) {
+	for _, child := range node.children {
+		if !child.dir {
+			*entries = append(*entries, ui.SidebarEntry{Path: child.path, Name: child.name, Depth: depth, Status: m.fileStatuses[child.path]})
+			continue
+		}
+		name := child.name
+		for len(child.children) == 1 && child.children[0].dir {
+			child = child.children[0]
+			name += "/" + child.name
+		}
+		status, totals := m.treeTotals(child)
+		collapsed := m.collapsed[child.path]
+		*entries = append(*entries, ui.SidebarEntry{Path: child.path, Name: name, Depth: depth, Dir: true, Collapsed: collapsed, Status: status, Totals: totals})
+		if !collapsed {
+			m.appendTreeEntries(entries, child, depth+1)
+		}
+	}
+}
+
+// treeTotals sums the diffstat below node and returns the status its files
+// share, or "" when they differ.
+func (m *model) treeTotals(node *treeNode) (string, ui.DiffTotals) {
+	if !node.dir {
+		stat := m.fileStats[node.path]
+		return m.fileStatuses[node.path], ui.DiffTotals{Files: 1, Added: stat.Added, Deleted: stat.Deleted}
+	}
+	var totals ui.DiffTotals
+	status := ""
+	for i, child := range node.children {
+		childStatus, childTotals := m.treeTotals(child)
+		totals.Files += childTotals.Files
+		totals.Added += childTotals.Added
+		totals.Deleted += childTotals.Deleted
+		if i == 0 {
+			status = childStatus
+		} else if childStatus != status {
+			status = ""
+		}
+	}
+	return status, totals
+}
+
+// rebuildEntries refreshes the tree rows after the file list, its order or a
+// directory's collapsed state changed. The flat list has no entries.
+func (m *model) rebuildEntries() {
+	m.entries = nil
+	if m.treeView && m.hasRealFiles() {
+		m.entries = m.buildTree(m.files)
+	}
+}
+
+// sidebarLen is the number of selectable sidebar rows.
+func (m *model) sidebarLen() int {
+	if m.entries != nil {
+		return len(m.entries)
+	}
+	return len(m.files)
+}
+
+// selectedPath is the full path of the selected sidebar row, file or
+// directory.
+func (m *model) selectedPath() string {
+	if m.entries != nil {
+		if m.selected < 0 || m.selected >= len(m.entries) {
+			return ""
+		}
+		return m.entries[m.selected].Path
+	}
+	return m.selectedFile()
+}
+
+// selectedDir returns the selected tree row when it is a directory.
+func (m *model) selectedDir() (ui.SidebarEntry, bool) {
+	if m.entries == nil || m.selected < 0 || m.selected >= len(m.entries) || !m.entries[m.selected].Dir {
+		return ui.SidebarEntry{}, false
+	}
+	return m.entries[m.selected], true
+}
+
+// pathIndex returns the sidebar row for path. A file hidden in a collapsed
+// directory maps to that directory's row.
+func (m *model) pathIndex(path string) int {
+	if m.entries == nil {
+		return indexOf(path, m.files)
+	}
+	best := -1
+	for i, entry := range m.entries {
+		if entry.Path == path {
+			return i
+		}
+		if entry.Dir && strings.HasPrefix(path, entry.Path+"/") {
+			best = i
+		}
+	}
+	return best
+}
+
+// selectPath reselects path after the sidebar rows changed.
+func (m *model) selectPath(path string) {
+	if idx := m.pathIndex(path); idx >= 0 {
+		m.selected = idx
+	}
+	m.selected = clamp(m.selected, 0, m.sidebarLen()-1)
+	m.ensureSidebarVisible()
+}
+
+// neighbourFile returns the closest file row after (direction > 0) or
+// before the selection, skipping directory rows, or -1 when there is none.
+func (m *model) neighbourFile(direction int) int {
+	for i := m.selected + direction; i >= 0 && i < m.sidebarLen(); i += direction {
+		if m.entries == nil || !m.entries[i].Dir {
+			return i
+		}
+	}
+	return -1
+}
+
+// toggleTreeView switches the sidebar between the flat list and the
+// directory tree, keeping the selected path selected.
+func (m model) toggleTreeView() (tea.Model, tea.Cmd) {
+	path, file := m.selectedPath(), m.selectedFile()
+	m.saveCursor()
+	m.treeView = !m.treeView
+	m.rebuildEntries()
+	m.selectPath(path)
+	if m.selectedFile() == file {
+		return m, nil
+	}
+	return m, m.showSelection()
+}
+
+// toggleSelectedDir collapses or expands the selected directory row.
+func (m model) toggleSelectedDir() (tea.Model, tea.Cmd) {
+	entry, ok := m.selectedDir()
+	if !ok {
+		return m, nil
+	}
+	m.collapsed[entry.Path] = !m.collapsed[entry.Path]
+	m.rebuildEntries()
+	m.selectPath(entry.Path)
+	return m, nil
+}
+
+// showSelection loads the selected file's diff, or shows a directory's
+// summary.
+func (m *model) showSelection() tea.Cmd {
+	if entry, ok := m.selectedDir(); ok {
+		return m.showDirectory(entry)
+	}
+	file := m.selectedFile()
+	if file == "" {
+		return nil
+	}
+	m.rows = loadingRows("loading diff...")
+	m.hunks = nil
+	m.cursor = 0
+	m.diffScroll = 0
+	return m.loadDiff(file)
+}
+
+// showDirectory replaces the diff with a summary of the directory's files.
+// Bumping diffReq drops any diff still loading for the previous selection.
+func (m *model) showDirectory(entry ui.SidebarEntry) tea.Cmd {
+	if m.continuous != nil {
+		return m.showSection(entry.Path)
+	}
+	m.diffReq++
+	m.loadedReq = m.diffReq
+	m.shownFile = ""
+	summary := fmt.Sprintf("(directory %s/: %s)", entry.Path, entry.Totals)
+	m.rows = []diff.Row{{Old: summary, New: summary, Kind: diff.Meta}}
+	m.hunks = nil
+	m.changeStarts = nil
+	m.syntax = nil
+	m.whitespaceErrors, m.invisibleChanges = 0, 0
+	m.guardedLines, m.guardedSize = 0, 0
+	m.preview = nil
+	m.cursor = 0
+	m.diffScroll = 0
+	return m.dismissImages()
+}
+
+// repoLabel is the header's "repo@branch", with "(detached)" after a
+// detached HEAD's commit and "(initial commit)" before the first one; ""
+// until the repository is known.
+func (m *model) repoLabel() string {
+	if m.repo == nil {
+		return ""
+	}
+	label := m.repo.Name
+	if m.repo.Branch != "" {
+		label += "@" + m.repo.Branch
+	}
+	switch {
+	case m.repo.Detached:
+		label += " (detached)"
+	case m.repo.Unborn:
+		label += " (initial commit)"
+	}
+	if m.worktree != "" {
+		label += " in " + m.worktree
+	}
+	return label
+}
+
+func (m *model) repoState() string {
+	if m.repo == nil {
+		return ""
+	}
+	return m.repo.State
+}
+
+// jumpTo puts the cursor on the row showing file's newNo, or else oldNo,
+// loading the file's diff first when another one is shown. The cursor the
+// previous file had is saved as when moving through the sidebar.
+func (m *model) jumpTo(file string, oldNo, newNo *int) tea.Cmd {
+	if m.pathIndex(file) < 0 {
+		m.flash = file + " has no changes listed now"
+		return nil
+	}
+	m.setFocus(ui.FocusNew)
+	if m.continuous != nil {
+		return m.jumpToSection(file, oldNo, newNo)
+	}
+	if file == m.selectedFile() && !m.diffLoading() {
+		m.cursor = diff.FindLine(m.rows, oldNo, newNo)
+		m.saveCursor()
+		m.placeCursor(placeQuarter)
+		return m.requestBlame()
+	}
+	m.saveCursor()
+	m.selectPath(file)
+	if m.selectedFile() != file {
+		m.flash = file + " is in a collapsed directory"
+		return nil
+	}
+	m.rows = loadingRows("loading diff...")
+	m.hunks = nil
+	m.cursor = 0
+	m.diffScroll = 0
+	cmd := m.loadDiff(file)
+	m.anchor = &diff.Row{OldNo: oldNo, NewNo: newNo}
+	m.anchorAbove = ui.NewRowMetrics(m.renderModel()).Lines() / 4
+	return cmd
+}
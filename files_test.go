@@ -0,0 +1,582 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestPathLess(t *testing.T) {
+	paths := []string{"b.go", "a/z.go", "a/b/c.go", "a.go", "a/b.go", "ab/a.go", "a-b.go", "a/b/a.go"}
+	sort.Slice(paths, func(i, j int) bool { return pathLess(paths[i], paths[j]) })
+	want := []string{"a/b/a.go", "a/b/c.go", "a/b.go", "a/z.go", "ab/a.go", "a-b.go", "a.go", "b.go"}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Fatalf("got %q, want %q", paths, want)
+		}
+	}
+	for _, p := range paths {
+		if pathLess(p, p) {
+			t.Fatalf("pathLess(%q, %q) = true", p, p)
+		}
+	}
+}
+
+func TestSortFiles_ConflictsFirst(t *testing.T) {
+	m := initialModel(defaultOptions())
+	m.fileStatuses = map[string]string{"a.go": "M", "b/c.go": "C", "d.go": "A", "z.go": "C"}
+	m.reviewed = map[reviewKey]string{{file: "z.go", mode: m.mode}: ""}
+	for _, order := range []fileSort{sortPath, sortStatus, sortChurn} {
+		m.fileSort = order
+		files := []string{"a.go", "b/c.go", "d.go", "z.go"}
+		m.sortFiles(files)
+		if files[0] != "b/c.go" || files[1] != "z.go" {
+			t.Fatalf("%s: %q, want the conflicted files first", order, files)
+		}
+	}
+}
+
+func TestSortFiles_CycleKeepsTheSelection(t *testing.T) {
+	m := initialModel(defaultOptions())
+	m.width, m.height = 160, 50
+	statuses := map[string]string{"b.go": "M", "pkg/a.go": "D", "c.go": "A", "a.go": "M"}
+	stats := map[string]git.FileStat{"b.go": {Added: 1}, "pkg/a.go": {Deleted: 40}, "c.go": {Added: 3, Deleted: 3}, "a.go": {Added: 2}}
+	next, _ := m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{"c.go", "b.go", "a.go", "pkg/a.go"}, statuses: statuses, stats: stats})
+	m = next.(model)
+	m.selected = 2
+	selected := m.selectedFile()
+	for _, want := range []struct {
+		sort  string
+		files string
+	}{
+		{"path", "pkg/a.go a.go b.go c.go"},
+		{"status", "c.go a.go b.go pkg/a.go"},
+		{"churn", "pkg/a.go c.go a.go b.go"},
+		{"path", "pkg/a.go a.go b.go c.go"},
+	} {
+		if got := strings.Join(m.files, " "); got != want.files {
+			t.Fatalf("%s order %q, want %q", want.sort, got, want.files)
+		}
+		if !strings.Contains(m.sidebarTitle(), " · "+want.sort) {
+			t.Fatalf("title %q does not name the %s order", m.sidebarTitle(), want.sort)
+		}
+		if m.selectedFile() != selected {
+			t.Fatalf("%s order selected %s, want %s kept", want.sort, m.selectedFile(), selected)
+		}
+		m = update(t, m, runeKeys("o")...)
+	}
+	// The order holds across a refresh, whatever order git lists files in.
+	next, _ = m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{"a.go", "pkg/a.go", "b.go", "c.go"}, statuses: statuses, stats: stats})
+	m = next.(model)
+	if got := strings.Join(m.files, " "); got != "c.go a.go b.go pkg/a.go" {
+		t.Fatalf("status order %q after a refresh", got)
+	}
+}
+
+// loadedModel is a model showing n changed files across nested directories.
+func loadedModel(n int) model {
+	files := make([]string, n)
+	statuses := make(map[string]string, n)
+	stats := make(map[string]git.FileStat, n)
+	for i := range files {
+		files[i] = fmt.Sprintf("vendor/mod%03d/pkg%02d/file%05d.go", i%97, i%13, i)
+		statuses[files[i]] = "AMDR?"[i%5 : i%5+1]
+		stats[files[i]] = git.FileStat{Added: i % 40, Deleted: i % 7}
+	}
+	m := initialModel(defaultOptions())
+	m.width, m.height = 160, 50
+	next, _ := m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: files, statuses: statuses, stats: stats})
+	return next.(model)
+}
+
+func TestFilesLoaded_SelectedFileVanishes(t *testing.T) {
+	m := loadedModel(5)
+	m.selected = 2
+	gone, after := m.files[2], m.files[3]
+	m.cursors[cursorKey{file: gone, mode: m.mode, algo: m.diffAlgo}] = cursorPos{cursor: 7}
+	m.lastCursors[gone] = cursorPos{cursor: 7}
+	var files []string
+	for _, f := range m.allFiles {
+		if f != gone {
+			files = append(files, f)
+		}
+	}
+	next, _ := m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: files, statuses: m.fileStatuses, stats: m.fileStats})
+	m = next.(model)
+	if got := m.selectedFile(); got != after {
+		t.Fatalf("selected %q after %q went away, want its neighbour %q", got, gone, after)
+	}
+	if _, ok := m.savedCursor(gone); ok {
+		t.Fatal("cursor of the vanished file was kept")
+	}
+	if want := gone + " no longer has changes"; m.notice() != want {
+		t.Fatalf("notice = %q, want %q", m.notice(), want)
+	}
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	m = next.(model)
+	if notice := m.notice(); notice != "" {
+		t.Fatalf("notice %q outlived the next key", notice)
+	}
+}
+
+func TestDiffLoaded_VanishedFile(t *testing.T) {
+	m := loadedModel(3)
+	file := m.selectedFile()
+	next, _ := m.handleDiffLoaded(diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: file, vanished: true})
+	m = next.(model)
+	want := "(" + file + " no longer has changes)"
+	if len(m.rows) != 1 || m.rows[0].New != want {
+		t.Fatalf("rows = %+v, want the single notice %q", m.rows, want)
+	}
+}
+
+func TestDiffLoaded_OpensOnTheFirstChange(t *testing.T) {
+	m := loadedModel(3)
+	file := m.selectedFile()
+	added := 61
+	rows := append(contextRows(1, 60), diff.Row{NewNo: &added, New: "new", Kind: diff.Add})
+	rows = append(rows, contextRows(62, 70)[1:]...)
+	msg := diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: file, rows: rows, hunks: []diff.Hunk{{RowStart: 0, RowEnd: len(rows)}}}
+	next, _ := m.handleDiffLoaded(msg)
+	m = next.(model)
+	if m.cursor != 61 {
+		t.Fatalf("first visit opened on row %d, want the added line at 61", m.cursor)
+	}
+	if rows := ui.NewRowMetrics(m.renderModel()).Lines(); m.cursor < m.diffScroll || m.cursor >= m.diffScroll+rows {
+		t.Fatalf("scroll %d leaves the first change off screen", m.diffScroll)
+	}
+	// A file seen before reopens where it was left.
+	m.cursor, m.diffScroll = 10, 0
+	m.saveCursor()
+	next, _ = m.handleDiffLoaded(msg)
+	m = next.(model)
+	if m.cursor != 10 {
+		t.Fatalf("second visit opened on row %d, want the saved 10", m.cursor)
+	}
+	// Without changes to land on, the diff opens at the top.
+	m.selected = 1
+	m.showSelection()
+	next, _ = m.handleDiffLoaded(diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: m.selectedFile(), rows: contextRows(1, 20)})
+	m = next.(model)
+	if m.cursor != 0 {
+		t.Fatalf("unchanged diff opened on row %d, want 0", m.cursor)
+	}
+}
+
+func TestToggleMode_KeepsSelectedFile(t *testing.T) {
+	m := loadedModel(5)
+	m.selected = 3
+	file, other := m.selectedFile(), m.files[0]
+	m.showSelection()
+	next, _ := m.handleDiffLoaded(diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: file, rows: contextRows(1, 20)})
+	m = next.(model)
+	m.cursor = 4
+	next, _ = m.toggleMode()
+	m = next.(model)
+	// The staged list is shorter, so the file sits at another index.
+	staged := []string{other, file}
+	next, _ = m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: staged, statuses: map[string]string{file: "M", other: "M"}})
+	m = next.(model)
+	if got := m.selectedFile(); got != file {
+		t.Fatalf("selected %q after toggling mode, want %q", got, file)
+	}
+	if pos, _ := m.savedCursor(file); pos.cursor != 4 {
+		t.Fatalf("saved cursor = %d, want 4", pos.cursor)
+	}
+}
+
+// BenchmarkSidebarNavigation is holding j in a list of 10,000 files, one
+// keypress and frame per iteration.
+func BenchmarkSidebarNavigation(b *testing.B) {
+	m := loadedModel(10000)
+	down := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		next, _ := m.Update(down)
+		m = next.(model)
+		if m.selected == len(m.files)-1 {
+			m.selected = 0
+		}
+		_ = m.View()
+	}
+}
+
+// BenchmarkLoadFiles is receiving a list of 10,000 files, as at startup.
+func BenchmarkLoadFiles(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		loadedModel(10000)
+	}
+}
+
+// fixtureRepo is a repository with files committed, which later git commands
+// run in until the test ends.
+func fixtureRepo(tb testing.TB, files map[string]string) string {
+	tb.Helper()
+	repo := tb.TempDir()
+	run := func(args ...string) {
+		tb.Helper()
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			tb.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	run("config", "user.name", "tdiff")
+	run("config", "user.email", "tdiff@example.com")
+	for name, content := range files {
+		writeFixture(tb, repo, name, content)
+	}
+	run("add", ".")
+	run("commit", "-q", "-m", "initial")
+	git.SetWorktree(repo)
+	tb.Cleanup(func() { git.SetWorktree("") })
+	return repo
+}
+
+func writeFixture(tb testing.TB, repo, name, content string) {
+	tb.Helper()
+	path := filepath.Join(repo, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		tb.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// BenchmarkLoadFilesUntracked is the git side of a refresh in a worktree with
+// 10,000 untracked files in 100 directories and one tracked file changed.
+func BenchmarkLoadFilesUntracked(b *testing.B) {
+	repo := fixtureRepo(b, map[string]string{"main.go": "package main\n"})
+	writeFixture(b, repo, "main.go", "package main\n\nfunc main() {}\n")
+	// Files written an hour ago, as most untracked files were.
+	old := time.Now().Add(-time.Hour)
+	for i := 0; i < 10000; i++ {
+		name := fmt.Sprintf("gen/d%02d/f%05d.txt", i%100, i)
+		writeFixture(b, repo, name, "one\ntwo\nthree\n")
+		if err := os.Chtimes(filepath.Join(repo, name), old, old); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg := loadFilesCmd(filesJob{mode: git.Worktree, untracked: true})().(filesLoadedMsg)
+		if msg.err != nil || len(msg.files) != 10001 || msg.stats["gen/d07/f00007.txt"].Added != 3 {
+			b.Fatalf("%d files, err %v, stats %+v", len(msg.files), msg.err, msg.stats["gen/d07/f00007.txt"])
+		}
+	}
+}
+
+func TestIgnored_ListedOnlyWhenAsked(t *testing.T) {
+	repo := fixtureRepo(t, map[string]string{"main.go": "package main\n", ".gitignore": "*.log\nbuild/\n"})
+	writeFixture(t, repo, "debug.log", "one\n")
+	writeFixture(t, repo, "build/out.txt", "two\n")
+	writeFixture(t, repo, "new.go", "package main\n")
+
+	msg := loadFilesCmd(filesJob{mode: git.Worktree, untracked: true})().(filesLoadedMsg)
+	if got := strings.Join(msg.files, " "); got != "new.go" {
+		t.Fatalf("files %q without ignored files", got)
+	}
+	msg = loadFilesCmd(filesJob{mode: git.Worktree, untracked: true, ignored: true})().(filesLoadedMsg)
+	sort.Strings(msg.files)
+	if got := strings.Join(msg.files, " "); got != "build/out.txt debug.log new.go" {
+		t.Fatalf("files %q with ignored files", got)
+	}
+	if msg.statuses["debug.log"] != "I" || msg.statuses["build/out.txt"] != "I" || msg.statuses["new.go"] != "?" {
+		t.Fatalf("statuses %v", msg.statuses)
+	}
+
+	m := initialModel(defaultOptions())
+	m.width, m.height = 160, 50
+	req := m.filesReq
+	m = update(t, m, runeKeys("I")...)
+	if !m.showIgnored || m.filesReq != req+1 || !m.newFilesJob().ignored {
+		t.Fatalf("I: show %v, req %d; want ignored files listed again", m.showIgnored, m.filesReq)
+	}
+	next, _ := m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: msg.files, statuses: msg.statuses, ignoredCapped: true})
+	m = next.(model)
+	if want := fmt.Sprintf("ignored files capped at %d", maxIgnoredFiles); m.notice() != want {
+		t.Fatalf("notice %q, want %q", m.notice(), want)
+	}
+}
+
+func TestGenerated_FoldedIntoOneRow(t *testing.T) {
+	m := initialModel(defaultOptions())
+	m.width, m.height = 160, 50
+	files := []string{"api.pb.go", "main.go", "vendor/x/x.go"}
+	generated := map[string]bool{"api.pb.go": true, "vendor/x/x.go": true}
+	next, _ := m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: files, statuses: map[string]string{}, generated: generated})
+	m = next.(model)
+	if got := strings.Join(m.files, " "); got != "main.go" || m.hiddenGenerated != 2 {
+		t.Fatalf("files %q, %d hidden; want the generated ones folded", got, m.hiddenGenerated)
+	}
+	if !strings.Contains(m.View(), "(2 generated files hidden · E)") {
+		t.Fatal("no row for the hidden generated files")
+	}
+	m = update(t, m, runeKeys("E")...)
+	if len(m.files) != 3 || m.hiddenGenerated != 0 || strings.Contains(m.View(), "generated files hidden") {
+		t.Fatalf("files %v, %d hidden after E", m.files, m.hiddenGenerated)
+	}
+	// A failed attribute lookup hides nothing.
+	next, _ = m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: files, statuses: map[string]string{}})
+	m = next.(model)
+	m = update(t, m, runeKeys("E")...)
+	if len(m.files) != 3 {
+		t.Fatalf("files %v without attributes", m.files)
+	}
+}
+
+// contextRows is a diff of lines first through last, all unchanged.
+func contextRows(first, last int) []diff.Row {
+	rows := []diff.Row{{Old: "@@", New: "@@", Kind: diff.HunkHeader}}
+	for no := first; no <= last; no++ {
+		old, new := no, no
+		rows = append(rows, diff.Row{OldNo: &old, NewNo: &new, Old: "x", New: "x", Kind: diff.Context})
+	}
+	return rows
+}
+
+func TestCycleDiffAlgo_KeepsCursorLine(t *testing.T) {
+	m := loadedModel(3)
+	next, _ := m.handleDiffLoaded(diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: m.selectedFile(), rows: contextRows(10, 90)})
+	m = next.(model)
+	m.cursor, m.diffScroll = 41, 36
+
+	next, _ = m.cycleDiffAlgo()
+	m = next.(model)
+	// The other algorithm's hunk starts 20 lines earlier, moving every row.
+	next, _ = m.handleDiffLoaded(diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: m.selectedFile(), rows: contextRows(1, 90)})
+	m = next.(model)
+	if no := m.rows[m.cursor].NewNo; no == nil || *no != 50 {
+		t.Fatalf("cursor on line %v after switching algorithm, want 50", no)
+	}
+	if above := m.cursor - m.diffScroll; above != 5 {
+		t.Fatalf("cursor %d rows below the top, want 5 as before", above)
+	}
+}
+
+func TestSavedCursor_RestoresScrollPerView(t *testing.T) {
+	m := loadedModel(3)
+	file := m.selectedFile()
+	load := func(m model) model {
+		next, _ := m.handleDiffLoaded(diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: m.selectedFile(), rows: contextRows(1, 200)})
+		return next.(model)
+	}
+	press := func(m model, key string) model {
+		next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)})
+		return next.(model)
+	}
+	m = load(m)
+	m.cursor, m.diffScroll = 120, 100
+
+	m = load(press(m, "j"))
+	m = load(press(m, "k"))
+	if m.selectedFile() != file || m.cursor != 120 || m.diffScroll != 100 {
+		t.Fatalf("back on %s at cursor %d, scroll %d; want 120, 100", m.selectedFile(), m.cursor, m.diffScroll)
+	}
+
+	next, _ := m.toggleMode()
+	m = next.(model)
+	next, _ = m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{file}, statuses: map[string]string{file: "M"}})
+	m = load(next.(model))
+	m.cursor, m.diffScroll = 30, 25
+	next, _ = m.toggleMode()
+	m = next.(model)
+	next, _ = m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{file}, statuses: map[string]string{file: "M"}})
+	m = load(next.(model))
+	if m.cursor != 120 || m.diffScroll != 100 {
+		t.Fatalf("worktree position became cursor %d, scroll %d after staged moved; want 120, 100", m.cursor, m.diffScroll)
+	}
+}
+
+func TestRepoLabel(t *testing.T) {
+	m := loadedModel(1)
+	if got := m.repoLabel(); got != "" {
+		t.Fatalf("label before the repository is known: %q", got)
+	}
+	next, _ := m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: m.allFiles, statuses: m.fileStatuses,
+		repo: git.RepoInfo{Name: "tdiff", Branch: "1a2b3c4", Detached: true, State: "REBASING"}, repoOK: true})
+	m = next.(model)
+	if got := m.repoLabel(); got != "tdiff@1a2b3c4 (detached)" || m.repoState() != "REBASING" {
+		t.Fatalf("label %q, state %q", got, m.repoState())
+	}
+	m.repo = &git.RepoInfo{Name: "tdiff", Branch: "main", Unborn: true}
+	if got := m.repoLabel(); got != "tdiff@main (initial commit)" {
+		t.Fatalf("label on an unborn branch %q", got)
+	}
+}
+
+// treeModel lists two files in pkg/, one in pkg/sub/ and one at the top, in
+// the tree view.
+func treeModel(t *testing.T) model {
+	t.Helper()
+	m := initialModel(defaultOptions())
+	m.width, m.height = 160, 50
+	m = update(t, m, treeListing(m.filesReq))
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyCtrlT})
+	if !m.treeView {
+		t.Fatal("ctrl+t did not switch to the tree")
+	}
+	return m
+}
+
+func treeListing(req int) filesLoadedMsg {
+	files := []string{"pkg/a.go", "pkg/b.go", "pkg/sub/c.go", "main.go"}
+	statuses := map[string]string{"pkg/a.go": "M", "pkg/b.go": "M", "pkg/sub/c.go": "A", "main.go": "M"}
+	return filesLoadedMsg{req: req, mode: git.Worktree, files: files, statuses: statuses}
+}
+
+// entryNames is the tree rows as their names, directories with a slash.
+func entryNames(m model) string {
+	names := make([]string, len(m.entries))
+	for i, entry := range m.entries {
+		names[i] = strings.Repeat(" ", entry.Depth) + entry.Name
+		if entry.Dir {
+			names[i] += "/"
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func TestTree_CollapsingHidesChildren(t *testing.T) {
+	m := treeModel(t)
+	full := "pkg/, sub/,  c.go, a.go, b.go,main.go"
+	if got := entryNames(m); got != full {
+		t.Fatalf("tree %q", got)
+	}
+	m.selectPath("pkg")
+	enter := tea.KeyMsg{Type: tea.KeyEnter}
+	m = typeKeys(t, m, enter)
+	if got := entryNames(m); got != "pkg/,main.go" || m.selectedPath() != "pkg" {
+		t.Fatalf("collapsed tree %q with %q selected", got, m.selectedPath())
+	}
+	m = typeKeys(t, m, enter)
+	if got := entryNames(m); got != full {
+		t.Fatalf("expanded again %q", got)
+	}
+}
+
+func TestTree_MotionsSkipCollapsedDirectories(t *testing.T) {
+	m := treeModel(t)
+	enter := tea.KeyMsg{Type: tea.KeyEnter}
+	m.selectPath("pkg/sub")
+	m = typeKeys(t, m, enter)
+	m = update(t, m, runeKeys("j")...)
+	if got := m.selectedPath(); got != "pkg/a.go" {
+		t.Fatalf("j from the collapsed sub/ selected %q", got)
+	}
+	m = update(t, m, runeKeys("k")...)
+	if got := m.selectedPath(); got != "pkg/sub" {
+		t.Fatalf("k back selected %q", got)
+	}
+
+	m.selectPath("pkg")
+	m = typeKeys(t, m, enter)
+	m = update(t, m, runeKeys("j")...)
+	if got := m.selectedPath(); got != "main.go" {
+		t.Fatalf("j past the collapsed pkg/ selected %q", got)
+	}
+	m = update(t, m, runeKeys("k")...)
+	if got := m.selectedPath(); got != "pkg" {
+		t.Fatalf("k back to pkg/ selected %q", got)
+	}
+}
+
+func TestTree_SelectionIsTheFullPath(t *testing.T) {
+	m := treeModel(t)
+	m.selectPath("pkg/sub/c.go")
+	if entry := m.entries[m.selected]; entry.Name != "c.go" || entry.Depth != 2 {
+		t.Fatalf("selected row %+v", entry)
+	}
+	if got := m.selectedFile(); got != "pkg/sub/c.go" {
+		t.Fatalf("selected file %q", got)
+	}
+	m = update(t, m, runeKeys("k")...)
+	if m.selectedFile() != "" || m.selectedPath() != "pkg/sub" {
+		t.Fatalf("directory row: file %q, path %q", m.selectedFile(), m.selectedPath())
+	}
+	m = update(t, m, runeKeys("jj")...)
+	if m.selectedFile() != "pkg/a.go" || m.diffJob.file != "pkg/a.go" {
+		t.Fatalf("selected %q, diff of %q", m.selectedFile(), m.diffJob.file)
+	}
+}
+
+func TestTree_CollapsedDirectoriesSurviveARefresh(t *testing.T) {
+	m := treeModel(t)
+	m.selectPath("pkg/sub")
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	m.selectPath("main.go")
+	m.filesReq++
+	m = update(t, m, treeListing(m.filesReq))
+	if got := entryNames(m); got != "pkg/, sub/, a.go, b.go,main.go" {
+		t.Fatalf("tree after refresh %q", got)
+	}
+	if m.selectedPath() != "main.go" {
+		t.Fatalf("selected %q after refresh", m.selectedPath())
+	}
+}
+
+func TestUntracked_ToggleHidesThemWithoutAskingGit(t *testing.T) {
+	m := initialModel(defaultOptions())
+	m.width, m.height = 160, 50
+	statuses := map[string]string{"a.go": "M", "new.go": "?", "z.go": "M"}
+	next, _ := m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{"a.go", "new.go", "z.go"}, statuses: statuses})
+	m = next.(model)
+	m.selectPath("new.go")
+	req := m.filesReq
+	m = update(t, m, runeKeys("t")...)
+	if got := strings.Join(m.files, " "); got != "a.go z.go" {
+		t.Fatalf("files %q with untracked hidden", got)
+	}
+	if m.filesReq != req {
+		t.Fatal("hiding untracked files listed them again")
+	}
+	if m.selectedFile() == "new.go" || m.selectedFile() == "" {
+		t.Fatalf("selected %q, want a neighbour of the hidden file", m.selectedFile())
+	}
+	if !strings.Contains(m.View(), "untracked hidden") {
+		t.Fatal("the header does not say untracked files are hidden")
+	}
+	// Hidden, they were left out of the next listing, so showing them again
+	// has to ask git.
+	m = update(t, m, runeKeys("t")...)
+	if m.filesReq != req+1 {
+		t.Fatalf("files req %d after showing untracked files, want a new listing", m.filesReq)
+	}
+	if got := strings.Join(m.files, " "); got != "a.go new.go z.go" {
+		t.Fatalf("files %q with untracked shown", got)
+	}
+}
+
+func TestStatusFilter_OnlyFromTheFileList(t *testing.T) {
+	m := initialModel(defaultOptions())
+	m.width, m.height = 160, 50
+	m = update(t, m, treeListing(m.filesReq))
+	m.focus = ui.FocusNew
+	m = update(t, m, runeKeys("D")...)
+	if m.statusFilter != "" || len(m.files) != 4 {
+		t.Fatalf("D in the NEW pane filtered by %q to %v", m.statusFilter, m.files)
+	}
+
+	m.focus = ui.FocusFiles
+	m = update(t, m, runeKeys("A")...)
+	if m.statusFilter != "A" || strings.Join(m.files, " ") != "pkg/sub/c.go" {
+		t.Fatalf("A in the file list filtered by %q to %v", m.statusFilter, m.files)
+	}
+	m = update(t, m, runeKeys("A")...)
+	if m.statusFilter != "" || len(m.files) != 4 {
+		t.Fatalf("A again left filter %q with %v", m.statusFilter, m.files)
+	}
+}
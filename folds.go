@@ -0,0 +1,203 @@
+package main
+
+import (
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/ui"
+)
+
+// foldKey names a folded hunk by its file and the row of its header within
+// that file's diff, so folds stay put while the continuous view loads the
+// files around it.
+type foldKey struct {
+	file string
+	row  int
+}
+
+func (m *model) hunkFoldKey(h diff.Hunk) foldKey {
+	offset := 0
+	if m.continuous != nil {
+		if i := m.sectionAt(h.RowStart); i >= 0 {
+			offset = m.continuous.sections[i].start + 1
+		}
+	}
+	return foldKey{m.rowFile(h.RowStart), h.RowStart - offset}
+}
+
+// foldable reports whether h starts with a header to fold it under; the
+// regions of a full-file diff have none.
+func (m *model) foldable(h diff.Hunk) bool {
+	return h.RowStart >= 0 && h.RowStart < len(m.rows) && m.rows[h.RowStart].Kind == diff.HunkHeader
+}
+
+func (m *model) isFolded(h diff.Hunk) bool {
+	return len(m.folds) > 0 && m.folds[m.hunkFoldKey(h)] && m.foldable(h)
+}
+
+// hiddenRows marks the rows that take no lines: git's file header lines
+// unless they are shown (X) and the bodies of folded hunks, which it also
+// sums up by header row. Both are nil while nothing is hidden.
+func (m *model) hiddenRows() ([]bool, map[int]ui.Fold) {
+	if m.diffLoading() {
+		return nil, nil
+	}
+	var hidden []bool
+	hide := func(idx int) {
+		if hidden == nil {
+			hidden = make([]bool, len(m.rows))
+		}
+		hidden[idx] = true
+	}
+	if !m.showHeaderMeta {
+		for idx, row := range m.rows {
+			if row.Kind == diff.HiddenMeta {
+				hide(idx)
+			}
+		}
+	}
+	if len(m.folds) == 0 {
+		return hidden, nil
+	}
+	var folds map[int]ui.Fold
+	for _, h := range m.hunks {
+		if !m.isFolded(h) {
+			continue
+		}
+		if folds == nil {
+			folds = map[int]ui.Fold{}
+		}
+		var fold ui.Fold
+		for idx := h.RowStart + 1; idx < h.RowEnd && idx < len(m.rows); idx++ {
+			hide(idx)
+			if row := m.rows[idx]; row.Kind == diff.Add || row.Kind == diff.Del {
+				if row.OldNo != nil {
+					fold.Deleted++
+				}
+				if row.NewNo != nil {
+					fold.Added++
+				}
+			}
+		}
+		folds[h.RowStart] = fold
+	}
+	return hidden, folds
+}
+
+// setFold folds or unfolds hunk h.
+func (m *model) setFold(h diff.Hunk, folded bool) {
+	if !m.foldable(h) {
+		return
+	}
+	key := m.hunkFoldKey(h)
+	if !folded {
+		delete(m.folds, key)
+		return
+	}
+	if m.folds == nil {
+		m.folds = map[foldKey]bool{}
+	}
+	m.folds[key] = true
+}
+
+// toggleFold folds the hunk under the cursor down to its header, or opens it
+// again (za).
+func (m *model) toggleFold() {
+	idx := diff.HunkAt(m.hunks, m.cursor)
+	if idx < 0 || m.diffLoading() {
+		return
+	}
+	h := m.hunks[idx]
+	if !m.foldable(h) {
+		m.flash = "nothing to fold: this hunk has no header"
+		return
+	}
+	folded := !m.isFolded(h)
+	m.setFold(h, folded)
+	if folded {
+		m.cursor = h.RowStart
+		m.saveCursor()
+	}
+	m.ensureCursorVisible()
+}
+
+// foldAll folds every hunk of the shown diff (zM), or opens them all (zR).
+func (m *model) foldAll(folded bool) {
+	if m.diffLoading() {
+		return
+	}
+	for _, h := range m.hunks {
+		m.setFold(h, folded)
+	}
+	if idx := diff.HunkAt(m.hunks, m.cursor); folded && idx >= 0 && m.foldable(m.hunks[idx]) {
+		m.cursor = m.hunks[idx].RowStart
+		m.saveCursor()
+	}
+	m.ensureCursorVisible()
+}
+
+// unfoldAt opens the folded hunk holding row, if any.
+func (m *model) unfoldAt(row int) {
+	if len(m.folds) == 0 {
+		return
+	}
+	if idx := diff.HunkAt(m.hunks, row); idx >= 0 && m.isFolded(m.hunks[idx]) {
+		m.setFold(m.hunks[idx], false)
+	}
+}
+
+// revealRow opens the fold row is hidden in, leaving folds it heads alone.
+func (m *model) revealRow(row int) {
+	if idx := diff.HunkAt(m.hunks, row); idx >= 0 && row != m.hunks[idx].RowStart {
+		m.unfoldAt(row)
+	}
+}
+
+// showCursorRow keeps the cursor on a row that shows. Whatever moved it
+// into a folded hunk opens the hunk; hidden header lines are passed over.
+func (m *model) showCursorRow() {
+	m.revealRow(m.cursor)
+	if hidden, _ := m.hiddenRows(); hidden != nil {
+		m.cursor = shownRow(hidden, m.cursor)
+	}
+}
+
+// atLastRow reports whether no row that shows is left past the cursor in
+// direction, so j and k can go on into the next file.
+func (m *model) atLastRow(direction int) bool {
+	hidden, _ := m.hiddenRows()
+	return len(m.rows) == 0 || stepVisible(hidden, m.cursor, direction, len(m.rows)) == m.cursor
+}
+
+// stepVisible moves from row by delta rows that show, passing over folded
+// ones, and stops at the last one that shows before either end.
+func stepVisible(hidden []bool, row, delta, count int) int {
+	if hidden == nil {
+		return clamp(row+delta, 0, count-1)
+	}
+	step := 1
+	if delta < 0 {
+		step, delta = -1, -delta
+	}
+	for ; delta > 0; delta-- {
+		next := row + step
+		for next >= 0 && next < count && hidden[next] {
+			next += step
+		}
+		if next < 0 || next >= count {
+			break
+		}
+		row = next
+	}
+	return row
+}
+
+// shownRow is row, or when it is hidden the first row after it that shows,
+// or failing that the last one before it.
+func shownRow(hidden []bool, row int) int {
+	if row < 0 || row >= len(hidden) || !hidden[row] {
+		return row
+	}
+	if next := stepVisible(hidden, row, 1, len(hidden)); !hidden[next] {
+		return next
+	}
+	return stepVisible(hidden, row, -1, len(hidden))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// foldModel shows a.go with two hunks: rows 0-3 and rows 4-6.
+func foldModel(t *testing.T) model {
+	t.Helper()
+	m := reviewModel()
+	one, two, nine := 1, 2, 9
+	rows := []diff.Row{
+		{Old: "@@ -1 +1,2 @@", New: "@@ -1 +1,2 @@", Kind: diff.HunkHeader},
+		{OldNo: &one, NewNo: &one, Old: "a", New: "b", Kind: diff.Add},
+		{NewNo: &two, New: "c", Kind: diff.Add},
+		{OldNo: &two, NewNo: &two, Old: "d", New: "d", Kind: diff.Context},
+		{Old: "@@ -9 +9 @@", New: "@@ -9 +9 @@", Kind: diff.HunkHeader},
+		{OldNo: &nine, Old: "e", Kind: diff.Del},
+		{NewNo: &nine, New: "f", Kind: diff.Add},
+	}
+	hunks := []diff.Hunk{{RowStart: 0, RowEnd: 4}, {RowStart: 4, RowEnd: 7}}
+	m = update(t, m, diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: "a.go", rows: rows, hunks: hunks})
+	m.focus = ui.FocusNew
+	return m
+}
+
+func runeKeys(seq string) []tea.Msg {
+	msgs := make([]tea.Msg, 0, len(seq))
+	for _, r := range seq {
+		msgs = append(msgs, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	return msgs
+}
+
+func TestFolds_HunkFoldsToItsHeader(t *testing.T) {
+	m := foldModel(t)
+	m.cursor = 2
+	m = update(t, m, runeKeys("za")...)
+	if m.cursor != 0 {
+		t.Fatalf("cursor %d, want the folded hunk's header", m.cursor)
+	}
+	rm := m.renderModel()
+	if fold := rm.Folds[0]; fold != (ui.Fold{Added: 2, Deleted: 1}) {
+		t.Fatalf("fold %+v, want +2 -1", fold)
+	}
+	if !rm.Hidden[1] || !rm.Hidden[3] || rm.Hidden[4] {
+		t.Fatalf("hidden %v", rm.Hidden)
+	}
+
+	// j passes over the folded rows; k comes back to the header.
+	m = update(t, m, runeKeys("j")...)
+	if m.cursor != 4 {
+		t.Fatalf("j went to row %d, want the next hunk", m.cursor)
+	}
+	m = update(t, m, runeKeys("k")...)
+	if m.cursor != 0 {
+		t.Fatalf("k went to row %d, want the folded header", m.cursor)
+	}
+
+	m = update(t, m, runeKeys("za")...)
+	if len(m.folds) != 0 {
+		t.Fatalf("za did not unfold: %v", m.folds)
+	}
+}
+
+func TestFolds_AllAndHunkJumpUnfolds(t *testing.T) {
+	m := foldModel(t)
+	m.cursor = 5
+	m = update(t, m, runeKeys("zM")...)
+	if len(m.folds) != 2 || m.cursor != 4 {
+		t.Fatalf("folds %v, cursor %d", m.folds, m.cursor)
+	}
+	m = update(t, m, runeKeys("p")...)
+	if m.cursor != 0 || len(m.folds) != 1 || m.folds[foldKey{"a.go", 0}] {
+		t.Fatalf("p went to row %d with folds %v, want the first hunk open", m.cursor, m.folds)
+	}
+	// Moving into a folded hunk any other way opens it too.
+	m = update(t, m, runeKeys("G")...)
+	if m.cursor != 6 || len(m.folds) != 0 {
+		t.Fatalf("G went to row %d with folds %v", m.cursor, m.folds)
+	}
+
+	m = update(t, m, runeKeys("zM")...)
+	m = update(t, m, runeKeys("zR")...)
+	if len(m.folds) != 0 {
+		t.Fatalf("zR left %v", m.folds)
+	}
+}
+
+func TestHeaderMeta_HiddenUntilShown(t *testing.T) {
+	m := reviewModel()
+	rows, hunks := diff.ParseHunks("diff --git a/a.go b/a.go\nindex 1111111..2222222 100644\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b\n")
+	m = update(t, m, diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: "a.go", rows: rows, hunks: hunks})
+	m.focus = ui.FocusNew
+	m = update(t, m, runeKeys("gg")...)
+	if m.cursor != 4 {
+		t.Fatalf("gg went to row %d, want the hunk header past the hidden lines", m.cursor)
+	}
+	if rm := m.renderModel(); len(rm.Hidden) != len(rows) || !rm.Hidden[0] || !rm.Hidden[3] || rm.Hidden[4] {
+		t.Fatalf("hidden %v", rm.Hidden)
+	}
+
+	m = update(t, m, runeKeys("Xgg")...)
+	if m.cursor != 0 || m.renderModel().Hidden != nil {
+		t.Fatalf("cursor %d, hidden %v with the header shown", m.cursor, m.renderModel().Hidden)
+	}
+	m = update(t, m, runeKeys("X")...)
+	if m.cursor != 4 {
+		t.Fatalf("cursor %d stayed on a hidden line", m.cursor)
+	}
+}
+
+func TestFolds_HalfPagePassesOverATallFold(t *testing.T) {
+	m := reviewModel()
+	rows := []diff.Row{{Old: "@@ -1 +1,200 @@", New: "@@ -1 +1,200 @@", Kind: diff.HunkHeader}}
+	for i := 1; i <= 200; i++ {
+		n := i
+		rows = append(rows, diff.Row{NewNo: &n, New: "added", Kind: diff.Add})
+	}
+	rows = append(rows, diff.Row{Old: "@@ -300 +500,200 @@", New: "@@ -300 +500,200 @@", Kind: diff.HunkHeader})
+	for i := 500; i < 700; i++ {
+		n := i
+		rows = append(rows, diff.Row{NewNo: &n, New: "added", Kind: diff.Add})
+	}
+	hunks := []diff.Hunk{{RowStart: 0, RowEnd: 201}, {RowStart: 201, RowEnd: len(rows)}}
+	m = update(t, m, diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: "a.go", rows: rows, hunks: hunks})
+	m.focus = ui.FocusNew
+	m.cursor = 0
+	m = update(t, m, runeKeys("za")...)
+
+	for i := 0; i < 5; i++ {
+		before := m.cursor
+		m = update(t, m, tea.KeyMsg{Type: tea.KeyCtrlD})
+		if m.cursor <= before || (m.cursor > 0 && m.cursor <= 200) {
+			t.Fatalf("ctrl+d %d: cursor went from %d to %d", i+1, before, m.cursor)
+		}
+	}
+}
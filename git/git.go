@@ -1,11 +1,18 @@
 package git
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Mode int
@@ -24,6 +31,18 @@ const (
 	DiffPatience
 )
 
+// DiffOptions selects how FileDiff asks git to produce a file's patch.
+type DiffOptions struct {
+	Algo DiffAlgo
+	// FunctionContext passes --function-context so hunks expand to whole functions.
+	FunctionContext bool
+	// Context is the number of context lines around each change (--unified).
+	Context int
+}
+
+// DefaultContext is git's own number of context lines.
+const DefaultContext = 3
+
 func (m Mode) String() string {
 	if m == Staged {
 		return "STAGED"
@@ -49,6 +68,19 @@ func (a DiffAlgo) String() string {
 	}
 }
 
+// DiffAlgos is every algorithm, in the order Next steps through them.
+var DiffAlgos = []DiffAlgo{DiffDefault, DiffHistogram, DiffPatience}
+
+// ParseDiffAlgo reads an algorithm name as String writes it, in any case.
+func ParseDiffAlgo(s string) (DiffAlgo, bool) {
+	for _, algo := range DiffAlgos {
+		if strings.EqualFold(s, algo.String()) {
+			return algo, true
+		}
+	}
+	return DiffDefault, false
+}
+
 func (a DiffAlgo) Next() DiffAlgo {
 	switch a {
 	case DiffDefault:
@@ -60,81 +92,420 @@ func (a DiffAlgo) Next() DiffAlgo {
 	}
 }
 
-func ListChangedFiles(mode Mode) ([]string, error) {
+// ListChangedFiles, FileStatuses and DiffStats leave untracked files out
+// of the worktree listing unless untracked is set, which spares git the walk
+// through the worktree that finds them.
+func ListChangedFiles(mode Mode, untracked bool) ([]string, error) {
 	if mode == Staged {
 		return listFilesStaged()
 	}
-	return listFilesWorktree()
+	return listFilesWorktree(untracked)
 }
 
-func FileStatuses(mode Mode) (map[string]string, error) {
+func FileStatuses(mode Mode, untracked bool) (map[string]string, error) {
 	if mode == Staged {
 		return stagedStatuses()
 	}
-	return worktreeStatuses()
+	return worktreeStatuses(untracked)
 }
 
-func listFilesWorktree() ([]string, error) {
-	out, err := runGit("diff", "--name-only")
+// listFilesWorktree lists paths as git status -z prints them, unquoted, so
+// they key the statuses.
+func listFilesWorktree(untracked bool) ([]string, error) {
+	out, err := runGit("diff", "--name-only", "-z")
 	if err != nil {
 		return nil, err
 	}
 
-	files := parseNonEmptyLines(out)
-	untrackedOut, err := runGit("ls-files", "--others", "--exclude-standard")
+	// A conflicted path is listed once for each side of the merge.
+	files := appendUnique(nil, parseNULFields(out))
+	if !untracked {
+		return files, nil
+	}
+	untrackedOut, err := runGit("ls-files", "-z", "--others", "--exclude-standard")
 	if err != nil {
 		return nil, err
 	}
-	return appendUnique(files, parseNonEmptyLines(untrackedOut)), nil
+	return appendUnique(files, parseNULFields(untrackedOut)), nil
 }
 
 func listFilesStaged() ([]string, error) {
-	out, err := runGit("diff", "--cached", "--name-only")
+	out, err := runGit(cachedDiff("--name-only")...)
 	if err != nil {
 		return nil, err
 	}
 	return parseNonEmptyLines(out), nil
 }
 
-func worktreeStatuses() (map[string]string, error) {
-	out, err := runGit("status", "--porcelain")
+func worktreeStatuses(untracked bool) (map[string]string, error) {
+	status, err := WorktreeStatus(untracked)
 	if err != nil {
 		return nil, err
 	}
+	return status.Codes(), nil
+}
 
-	statuses := map[string]string{}
-	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
-	for _, line := range lines {
-		if len(line) < 3 || strings.TrimSpace(line) == "" {
-			continue
+// Status is git status --porcelain=v2 for the worktree: the branch and its
+// upstream, and every path that differs from HEAD in the index or the
+// worktree.
+type Status struct {
+	Branch BranchStatus
+	Files  []FileStatus
+}
+
+// BranchStatus is the branch header of git status --porcelain=v2. Head is
+// "(detached)" for a detached HEAD and OID "(initial)" before the first
+// commit. Ahead and Behind are only known with an upstream.
+type BranchStatus struct {
+	OID            string
+	Head           string
+	Upstream       string
+	HasAheadBehind bool
+	Ahead          int
+	Behind         int
+}
+
+// FileStatus is one path's record. XY is the index and worktree status
+// pair, "." for a side without changes, "??" for an untracked file and "!!"
+// for an ignored one. Renames and copies keep their source in Orig and the
+// similarity in Score, e.g. "R100".
+type FileStatus struct {
+	XY        string
+	Path      string
+	Orig      string
+	Score     string
+	Unmerged  bool
+	Submodule SubmoduleStatus
+}
+
+// SubmoduleStatus says how a submodule path changed: its checked-out
+// commit, tracked changes inside it, or new files in it. Submodule is false
+// for every other path.
+type SubmoduleStatus struct {
+	Submodule     bool
+	CommitChanged bool
+	Modified      bool
+	Untracked     bool
+}
+
+// Staged and Unstaged report whether the path has changes in the index, or
+// in the worktree over the index.
+func (f FileStatus) Staged() bool {
+	return len(f.XY) == 2 && f.XY[0] != '.' && f.XY[0] != '?' && f.XY[0] != '!'
+}
+
+func (f FileStatus) Unstaged() bool {
+	return len(f.XY) == 2 && f.XY[1] != '.' && f.XY[1] != '?' && f.XY[1] != '!'
+}
+
+// Code is the one-letter status the file list shows for the path, "" for
+// those it does not list.
+func (f FileStatus) Code() string {
+	return normalizeStatusCode(strings.ReplaceAll(f.XY, ".", " "))
+}
+
+// StagedCode is the one-letter status of the path's index side alone, ""
+// without staged changes.
+func (f FileStatus) StagedCode() string {
+	if !f.Staged() || f.Unmerged {
+		return ""
+	}
+	return normalizeStatusRune(rune(f.XY[0]))
+}
+
+// Codes maps each path to its Code, and StagedCodes each path with staged
+// changes to its StagedCode.
+func (s Status) Codes() map[string]string {
+	codes := map[string]string{}
+	for _, file := range s.Files {
+		if code := file.Code(); code != "" {
+			codes[file.Path] = code
 		}
+	}
+	return codes
+}
 
-		code := line[:2]
-		path := parsePorcelainPath(strings.TrimSpace(line[3:]))
-		if path == "" {
-			continue
+func (s Status) StagedCodes() map[string]string {
+	codes := map[string]string{}
+	for _, file := range s.Files {
+		if code := file.StagedCode(); code != "" {
+			codes[file.Path] = code
+		}
+	}
+	return codes
+}
+
+// WorktreeStatus runs git status --porcelain=v2, listing each untracked
+// file when untracked is set and none otherwise.
+func WorktreeStatus(untracked bool) (Status, error) {
+	args := []string{"status", "--porcelain=v2", "-z", "--branch", "--untracked-files=no"}
+	if untracked {
+		args[len(args)-1] = "--untracked-files=all"
+	}
+	out, err := runGit(args...)
+	if err != nil {
+		return Status{}, err
+	}
+	return ParseStatus(out), nil
+}
+
+// ParseStatus reads the output of git status --porcelain=v2 -z, skipping
+// records it does not recognize.
+func ParseStatus(out string) Status {
+	var status Status
+	fields := strings.Split(out, "\x00")
+	for i := 0; i < len(fields); i++ {
+		record := fields[i]
+		kind, rest, _ := strings.Cut(record, " ")
+		switch kind {
+		case "#":
+			status.Branch.parseHeader(rest)
+		case "1":
+			// 1 XY sub mH mI mW hH hI path
+			if parts := strings.SplitN(rest, " ", 8); len(parts) == 8 {
+				status.Files = append(status.Files, newFileStatus(parts[0], parts[1], parts[7]))
+			}
+		case "2":
+			// 2 XY sub mH mI mW hH hI Xscore path, then the source path as
+			// a field of its own.
+			if parts := strings.SplitN(rest, " ", 9); len(parts) == 9 {
+				file := newFileStatus(parts[0], parts[1], parts[8])
+				file.Score = parts[7]
+				if i+1 < len(fields) {
+					i++
+					file.Orig = fields[i]
+				}
+				status.Files = append(status.Files, file)
+			}
+		case "u":
+			// u XY sub m1 m2 m3 mW h1 h2 h3 path
+			if parts := strings.SplitN(rest, " ", 10); len(parts) == 10 {
+				file := newFileStatus(parts[0], parts[1], parts[9])
+				file.Unmerged = true
+				status.Files = append(status.Files, file)
+			}
+		case "?", "!":
+			if rest != "" {
+				status.Files = append(status.Files, FileStatus{XY: kind + kind, Path: rest})
+			}
+		}
+	}
+	return status
+}
+
+func newFileStatus(xy, sub, path string) FileStatus {
+	file := FileStatus{XY: xy, Path: path}
+	if len(sub) == 4 && sub[0] == 'S' {
+		file.Submodule = SubmoduleStatus{
+			Submodule:     true,
+			CommitChanged: sub[1] == 'C',
+			Modified:      sub[2] == 'M',
+			Untracked:     sub[3] == 'U',
+		}
+	}
+	return file
+}
+
+func (b *BranchStatus) parseHeader(header string) {
+	key, value, _ := strings.Cut(header, " ")
+	switch key {
+	case "branch.oid":
+		b.OID = value
+	case "branch.head":
+		b.Head = value
+	case "branch.upstream":
+		b.Upstream = value
+	case "branch.ab":
+		var ahead, behind int
+		if n, _ := fmt.Sscanf(value, "+%d -%d", &ahead, &behind); n == 2 {
+			b.HasAheadBehind, b.Ahead, b.Behind = true, ahead, behind
 		}
+	}
+}
+
+// ListIgnoredFiles lists ignored untracked files, stopping after limit so a
+// huge ignored tree such as node_modules cannot flood the list. capped
+// reports that more files exist.
+func ListIgnoredFiles(limit int) (files []string, capped bool, err error) {
+	args := []string{"ls-files", "--others", "--ignored", "--exclude-standard"}
+	cmd := gitCommand(args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, false, err
+	}
 
-		status := normalizeStatusCode(code)
-		if status == "" {
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
 			continue
 		}
-		statuses[path] = status
+		if len(files) == limit {
+			capped = true
+			break
+		}
+		files = append(files, line)
+	}
+	if capped {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return files, true, nil
 	}
+	if err := cmd.Wait(); err != nil {
+		return nil, false, &CommandError{Args: args, Output: strings.TrimSpace(stderr.String()), Err: err}
+	}
+	return files, false, nil
+}
 
-	// Ensure untracked files are always labeled consistently with the files list.
-	untrackedOut, err := runGit("ls-files", "--others", "--exclude-standard")
+// SkippedFiles lists the files marked skip-worktree or assume-unchanged
+// whose content on disk differs from the index. git diff and git diff-files
+// take the marks at their word and never look, so each marked file present
+// in the worktree is hashed and compared with its index entry; a marked file
+// missing from disk, as in a sparse checkout, is not listed.
+func SkippedFiles() ([]string, error) {
+	// ":/" lists the whole repository when tdiff runs in a subdirectory.
+	out, err := runGit("ls-files", "-v", "-s", "--full-name", "-z", "--", ":/")
 	if err != nil {
 		return nil, err
 	}
-	for _, path := range parseNonEmptyLines(untrackedOut) {
-		statuses[path] = "?"
+	var marked []string
+	sides := map[string][2]string{}
+	for _, entry := range strings.Split(out, "\x00") {
+		// "h 100644 <id> 0\t<path>": S is skip-worktree and a lowercase tag
+		// assume-unchanged.
+		info, file, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 4 || fields[3] != "0" {
+			continue
+		}
+		if tag := fields[0]; tag != "S" && strings.ToUpper(tag) == tag {
+			continue
+		}
+		marked = append(marked, file)
+		sides[file] = [2]string{fields[2]}
+	}
+	if len(marked) == 0 {
+		return nil, nil
+	}
+	if err := hashWorktreeFiles(marked, sides); err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, file := range marked {
+		if side := sides[file]; side[1] != "" && side[1] != side[0] {
+			files = append(files, file)
+		}
 	}
-	return statuses, nil
+	return files, nil
+}
+
+// SkippedFileDiff diffs a file SkippedFiles lists against its index blob
+// with git diff --no-index, as git diff shows nothing while it is marked.
+func SkippedFileDiff(opts DiffOptions, file string) (string, error) {
+	blob, err := runGit("cat-file", "blob", ":"+file)
+	if err != nil {
+		return "", err
+	}
+	path := WorktreePath(file)
+	tmp, err := os.CreateTemp("", "tdiff-index-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(blob)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	// Matching the worktree file's mode keeps a mode change out of the diff.
+	if info, err := os.Stat(path); err == nil {
+		_ = os.Chmod(tmp.Name(), info.Mode().Perm())
+	}
+	args := append([]string{"diff", "--no-color"}, diffOptionArgs(opts)...)
+	args = append(args, "--no-index", "--", tmp.Name(), path)
+	out, err := runDiffAllowExitCodesWithAlgoFallback(opts.Algo, map[int]struct{}{1: {}}, args...)
+	if err != nil {
+		return "", err
+	}
+	// Name both sides in the header after the file rather than the
+	// temporary copy.
+	replacer := strings.NewReplacer(
+		"a/"+strings.TrimPrefix(filepath.ToSlash(tmp.Name()), "/"), "a/"+file,
+		"b/"+strings.TrimPrefix(filepath.ToSlash(path), "/"), "b/"+file,
+	)
+	header, body := out, ""
+	if i := strings.Index(out, "\n@@"); i >= 0 {
+		header, body = out[:i], out[i:]
+	}
+	return replacer.Replace(header) + body, nil
+}
+
+// HasCommits reports whether HEAD points at a commit; on an unborn branch,
+// as in a repository that was just initialized, it does not.
+func HasCommits() bool {
+	_, err := runGit("rev-parse", "--verify", "--quiet", "HEAD")
+	return err == nil
+}
+
+// emptyTree is the id of the tree with nothing in it, which staged mode
+// compares the index with before the first commit.
+func emptyTree() string {
+	out, err := runGitInput("", "hash-object", "-t", "tree", "--stdin")
+	if err != nil {
+		// The SHA-1 empty tree, which git knows without it being stored.
+		return "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	}
+	return strings.TrimSpace(out)
+}
+
+// unborn is whether the branch has no commits yet, as the last refresh found
+// it, so staged diffs need not ask git for HEAD on every call.
+var unborn struct {
+	sync.Mutex
+	known, value bool
+}
+
+// SetUnborn records RepoInfo.Unborn for the staged diffs that follow, until
+// the next refresh or worktree switch.
+func SetUnborn(value bool) {
+	unborn.Lock()
+	unborn.known, unborn.value = true, value
+	unborn.Unlock()
+}
+
+// isUnborn is what SetUnborn last recorded, or what git says when nothing
+// has been recorded for this worktree yet.
+func isUnborn() bool {
+	unborn.Lock()
+	known, value := unborn.known, unborn.value
+	unborn.Unlock()
+	if known {
+		return value
+	}
+	value = !HasCommits()
+	SetUnborn(value)
+	return value
+}
+
+// cachedDiff is git diff --cached with args: against HEAD, or against the
+// empty tree on an unborn branch so every staged file shows as added.
+func cachedDiff(args ...string) []string {
+	diff := []string{"diff", "--cached"}
+	if isUnborn() {
+		diff = append(diff, emptyTree())
+	}
+	return append(diff, args...)
 }
 
 func stagedStatuses() (map[string]string, error) {
-	out, err := runGit("diff", "--cached", "--name-status")
+	out, err := runGit(cachedDiff("--name-status")...)
 	if err != nil {
 		return nil, err
 	}
@@ -173,17 +544,6 @@ func stagedStatuses() (map[string]string, error) {
 	return statuses, nil
 }
 
-func parsePorcelainPath(path string) string {
-	if path == "" {
-		return ""
-	}
-	if strings.Contains(path, " -> ") {
-		parts := strings.Split(path, " -> ")
-		return strings.TrimSpace(parts[len(parts)-1])
-	}
-	return strings.TrimSpace(path)
-}
-
 func normalizeStatusCode(code string) string {
 	code = strings.TrimSpace(code)
 	if code == "" {
@@ -192,6 +552,9 @@ func normalizeStatusCode(code string) string {
 	if code == "??" {
 		return "?"
 	}
+	if unmergedCodes[code] {
+		return "C"
+	}
 
 	// porcelain uses XY: prefer unstaged (Y) for worktree-like display, then X.
 	if len(code) >= 2 {
@@ -205,6 +568,10 @@ func normalizeStatusCode(code string) string {
 	return normalizeStatusRune(rune(code[0]))
 }
 
+// unmergedCodes are the XY pairs git status gives a path a merge left
+// conflicted: deleted, added or modified by us, them or both.
+var unmergedCodes = map[string]bool{"DD": true, "AU": true, "UD": true, "UA": true, "DU": true, "AA": true, "UU": true}
+
 func normalizeStatusRune(r rune) string {
 	switch r {
 	case 'M':
@@ -215,6 +582,11 @@ func normalizeStatusRune(r rune) string {
 		return "D"
 	case 'R', 'C':
 		return "R"
+	case 'T':
+		return "T"
+	case 'U':
+		// git diff --name-status gives conflicted paths a bare U.
+		return "C"
 	case '?':
 		return "?"
 	default:
@@ -222,17 +594,918 @@ func normalizeStatusRune(r rune) string {
 	}
 }
 
-func FileDiff(mode Mode, algo DiffAlgo, file string) (string, error) {
+func FileDiff(mode Mode, opts DiffOptions, file string) (string, error) {
+	if mode == Staged {
+		return loadDiffStaged(opts, file)
+	}
+	return loadDiffWorktree(opts, file)
+}
+
+// HasChanges reports whether file still differs in mode: from the index, or
+// untracked, in the worktree; from HEAD when staged. Changes only in the
+// index do not count in the worktree, whose diff leaves them out.
+func HasChanges(mode Mode, file string) (bool, error) {
+	if mode == Staged {
+		out, err := runGit(cachedDiff("--name-only", "--", file)...)
+		if err != nil {
+			return false, err
+		}
+		return strings.TrimSpace(out) != "", nil
+	}
+
+	args := []string{"diff", "--quiet", "--", file}
+	cmd := gitCommand(args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return true, nil
+	case err != nil:
+		return false, &CommandError{Args: args, Output: strings.TrimSpace(stderr.String()), Err: err}
+	}
+	return isUntrackedFile(file)
+}
+
+// ChangedLineCount reports how many lines a file's diff adds plus deletes without
+// loading the patch itself. Binary files report binary=true and a zero count.
+func ChangedLineCount(mode Mode, file string) (int, bool, error) {
+	args := []string{"diff", "--numstat", "--", file}
+	if mode == Staged {
+		args = cachedDiff("--numstat", "--", file)
+	}
+	out, err := runGit(args...)
+	if err != nil {
+		return 0, false, err
+	}
+	if mode == Worktree && strings.TrimSpace(out) == "" {
+		untracked, err := isUntrackedFile(file)
+		if err != nil {
+			return 0, false, err
+		}
+		if untracked {
+			out, err = runGitAllowExitCodes(map[int]struct{}{1: {}}, "diff", "--numstat", "--no-index", "--", "/dev/null", file)
+			if err != nil {
+				return 0, false, err
+			}
+		}
+	}
+	count, binary := parseNumstat(out)
+	return count, binary, nil
+}
+
+func parseNumstat(out string) (int, bool) {
+	total := 0
+	for _, line := range parseNonEmptyLines(out) {
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		if parts[0] == "-" || parts[1] == "-" {
+			return 0, true
+		}
+		added, errAdd := strconv.Atoi(parts[0])
+		deleted, errDel := strconv.Atoi(parts[1])
+		if errAdd != nil || errDel != nil {
+			continue
+		}
+		total += added + deleted
+	}
+	return total, false
+}
+
+// FileStat is one file's line counts from git diff --numstat.
+type FileStat struct {
+	Added   int
+	Deleted int
+	Binary  bool
+}
+
+// DiffStats returns line counts for every changed file in mode, keyed like
+// ListChangedFiles. Untracked files count all their lines as added, counted
+// here rather than by a git process per file. When some of them cannot be
+// read it returns the counts it has with an error naming those files.
+func DiffStats(mode Mode, untracked bool) (map[string]FileStat, error) {
+	args := []string{"diff", "--numstat", "-z"}
+	if mode == Staged {
+		args = cachedDiff("--numstat", "-z")
+	}
+	out, err := runGit(args...)
+	if err != nil {
+		return nil, err
+	}
+	stats := parseNumstatZ(out)
+	if mode == Staged || !untracked {
+		return stats, nil
+	}
+
+	untrackedOut, err := runGit("ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	var failed []string
+	var firstErr error
+	untrackedStats.Lock()
+	defer untrackedStats.Unlock()
+	known := untrackedStats.files
+	untrackedStats.files = make(map[string]untrackedCount, len(known))
+	buf := make([]byte, 64<<10)
+	for _, file := range parseNULFields(untrackedOut) {
+		stat, ok, err := countUntracked(commandPath(file), known, buf)
+		switch {
+		case err != nil:
+			failed = append(failed, file)
+			if firstErr == nil {
+				firstErr = err
+			}
+		case ok:
+			stats[file] = stat
+		}
+	}
+	switch {
+	case len(failed) == 1:
+		return stats, fmt.Errorf("cannot count the lines of untracked %s: %w", failed[0], firstErr)
+	case len(failed) > 1:
+		return stats, fmt.Errorf("cannot count the lines of %d untracked files, %s first: %w", len(failed), failed[0], firstErr)
+	}
+	return stats, nil
+}
+
+// binarySniffLen is how much of a file is searched for a NUL byte to tell
+// binary from text, as git does.
+const binarySniffLen = 8000
+
+// untrackedStats remembers the untracked files DiffStats counted, so a
+// refresh only reads the ones whose size or modification time changed.
+var untrackedStats struct {
+	sync.Mutex
+	files map[string]untrackedCount
+}
+
+type untrackedCount struct {
+	size    int64
+	modTime time.Time
+	stat    FileStat
+}
+
+// racyWindow is how recently a file must not have changed for its count to
+// be kept: a write within the same timestamp could leave size and time as
+// they were.
+const racyWindow = 2 * time.Second
+
+// countUntracked is untrackedStat for path, taken from known when the file
+// is as it was then. It records the count in untrackedStats.
+func countUntracked(path string, known map[string]untrackedCount, buf []byte) (FileStat, bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return FileStat{}, false, err
+	}
+	if prev, ok := known[path]; ok && prev.size == info.Size() && prev.modTime.Equal(info.ModTime()) {
+		untrackedStats.files[path] = prev
+		return prev.stat, true, nil
+	}
+	stat, ok, err := untrackedStat(path, buf)
+	if ok && time.Since(info.ModTime()) > racyWindow {
+		untrackedStats.files[path] = untrackedCount{size: info.Size(), modTime: info.ModTime(), stat: stat}
+	}
+	return stat, ok, err
+}
+
+// untrackedStat counts an untracked file the way git diff --numstat counts a
+// new one: every line added, or binary when its start holds a NUL byte. A
+// symlink is one line, its target. ok is false for what git lists that is
+// not a file, such as a nested repository. buf is reused from file to file
+// and must be longer than binarySniffLen.
+func untrackedStat(path string, buf []byte) (stat FileStat, ok bool, err error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return FileStat{}, false, err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return FileStat{Added: 1}, true, nil
+	case !info.Mode().IsRegular():
+		return FileStat{}, false, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return FileStat{}, false, err
+	}
+	defer f.Close()
+	last := byte('\n')
+	for first := true; ; first = false {
+		n, err := io.ReadFull(f, buf)
+		if first {
+			head := buf[:n]
+			if len(head) > binarySniffLen {
+				head = head[:binarySniffLen]
+			}
+			if bytes.IndexByte(head, 0) >= 0 {
+				return FileStat{Binary: true}, true, nil
+			}
+		}
+		if n > 0 {
+			stat.Added += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return FileStat{}, false, err
+		}
+	}
+	if last != '\n' {
+		stat.Added++
+	}
+	return stat, true, nil
+}
+
+// ConflictMarkerFiles returns the changed files of mode whose added lines
+// include leftover conflict markers, as git diff --check reports them.
+// Untracked files are not checked.
+func ConflictMarkerFiles(mode Mode) (map[string]bool, error) {
+	args := []string{"-c", "core.quotePath=false", "diff", "--check", "--no-color"}
+	if mode == Staged {
+		args = append([]string{"-c", "core.quotePath=false"}, cachedDiff("--check", "--no-color")...)
+	}
+	// --check exits 2 when it finds problems, whitespace errors included.
+	out, err := runGitAllowExitCodes(map[int]struct{}{2: {}}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseConflictMarkerCheck(out), nil
+}
+
+// parseConflictMarkerCheck picks the "path:line: leftover conflict marker"
+// lines out of git diff --check output. The offending lines it quotes start
+// with "+", so they never match.
+func parseConflictMarkerCheck(out string) map[string]bool {
+	files := map[string]bool{}
+	for _, line := range parseNonEmptyLines(out) {
+		rest := strings.TrimSuffix(line, ": leftover conflict marker")
+		colon := strings.LastIndexByte(rest, ':')
+		if rest == line || strings.HasPrefix(line, "+") || colon <= 0 {
+			continue
+		}
+		path := rest[:colon]
+		if unquoted, err := strconv.Unquote(path); err == nil {
+			path = unquoted
+		}
+		files[path] = true
+	}
+	return files
+}
+
+// UnmergedFiles returns the files a merge, rebase or cherry-pick left
+// conflicted in the index, whichever mode is shown.
+func UnmergedFiles() (map[string]bool, error) {
+	out, err := runGit("diff", "--name-only", "--diff-filter=U", "-z")
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]bool{}
+	for _, file := range strings.Split(out, "\x00") {
+		if file != "" {
+			files[file] = true
+		}
+	}
+	return files, nil
+}
+
+// TakeSide resolves a conflicted file wholesale: it checks out our side of
+// the merge, or theirs, over the worktree copy and stages the result.
+func TakeSide(file string, theirs bool) error {
+	side := "--ours"
+	if theirs {
+		side = "--theirs"
+	}
+	path := WorktreePath(file)
+	if _, err := runGit("checkout", side, "--", path); err != nil {
+		return err
+	}
+	_, err := runGit("add", "--", path)
+	return err
+}
+
+// MergeFile merges the changes from base to remote into local as a
+// mergetool sees them, returning the result with diff3-style markers
+// around each conflict. The files are left as they are.
+func MergeFile(local, base, remote string) (string, error) {
+	// merge-file exits with the number of conflicts, up to 127.
+	conflicts := map[int]struct{}{}
+	for n := 1; n <= 127; n++ {
+		conflicts[n] = struct{}{}
+	}
+	return runGitAllowExitCodes(conflicts, "merge-file", "-p", "--diff3", "-L", "LOCAL", "-L", "BASE", "-L", "REMOTE", "--", local, base, remote)
+}
+
+// Stash is one entry of git stash list.
+type Stash struct {
+	// Ref names the entry for git stash, e.g. "stash@{0}".
+	Ref     string
+	Subject string
+}
+
+// ListStashes returns the stash entries, newest first.
+func ListStashes() ([]Stash, error) {
+	out, err := runGit("stash", "list", "--format=%gd%x00%gs")
+	if err != nil {
+		return nil, err
+	}
+	var stashes []Stash
+	for _, line := range parseNonEmptyLines(out) {
+		ref, subject, _ := strings.Cut(line, "\x00")
+		stashes = append(stashes, Stash{Ref: ref, Subject: subject})
+	}
+	return stashes, nil
+}
+
+// StashFile sets file's changes aside with git stash push, staged and
+// unstaged alike; untracked files need untracked set to be taken.
+func StashFile(file string, untracked bool) error {
+	args := []string{"stash", "push"}
+	if untracked {
+		args = append(args, "--include-untracked")
+	}
+	_, err := runGit(append(args, "--", WorktreePath(file))...)
+	return err
+}
+
+// StashPatch sets the changes of patch, a worktree patch such as
+// diff.BuildPatch makes for one hunk, aside as a new stash entry named
+// message and takes them out of the worktree. The index is kept as it is,
+// as git stash push -p does.
+func StashPatch(patch, message string) error {
+	top, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	at := []string{"-C", strings.TrimSpace(top)}
+	head, err := runGit("rev-parse", "--verify", "HEAD")
+	if err != nil {
+		return err
+	}
+	head = strings.TrimSpace(head)
+	branch, err := runGit("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return err
+	}
+	message = "On " + strings.TrimSpace(branch) + ": " + message
+
+	// A stash is a commit of the worktree whose parents are HEAD and a
+	// commit of the index; the worktree tree is the index plus patch.
+	indexTree, err := runGit("write-tree")
+	if err != nil {
+		return err
+	}
+	indexCommit, err := runGitInput("index on "+strings.TrimSpace(branch)+"\n", "commit-tree", strings.TrimSpace(indexTree), "-p", head)
+	if err != nil {
+		return err
+	}
+	index, err := os.CreateTemp("", "tdiff-stash-index-*")
+	if err != nil {
+		return err
+	}
+	index.Close()
+	defer os.Remove(index.Name())
+	env := []string{"GIT_INDEX_FILE=" + index.Name()}
+	if _, err := runGitEnv(env, "", "read-tree", strings.TrimSpace(indexTree)); err != nil {
+		return err
+	}
+	if _, err := runGitEnv(env, patch, append(at, "apply", "--cached", "--unidiff-zero", "-")...); err != nil {
+		return err
+	}
+	workTree, err := runGitEnv(env, "", "write-tree")
+	if err != nil {
+		return err
+	}
+	workCommit, err := runGitInput(message+"\n", "commit-tree", strings.TrimSpace(workTree), "-p", head, "-p", strings.TrimSpace(indexCommit))
+	if err != nil {
+		return err
+	}
+	if _, err := runGit("stash", "store", "-m", message, strings.TrimSpace(workCommit)); err != nil {
+		return err
+	}
+	_, err = runGitInput(patch, append(at, "apply", "-R", "--unidiff-zero", "-")...)
+	return err
+}
+
+// StashContents is what the entry ref changes, as git stash show prints it:
+// a summary of its files followed by the patch.
+func StashContents(ref string) (string, error) {
+	return runGit("stash", "show", "--stat", "-p", ref)
+}
+
+// StashAction runs git stash pop, apply or drop on the entry ref.
+func StashAction(action, ref string) error {
+	_, err := runGit("stash", action, ref)
+	return err
+}
+
+// parseNumstatZ parses git diff --numstat -z output. Renames carry an empty
+// path followed by the old and new paths; they are keyed by the new path.
+func parseNumstatZ(out string) map[string]FileStat {
+	stats := map[string]FileStat{}
+	fields := strings.Split(out, "\x00")
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		path := parts[2]
+		if path == "" && i+2 < len(fields) {
+			path = fields[i+2]
+			i += 2
+		}
+		var stat FileStat
+		if parts[0] == "-" || parts[1] == "-" {
+			stat.Binary = true
+		} else {
+			stat.Added, _ = strconv.Atoi(parts[0])
+			stat.Deleted, _ = strconv.Atoi(parts[1])
+		}
+		stats[path] = stat
+	}
+	return stats
+}
+
+// zeroObject stands for the missing side of an added or deleted file in
+// DiffBlobs.
+const zeroObject = "0000000000000000000000000000000000000000"
+
+// DiffBlobs names what each of files' diffs in mode is between, as
+// "old..new" object ids with zeros for a side that does not exist, so the
+// name changes whenever the diff does. Worktree files are hashed as git
+// would store them; untracked ones have no old side.
+func DiffBlobs(mode Mode, files []string) (map[string]string, error) {
+	args := []string{"diff", "--raw", "-z", "--no-abbrev"}
+	if mode == Staged {
+		args = cachedDiff("--raw", "-z", "--no-abbrev")
+	}
+	out, err := runGit(args...)
+	if err != nil {
+		return nil, err
+	}
+	sides := parseRawZ(out)
+	if mode == Worktree {
+		if err := hashWorktreeFiles(files, sides); err != nil {
+			return nil, err
+		}
+	}
+	blobs := make(map[string]string, len(sides))
+	for file, side := range sides {
+		if side[0] == "" {
+			side[0] = zeroObject
+		}
+		blobs[file] = side[0] + ".." + side[1]
+	}
+	return blobs, nil
+}
+
+// parseRawZ reads the old and new object ids from git diff --raw -z output,
+// keyed by path. Renames and copies carry both paths; they are keyed by the
+// new one.
+func parseRawZ(out string) map[string][2]string {
+	sides := map[string][2]string{}
+	fields := strings.Split(out, "\x00")
+	for i := 0; i+1 < len(fields); i++ {
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) < 5 {
+			continue
+		}
+		path := fields[i+1]
+		i++
+		if (meta[4][0] == 'R' || meta[4][0] == 'C') && i+1 < len(fields) {
+			path = fields[i+1]
+			i++
+		}
+		sides[path] = [2]string{meta[2], meta[3]}
+	}
+	return sides
+}
+
+// hashWorktreeFiles sets the new side of sides, which git diff leaves as
+// zeros, to the object id of each of files that is in the worktree, in one
+// git hash-object call.
+func hashWorktreeFiles(files []string, sides map[string][2]string) error {
+	out, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	top := strings.TrimSpace(out)
+	var present []string
+	var paths strings.Builder
+	for _, file := range files {
+		path := filepath.Join(top, filepath.FromSlash(file))
+		if info, err := os.Lstat(path); err != nil || info.IsDir() || strings.ContainsAny(file, "\n") {
+			continue
+		}
+		present = append(present, file)
+		paths.WriteString(path + "\n")
+	}
+	if len(present) == 0 {
+		return nil
+	}
+	out, err = runGitInput(paths.String(), "hash-object", "--stdin-paths")
+	if err != nil {
+		return err
+	}
+	ids := parseNonEmptyLines(out)
+	if len(ids) != len(present) {
+		return fmt.Errorf("git hash-object: %d ids for %d files", len(ids), len(present))
+	}
+	for i, file := range present {
+		side := sides[file]
+		side[1] = ids[i]
+		sides[file] = side
+	}
+	return nil
+}
+
+// GeneratedFiles returns which of files .gitattributes marks as generated,
+// either linguist-generated or -diff, using one git check-attr call.
+func GeneratedFiles(files []string) (map[string]bool, error) {
+	generated := map[string]bool{}
+	if len(files) == 0 {
+		return generated, nil
+	}
+	input := strings.Join(files, "\x00") + "\x00"
+	out, err := runGitInput(input, "check-attr", "--stdin", "-z", "linguist-generated", "diff")
+	if err != nil {
+		return nil, err
+	}
+	// -z output is a flat list of path, attribute, value triples.
+	fields := strings.Split(out, "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		path, attr, value := fields[i], fields[i+1], fields[i+2]
+		if (attr == "linguist-generated" && (value == "set" || value == "true")) || (attr == "diff" && value == "unset") {
+			generated[path] = true
+		}
+	}
+	return generated, nil
+}
+
+// FileSizes holds the byte sizes of a file's old and new versions. A side is
+// absent (HasOld/HasNew false) when the file was added or deleted.
+type FileSizes struct {
+	Old    int64
+	New    int64
+	HasOld bool
+	HasNew bool
+}
+
+// BlobSizes looks up the old and new sizes of file for the given mode: the index
+// against the worktree file, or HEAD against the index when staged.
+func BlobSizes(mode Mode, file string) FileSizes {
+	var sizes FileSizes
 	if mode == Staged {
-		return loadDiffStaged(algo, file)
+		sizes.Old, sizes.HasOld = catFileSize("HEAD:" + file)
+		sizes.New, sizes.HasNew = catFileSize(":" + file)
+		return sizes
+	}
+
+	sizes.Old, sizes.HasOld = catFileSize(":" + file)
+	if info, err := os.Stat(WorktreePath(file)); err == nil && !info.IsDir() {
+		sizes.New, sizes.HasNew = info.Size(), true
+	}
+	return sizes
+}
+
+// FileVersions holds the raw old and new contents of a file, following the same
+// old/new sides as BlobSizes.
+type FileVersions struct {
+	Old    []byte
+	New    []byte
+	HasOld bool
+	HasNew bool
+}
+
+// LoadFileVersions reads both sides of file for the given mode.
+func LoadFileVersions(mode Mode, file string) FileVersions {
+	var versions FileVersions
+	if mode == Staged {
+		versions.Old, versions.HasOld = showBlob("HEAD:" + file)
+		versions.New, versions.HasNew = showBlob(":" + file)
+		return versions
+	}
+
+	versions.Old, versions.HasOld = showBlob(":" + file)
+	if data, err := os.ReadFile(WorktreePath(file)); err == nil {
+		versions.New, versions.HasNew = data, true
+	}
+	return versions
+}
+
+// BlameLine is who last changed one line: the abbreviated commit, its
+// author and the author date as YYYY-MM-DD. Lines not committed yet have
+// NotCommitted set and nothing else.
+type BlameLine struct {
+	Commit       string
+	Author       string
+	Date         string
+	NotCommitted bool
+}
+
+// blameAbbrev is how many hex digits of a commit BlameLine keeps.
+const blameAbbrev = 7
+
+// Blame annotates the NEW side of file in mode, keyed by its line numbers:
+// the worktree file, or in staged mode the index copy. A file HEAD does not
+// have yet gets an empty map, since none of its lines are committed.
+func Blame(mode Mode, file string) (map[int]BlameLine, error) {
+	if _, ok := catFileSize("HEAD:" + file); !ok {
+		return map[int]BlameLine{}, nil
+	}
+	var out string
+	var err error
+	if mode == Staged {
+		index, ok := showBlob(":" + file)
+		if !ok {
+			return map[int]BlameLine{}, nil
+		}
+		out, err = runGitInput(string(index), "blame", "--line-porcelain", "--contents", "-", "--", file)
+	} else {
+		out, err = runGit("blame", "--line-porcelain", "--", file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseBlamePorcelain(out), nil
+}
+
+// parseBlamePorcelain parses git blame --line-porcelain output, where every
+// line carries its commit's headers and then the line itself after a tab.
+func parseBlamePorcelain(out string) map[int]BlameLine {
+	lines := map[int]BlameLine{}
+	var line BlameLine
+	var lineNo int
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case strings.HasPrefix(text, "\t"):
+			if lineNo > 0 {
+				lines[lineNo] = line
+			}
+			line, lineNo = BlameLine{}, 0
+		case strings.HasPrefix(text, "author "):
+			line.Author = strings.TrimPrefix(text, "author ")
+		case strings.HasPrefix(text, "author-time "):
+			if secs, err := strconv.ParseInt(strings.TrimPrefix(text, "author-time "), 10, 64); err == nil {
+				line.Date = time.Unix(secs, 0).Format("2006-01-02")
+			}
+		case lineNo == 0:
+			// The first header of a line: <commit> <orig line> <final line>.
+			fields := strings.Fields(text)
+			if len(fields) < 3 {
+				continue
+			}
+			if n, err := strconv.Atoi(fields[2]); err == nil {
+				lineNo = n
+			}
+			if strings.Trim(fields[0], "0") == "" {
+				line.NotCommitted = true
+			} else if len(fields[0]) > blameAbbrev {
+				line.Commit = fields[0][:blameAbbrev]
+			} else {
+				line.Commit = fields[0]
+			}
+		}
+	}
+	for n, l := range lines {
+		if l.NotCommitted {
+			lines[n] = BlameLine{NotCommitted: true}
+		}
+	}
+	return lines
+}
+
+// HistoryCommit is one commit of a line's history: a summary line such as
+// "1a2b3c4 2026-09-30 Jane Doe", its subject and the patch to the line.
+type HistoryCommit struct {
+	Summary string
+	Subject string
+	Patch   string
+}
+
+// historySeparator starts each commit in LineHistory's log output; patch
+// lines are prefixed, so it cannot start one of theirs.
+const historySeparator = "\x1e"
+
+// LineHistory runs git log -L for line of file as HEAD has it, newest
+// first, skipping the first skip commits and returning at most count.
+func LineHistory(file string, line, skip, count int) ([]HistoryCommit, error) {
+	out, err := runGit("log", "--no-color", "--date=short",
+		"--format="+historySeparator+"%h %ad %an%n%s",
+		fmt.Sprintf("--skip=%d", skip), fmt.Sprintf("--max-count=%d", count),
+		fmt.Sprintf("-L%d,%d:%s", line, line, file))
+	if err != nil {
+		return nil, err
 	}
-	return loadDiffWorktree(algo, file)
+	return parseLineHistory(out), nil
 }
 
-func loadDiffWorktree(algo DiffAlgo, file string) (string, error) {
-	args := append([]string{"diff", "--no-color", "--unified=3"}, diffAlgoArgs(algo)...)
+func parseLineHistory(out string) []HistoryCommit {
+	var commits []HistoryCommit
+	for _, section := range strings.Split(out, historySeparator)[1:] {
+		var commit HistoryCommit
+		commit.Summary, section, _ = strings.Cut(section, "\n")
+		commit.Subject, section, _ = strings.Cut(section, "\n")
+		commit.Patch = strings.TrimLeft(section, "\n")
+		commits = append(commits, commit)
+	}
+	return commits
+}
+
+// WhitespaceConfig returns the core.whitespace setting, or "" when it is unset.
+func WhitespaceConfig() string {
+	out, err := runGitAllowExitCodes(map[int]struct{}{1: {}}, "config", "--get", "core.whitespace")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// HasLFS reports whether the git-lfs extension is installed.
+func HasLFS() bool {
+	_, err := exec.LookPath("git-lfs")
+	return err == nil
+}
+
+// LFSSmudge resolves an LFS pointer to the object content it references,
+// fetching it if the local LFS cache does not have it yet.
+func LFSSmudge(pointer, file string) ([]byte, error) {
+	cmd := gitCommand("lfs", "smudge", "--", file)
+	cmd.Stdin = strings.NewReader(pointer)
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, &CommandError{
+			Args:   []string{"lfs", "smudge", "--", file},
+			Output: strings.TrimSpace(stderr.String()),
+			Err:    err,
+		}
+	}
+	return stdout.Bytes(), nil
+}
+
+func showBlob(object string) ([]byte, bool) {
+	out, err := runGit("cat-file", "blob", object)
+	if err != nil {
+		return nil, false
+	}
+	return []byte(out), true
+}
+
+func catFileSize(object string) (int64, bool) {
+	out, err := runGit("cat-file", "-s", object)
+	if err != nil {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+// RepoInfo is where tdiff runs: the top of the worktree and its basename,
+// the current branch or, when HEAD is detached, its abbreviated commit, and
+// the operation in progress, if any, such as "MERGING". Unborn is set before
+// the branch has its first commit.
+type RepoInfo struct {
+	Root     string
+	Name     string
+	Branch   string
+	Detached bool
+	Unborn   bool
+	State    string
+}
+
+// repoStates maps files in the git directory to the operation they show is
+// in progress, in the order they are checked.
+var repoStates = []struct{ path, state string }{
+	{"rebase-merge", "REBASING"},
+	{"rebase-apply", "REBASING"},
+	{"MERGE_HEAD", "MERGING"},
+	{"CHERRY_PICK_HEAD", "CHERRY-PICKING"},
+	{"REVERT_HEAD", "REVERTING"},
+	{"BISECT_LOG", "BISECTING"},
+}
+
+// WorktreeInfo is one of the repository's worktrees as git worktree list
+// describes it. Branch is empty for a detached HEAD.
+type WorktreeInfo struct {
+	Path     string
+	Head     string
+	Branch   string
+	Bare     bool
+	Detached bool
+}
+
+// ListWorktrees lists the repository's worktrees, the main one first.
+func ListWorktrees() ([]WorktreeInfo, error) {
+	out, err := runGit("worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	return parseWorktrees(out), nil
+}
+
+func parseWorktrees(out string) []WorktreeInfo {
+	var worktrees []WorktreeInfo
+	for _, line := range strings.Split(out, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if key == "worktree" {
+			worktrees = append(worktrees, WorktreeInfo{Path: value})
+			continue
+		}
+		if len(worktrees) == 0 {
+			continue
+		}
+		wt := &worktrees[len(worktrees)-1]
+		switch key {
+		case "HEAD":
+			wt.Head = value
+		case "branch":
+			wt.Branch = strings.TrimPrefix(value, "refs/heads/")
+		case "bare":
+			wt.Bare = true
+		case "detached":
+			wt.Detached = true
+		}
+	}
+	return worktrees
+}
+
+// LoadRepoInfo reads RepoInfo for the worktree git commands run in. A repository
+// without commits still has its branch; ok is false outside a repository.
+func LoadRepoInfo() (info RepoInfo, ok bool) {
+	out, err := runGit("rev-parse", "--show-toplevel", "--absolute-git-dir")
+	lines := parseNonEmptyLines(out)
+	if err != nil || len(lines) < 2 {
+		return RepoInfo{}, false
+	}
+	info.Root = lines[0]
+	info.Name = filepath.Base(info.Root)
+	gitDir := lines[1]
+	if branch, err := runGit("symbolic-ref", "--short", "-q", "HEAD"); err == nil {
+		info.Branch = strings.TrimSpace(branch)
+		info.Unborn = !HasCommits()
+	} else if commit, err := runGit("rev-parse", "--short", "HEAD"); err == nil {
+		info.Branch, info.Detached = strings.TrimSpace(commit), true
+	}
+	for _, s := range repoStates {
+		if _, err := os.Stat(filepath.Join(gitDir, s.path)); err == nil {
+			info.State = s.state
+			break
+		}
+	}
+	return info, true
+}
+
+// RemoteURL is the URL the named remote fetches from.
+func RemoteURL(name string) (string, error) {
+	out, err := runGit("remote", "get-url", name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// WorktreePath resolves a repository-relative path (as printed by git diff)
+// against the top of the worktree so it can be opened from any subdirectory.
+func WorktreePath(file string) string {
+	out, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return file
+	}
+	top := strings.TrimSpace(out)
+	if top == "" {
+		return file
+	}
+	return filepath.Join(top, file)
+}
+
+// GitDirPath is file inside the repository's git directory, for files tdiff
+// writes that should not show up as untracked in the worktree.
+func GitDirPath(file string) (string, error) {
+	out, err := runGit("rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(strings.TrimSpace(out), file), nil
+}
+
+func loadDiffWorktree(opts DiffOptions, file string) (string, error) {
+	args := append([]string{"diff", "--no-color"}, diffOptionArgs(opts)...)
 	args = append(args, "--", file)
-	out, err := runDiffWithAlgoFallback(algo, args...)
+	out, err := runDiffWithAlgoFallback(opts.Algo, args...)
 	if err != nil {
 		return "", err
 	}
@@ -249,19 +1522,27 @@ func loadDiffWorktree(algo DiffAlgo, file string) (string, error) {
 	}
 
 	// Untracked files are not shown by plain `git diff`; compare against /dev/null.
-	return loadDiffNoIndex(algo, file)
+	return loadDiffNoIndex(opts, file)
 }
 
-func loadDiffStaged(algo DiffAlgo, file string) (string, error) {
-	args := append([]string{"diff", "--cached", "--no-color", "--unified=3"}, diffAlgoArgs(algo)...)
+func loadDiffStaged(opts DiffOptions, file string) (string, error) {
+	args := append(cachedDiff("--no-color"), diffOptionArgs(opts)...)
 	args = append(args, "--", file)
-	return runDiffWithAlgoFallback(algo, args...)
+	return runDiffWithAlgoFallback(opts.Algo, args...)
 }
 
-func loadDiffNoIndex(algo DiffAlgo, file string) (string, error) {
-	args := append([]string{"diff", "--no-color", "--unified=3"}, diffAlgoArgs(algo)...)
+func loadDiffNoIndex(opts DiffOptions, file string) (string, error) {
+	args := append([]string{"diff", "--no-color"}, diffOptionArgs(opts)...)
 	args = append(args, "--no-index", "--", "/dev/null", file)
-	return runDiffAllowExitCodesWithAlgoFallback(algo, map[int]struct{}{1: {}}, args...)
+	return runDiffAllowExitCodesWithAlgoFallback(opts.Algo, map[int]struct{}{1: {}}, args...)
+}
+
+func diffOptionArgs(opts DiffOptions) []string {
+	args := append([]string{"--unified=" + strconv.Itoa(opts.Context)}, diffAlgoArgs(opts.Algo)...)
+	if opts.FunctionContext {
+		args = append(args, "--function-context")
+	}
+	return args
 }
 
 func diffAlgoArgs(algo DiffAlgo) []string {
@@ -364,12 +1645,94 @@ func FriendlyError(err error) string {
 		if strings.Contains(lower, "not a git repository") {
 			return "Not a git repository. Run TDiff inside a git repository."
 		}
+		if isMissingHead(lower) {
+			return "This repository has no commits yet, so there is no HEAD to compare with."
+		}
 	}
 	return err.Error()
 }
 
+// IsIndexLocked reports whether err is git failing because another process
+// holds .git/index.lock.
+func IsIndexLocked(err error) bool {
+	var cmdErr *CommandError
+	return errors.As(err, &cmdErr) && strings.Contains(cmdErr.Output, "index.lock")
+}
+
+// isMissingHead reports whether lowercased git output is a complaint about
+// HEAD not resolving, which it does not before the first commit.
+func isMissingHead(lower string) bool {
+	for _, msg := range []string{"bad revision 'head'", "ambiguous argument 'head'", "bad default revision 'head'", "does not have any commits yet"} {
+		if strings.Contains(lower, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorHint suggests what to do about err for failures with a common cause,
+// and is empty for the rest.
+func ErrorHint(err error) string {
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		return ""
+	}
+	lower := strings.ToLower(cmdErr.Output)
+	switch {
+	case strings.Contains(lower, "not a git repository"):
+		return "Run TDiff from inside a git repository."
+	case isMissingHead(lower):
+		return "Make a first commit to get a HEAD; until then staged mode compares the index with an empty tree."
+	case IsIndexLocked(err):
+		return "Another git process, often an editor, holds the index lock. Wait for it to finish; if none is running, delete the index.lock file named above."
+	case strings.Contains(lower, "unknown revision"), strings.Contains(lower, "bad revision"),
+		strings.Contains(lower, "bad object"), strings.Contains(lower, "ambiguous argument"):
+		return "A revision could not be resolved. Check that the branch or commit exists; a repository without commits has no HEAD yet."
+	}
+	return ""
+}
+
+var worktree struct {
+	sync.Mutex
+	dir string
+}
+
+// SetWorktree runs every later git command in dir, as with git -C; "" runs
+// them in the current directory again.
+func SetWorktree(dir string) {
+	worktree.Lock()
+	worktree.dir = dir
+	worktree.Unlock()
+	unborn.Lock()
+	unborn.known = false
+	unborn.Unlock()
+}
+
+// gitCommand is git with args, run in the worktree SetWorktree chose.
+func gitCommand(args ...string) *exec.Cmd {
+	worktree.Lock()
+	dir := worktree.dir
+	worktree.Unlock()
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	return exec.Command("git", args...)
+}
+
+// commandPath is file, which git printed relative to where it runs, as a
+// path this process can open.
+func commandPath(file string) string {
+	worktree.Lock()
+	dir := worktree.dir
+	worktree.Unlock()
+	if dir == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(dir, file)
+}
+
 func runGit(args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
+	cmd := gitCommand(args...)
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -386,8 +1749,35 @@ func runGit(args ...string) (string, error) {
 	return stdout.String(), nil
 }
 
+// runGitInput runs git with input on stdin.
+func runGitInput(input string, args ...string) (string, error) {
+	return runGitEnv(nil, input, args...)
+}
+
+// runGitEnv runs git with env added to its environment and input on stdin.
+func runGitEnv(env []string, input string, args ...string) (string, error) {
+	cmd := gitCommand(args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdin = strings.NewReader(input)
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		output := strings.TrimSpace(stdout.String() + "\n" + stderr.String())
+		return output, &CommandError{
+			Args:   append([]string(nil), args...),
+			Output: output,
+			Err:    err,
+		}
+	}
+	return stdout.String(), nil
+}
+
 func runGitAllowExitCodes(allowed map[int]struct{}, args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
+	cmd := gitCommand(args...)
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -410,14 +1800,27 @@ func runGitAllowExitCodes(allowed map[int]struct{}, args ...string) (string, err
 	return stdout.String(), nil
 }
 
+// isUntrackedFile reports whether file is not tracked, ignored or not, so
+// ignored files listed on request load through the same no-index path.
 func isUntrackedFile(file string) (bool, error) {
-	out, err := runGit("ls-files", "--others", "--exclude-standard", "--", file)
+	out, err := runGit("ls-files", "--others", "--", file)
 	if err != nil {
 		return false, err
 	}
 	return strings.TrimSpace(out) != "", nil
 }
 
+// parseNULFields splits -z output into its non-empty fields.
+func parseNULFields(s string) []string {
+	var fields []string
+	for _, field := range strings.Split(s, "\x00") {
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
 func parseNonEmptyLines(s string) []string {
 	s = strings.TrimSpace(s)
 	if s == "" {
@@ -0,0 +1,398 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+)
+
+// testRepo makes a repository in a temporary directory with files
+// committed, and runs git there until the test ends.
+func testRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	run("init", "-q")
+	run("config", "user.name", "tdiff")
+	run("config", "user.email", "tdiff@example.com")
+	for name, content := range files {
+		writeFile(t, filepath.Join(dir, name), content)
+	}
+	run("add", ".")
+	run("commit", "-q", "-m", "initial")
+	SetWorktree(dir)
+	t.Cleanup(func() { SetWorktree("") })
+	return dir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStashPatch_StashesOneHunkWithoutContext(t *testing.T) {
+	lines := []string{"one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten"}
+	dir := testRepo(t, map[string]string{"a.txt": strings.Join(lines, "\n") + "\n"})
+	lines[1], lines[8] = "TWO", "NINE"
+	edited := strings.Join(lines, "\n") + "\n"
+	writeFile(t, filepath.Join(dir, "a.txt"), edited)
+
+	raw, err := FileDiff(Worktree, DiffOptions{Context: 0}, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, hunks := diff.ParseHunks(raw)
+	if len(hunks) != 2 {
+		t.Fatalf("hunks %+v", hunks)
+	}
+	patch, err := diff.BuildPatch("a.txt", hunks[:1], rows, hunks[0].Range())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := StashPatch(patch, "a.txt first hunk"); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if want := strings.Replace(edited, "TWO", "two", 1); string(content) != want {
+		t.Fatalf("worktree after stashing %q, want only the second hunk left", content)
+	}
+	stashes, err := ListStashes()
+	if err != nil || len(stashes) != 1 || stashes[0].Ref != "stash@{0}" || !strings.HasSuffix(stashes[0].Subject, ": a.txt first hunk") {
+		t.Fatalf("stashes %+v, %v", stashes, err)
+	}
+	shown, err := StashContents("stash@{0}")
+	if err != nil || !strings.Contains(shown, "+TWO") || strings.Contains(shown, "NINE") {
+		t.Fatalf("stash shows %q, %v", shown, err)
+	}
+
+	// git stash pop will not touch a file with changes of its own.
+	writeFile(t, filepath.Join(dir, "a.txt"), strings.Replace(string(content), "NINE", "nine", 1))
+	if err := StashAction("pop", "stash@{0}"); err != nil {
+		t.Fatal(err)
+	}
+	content, _ = os.ReadFile(filepath.Join(dir, "a.txt"))
+	if want := strings.Replace(edited, "NINE", "nine", 1); string(content) != want {
+		t.Fatalf("worktree after pop %q, want the stashed hunk back", content)
+	}
+	if stashes, err := ListStashes(); err != nil || len(stashes) != 0 {
+		t.Fatalf("stashes after pop %+v, %v", stashes, err)
+	}
+}
+
+func TestParseConflictMarkerCheck(t *testing.T) {
+	cases := []struct {
+		name string
+		out  string
+		want []string
+	}{
+		{"none", "", nil},
+		{"whitespace only", "a.go:3: trailing whitespace.\n+x := 1 \n", nil},
+		{"markers", "a.go:1: leftover conflict marker\n+<<<<<<< HEAD\na.go:3: leftover conflict marker\n+=======\n", []string{"a.go"}},
+		{"mixed", "b.go:2: trailing whitespace.\n+y \nc/d.go:7: leftover conflict marker\n+>>>>>>> topic\n", []string{"c/d.go"}},
+		{"colon in path", "dir:x/e.go:12: leftover conflict marker\n+=======\n", []string{"dir:x/e.go"}},
+		{"quoted path", "\"sp ace\\tf.go\":4: leftover conflict marker\n+<<<<<<< ours\n", []string{"sp ace\tf.go"}},
+		{"quoted offending line", "+a.go:1: leftover conflict marker\n", nil},
+	}
+	for _, c := range cases {
+		got := parseConflictMarkerCheck(c.out)
+		if len(got) != len(c.want) {
+			t.Errorf("%s: files %v, want %v", c.name, got, c.want)
+			continue
+		}
+		for _, file := range c.want {
+			if !got[file] {
+				t.Errorf("%s: files %v, want %v", c.name, got, c.want)
+			}
+		}
+	}
+}
+
+func TestGitDirPath_IsOutsideTheWorktree(t *testing.T) {
+	dir := testRepo(t, map[string]string{"a.txt": "a\n"})
+	path, err := GitDirPath("tdiff-notes.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "notes\n")
+	if status, err := runGit("status", "--porcelain", "--untracked-files=all"); err != nil || status != "" {
+		t.Fatalf("status after writing %s: %q, %v", path, status, err)
+	}
+	if filepath.Dir(path) == dir || filepath.Base(filepath.Dir(path)) != ".git" {
+		t.Fatalf("path %s is not in the git directory", path)
+	}
+}
+
+// statusV2 is git status --porcelain=v2 -z --branch -uall, captured during
+// a conflicted merge with a staged rename, a submodule with changes inside
+// it and an untracked file.
+var statusV2 = strings.Join([]string{
+	"# branch.oid 20873cb3afdb93e3cd310037535544d0e18b623e",
+	"# branch.head main",
+	"# branch.upstream origin/main",
+	"# branch.ab +2 -0",
+	"2 R. N... 100644 100644 100644 8a1218a1024a212bb3db30becd860315f9f3ac52 8a1218a1024a212bb3db30becd860315f9f3ac52 R100 new.txt",
+	"old.txt",
+	"1 .M S.M. 160000 160000 160000 97c5b72aabd7fc5f40f02ed32470b5a4eea6b402 97c5b72aabd7fc5f40f02ed32470b5a4eea6b402 sub",
+	"u UU N... 100644 100644 100644 100644 f2ad6c76f0115a6ba5b00456a849810e7ec0af20 28ce6a8b26aa170e1de65536fe8abe1832bd3242 13e7564ea0c889e81bcba6f8e496b2a74cdb32fa conf.txt",
+	"? new ü.txt",
+	"",
+}, "\x00")
+
+func TestParseStatus_CapturedV2(t *testing.T) {
+	status := ParseStatus(statusV2)
+	branch := BranchStatus{
+		OID:            "20873cb3afdb93e3cd310037535544d0e18b623e",
+		Head:           "main",
+		Upstream:       "origin/main",
+		HasAheadBehind: true,
+		Ahead:          2,
+	}
+	if status.Branch != branch {
+		t.Fatalf("branch %+v", status.Branch)
+	}
+	want := []FileStatus{
+		{XY: "R.", Path: "new.txt", Orig: "old.txt", Score: "R100"},
+		{XY: ".M", Path: "sub", Submodule: SubmoduleStatus{Submodule: true, Modified: true}},
+		{XY: "UU", Path: "conf.txt", Unmerged: true},
+		{XY: "??", Path: "new ü.txt"},
+	}
+	if !reflect.DeepEqual(status.Files, want) {
+		t.Fatalf("files\n got %+v\nwant %+v", status.Files, want)
+	}
+	if staged := status.StagedCodes(); len(staged) != 1 || staged["new.txt"] != "R" {
+		t.Errorf("staged codes %v, want only the rename", staged)
+	}
+	for i, code := range []string{"R", "M", "C", "?"} {
+		if got := status.Files[i].Code(); got != code {
+			t.Errorf("%s: code %q, want %q", status.Files[i].Path, got, code)
+		}
+	}
+}
+
+func TestParseStatus_UnmergedPairsAreConflicts(t *testing.T) {
+	for _, xy := range []string{"DD", "AU", "UD", "UA", "DU", "AA", "UU"} {
+		status := ParseStatus("u " + xy + " N... 100644 100644 100644 100644 a b c f.go\x00")
+		if len(status.Files) != 1 || status.Files[0].Code() != "C" || !status.Files[0].Unmerged {
+			t.Errorf("%s: %+v", xy, status.Files)
+		}
+	}
+}
+
+func TestParseStatus_StagedAndUnstaged(t *testing.T) {
+	status := ParseStatus("1 MM N... 100644 100644 100644 aaaa bbbb both.go\x001 A. N... 000000 100644 100644 0000 cccc added.go\x001 .D N... 100644 100644 000000 dddd dddd gone.go\x00")
+	cases := []struct {
+		code, stagedCode string
+		staged, unstaged bool
+	}{
+		{"M", "M", true, true},
+		{"A", "A", true, false},
+		{"D", "", false, true},
+	}
+	if len(status.Files) != len(cases) {
+		t.Fatalf("files %+v", status.Files)
+	}
+	for i, c := range cases {
+		file := status.Files[i]
+		if file.Code() != c.code || file.StagedCode() != c.stagedCode || file.Staged() != c.staged || file.Unstaged() != c.unstaged {
+			t.Errorf("%s: code %q/%q staged %v unstaged %v, want %q/%q %v %v", file.Path, file.Code(), file.StagedCode(), file.Staged(), file.Unstaged(), c.code, c.stagedCode, c.staged, c.unstaged)
+		}
+	}
+}
+
+func TestParseStatus_DetachedAndInitial(t *testing.T) {
+	status := ParseStatus("# branch.oid (initial)\x00# branch.head (detached)\x00")
+	if status.Branch.OID != "(initial)" || status.Branch.Head != "(detached)" || status.Branch.HasAheadBehind || len(status.Files) != 0 {
+		t.Fatalf("status %+v", status)
+	}
+}
+
+func TestParseStatus_SkipsTruncatedRecords(t *testing.T) {
+	status := ParseStatus("1 .M N... 100644\x00? \x002 R. N... 100644 100644 100644 a b R90 last.go")
+	if len(status.Files) != 1 || status.Files[0].Path != "last.go" || status.Files[0].Orig != "" {
+		t.Fatalf("files %+v", status.Files)
+	}
+}
+
+func TestParseDiffAlgo(t *testing.T) {
+	for _, algo := range DiffAlgos {
+		if got, ok := ParseDiffAlgo(strings.ToUpper(algo.String())); !ok || got != algo {
+			t.Fatalf("%s parsed as %v, %v", algo, got, ok)
+		}
+	}
+	if _, ok := ParseDiffAlgo("minimal"); ok {
+		t.Fatal("an unknown algorithm parsed")
+	}
+}
+
+func TestDiffStats_CountsUntrackedFilesLikeGit(t *testing.T) {
+	dir := testRepo(t, map[string]string{"a.txt": "a\n"})
+	writeFile(t, filepath.Join(dir, "a.txt"), "a\nb\n")
+	untracked := map[string]string{
+		"lines.txt":    "one\ntwo\nthree\n",
+		"no-eol.txt":   "one\ntwo",
+		"empty.txt":    "",
+		"blank.txt":    "\n\n",
+		"image.bin":    "PNG\x00\x01\x02",
+		"late-nul.txt": strings.Repeat("x", 9000) + "\x00\n",
+	}
+	for name, content := range untracked {
+		writeFile(t, filepath.Join(dir, name), content)
+	}
+	if err := os.Symlink("lines.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := DiffStats(Worktree, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stats["a.txt"]; got != (FileStat{Added: 1}) {
+		t.Errorf("a.txt: %+v", got)
+	}
+	for _, file := range append([]string{"link"}, keys(untracked)...) {
+		out, err := runGitAllowExitCodes(map[int]struct{}{1: {}}, "diff", "--numstat", "-z", "--no-index", "--", "/dev/null", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := FileStat{}
+		for _, stat := range parseNumstatZ(out) {
+			want = stat
+		}
+		if got := stats[file]; got != want {
+			t.Errorf("%s: %+v, git counts %+v", file, got, want)
+		}
+	}
+}
+
+func TestDiffStats_ReportsUnreadableUntrackedFiles(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root reads every file")
+	}
+	dir := testRepo(t, map[string]string{"a.txt": "a\n"})
+	writeFile(t, filepath.Join(dir, "ok.txt"), "one\n")
+	writeFile(t, filepath.Join(dir, "secret.txt"), "one\n")
+	if err := os.Chmod(filepath.Join(dir, "secret.txt"), 0); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := DiffStats(Worktree, true)
+	if err == nil || !strings.Contains(err.Error(), "secret.txt") {
+		t.Fatalf("error %v, want secret.txt named", err)
+	}
+	if stats["ok.txt"].Added != 1 {
+		t.Fatalf("stats %+v, want the readable file counted", stats)
+	}
+}
+
+func keys(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestDiffStats_RecountsUntrackedFilesThatChange(t *testing.T) {
+	dir := testRepo(t, map[string]string{"a.txt": "a\n"})
+	path := filepath.Join(dir, "new.txt")
+	write := func(content string, age time.Duration) {
+		t.Helper()
+		writeFile(t, path, content)
+		when := time.Now().Add(-age)
+		if err := os.Chtimes(path, when, when); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func() int {
+		t.Helper()
+		stats, err := DiffStats(Worktree, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stats["new.txt"].Added
+	}
+	write("one\n", time.Hour)
+	if got := count(); got != 1 {
+		t.Fatalf("first count %d", got)
+	}
+	write("one\ntwo\n", 2*time.Hour)
+	if got := count(); got != 2 {
+		t.Fatalf("count %d after the file grew", got)
+	}
+	// A file written just now may change again within the same timestamp and
+	// size, so its count is not remembered.
+	write("uno\ntwo\nthree\n", 0)
+	if got := count(); got != 3 {
+		t.Fatalf("count %d after a fresh write", got)
+	}
+	write("one\ntwo\nsix\n\n\n", 0)
+	if got := count(); got != 5 {
+		t.Fatalf("count %d after a second write of the same size", got)
+	}
+}
+
+func TestCachedDiff_UsesTheRecordedUnbornState(t *testing.T) {
+	dir := testRepo(t, map[string]string{"a.txt": "a\n"})
+	staged := func() []string {
+		t.Helper()
+		files, err := ListChangedFiles(Staged, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files
+	}
+	if files := staged(); len(files) != 0 {
+		t.Fatalf("staged %v with nothing staged", files)
+	}
+	// Recorded as unborn, the index is compared with the empty tree and not
+	// with the HEAD git would have found.
+	SetUnborn(true)
+	if files := staged(); len(files) != 1 || files[0] != "a.txt" {
+		t.Fatalf("staged %v against the empty tree, want [a.txt]", files)
+	}
+	SetWorktree(dir)
+	if files := staged(); len(files) != 0 {
+		t.Fatalf("staged %v after a worktree switch, want HEAD asked again", files)
+	}
+}
+
+func TestListIgnoredFiles_StopsAtTheLimit(t *testing.T) {
+	dir := testRepo(t, map[string]string{".gitignore": "*.log\n"})
+	for _, name := range []string{"a.log", "b.log", "c.log"} {
+		writeFile(t, filepath.Join(dir, name), "x\n")
+	}
+	files, capped, err := ListIgnoredFiles(2)
+	if err != nil || !capped || len(files) != 2 {
+		t.Fatalf("files %v, capped %v, err %v; want two and capped", files, capped, err)
+	}
+	files, capped, err = ListIgnoredFiles(3)
+	if err != nil || capped || len(files) != 3 {
+		t.Fatalf("files %v, capped %v, err %v; want all three", files, capped, err)
+	}
+}
+
+func TestGeneratedFiles_ReadsGitattributes(t *testing.T) {
+	testRepo(t, map[string]string{
+		".gitattributes": "*.pb.go linguist-generated\nkeep.pb.go -linguist-generated\n*.min.js -diff\n",
+	})
+	got, err := GeneratedFiles([]string{"api.pb.go", "keep.pb.go", "app.min.js", "main.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got["api.pb.go"] || !got["app.min.js"] {
+		t.Fatalf("generated %v, want api.pb.go and app.min.js", got)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// historyPage is how many commits of a line's history load at a time; more
+// load as the overlay is scrolled to its end.
+const historyPage = 20
+
+// lineHistory is the line the history overlay shows and how much of its
+// history has loaded.
+type lineHistory struct {
+	file    string
+	line    int
+	loaded  int
+	done    bool
+	loading bool
+}
+
+// historyLoadedMsg carries one page of a line's history, starting skip
+// commits in.
+type historyLoadedMsg struct {
+	file    string
+	line    int
+	skip    int
+	commits []git.HistoryCommit
+	err     error
+}
+
+func loadHistoryCmd(file string, line, skip int) tea.Cmd {
+	return guardCmd(func() tea.Msg {
+		commits, err := git.LineHistory(file, line, skip, historyPage)
+		return historyLoadedMsg{file: file, line: line, skip: skip, commits: commits, err: err}
+	}, func(err error) tea.Msg {
+		return historyLoadedMsg{file: file, line: line, skip: skip, err: err}
+	})
+}
+
+// historyLine is the line of HEAD's file that the cursor row shows: its OLD
+// line, which HEAD has unless the index differs, or 0 for rows only the NEW
+// side has.
+func (m *model) historyLine() int {
+	if m.cursor < 0 || m.cursor >= len(m.rows) {
+		return 0
+	}
+	row := m.rows[m.cursor]
+	if row.Kind == diff.Meta || row.Kind == diff.HunkHeader || row.OldNo == nil {
+		return 0
+	}
+	return *row.OldNo
+}
+
+// showLineHistory opens an overlay with the commits that changed the cursor
+// line (h), loading the first page of them.
+func (m model) showLineHistory() (tea.Model, tea.Cmd) {
+	file := m.selectedFile()
+	if file == "" || m.diffLoading() {
+		return m, nil
+	}
+	line := m.historyLine()
+	if line == 0 {
+		if m.cursor >= 0 && m.cursor < len(m.rows) && m.rows[m.cursor].NewNo != nil {
+			m.flash = "no history: the line is not committed yet"
+		}
+		return m, nil
+	}
+	m.history = &lineHistory{file: file, line: line, loading: true}
+	m.overlay = &ui.Overlay{Title: fmt.Sprintf("HISTORY %s:%d", file, line), Lines: []string{"loading..."}}
+	return m, tea.Batch(m.dismissImages(), loadHistoryCmd(file, line, 0))
+}
+
+func (m model) handleHistoryLoaded(msg historyLoadedMsg) (tea.Model, tea.Cmd) {
+	h := m.history
+	if h == nil || m.overlay == nil || msg.file != h.file || msg.line != h.line || msg.skip != h.loaded {
+		return m, nil
+	}
+	history := *h
+	history.loading = false
+	overlay := *m.overlay
+	if msg.skip == 0 {
+		overlay.Lines = nil
+	}
+	if msg.err != nil {
+		history.done = true
+		overlay.Lines = append(overlay.Lines, errorDetail(msg.err)...)
+	} else {
+		history.loaded += len(msg.commits)
+		history.done = len(msg.commits) < historyPage
+		overlay.Lines = append(overlay.Lines, historyLines(msg.commits)...)
+		if history.loaded == 0 {
+			overlay.Lines = []string{"(no commits changed this line)"}
+		}
+	}
+	m.history, m.overlay = &history, &overlay
+	return m, nil
+}
+
+// historyLines lays out commits for the overlay: a summary, the subject and
+// the patch to the line, as the plain view prints diffs.
+func historyLines(commits []git.HistoryCommit) []string {
+	var lines []string
+	for _, commit := range commits {
+		lines = append(lines, commit.Summary, "    "+commit.Subject, "")
+		rows, _ := diff.ParseHunks(commit.Patch)
+		lines = append(lines, diff.UnifiedLines(rows)...)
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+// moreHistory loads the next page once the overlay is scrolled to its end.
+func (m *model) moreHistory() tea.Cmd {
+	h := m.history
+	if h == nil || h.done || h.loading || m.overlay.Scroll < m.overlay.MaxScroll(m.width, m.bodyHeight()) {
+		return nil
+	}
+	history := *h
+	history.loading = true
+	m.history = &history
+	return loadHistoryCmd(h.file, h.line, h.loaded)
+}
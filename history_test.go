@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+)
+
+func historyModel() model {
+	m := loadedModel(2)
+	m.loadedReq = m.diffReq
+	one, two := 1, 2
+	m.rows = []diff.Row{
+		{OldNo: &one, NewNo: &one, Old: "a", New: "a", Kind: diff.Context},
+		{NewNo: &two, New: "b", Kind: diff.Add},
+	}
+	return m
+}
+
+func commits(n int) []git.HistoryCommit {
+	commits := make([]git.HistoryCommit, n)
+	for i := range commits {
+		commits[i] = git.HistoryCommit{
+			Summary: fmt.Sprintf("%07d 2026-09-30 Jane Doe", i),
+			Subject: "edit",
+			Patch:   "diff --git a/f b/f\n--- a/f\n+++ b/f\n@@ -1,1 +1,1 @@\n-old\n+new\n",
+		}
+	}
+	return commits
+}
+
+func TestLineHistory_LoadsPagesAsItScrolls(t *testing.T) {
+	m := historyModel()
+	file := m.selectedFile()
+	next, cmd := m.showLineHistory()
+	m = next.(model)
+	if cmd == nil || m.overlay == nil || m.history == nil || m.history.line != 1 {
+		t.Fatal("h on a committed line did not open its history")
+	}
+	next, _ = m.handleHistoryLoaded(historyLoadedMsg{file: file, line: 1, commits: commits(historyPage)})
+	m = next.(model)
+	text := strings.Join(m.overlay.Lines, "\n")
+	if !strings.Contains(text, "0000000 2026-09-30 Jane Doe\n    edit\n") || !strings.Contains(text, "-old\n+new") {
+		t.Fatalf("history overlay:\n%s", text)
+	}
+	// A page arriving twice is not appended again.
+	lines := len(m.overlay.Lines)
+	next, _ = m.handleHistoryLoaded(historyLoadedMsg{file: file, line: 1, commits: commits(historyPage)})
+	if got := len(next.(model).overlay.Lines); got != lines {
+		t.Fatalf("stale page appended: %d lines, want %d", got, lines)
+	}
+
+	next, cmd = m.handleOverlayKey("G")
+	m = next.(model)
+	if cmd == nil || !m.history.loading {
+		t.Fatal("scrolling to the end did not load more history")
+	}
+	next, _ = m.handleHistoryLoaded(historyLoadedMsg{file: file, line: 1, skip: historyPage, commits: commits(3)})
+	m = next.(model)
+	if m.history.loaded != historyPage+3 || !m.history.done {
+		t.Fatalf("history = %+v", *m.history)
+	}
+	if _, cmd := m.handleOverlayKey("G"); cmd != nil {
+		t.Fatal("loaded past the end of the history")
+	}
+
+	cursor := m.cursor
+	next, _ = m.handleOverlayKey("esc")
+	m = next.(model)
+	if m.overlay != nil || m.history != nil || m.cursor != cursor {
+		t.Fatal("esc did not return to the diff where it was")
+	}
+}
+
+func TestLineHistory_UncommittedLine(t *testing.T) {
+	m := historyModel()
+	m.cursor = 1
+	next, cmd := m.showLineHistory()
+	m = next.(model)
+	if cmd != nil || m.overlay != nil || m.notice() == "" {
+		t.Fatalf("h on an added line: overlay %v, notice %q", m.overlay != nil, m.notice())
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"time"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxCount caps vim-style count prefixes.
+const maxCount = 9999
+
+// accumulateCount records a digit of a count prefix such as the 15 in "15j".
+// A leading 0 is not a count.
+func (m *model) accumulateCount(key string) bool {
+	if len(key) != 1 || key[0] < '0' || key[0] > '9' || (key == "0" && m.count == 0) {
+		return false
+	}
+	m.count = m.count*10 + int(key[0]-'0')
+	if m.count > maxCount {
+		m.count = maxCount
+	}
+	return true
+}
+
+// takeCount returns the pending count for the key being handled, at least 1,
+// and clears it so it never outlives one keypress.
+func (m *model) takeCount() int {
+	count := m.count
+	m.count = 0
+	if count < 1 {
+		return 1
+	}
+	return count
+}
+
+// pendingKeyTimeout is how long a prefix key such as g waits for the key that
+// completes it.
+const pendingKeyTimeout = time.Second
+
+type pendingKeyTimeoutMsg struct {
+	req int
+}
+
+// startPendingKey holds prefix and its count until the next key arrives or the
+// timeout fires.
+func (m *model) startPendingKey(prefix string, count int) tea.Cmd {
+	m.pendingKey = prefix
+	m.pendingCount = count
+	m.pendingReq++
+	req := m.pendingReq
+	return tea.Tick(pendingKeyTimeout, func(time.Time) tea.Msg {
+		return pendingKeyTimeoutMsg{req: req}
+	})
+}
+
+func (m model) handlePendingKeyTimeout(msg pendingKeyTimeoutMsg) (tea.Model, tea.Cmd) {
+	if msg.req == m.pendingReq {
+		m.pendingKey = ""
+	}
+	return m, nil
+}
+
+// handleKeySequence runs a prefixed binding such as gg. It reports false when
+// seq is not bound, so the second key is handled on its own.
+func (m *model) handleKeySequence(seq string) bool {
+	if m.focus != ui.FocusOld && m.focus != ui.FocusNew {
+		return false
+	}
+	switch seq {
+	case "gg":
+		m.goTop()
+	case "ge":
+		m.goHunkEnd()
+	case "zz":
+		m.placeCursor(placeCenter)
+	case "zt":
+		m.placeCursor(placeTop)
+	case "zb":
+		m.placeCursor(placeBottom)
+	case "za":
+		m.toggleFold()
+	case "zR":
+		m.foldAll(false)
+	case "zM":
+		m.foldAll(true)
+	case "]c":
+		m.jumpChange(1, m.pendingCount)
+	case "[c":
+		m.jumpChange(-1, m.pendingCount)
+	case "]x":
+		m.jumpConflict(1, m.pendingCount)
+	case "[x":
+		m.jumpConflict(-1, m.pendingCount)
+	default:
+		return false
+	}
+	return true
+}
+
+// goHunkEnd moves the cursor to the last row of the hunk under it.
+func (m *model) goHunkEnd() {
+	idx := diff.HunkAt(m.hunks, m.cursor)
+	if idx < 0 {
+		return
+	}
+	m.cursor = clamp(m.hunks[idx].RowEnd-1, 0, len(m.rows)-1)
+	m.saveCursor()
+	m.ensureCursorVisible()
+}
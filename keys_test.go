@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// paneModel has the NEW pane focused on n unchanged lines.
+func paneModel(n int) model {
+	m := reviewModel()
+	m.rows = nil
+	for i := 1; i <= n; i++ {
+		no := i
+		line := fmt.Sprintf("line %d", i)
+		m.rows = append(m.rows, diff.Row{OldNo: &no, NewNo: &no, Old: line, New: line, Kind: diff.Context})
+	}
+	m.focus = ui.FocusNew
+	return m
+}
+
+func TestPendingKey_LoneGExpires(t *testing.T) {
+	m := paneModel(200)
+	m = update(t, m, runeKeys("100j")...)
+	m = update(t, m, runeKeys("g")...)
+	if m.pendingKey != "g" || m.pendingKeys() != "g" {
+		t.Fatalf("pending %q", m.pendingKey)
+	}
+	m = update(t, m, pendingKeyTimeoutMsg{req: m.pendingReq})
+	if m.pendingKey != "" {
+		t.Fatalf("pending %q after the timeout", m.pendingKey)
+	}
+	m = update(t, m, runeKeys("g")...)
+	if m.cursor != 100 || m.pendingKey != "g" {
+		t.Fatalf("g after the timeout: cursor %d, pending %q; want a new prefix", m.cursor, m.pendingKey)
+	}
+	m = update(t, m, runeKeys("g")...)
+	if m.cursor != 0 || m.pendingKey != "" {
+		t.Fatalf("gg: cursor %d, pending %q", m.cursor, m.pendingKey)
+	}
+}
+
+func TestPendingKey_EscClears(t *testing.T) {
+	m := paneModel(200)
+	m = update(t, m, runeKeys("100j")...)
+	m = update(t, m, runeKeys("5g")...)
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyEsc})
+	if m.pendingKey != "" || m.count != 0 || m.pendingKeys() != "" {
+		t.Fatalf("esc left %q pending", m.pendingKeys())
+	}
+	m = update(t, m, runeKeys("g")...)
+	if m.cursor != 100 || m.pendingKey != "g" {
+		t.Fatalf("g after esc: cursor %d, pending %q", m.cursor, m.pendingKey)
+	}
+}
+
+func TestPendingKey_StaleTimeoutKeepsANewerPrefix(t *testing.T) {
+	m := paneModel(200)
+	m = update(t, m, runeKeys("100j")...)
+	m = update(t, m, runeKeys("g")...)
+	stale := pendingKeyTimeoutMsg{req: m.pendingReq}
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyEsc})
+	m = update(t, m, runeKeys("g")...)
+	m = update(t, m, stale)
+	if m.pendingKey != "g" {
+		t.Fatalf("the first g's timeout cleared the second: pending %q", m.pendingKey)
+	}
+	m = update(t, m, runeKeys("g")...)
+	if m.cursor != 0 {
+		t.Fatalf("gg after a stale timeout: cursor %d", m.cursor)
+	}
+}
+
+// linesAbove is how many pane lines are drawn before the cursor row, and
+// room how many the panes have besides the cursor row's own.
+func linesAbove(m model) (above, room int) {
+	metrics := ui.NewRowMetrics(m.renderModel())
+	for idx := m.diffScroll; idx < m.cursor; idx++ {
+		above += metrics.Height(idx)
+	}
+	return above, metrics.Lines() - metrics.Height(m.cursor)
+}
+
+func TestPlaceCursor_ZKeys(t *testing.T) {
+	m := paneModel(200)
+	lines := ui.NewRowMetrics(m.renderModel()).Lines()
+	maxScroll := 200 - lines
+	cases := []struct {
+		name       string
+		cursor     int
+		keys       string
+		wantScroll int
+	}{
+		{"zt mid-file", 100, "zt", 100},
+		{"zz mid-file", 100, "zz", 100 - (lines-1)/2},
+		{"zb mid-file", 100, "zb", 100 - (lines - 1)},
+		{"zt near the top", 3, "zt", 3},
+		{"zz near the top", 3, "zz", 0},
+		{"zb near the top", 3, "zb", 0},
+		{"zt near the bottom", 197, "zt", maxScroll},
+		{"zz near the bottom", 197, "zz", maxScroll},
+		{"zb near the bottom", 197, "zb", 197 - (lines - 1)},
+		{"zt on the last row", 199, "zt", maxScroll},
+	}
+	for _, c := range cases {
+		m.cursor, m.diffScroll = c.cursor, 0
+		m.ensureCursorVisible()
+		got := update(t, m, runeKeys(c.keys)...)
+		if got.cursor != c.cursor || got.diffScroll != c.wantScroll {
+			t.Errorf("%s: cursor %d, scroll %d; want cursor %d, scroll %d", c.name, got.cursor, got.diffScroll, c.cursor, c.wantScroll)
+		}
+	}
+}
+
+func TestPlaceCursor_ZKeysCountWrappedLines(t *testing.T) {
+	m := wrapModel()
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyCtrlW})
+	m.cursor = 39
+	m.ensureCursorVisible()
+	metrics := ui.NewRowMetrics(m.renderModel())
+	for _, keys := range []string{"zt", "zz", "zb"} {
+		got := update(t, m, runeKeys(keys)...)
+		above, room := linesAbove(got)
+		want := map[string]int{"zt": 0, "zz": room / 2, "zb": room}[keys]
+		// Wrapped rows above can leave less than asked for, never more.
+		if above > want || above+metrics.Height(got.diffScroll-1) <= want {
+			t.Errorf("%s: %d lines above the cursor from row %d, want at most %d", keys, above, got.diffScroll, want)
+		}
+		cursorShown(t, got)
+	}
+}
+
+func TestPlaceCursor_ZKeysSkipFoldedRows(t *testing.T) {
+	m := reviewModel()
+	var rows []diff.Row
+	for hunk := 0; hunk < 2; hunk++ {
+		rows = append(rows, diff.Row{Old: "@@", New: "@@", Kind: diff.HunkHeader})
+		for i := 1; i <= 100; i++ {
+			no := hunk*100 + i
+			rows = append(rows, diff.Row{OldNo: &no, NewNo: &no, Old: "x", New: "x", Kind: diff.Context})
+		}
+	}
+	hunks := []diff.Hunk{{RowStart: 0, RowEnd: 101}, {RowStart: 101, RowEnd: 202}}
+	m = update(t, m, diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: "a.go", rows: rows, hunks: hunks})
+	m.focus = ui.FocusNew
+	m = update(t, m, runeKeys("za")...)
+	if rm := m.renderModel(); !rm.Hidden[50] {
+		t.Fatal("the first hunk did not fold")
+	}
+	m.cursor = 150
+	m.ensureCursorVisible()
+
+	m = update(t, m, runeKeys("zb")...)
+	if above, room := linesAbove(m); above != room {
+		t.Fatalf("zb: %d lines above the cursor, want %d", above, room)
+	}
+	m = update(t, m, runeKeys("zz")...)
+	if above, room := linesAbove(m); above != room/2 {
+		t.Fatalf("zz: %d lines above the cursor, want %d", above, room/2)
+	}
+
+	// Near the top only the fold's header is above: zb cannot scroll past it.
+	m.cursor = 103
+	m = update(t, m, runeKeys("zb")...)
+	if above, _ := linesAbove(m); m.diffScroll != 0 || above != 3 {
+		t.Fatalf("zb by the fold: scroll %d, %d lines above, want the header and 2 rows", m.diffScroll, above)
+	}
+}
+
+func TestPageMotions(t *testing.T) {
+	m := paneModel(200)
+	page := ui.NewRowMetrics(m.renderModel()).Lines()
+	half := (page + 1) / 2
+	cases := []struct {
+		name   string
+		key    tea.KeyMsg
+		cursor int
+		want   int
+	}{
+		{"ctrl+d", tea.KeyMsg{Type: tea.KeyCtrlD}, 100, 100 + half},
+		{"ctrl+u", tea.KeyMsg{Type: tea.KeyCtrlU}, 100, 100 - half},
+		{"ctrl+f", tea.KeyMsg{Type: tea.KeyCtrlF}, 100, 100 + page},
+		{"ctrl+b", tea.KeyMsg{Type: tea.KeyCtrlB}, 100, 100 - page},
+		{"pgdown", tea.KeyMsg{Type: tea.KeyPgDown}, 100, 100 + page},
+		{"pgup", tea.KeyMsg{Type: tea.KeyPgUp}, 100, 100 - page},
+		{"ctrl+d at the bottom", tea.KeyMsg{Type: tea.KeyCtrlD}, 195, 199},
+		{"ctrl+u at the top", tea.KeyMsg{Type: tea.KeyCtrlU}, 3, 0},
+		{"ctrl+f at the bottom", tea.KeyMsg{Type: tea.KeyCtrlF}, 199, 199},
+		{"pgup at the top", tea.KeyMsg{Type: tea.KeyPgUp}, 0, 0},
+	}
+	for _, tc := range cases {
+		got := m
+		got.cursor = tc.cursor
+		got.diffScroll = tc.cursor
+		got.ensureCursorVisible()
+		got = update(t, got, tc.key)
+		if got.cursor != tc.want {
+			t.Errorf("%s from row %d: cursor %d, want %d", tc.name, tc.cursor, got.cursor, tc.want)
+		}
+		if got.diffScroll < 0 || got.diffScroll > 200-page || got.cursor < got.diffScroll || got.cursor >= got.diffScroll+page {
+			t.Errorf("%s from row %d: scroll %d leaves the cursor off screen", tc.name, tc.cursor, got.diffScroll)
+		}
+	}
+}
+
+func TestPageMotions_ScrollWithTheCursor(t *testing.T) {
+	m := paneModel(200)
+	page := ui.NewRowMetrics(m.renderModel()).Lines()
+	m.cursor, m.diffScroll = 60, 50
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyCtrlD})
+	if m.cursor-m.diffScroll != 10 {
+		t.Errorf("ctrl+d moved the cursor to %d and the scroll to %d; want it kept 10 rows down the page", m.cursor, m.diffScroll)
+	}
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyCtrlB})
+	if m.diffScroll != 50+(page+1)/2-page || m.cursor-m.diffScroll != 10 {
+		t.Errorf("ctrl+b: cursor %d, scroll %d", m.cursor, m.diffScroll)
+	}
+}
+
+func TestCount_RepeatsTheMotion(t *testing.T) {
+	m := paneModel(200)
+	m = update(t, m, runeKeys("5j")...)
+	if m.cursor != 5 || m.count != 0 {
+		t.Fatalf("5j: cursor %d, count %d; want 5 and the count used up", m.cursor, m.count)
+	}
+	m = update(t, m, runeKeys("3k")...)
+	if m.cursor != 2 {
+		t.Fatalf("3k: cursor %d, want 2", m.cursor)
+	}
+	m = update(t, m, runeKeys("10j")...)
+	if m.cursor != 12 {
+		t.Fatalf("10j: cursor %d, want 12", m.cursor)
+	}
+}
+
+func TestCount_IsCapped(t *testing.T) {
+	m := paneModel(20000)
+	m = update(t, m, runeKeys("123456")...)
+	if m.count != maxCount {
+		t.Fatalf("count %d, want it capped at %d", m.count, maxCount)
+	}
+	m = update(t, m, runeKeys("j")...)
+	if m.cursor != maxCount {
+		t.Fatalf("cursor %d after a capped count, want %d", m.cursor, maxCount)
+	}
+}
+
+func TestCount_ClearedByOtherKeys(t *testing.T) {
+	m := paneModel(200)
+	m = update(t, m, runeKeys("5w")...)
+	if m.count != 0 || m.pendingKeys() != "" {
+		t.Fatalf("count %d, pending %q after w", m.count, m.pendingKeys())
+	}
+	m = update(t, m, runeKeys("j")...)
+	if m.cursor != 1 {
+		t.Fatalf("j after 5w: cursor %d, want 1", m.cursor)
+	}
+	m = update(t, m, runeKeys("7")...)
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyEsc})
+	m = update(t, m, runeKeys("j")...)
+	if m.cursor != 2 {
+		t.Fatalf("j after 7 esc: cursor %d, want 2", m.cursor)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestLargeFile_LLoadsItAnyway(t *testing.T) {
+	m := reviewModel()
+	if job := m.newDiffJob("a.go"); job.maxBytes != defaultLargeFileBytes {
+		t.Fatalf("guard off by default: %d", job.maxBytes)
+	}
+	size := int64(48 << 20)
+	m = update(t, m, diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: "a.go", rows: largeFileRows(size), guardedSize: size})
+	if got := m.rows[0].New; got != "(file too large: 48.0 MB — press L to diff anyway)" {
+		t.Fatalf("placeholder %q", got)
+	}
+	req := m.diffReq
+	m = update(t, m, runeKeys("L")...)
+	if m.diffReq != req+1 || m.guardedSize != 0 || !m.largeDiffOptIn["a.go"] {
+		t.Fatalf("L did not reload: req %d, guarded %d", m.diffReq, m.guardedSize)
+	}
+	if m.diffJob.maxBytes != 0 || m.diffJob.maxLines != 0 {
+		t.Fatalf("the reload is still guarded: %+v", m.diffJob)
+	}
+}
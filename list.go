@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/PedroElizalde01/tdiff/git"
+)
+
+// defaultListFormat is a --list line: the status letter and the path.
+const defaultListFormat = "%s %p"
+
+// listFiles is --list: it prints the files the sidebar would show, in its
+// order, one line each in opts.listFormat, and no TUI. The list goes through
+// the same loading and filtering as the sidebar so the two always agree.
+func listFiles(opts options, stdout, stderr io.Writer) int {
+	m := initialModel(opts)
+	msg := loadFilesCmd(m.newFilesJob())().(filesLoadedMsg)
+	if msg.err != nil {
+		fmt.Fprintf(stderr, "tdiff: %s\n", git.FriendlyError(msg.err))
+		return exitError
+	}
+	next, _ := m.handleFilesLoaded(msg)
+	m = next.(model)
+	if !m.hasRealFiles() {
+		return exitOK
+	}
+	for _, file := range m.files {
+		fmt.Fprintln(stdout, formatListLine(opts.listFormat, file, m.fileStatuses[file], m.fileStats[file]))
+	}
+	return exitOK
+}
+
+// formatListLine expands format's placeholders for one file: %s the status
+// letter, %p the path, %a and %d the added and deleted line counts ("-" for
+// binary files) and %% a percent sign. Anything else is kept as written.
+func formatListLine(format, file, status string, stat git.FileStat) string {
+	count := func(n int) string {
+		if stat.Binary {
+			return "-"
+		}
+		return strconv.Itoa(n)
+	}
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 's':
+			b.WriteString(status)
+		case 'p':
+			b.WriteString(file)
+		case 'a':
+			b.WriteString(count(stat.Added))
+		case 'd':
+			b.WriteString(count(stat.Deleted))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
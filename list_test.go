@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/git"
+)
+
+func TestFormatListLine(t *testing.T) {
+	stat := git.FileStat{Added: 12, Deleted: 3}
+	for _, tc := range []struct {
+		format string
+		stat   git.FileStat
+		want   string
+	}{
+		{defaultListFormat, stat, "M ui/ui.go"},
+		{"%a\t%d\t%p", stat, "12\t3\tui/ui.go"},
+		{"%a %d %p", git.FileStat{Binary: true}, "- - ui/ui.go"},
+		{"100%% %p %x%", stat, "100% ui/ui.go %x%"},
+	} {
+		if got := formatListLine(tc.format, "ui/ui.go", "M", tc.stat); got != tc.want {
+			t.Errorf("formatListLine(%q) = %q, want %q", tc.format, got, tc.want)
+		}
+	}
+}
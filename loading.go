@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// slowLoadAfter is how long a diff may load before the pane titles suggest
+// the file is huge, and the file list before the header suggests leaving
+// untracked files out of it.
+const slowLoadAfter = 3 * time.Second
+
+// newSpinner turns while a diff loads; ASCII mode swaps the braille dots for
+// a line.
+func newSpinner(ascii bool) spinner.Model {
+	frames := spinner.MiniDot
+	if ascii {
+		frames = spinner.Line
+	}
+	return spinner.New(spinner.WithSpinner(frames))
+}
+
+// diffLoading reports whether a diff request is still outstanding.
+func (m *model) diffLoading() bool {
+	return m.loadedReq != m.diffReq
+}
+
+// startSpinner times a diff request that was just sent and keeps the
+// spinner turning until it arrives.
+func (m *model) startSpinner() tea.Cmd {
+	m.loadStarted = time.Now()
+	return m.spinner.Tick
+}
+
+// filesLoading reports whether the sidebar waits on the file list, showing
+// the loading placeholder in its place.
+func (m *model) filesLoading() bool {
+	return len(m.files) == 1 && m.files[0] == "(loading...)"
+}
+
+// startFilesTimer times a file list request sent while the sidebar shows
+// the loading placeholder, turning the spinner next to it.
+func (m *model) startFilesTimer() tea.Cmd {
+	m.filesStarted = time.Now()
+	return m.spinner.Tick
+}
+
+// handleSpinnerTick advances the spinner while a diff or the file list
+// loads. Once both have arrived the tick is dropped, which stops the spinner
+// until the next load.
+func (m model) handleSpinnerTick(msg spinner.TickMsg) (tea.Model, tea.Cmd) {
+	if !m.diffLoading() && !m.filesLoading() {
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.spinner, cmd = m.spinner.Update(msg)
+	return m, cmd
+}
+
+// finishLoad forgets file's outstanding request when req is its latest one,
+// whether or not the diff is still wanted.
+func (m *model) finishLoad(file string, req int) {
+	if m.inFlight[file] == req {
+		delete(m.inFlight, file)
+	}
+}
+
+// fileLoads is the sidebar's load markers: files with requests outstanding,
+// and the file whose diff is shown.
+func (m *model) fileLoads() map[string]ui.FileLoad {
+	if len(m.inFlight) == 0 && m.shownFile == "" {
+		return nil
+	}
+	loads := make(map[string]ui.FileLoad, len(m.inFlight)+1)
+	for file := range m.inFlight {
+		loads[file] = ui.FileLoading
+	}
+	if m.shownFile != "" {
+		loads[m.shownFile] = ui.FileLoaded
+	}
+	return loads
+}
+
+// loadingStatus follows the OLD title while a diff loads, e.g.
+// "⠋ loading 1.2s". Past slowLoadAfter, hint follows the NEW title with what
+// to do about it. Both are empty otherwise.
+func (m *model) loadingStatus() (status, hint string) {
+	if !m.diffLoading() || m.loadStarted.IsZero() {
+		return "", ""
+	}
+	elapsed := time.Since(m.loadStarted)
+	status = fmt.Sprintf("%s loading %.1fs", m.spinner.View(), elapsed.Seconds())
+	if elapsed >= slowLoadAfter {
+		hint = "huge file? select another to skip it; --max-diff-lines guards large diffs"
+	}
+	return status, hint
+}
+
+// filesPlaceholder is the sidebar's loading placeholder with how long the
+// file list has taken so far, e.g. "(loading... ⠋ 1.2s)".
+func (m *model) filesPlaceholder() string {
+	if !m.filesLoading() || m.filesStarted.IsZero() {
+		return "(loading...)"
+	}
+	return fmt.Sprintf("(loading... %s %.1fs)", m.spinner.View(), time.Since(m.filesStarted).Seconds())
+}
+
+// slowScanHint is the header's notice once the file list has loaded for
+// slowLoadAfter: most of that time tends to go to git looking for untracked
+// files, which t stops. It is empty otherwise.
+func (m *model) slowScanHint() string {
+	if !m.filesLoading() || m.filesStarted.IsZero() || time.Since(m.filesStarted) < slowLoadAfter {
+		return ""
+	}
+	if m.hideUntracked || m.mode != git.Worktree || m.merge != nil {
+		return "slow status scan: git is still listing the changes"
+	}
+	return "slow status scan? t stops looking for untracked files, as --untracked=no does"
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PedroElizalde01/tdiff/ui"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestLoadingStatus_ShownUntilDiffArrives(t *testing.T) {
+	m := loadedModel(3)
+	if !m.diffLoading() {
+		t.Fatal("no diff request outstanding after loading files")
+	}
+	status, hint := m.loadingStatus()
+	if !strings.Contains(status, "loading") || hint != "" {
+		t.Fatalf("loadingStatus() = %q, %q; want a loading status and no hint", status, hint)
+	}
+	if _, cmd := m.handleSpinnerTick(spinner.TickMsg{ID: m.spinner.ID()}); cmd == nil {
+		t.Fatal("spinner stopped while the diff is loading")
+	}
+
+	m.loadStarted = time.Now().Add(-2 * slowLoadAfter)
+	if _, hint := m.loadingStatus(); !strings.Contains(hint, "--max-diff-lines") {
+		t.Fatalf("slow load hint = %q, want it to mention --max-diff-lines", hint)
+	}
+
+	next, _ := m.handleDiffLoaded(diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: m.selectedFile(), rows: noDiffRows()})
+	m = next.(model)
+	if status, hint := m.loadingStatus(); status != "" || hint != "" {
+		t.Fatalf("loadingStatus() after load = %q, %q; want empty", status, hint)
+	}
+	if _, cmd := m.handleSpinnerTick(spinner.TickMsg{ID: m.spinner.ID()}); cmd != nil {
+		t.Fatal("spinner still ticking after the diff arrived")
+	}
+}
+
+func TestFileLoads_TrackRequestsPerFile(t *testing.T) {
+	m := loadedModel(3)
+	first := m.selectedFile()
+	firstReq := m.diffReq
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	m = next.(model)
+	second := m.selectedFile()
+	if loads := m.fileLoads(); loads[first] != ui.FileLoading || loads[second] != ui.FileLoading {
+		t.Fatalf("fileLoads() = %v, want both %s and %s loading", loads, first, second)
+	}
+
+	next, _ = m.handleDiffLoaded(diffLoadedMsg{req: firstReq, mode: m.mode, algo: m.diffAlgo, file: first, rows: noDiffRows()})
+	m = next.(model)
+	if loads := m.fileLoads(); loads[first] != ui.FileNotLoaded || loads[second] != ui.FileLoading {
+		t.Fatalf("fileLoads() after the stale diff = %v, want only %s loading", loads, second)
+	}
+
+	next, _ = m.handleDiffLoaded(diffLoadedMsg{req: m.diffReq, mode: m.mode, algo: m.diffAlgo, file: second, rows: noDiffRows()})
+	m = next.(model)
+	if loads := m.fileLoads(); len(loads) != 1 || loads[second] != ui.FileLoaded {
+		t.Fatalf("fileLoads() after the diff arrived = %v, want %s loaded", loads, second)
+	}
+}
+
+func TestFilesPlaceholder_CountsUpAndHintsAtUntracked(t *testing.T) {
+	m := initialModel(defaultOptions())
+	m.width, m.height = 160, 50
+	if _, cmd := m.handleSpinnerTick(spinner.TickMsg{ID: m.spinner.ID()}); cmd == nil {
+		t.Fatal("spinner stopped while the file list is loading")
+	}
+	if got := m.filesPlaceholder(); !strings.HasPrefix(got, "(loading... ") || !strings.HasSuffix(got, "s)") {
+		t.Fatalf("placeholder %q, want the elapsed time", got)
+	}
+	if hint := m.notice(); hint != "" {
+		t.Fatalf("hint %q before the scan is slow", hint)
+	}
+
+	m.filesStarted = time.Now().Add(-2 * slowLoadAfter)
+	if hint := m.notice(); !strings.Contains(hint, "t stops looking for untracked files") {
+		t.Fatalf("slow scan hint %q, want it to point at t", hint)
+	}
+	req := m.filesReq
+	m = update(t, m, runeKeys("t")[0])
+	if !m.hideUntracked || m.filesReq != req+1 {
+		t.Fatalf("t during the scan: hidden %v, files req %d, want a new request", m.hideUntracked, m.filesReq)
+	}
+	if hint := m.notice(); strings.Contains(hint, "untracked") {
+		t.Fatalf("hint %q with untracked files already hidden", hint)
+	}
+
+	m = update(t, m, filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{"a.go"}, statuses: map[string]string{}})
+	if m.filesLoading() || m.notice() != "" {
+		t.Fatalf("still loading after the files arrived: %v, %q", m.files, m.notice())
+	}
+	req = m.filesReq
+	if m = update(t, m, runeKeys("t")[0]); m.hideUntracked || m.filesReq != req+1 {
+		t.Fatalf("showing untracked files: hidden %v, files req %d, want them asked for", m.hideUntracked, m.filesReq)
+	}
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/PedroElizalde01/tdiff/diff"
 	"github.com/PedroElizalde01/tdiff/git"
 	"github.com/PedroElizalde01/tdiff/ui"
+	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 )
 
 type filesLoadedMsg struct {
@@ -14,31 +23,135 @@ type filesLoadedMsg struct {
 	mode     git.Mode
 	files    []string
 	statuses map[string]string
+	stats    map[string]git.FileStat
 	err      error
+	// generated marks files .gitattributes flags as generated; nil when the
+	// lookup failed, which hides nothing.
+	generated map[string]bool
+	// ignoredCapped reports that ignored files were cut at maxIgnoredFiles.
+	ignoredCapped bool
+	// statsErr is why stats lacks some files' line counts.
+	statsErr error
+	// blobs is git.DiffBlobs of the changed files; nil when it failed or
+	// was not asked for.
+	blobs map[string]string
+	// conflicts is git.ConflictMarkerFiles while a merge, rebase or
+	// cherry-pick could have left markers; nil otherwise or when it failed.
+	conflicts map[string]bool
+	// unmerged is git.UnmergedFiles; nil when it failed.
+	unmerged map[string]bool
+	// staged maps the worktree files that have changes staged as well to the
+	// status of their staged side, and stagedBlobs names those staged diffs
+	// when blobs are asked for.
+	staged      map[string]string
+	stagedBlobs map[string]string
+	// repo is read with every listing so the header follows branch switches.
+	repo   git.RepoInfo
+	repoOK bool
 }
 
 type diffLoadedMsg struct {
-	req        int
-	mode       git.Mode
-	algo       git.DiffAlgo
-	file       string
-	rows       []diff.Row
-	hunkStarts []int
-	err        error
+	req   int
+	mode  git.Mode
+	algo  git.DiffAlgo
+	file  string
+	rows  []diff.Row
+	hunks []diff.Hunk
+	// preview carries image data when the file is an image the terminal can show.
+	preview *imagePreview
+	// syntax holds token colors parallel to rows when highlighting was requested.
+	syntax []ui.RowSyntax
+	// whitespaceErrors counts added lines that break core.whitespace.
+	whitespaceErrors int
+	// invisibleChanges counts edit pairs that differ only in invisible
+	// characters.
+	invisibleChanges int
+	// vanished reports that the file no longer has changes to show.
+	vanished bool
+	// guardedLines is non-zero when the diff was skipped for being larger than
+	// the configured threshold; it carries the changed-line count for display.
+	// guardedSize is likewise the size of a file too large to diff at all.
+	guardedLines int
+	guardedSize  int64
+	// fileInfo is fileInfo of the file, for the line under the header.
+	fileInfo string
+	err      error
 }
 
+// defaultLargeDiffLines is the changed-line count above which a diff is not
+// parsed until the user explicitly asks for it with L.
+const defaultLargeDiffLines = 10000
+
+// defaultLargeFileBytes is the file size above which git is not even asked
+// for a diff until L, so a huge asset is never piped through it by accident.
+const defaultLargeFileBytes = 5 << 20
+
+type options struct {
+	largeDiffLines int
+	largeFileBytes int64
+	tabWidth       int
+	autoAdvance    bool
+	noHints        bool
+	ignored        bool
+	skipped        bool
+	mode           git.Mode
+	algo           git.DiffAlgo
+	context        int
+	showWhitespace bool
+	sidebarWidth   int
+	hideUntracked  bool
+	keys           map[string]string
+	// swapPanes and split are the pane order and split the panes start with.
+	swapPanes bool
+	split     int
+	// themes is every theme C cycles through; theme indexes the one in use.
+	themes []ui.Theme
+	theme  int
+	// background is set by --light and --dark.
+	background background
+
+	noColor bool
+	ascii   bool
+
+	noBanner bool
+
+	// pick is set by --pick: enter quits and prints the selected path.
+	pick bool
+	// exitCode makes the exit status report changes; quiet checks for them
+	// without the TUI.
+	exitCode bool
+	quiet    bool
+	// list prints the sidebar's files in listFormat instead of starting the
+	// TUI.
+	list       bool
+	listFormat string
+	// showVersion is --version: print versionString and quit.
+	showVersion bool
+	// merge is --merge, with mergeArgs the files it names.
+	merge     bool
+	mergeArgs []string
+}
+
+// sidebarWidthStep is how many columns < and > resize the sidebar by.
+const sidebarWidthStep = 2
+
+// tabWidths are the tab stop intervals T cycles through.
+var tabWidths = []int{2, 4, 8}
+
 type model struct {
 	mode          git.Mode
 	diffAlgo      git.DiffAlgo
 	focus         ui.Focus
 	files         []string
 	fileStatuses  map[string]string
+	fileStats     map[string]git.FileStat
+	fileSort      fileSort
 	selected      int
 	noChanges     bool
 	rows          []diff.Row
-	hunkStarts    []int
+	hunks         []diff.Hunk
+	changeStarts  []int
 	cursor        int
-	cursors       map[string]int
 	sidebarScroll int
 	diffScroll    int
 	width         int
@@ -46,87 +159,621 @@ type model struct {
 	errMsg        string
 	filesReq      int
 	diffReq       int
+
+	// lastErr is the error errMsg summarizes, and overlay is the detail
+	// view opened on it with e.
+	lastErr error
+	overlay *ui.Overlay
+	// errSeen is set once a key is pressed while lastErr is shown, and
+	// listed once a file listing has loaded. Only an error the user saw, or
+	// one that kept the list from ever loading, fails the exit status.
+	errSeen bool
+	listed  bool
+	// flash is a one-shot notice for the header, cleared by the next key.
+	flash string
+	// diffJob is the diff request last sent. failed is the load whose error
+	// is shown, which r sends again; lockRetried is set while the automatic
+	// retry of an index.lock failure is outstanding, so it is tried once.
+	diffJob     diffJob
+	failed      *failedLoad
+	lockRetried bool
+
+	// cursors saves where the cursor and scroll were per file, mode and
+	// algorithm; lastCursors holds each file's latest, for views of it that
+	// have none saved yet.
+	cursors     map[cursorKey]cursorPos
+	lastCursors map[string]cursorPos
+
+	// togglePath is the path selected before the mode was toggled, selected
+	// again when the other mode's list arrives if it is there.
+	togglePath string
+
+	// allFiles is every changed file; files is the part the filters let
+	// through, and noMatches is set when that is nothing.
+	allFiles     []string
+	statusFilter string
+	noMatches    bool
+	// totals and allTotals are the diffstats of files and allFiles, summed
+	// when the lists change rather than on every frame.
+	totals    ui.DiffTotals
+	allTotals ui.DiffTotals
+	// statsErr is why the line counts miss some files, shown as a notice.
+	statsErr error
+	// hideUntracked drops untracked files from the worktree list, and git is
+	// not asked for them while it is set.
+	hideUntracked bool
+	// showIgnored adds ignored files to the worktree list, at most
+	// maxIgnoredFiles of them; ignoredCapped reports that more exist.
+	showIgnored   bool
+	ignoredCapped bool
+	// showSkipped adds the files marked skip-worktree or assume-unchanged
+	// that differ on disk to the worktree list.
+	showSkipped bool
+	// generated marks files flagged as generated by .gitattributes. They
+	// are folded into one sidebar row, counted by hiddenGenerated, until
+	// showGenerated is set.
+	generated       map[string]bool
+	showGenerated   bool
+	hiddenGenerated int
+
+	// treeView groups the sidebar by directory. entries holds its rows, and
+	// selected indexes entries instead of files while it is set; collapsed
+	// holds the directories whose files are hidden.
+	treeView  bool
+	entries   []ui.SidebarEntry
+	collapsed map[string]bool
+
+	// sidebarWidth is the width chosen with < and >, 0 until first resized.
+	sidebarWidth int
+	// swapPanes draws NEW before OLD (~); split is the percentage of the width
+	// OLD takes, moved with { and }.
+	swapPanes bool
+	split     int
+	// keepPanes stops a pane with no lines from collapsing (=).
+	keepPanes bool
+	// apart is where the pane not being scrolled was left while the scroll
+	// lock is off (ctrl+l); nil while both panes show the same rows.
+	apart *ui.PaneApart
+	// showHints reserves the bottom line for key hints of the current focus.
+	showHints bool
+	// hideBanner gives the sidebar banner's rows to the file list (B).
+	hideBanner bool
+	// layout is the pane arrangement chosen with |; auto stacks the panes on
+	// narrow terminals.
+	layout ui.Layout
+	// highlight is how edit rows mark their changes, cycled with x.
+	highlight ui.ChangeHighlight
+
+	// functionContext expands hunks to whole functions via git's -W.
+	functionContext bool
+	// fullFile shows the whole file with changed regions marked.
+	fullFile bool
+	// anchor, when set, places the cursor on this row's line numbers once the
+	// next diff loads instead of restoring the saved cursor index, with
+	// anchorAbove lines above it as before the reload.
+	anchor      *diff.Row
+	anchorAbove int
+	// syntaxHighlight colors code by language; syntax is computed once per loaded
+	// diff so rendering a frame only applies the spans.
+	syntaxHighlight bool
+	syntax          []ui.RowSyntax
+	// showWhitespace draws tabs and trailing spaces as visible glyphs.
+	showWhitespace bool
+	// tabWidth is the tab stop interval used when expanding tabs on screen.
+	tabWidth int
+	// wrap soft-wraps long rows instead of truncating them at the pane edge.
+	wrap bool
+	// autoAdvance continues into the neighbouring file when a motion runs
+	// past either end of the diff; landing says where that file opens.
+	autoAdvance bool
+	landing     landing
+	// loadedReq is the diffReq of the last diff that arrived; it differs from
+	// diffReq while a diff is loading. loadStarted is when that load began,
+	// and spinner turns in the pane titles until it ends.
+	loadedReq   int
+	loadStarted time.Time
+	spinner     spinner.Model
+	// filesStarted is when the file list began loading while the sidebar
+	// shows the loading placeholder, which then counts the time up.
+	filesStarted time.Time
+	// inFlight maps each file with a diff request outstanding to the id of
+	// its latest one, and shownFile is the file whose diff the panes hold;
+	// the sidebar marks both.
+	inFlight  map[string]int
+	shownFile string
+	// count is a pending vim-style count prefix, 0 when none was typed.
+	count int
+	// pendingKey is a prefix key such as g waiting for its second key, with
+	// the count typed before it; pendingReq rejects timeouts of earlier prefixes.
+	pendingKey   string
+	pendingCount int
+	pendingReq   int
+	// whitespaceErrors is the number of added lines git diff --check would flag.
+	whitespaceErrors int
+	// invisibleChanges is the number of edit pairs that look the same on screen.
+	invisibleChanges int
+	// contextLines is how many lines of context git puts around changes.
+	contextLines int
+	// keys maps keys bound in the config file to the built-in keys they act as.
+	keys map[string]string
+	// themes are the color themes C cycles through; theme indexes the current one.
+	themes []ui.Theme
+	theme  int
+	// renderCache is shared by every copy of the model, so each frame reuses
+	// what the last one drew.
+	renderCache *ui.RenderCache
+
+	largeDiffLines int
+	largeFileBytes int64
+	largeDiffOptIn map[string]bool
+	guardedLines   int
+	guardedSize    int64
+	// fileInfo describes the shown file under the header, "" while none is.
+	fileInfo string
+
+	imageProtocol ui.ImageProtocol
+	showImages    bool
+	preview       *imagePreview
+	imagesShown   bool
+	// screen is the terminal the program draws on; graphics escapes are
+	// written to it directly.
+	screen io.Writer
+
+	// pick and picked are --pick and the file enter chose under it.
+	pick   bool
+	picked string
+
+	// showBlame adds the cursor line's blame to the NEW title (b). blame
+	// caches it per file until the file list reloads.
+	showBlame     bool
+	blame         map[blameKey]map[int]git.BlameLine
+	blameInFlight map[blameKey]bool
+
+	// repo names the repository and branch in the header once known.
+	repo *git.RepoInfo
+
+	// history is the line the overlay shows the history of, if it does.
+	history *lineHistory
+
+	// notes are the review notes on lines (c), noteEdit the one being typed
+	// and noteList the notes the overlay lists while it does.
+	notes    map[noteKey]note
+	noteEdit *noteEdit
+	noteList []note
+	// fileBlobs names each changed file's diff (git.DiffBlobs), and reviewed
+	// holds the name each file had when space marked it reviewed. The listing
+	// only names them all, setting blobsListed, while some file is reviewed.
+	// stagedBlobs names the staged side of partly staged files for those
+	// that show it (+).
+	fileBlobs   map[string]string
+	stagedBlobs map[string]string
+	blobsListed bool
+	reviewed    map[reviewKey]string
+	// bookmarks are the rows marked with m, and bookmarkList the ones the
+	// overlay lists while it does.
+	bookmarks    map[bookmarkKey]bookmark
+	bookmarkList []bookmark
+	// state keeps notes, bookmarks and reviewed files between runs in the session named
+	// sessionKey, once sessionLoaded; stateSeq numbers the saves. A nil state
+	// keeps nothing.
+	state         *stateStore
+	sessionKey    string
+	sessionLoaded bool
+	stateSeq      int
+
+	// continuous is the continuous view's state while it is on (V).
+	continuous *continuousView
+	// folds are the hunks folded down to their headers (za, zM).
+	folds map[foldKey]bool
+	// showHeaderMeta shows git's file header lines (X).
+	showHeaderMeta bool
+	// conflictFiles are the files whose added lines leave conflict markers.
+	conflictFiles map[string]bool
+	// unmerged are the files the index holds conflicted, and resolving the
+	// one go or gt asks to take a side of while the overlay asks.
+	unmerged  map[string]bool
+	resolving *resolveChoice
+	// stagedParts maps the worktree files with changes staged as well to the
+	// status of their staged side, and stagedView marks those whose panes
+	// show that staged side (+) while the rest of the list stays unstaged.
+	stagedParts map[string]string
+	stagedView  map[string]bool
+	// merge is the --merge session, which stands in for git's changes.
+	merge *mergeSession
+	// stashList is the stash list the overlay shows (Z), stashConfirm the
+	// pop, apply or drop it asks to confirm and stashShown the entry whose
+	// changes it shows in place of the list.
+	stashList    []git.Stash
+	stashConfirm *stashAction
+	stashShown   *stashAction
+	// worktree is the worktree git runs in once the picker (ctrl+g) left
+	// homeWorktree, the one tdiff started in; it is "" there. worktreeList
+	// is what the picker lists while it does, and worktreePlaces keeps the
+	// place left in each worktree switched away from.
+	worktree       string
+	homeWorktree   string
+	worktreeList   []git.WorktreeInfo
+	worktreePlaces map[string]worktreePlace
+	// algoPicker is set while the overlay lists the diff algorithms (A).
+	algoPicker bool
+
+	// crash catches panics in Update and View for main to report.
+	crash *crashGuard
 }
 
-func initialModel() model {
+func initialModel(opts options) model {
 	return model{
-		mode:         git.Worktree,
-		diffAlgo:     git.DiffHistogram,
+		mode:         opts.mode,
+		diffAlgo:     opts.algo,
 		focus:        ui.FocusFiles,
 		files:        []string{"(loading...)"},
+		filesStarted: time.Now(),
 		fileStatuses: map[string]string{},
 		rows:         loadingRows("loading..."),
-		cursors:      map[string]int{},
+		cursors:      map[cursorKey]cursorPos{},
+		lastCursors:  map[string]cursorPos{},
+		collapsed:    map[string]bool{},
 		width:        120,
 		height:       32,
 		filesReq:     1,
 		noChanges:    false,
+
+		largeDiffLines: opts.largeDiffLines,
+		largeFileBytes: opts.largeFileBytes,
+		autoAdvance:    opts.autoAdvance,
+		largeDiffOptIn: map[string]bool{},
+
+		syntaxHighlight: true,
+		tabWidth:        opts.tabWidth,
+		showHints:       !opts.noHints,
+		hideBanner:      opts.noBanner,
+		showIgnored:     opts.ignored,
+		showSkipped:     opts.skipped,
+		showWhitespace:  opts.showWhitespace,
+		hideUntracked:   opts.hideUntracked,
+		sidebarWidth:    opts.sidebarWidth,
+		swapPanes:       opts.swapPanes,
+		split:           ui.ClampSplit(opts.split),
+		contextLines:    opts.context,
+		keys:            opts.keys,
+		themes:          opts.themes,
+		theme:           opts.theme,
+		renderCache:     &ui.RenderCache{},
+
+		spinner:       newSpinner(opts.ascii),
+		inFlight:      map[string]int{},
+		imageProtocol: ui.DetectImageProtocol(),
+		showImages:    true,
+		screen:        os.Stdout,
+
+		blame:         map[blameKey]map[int]git.BlameLine{},
+		blameInFlight: map[blameKey]bool{},
+
+		pick:  opts.pick,
+		crash: &crashGuard{},
 	}
 }
 
 func (m model) Init() tea.Cmd {
-	return loadFilesCmd(m.mode, m.filesReq)
+	return tea.Batch(m.loadFiles(), m.spinner.Tick)
+}
+
+// maxIgnoredFiles caps how many ignored files are listed when they are shown.
+const maxIgnoredFiles = 2000
+
+// filesJob is everything loadFilesCmd needs to list the changed files.
+type filesJob struct {
+	req  int
+	mode git.Mode
+	// ignored adds ignored untracked files to the worktree list, and skipped
+	// the skip-worktree and assume-unchanged ones that differ on disk.
+	// Untracked files are only looked for with untracked set.
+	ignored   bool
+	skipped   bool
+	untracked bool
+	// blobs names each file's diff for the reviewed marks, which nothing
+	// needs while no file is reviewed.
+	blobs bool
+}
+
+// newFilesJob lists the changed files as the sidebar is set to show them.
+func (m *model) newFilesJob() filesJob {
+	return filesJob{req: m.filesReq, mode: m.mode, ignored: m.showIgnored, skipped: m.showSkipped, untracked: !m.hideUntracked, blobs: len(m.reviewed) > 0}
+}
+
+func (m *model) loadFiles() tea.Cmd {
+	if m.merge != nil {
+		return m.merge.filesCmd(m.filesReq, m.mode)
+	}
+	return loadFilesCmd(m.newFilesJob())
 }
 
-func loadFilesCmd(mode git.Mode, req int) tea.Cmd {
-	return func() tea.Msg {
-		files, err := git.ListChangedFiles(mode)
+func loadFilesCmd(job filesJob) tea.Cmd {
+	mode, req := job.mode, job.req
+	failed := func(err error) tea.Msg {
+		return filesLoadedMsg{req: req, mode: mode, err: err}
+	}
+	return guardCmd(func() tea.Msg {
+		repo, repoOK := git.LoadRepoInfo()
+		if repoOK {
+			git.SetUnborn(repo.Unborn)
+		}
+		files, err := git.ListChangedFiles(mode, job.untracked)
 		if err != nil {
 			return filesLoadedMsg{
 				req:   req,
 				mode:  mode,
 				files: files,
 				err:   err,
+
+				repo:   repo,
+				repoOK: repoOK,
+			}
+		}
+		var blobs map[string]string
+		if job.blobs {
+			if names, blobsErr := git.DiffBlobs(mode, files); blobsErr == nil {
+				blobs = names
+			}
+		}
+		statuses, staged := map[string]string{}, map[string]string(nil)
+		if mode == git.Worktree {
+			// One status run tells both sides of each file apart.
+			if status, statusErr := git.WorktreeStatus(job.untracked); statusErr == nil {
+				statuses, staged = status.Codes(), status.StagedCodes()
+			}
+		} else if codes, statusErr := git.FileStatuses(mode, job.untracked); statusErr == nil {
+			statuses = codes
+		}
+		var stagedBlobs map[string]string
+		if job.blobs && len(staged) > 0 {
+			if names, blobsErr := git.DiffBlobs(git.Staged, nil); blobsErr == nil {
+				stagedBlobs = names
+			}
+		}
+		ignoredCapped := false
+		if job.ignored && mode == git.Worktree {
+			ignored, capped, ignoredErr := git.ListIgnoredFiles(maxIgnoredFiles)
+			if ignoredErr == nil {
+				for _, file := range ignored {
+					if _, ok := statuses[file]; !ok {
+						statuses[file] = "I"
+					}
+				}
+				files = appendNew(files, ignored)
+				ignoredCapped = capped
+			}
+		}
+		if job.skipped && mode == git.Worktree {
+			if skipped, skippedErr := git.SkippedFiles(); skippedErr == nil {
+				for _, file := range skipped {
+					if _, ok := statuses[file]; !ok {
+						statuses[file] = "S"
+					}
+				}
+				files = appendNew(files, skipped)
 			}
 		}
-		statuses, statusErr := git.FileStatuses(mode)
-		if statusErr != nil {
-			statuses = map[string]string{}
+		generated, generatedErr := git.GeneratedFiles(files)
+		if generatedErr != nil {
+			generated = nil
+		}
+		stats, statsErr := git.DiffStats(mode, job.untracked)
+		if stats == nil {
+			stats = map[string]git.FileStat{}
+		}
+		unmerged, unmergedErr := git.UnmergedFiles()
+		if unmergedErr != nil {
+			unmerged = nil
+		}
+		// Markers are only looked for while a merge could have left them,
+		// as the check diffs every file over again.
+		var conflicts map[string]bool
+		if len(unmerged) > 0 || (repoOK && repo.State != "" && repo.State != "BISECTING") {
+			if found, conflictsErr := git.ConflictMarkerFiles(mode); conflictsErr == nil {
+				conflicts = found
+			}
 		}
 		return filesLoadedMsg{
 			req:      req,
 			mode:     mode,
 			files:    files,
 			statuses: statuses,
+			stats:    stats,
 			err:      err,
+
+			generated:     generated,
+			ignoredCapped: ignoredCapped,
+			statsErr:      statsErr,
+			blobs:         blobs,
+			conflicts:     conflicts,
+			unmerged:      unmerged,
+			staged:        staged,
+			stagedBlobs:   stagedBlobs,
+
+			repo:   repo,
+			repoOK: repoOK,
 		}
-	}
+	}, failed)
 }
 
-func loadDiffCmd(mode git.Mode, algo git.DiffAlgo, file string, req int) tea.Cmd {
-	return func() tea.Msg {
-		raw, err := git.FileDiff(mode, algo, file)
+// diffJob is everything loadDiffCmd needs to fetch and prepare one file diff.
+type diffJob struct {
+	req  int
+	mode git.Mode
+	opts git.DiffOptions
+	file string
+	// status is the sidebar status code, e.g. "D" for a deleted file.
+	status string
+	// maxLines enables the large-diff guard when positive, and maxBytes the
+	// guard against files too large to diff.
+	maxLines int
+	maxBytes int64
+	// fullFile expands text diffs to the whole new version of the file.
+	fullFile bool
+	// syntax requests highlighting, skipped for diffs over ui.SyntaxMaxRows.
+	syntax   bool
+	protocol ui.ImageProtocol
+}
+
+// loadDiffCmd loads and parses a file diff. When job.maxLines is positive and
+// the diff changes more lines than that, it returns a placeholder instead so
+// huge files such as lockfiles do not stall the UI.
+func loadDiffCmd(job diffJob) tea.Cmd {
+	failed := func(err error) tea.Msg {
+		return diffLoadedMsg{req: job.req, mode: job.mode, algo: job.opts.Algo, file: job.file, err: err}
+	}
+	return guardCmd(func() tea.Msg {
+		msg := diffLoadedMsg{
+			req:  job.req,
+			mode: job.mode,
+			algo: job.opts.Algo,
+			file: job.file,
+
+			fileInfo: fileInfo(job.mode, job.file),
+		}
+
+		if job.maxBytes > 0 {
+			if size := largestSide(git.BlobSizes(job.mode, job.file)); size > job.maxBytes {
+				msg.rows = largeFileRows(size)
+				msg.guardedSize = size
+				return msg
+			}
+		}
+		if job.status == "?" {
+			// git would only say the file differs from /dev/null.
+			if size, ok := untrackedBinarySize(job.file); ok {
+				summary := binaryNewFile(job.file, size)
+				msg.rows = []diff.Row{{Old: summary, New: summary, Kind: diff.Meta}}
+				msg.preview = loadImagePreview(job.protocol, job.mode, job.file)
+				return msg
+			}
+		}
+		if job.maxLines > 0 {
+			changed, binary, err := git.ChangedLineCount(job.mode, job.file)
+			if err == nil && !binary && changed > job.maxLines {
+				msg.rows = largeDiffRows(changed)
+				msg.guardedLines = changed
+				return msg
+			}
+		}
+
+		var raw string
+		var err error
+		if job.status == "S" {
+			raw, err = git.SkippedFileDiff(job.opts, job.file)
+		} else {
+			raw, err = git.FileDiff(job.mode, job.opts, job.file)
+		}
 		if err != nil {
-			return diffLoadedMsg{
-				req:  req,
-				mode: mode,
-				algo: algo,
-				file: file,
-				err:  err,
+			msg.err = err
+			return msg
+		}
+		// An empty diff for a listed file usually means its changes were
+		// committed or undone since the list loaded.
+		if raw == "" && job.status != "?" {
+			if changed, err := git.HasChanges(job.mode, job.file); err == nil && !changed {
+				msg.vanished = true
+				return msg
 			}
 		}
-		rows, hunks := diff.ParseUnified(raw)
-		return diffLoadedMsg{
-			req:        req,
-			mode:       mode,
-			algo:       algo,
-			file:       file,
-			rows:       rows,
-			hunkStarts: hunks,
+		rows, hunks := diff.ParseHunks(raw)
+		switch {
+		case diff.IsBinary(raw):
+			rows = binarySummaryRows(job.file, git.BlobSizes(job.mode, job.file), rows)
+			msg.preview = loadImagePreview(job.protocol, job.mode, job.file)
+		case job.status == "D":
+			if content, ok := deletedFileContent(job.mode, job.file); ok {
+				rows = deletedFileRows(content)
+				hunks = nil
+			}
+		default:
+			if change, ok := diff.DetectLFSChange(rows); ok {
+				rows = lfsSummaryRows(change)
+				hunks = nil
+				msg.preview = loadLFSImagePreview(job.protocol, change, job.file)
+			} else if job.fullFile {
+				if versions := git.LoadFileVersions(job.mode, job.file); versions.HasNew {
+					rows, hunks = diff.FullFileRows(string(versions.New), rows, hunks)
+				}
+			}
+		}
+		msg.rows = rows
+		msg.hunks = hunks
+		msg.whitespaceErrors = diff.MarkWhitespaceErrors(rows, diff.ParseWhitespaceRule(git.WhitespaceConfig()))
+		msg.invisibleChanges = diff.MarkInvisibleChanges(rows)
+		if job.syntax && len(rows) <= ui.SyntaxMaxRows {
+			msg.syntax = ui.HighlightRows(job.file, rows)
 		}
+		return msg
+	}, failed)
+}
+
+// deletedFileContent loads the last known content of a deleted file: the index
+// copy for worktree deletions, HEAD for staged ones.
+func deletedFileContent(mode git.Mode, file string) (string, bool) {
+	versions := git.LoadFileVersions(mode, file)
+	if !versions.HasOld {
+		return "", false
 	}
+	return string(versions.Old), true
+}
+
+// deletedFileRows shows a deleted file's whole content in the OLD pane with
+// deletion styling, leaving the NEW pane as a single notice.
+func deletedFileRows(content string) []diff.Row {
+	rows := diff.DeletedFileRows(content)
+	header := diff.Row{Old: fmt.Sprintf("(deleted: %s lines)", formatCount(len(rows))), New: "(file deleted)", Kind: diff.Meta}
+	return append([]diff.Row{header}, rows...)
 }
 
-func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+func (m model) Update(msg tea.Msg) (next tea.Model, cmd tea.Cmd) {
+	defer m.catchUpdatePanic(&next, &cmd)
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
-		return m.handleWindowSize(msg)
+		return followCursor(m.handleWindowSize(msg))
 	case filesLoadedMsg:
 		return m.handleFilesLoaded(msg)
 	case diffLoadedMsg:
 		return m.handleDiffLoaded(msg)
+	case pendingKeyTimeoutMsg:
+		return m.handlePendingKeyTimeout(msg)
+	case drawImagesMsg:
+		return m.handleDrawImages(msg)
+	case spinner.TickMsg:
+		return m.handleSpinnerTick(msg)
+	case retryMsg:
+		return m.handleRetry(msg)
+	case resumedMsg:
+		return m.handleResumed(msg)
+	case blameLoadedMsg:
+		return m.handleBlameLoaded(msg)
+	case historyLoadedMsg:
+		return m.handleHistoryLoaded(msg)
+	case remoteURLMsg:
+		return m.handleRemoteURL(msg)
+	case resolvedMsg:
+		return m.handleResolved(msg)
+	case stashDoneMsg:
+		return m.handleStashDone(msg)
+	case stashShownMsg:
+		return m.handleStashShown(msg)
+	case stashesLoadedMsg:
+		return m.handleStashesLoaded(msg)
+	case worktreesLoadedMsg:
+		return m.handleWorktreesLoaded(msg)
+	case mergeWrittenMsg:
+		return m.handleMergeWritten(msg)
+	case mergeEditedMsg:
+		return m.handleMergeEdited(msg)
+	case plainViewDoneMsg:
+		return m.handlePlainViewDone(msg)
+	case sessionLoadedMsg:
+		return m.handleSessionLoaded(msg)
+	case stateSavedMsg:
+		return m.handleStateSaved(msg)
 	case tea.KeyMsg:
-		return m.handleKeyMsg(msg)
+		return followCursor(m.handleKeyMsg(msg))
 	}
 
 	return m, nil
@@ -137,118 +784,479 @@ func (m model) handleWindowSize(msg tea.WindowSizeMsg) (tea.Model, tea.Cmd) {
 	m.height = msg.Height
 	m.ensureSidebarVisible()
 	m.ensureCursorVisible()
-	return m, nil
+	return m, m.drawImagesCmd()
 }
 
 func (m model) handleFilesLoaded(msg filesLoadedMsg) (tea.Model, tea.Cmd) {
 	if msg.req != m.filesReq || msg.mode != m.mode {
 		return m, nil
 	}
+	if msg.repoOK {
+		m.repo = &msg.repo
+	}
+	session := m.openSession()
 	if msg.err != nil {
-		m.errMsg = git.FriendlyError(msg.err)
+		m.setError(msg.err)
+		job := m.newFilesJob()
+		job.req, job.mode = msg.req, msg.mode
+		m.failed = &failedLoad{files: &job}
 		m.applyNoChangesState()
-		return m, nil
+		return m, tea.Batch(m.dismissImages(), m.retryLockedCmd(msg.err), session)
 	}
 
-	prevFile := m.selectedFile()
-	m.errMsg = ""
+	prevPath := m.selectedPath()
+	if prevPath == "" {
+		prevPath = m.togglePath
+	}
+	m.togglePath = ""
+	prevFile, prevFiles := m.selectedFile(), m.files
+	m.clearError()
+	m.listed = true
+	m.forgetBlame()
+	m.lockRetried = false
+	m.fileBlobs, m.blobsListed = msg.blobs, msg.blobs != nil
+	m.stagedBlobs = msg.stagedBlobs
+	if m.forgetStaleReviews() {
+		session = tea.Batch(session, m.saveSession())
+	}
 	if len(msg.files) == 0 {
 		m.applyNoChangesState()
-		return m, nil
+		return m, tea.Batch(m.dismissImages(), session)
 	}
 
 	m.noChanges = false
-	m.files = msg.files
+	m.allFiles = msg.files
 	m.fileStatuses = msg.statuses
-	m.selected = clamp(m.selected, 0, len(m.files)-1)
-	if prevFile != "" {
-		if idx := indexOf(prevFile, m.files); idx >= 0 {
+	m.fileStats = msg.stats
+	m.conflictFiles = msg.conflicts
+	m.unmerged = msg.unmerged
+	m.setStagedParts(msg.staged)
+	m.ignoredCapped = msg.ignoredCapped
+	m.statsErr = msg.statsErr
+	m.generated = msg.generated
+	m.applyFileFilters()
+	m.selected = clamp(m.selected, 0, m.sidebarLen()-1)
+	if prevFile != "" && indexOf(prevFile, m.allFiles) < 0 {
+		// The selected file no longer has changes: move to its neighbour
+		// and forget where the cursor was in it.
+		m.forgetCursor(prevFile)
+		m.flash = vanishedNotice(prevFile)
+		prevPath = m.nearestListed(prevFiles, prevFile)
+	}
+	if prevPath != "" {
+		if idx := m.pathIndex(prevPath); idx >= 0 {
 			m.selected = idx
 		}
 	}
 	m.ensureSidebarVisible()
 
+	if m.continuous != nil {
+		// Every file may have changed.
+		m.continuous.loaded = map[string]sectionDiff{}
+		m.continuous.pending = map[string]int{}
+		m.rebuildSections()
+		return m, tea.Batch(m.loadVisibleSections(), session)
+	}
 	m.rows = loadingRows("loading diff...")
-	m.hunkStarts = nil
+	m.hunks = nil
 	m.diffScroll = 0
 	m.cursor = 0
 
+	if entry, ok := m.selectedDir(); ok {
+		return m, tea.Batch(m.showDirectory(entry), session)
+	}
 	file := m.selectedFile()
 	if file == "" {
 		m.rows = noDiffRows()
-		return m, nil
+		return m, session
 	}
-	m.diffReq++
-	return m, loadDiffCmd(m.mode, m.diffAlgo, file, m.diffReq)
+	return m, tea.Batch(m.loadDiff(file), session)
 }
 
 func (m *model) applyNoChangesState() {
 	m.noChanges = true
 	m.files = []string{"(no changes)"}
+	m.allFiles = nil
+	m.noMatches = false
+	m.totals, m.allTotals = ui.DiffTotals{}, ui.DiffTotals{}
 	m.fileStatuses = map[string]string{}
+	m.fileStats = nil
+	m.entries = nil
 	m.selected = 0
 	m.rows = noDiffRows()
-	m.hunkStarts = nil
+	m.hunks = nil
+	m.preview = nil
+	m.fileInfo = ""
 	m.cursor = 0
 	m.sidebarScroll = 0
 	m.diffScroll = 0
+	if m.continuous != nil {
+		m.continuous.sections = nil
+	}
+}
+
+// resizeSidebar grows or shrinks the sidebar from its current on-screen width.
+// The chosen width is kept for the session and clamped again whenever the
+// terminal is too narrow for it.
+func (m model) resizeSidebar(delta int) (tea.Model, tea.Cmd) {
+	m.sidebarWidth = ui.SidebarWidth(m.width, ui.SidebarWidth(m.width, m.sidebarWidth)+delta)
+	m.ensureSidebarVisible()
+	m.ensureCursorVisible()
+	return m, m.drawImagesCmd()
 }
 
 func (m model) handleDiffLoaded(msg diffLoadedMsg) (tea.Model, tea.Cmd) {
-	if msg.req != m.diffReq || msg.mode != m.mode || msg.algo != m.diffAlgo || msg.file != m.selectedFile() {
+	if m.continuous != nil {
+		return m.handleSectionLoaded(msg)
+	}
+	m.finishLoad(msg.file, msg.req)
+	if msg.req != m.diffReq || msg.mode != m.diffMode(msg.file) || msg.algo != m.diffAlgo || msg.file != m.selectedFile() {
 		return m, nil
 	}
+	m.loadedReq = msg.req
+	m.fileInfo = msg.fileInfo
+	landing := m.landing
+	m.landing = landSaved
 	if msg.err != nil {
-		m.errMsg = git.FriendlyError(msg.err)
+		m.setError(msg.err)
+		job := m.diffJob
+		m.failed = &failedLoad{diff: &job}
 		m.rows = noDiffRows()
-		m.hunkStarts = nil
+		m.hunks = nil
+		m.syntax = nil
+		m.whitespaceErrors, m.invisibleChanges = 0, 0
+		m.changeStarts = nil
 		m.cursor = 0
 		m.diffScroll = 0
-		return m, nil
+		return m, m.retryLockedCmd(msg.err)
 	}
 
-	m.errMsg = ""
+	m.clearError()
+	m.lockRetried = false
+	m.shownFile = msg.file
 	m.rows = msg.rows
-	m.hunkStarts = msg.hunkStarts
+	if msg.vanished {
+		m.flash = vanishedNotice(msg.file)
+		m.rows = []diff.Row{{Old: "(" + m.flash + ")", New: "(" + m.flash + ")", Kind: diff.Meta}}
+	}
+	m.hunks = msg.hunks
+	m.syntax = msg.syntax
+	m.changeStarts = diff.ChangeStarts(m.rows)
+	m.noteConflicts(msg.file, m.rows)
+	m.whitespaceErrors, m.invisibleChanges = msg.whitespaceErrors, msg.invisibleChanges
+	m.guardedLines, m.guardedSize = msg.guardedLines, msg.guardedSize
+	m.preview = msg.preview
 	if len(m.rows) == 0 {
 		m.rows = noDiffRows()
-		m.hunkStarts = nil
+		m.hunks = nil
 	}
 
 	current := m.selectedFile()
-	m.cursor = clamp(m.cursors[current], 0, len(m.rows)-1)
+	saved, hasSaved := m.savedCursor(current)
+	m.cursor = clamp(saved.cursor, 0, len(m.rows)-1)
+	// A file seen for the first time opens on its first change rather than on
+	// leading meta or context rows.
+	firstVisit := (!hasSaved || landing == landFirstChange) && m.anchor == nil && len(m.changeStarts) > 0
+	if firstVisit {
+		m.cursor = m.changeStarts[0]
+	}
+	lastHunk := landing == landLastHunk && m.anchor == nil && len(m.hunks) > 0
+	if lastHunk {
+		m.cursor = m.hunks[len(m.hunks)-1].RowStart
+	}
 	m.diffScroll = 0
+	if hasSaved && !firstVisit && !lastHunk {
+		// ensureCursorVisible moves it only if the rows no longer allow it.
+		m.diffScroll = saved.scroll
+	}
+	if m.anchor != nil {
+		m.cursor = diff.FindLine(m.rows, m.anchor.OldNo, m.anchor.NewNo)
+		m.anchor = nil
+		m.saveCursor()
+		m.diffScroll = scrollStart(ui.NewRowMetrics(m.renderModel()), m.cursor, m.anchorAbove)
+	}
 	m.ensureCursorVisible()
-	return m, nil
+	if firstVisit {
+		m.placeCursor(placeAfterContext)
+	}
+	if lastHunk {
+		m.placeCursor(placeQuarter)
+	}
+	return m, tea.Batch(m.drawImagesCmd(), m.requestBlame())
 }
 
 func (m model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.flash = ""
+	if m.lastErr != nil {
+		m.errSeen = true
+	}
+	if m.noteEdit != nil {
+		return m.handleNoteKey(msg)
+	}
 	key := msg.String()
+	if target, ok := m.keys[key]; ok {
+		key = target
+	}
+	if m.overlay != nil {
+		return m.handleOverlayKey(key)
+	}
+	if m.pendingKey != "" {
+		seq := m.pendingKey + key
+		m.pendingKey = ""
+		if key == "esc" || (m.focus == ui.FocusFiles && !sidebarSequence(seq)) {
+			m.count = 0
+			return m, nil
+		}
+		if next, cmd, ok := m.handleBookmarkSequence(seq); ok {
+			m.count = 0
+			return next, cmd
+		}
+		if next, cmd, ok := m.handleMergeSequence(seq); ok {
+			m.count = 0
+			return next, cmd
+		}
+		if next, cmd, ok := m.handleStashSequence(seq); ok {
+			m.count = 0
+			return next, cmd
+		}
+		if next, cmd, ok := m.handleResolveSequence(seq); ok {
+			m.count = 0
+			return next, cmd
+		}
+		if m.handleKeySequence(seq) {
+			m.count = 0
+			return m, nil
+		}
+	}
+	if m.accumulateCount(key) {
+		return m, nil
+	}
+	count := m.takeCount()
+
 	switch key {
+	case "esc":
+		if m.statusFilter != "" {
+			return m.setStatusFilter("")
+		}
+		if m.pick {
+			return m, tea.Quit
+		}
+		return m, nil
+	case "enter":
+		if m.pick && m.selectedFile() != "" {
+			return m.pickFile()
+		}
 	case "ctrl+c", "q":
 		return m, tea.Quit
+	case "ctrl+z":
+		return m.suspend()
+	case "ctrl+s":
+		return m.showPlainView()
+	case "b":
+		return m.toggleBlame()
+	case "h":
+		return m.showLineHistory()
+	case "c":
+		return m.startNote()
+	case "m":
+		return m.toggleBookmark()
+	case "'", "`":
+		cmd := m.startPendingKey(key, count)
+		return m, cmd
+	case "ctrl+n":
+		return m.showNotes()
+	case "S":
+		return m.stashFile()
+	case "Z":
+		return m.showStashes()
+	case "ctrl+g":
+		return m.showWorktrees()
+	case "V":
+		return m.toggleContinuous()
+	case "O":
+		return m.openRemote(false)
+	case "ctrl+o":
+		return m.openRemote(true)
 	case "s":
 		return m.toggleMode()
 	case "a":
 		return m.cycleDiffAlgo()
+	case "L":
+		return m.loadLargeDiff()
+	case "e":
+		return m.showErrorDetail()
+	case "r":
+		return m.retryFailed()
+	case "W":
+		return m.toggleFunctionContext()
+	case "i":
+		return m.toggleImagePreview()
+	case "f":
+		return m.toggleFullFile()
+	case "H":
+		return m.toggleSyntax()
+	case "w":
+		m.showWhitespace = !m.showWhitespace
+		return m, nil
+	case "T":
+		m.tabWidth = nextTabWidth(m.tabWidth)
+		m.ensureCursorVisible()
+		return m, nil
+	case "ctrl+w":
+		m.wrap = !m.wrap
+		m.ensureCursorVisible()
+		return m, nil
+	case "R":
+		m.autoAdvance = !m.autoAdvance
+		return m, nil
+	case "B":
+		m.hideBanner = !m.hideBanner
+		m.ensureSidebarVisible()
+		return m, nil
+	case "K":
+		m.showHints = !m.showHints
+		m.ensureSidebarVisible()
+		m.ensureCursorVisible()
+		return m, m.drawImagesCmd()
+	case "o":
+		return m.cycleFileSort()
+	case "C":
+		if len(m.themes) > 0 {
+			m.theme = (m.theme + 1) % len(m.themes)
+		}
+		return m, m.drawImagesCmd()
+	case "ctrl+t":
+		return m.toggleTreeView()
+	case "t":
+		return m.toggleUntracked()
+	case "I":
+		return m.toggleIgnored()
+	case "+":
+		return m.toggleFileStaged()
+	case "F":
+		return m.toggleSkipped()
+	case "E":
+		m.showGenerated = !m.showGenerated
+		return m, m.refilter()
+	case "x":
+		m.highlight = m.highlight.Next()
+		return m, nil
+	case "X":
+		m.showHeaderMeta = !m.showHeaderMeta
+		m.ensureCursorVisible()
+		return m, nil
+	case "|":
+		m.layout = m.layout.Next()
+		m.ensureSidebarVisible()
+		m.ensureCursorVisible()
+		return m, m.drawImagesCmd()
+	case "<", "ctrl+left":
+		return m.resizeSidebar(-sidebarWidthStep)
+	case ">", "ctrl+right":
+		return m.resizeSidebar(sidebarWidthStep)
+	case "{":
+		return m.moveSplit(-ui.SplitStep)
+	case "}":
+		return m.moveSplit(ui.SplitStep)
+	case "~":
+		return m.swapPaneOrder()
+	case "=":
+		return m.toggleKeepPanes()
+	case "ctrl+l":
+		return m.toggleScrollLock()
+	}
+
+	next, cmd := m.handleFocusKey(key, count)
+	// Moving focus restyles every pane border, which wipes cell-based images.
+	if nm, ok := next.(model); ok && nm.focus != m.focus && nm.previewActive() {
+		return nm, tea.Batch(cmd, nm.drawImagesCmd())
+	}
+	return next, cmd
+}
+
+// pendingKeys is the count and prefix typed so far, e.g. "15" or "g".
+func (m *model) pendingKeys() string {
+	keys := m.pendingKey
+	if m.count > 0 {
+		keys = strconv.Itoa(m.count) + keys
 	}
+	return keys
+}
 
+func (m model) handleFocusKey(key string, count int) (tea.Model, tea.Cmd) {
+	if m.stacked() {
+		if cmd, ok := m.handleStackedKey(key, count); ok {
+			return m, cmd
+		}
+	}
 	switch m.focus {
 	case ui.FocusFiles:
-		return m.handleFilesFocusKey(key)
+		return m.handleFilesFocusKey(key, count)
 	case ui.FocusOld:
-		return m.handleOldPaneKey(key)
+		return m.handleOldPaneKey(key, count)
 	case ui.FocusNew:
-		return m.handleNewPaneKey(key)
+		return m.handleNewPaneKey(key, count)
 	default:
 		return m, nil
 	}
 }
 
+func (m *model) stacked() bool {
+	return ui.ResolveLayout(m.layout, m.width) == ui.LayoutStacked
+}
+
+// handleStackedKey handles the keys whose meaning follows the stacked layout:
+// shift+up/down move focus between the file strip, OLD and NEW, which sit
+// above each other, and left/right on the strip step through files.
+func (m *model) handleStackedKey(key string, count int) (tea.Cmd, bool) {
+	switch key {
+	case "shift+up", "shift+down":
+		m.stepFocus(key == "shift+down")
+		return nil, true
+	case "left", "right":
+		if m.focus != ui.FocusFiles {
+			return nil, false
+		}
+		if key == "left" {
+			count = -count
+		}
+		return m.moveSelection(count), true
+	}
+	return nil, false
+}
+
 // cycleDiffAlgo rotates through default -> histogram -> patience and reloads the
 // selected diff immediately so the user can compare hunk quality in-place.
 func (m model) cycleDiffAlgo() (tea.Model, tea.Cmd) {
-	m.diffAlgo = m.diffAlgo.Next()
+	return m.useDiffAlgo(m.diffAlgo.Next())
+}
+
+// useDiffAlgo switches to algo and reloads the selected diff with it.
+func (m model) useDiffAlgo(algo git.DiffAlgo) (tea.Model, tea.Cmd) {
+	m.saveCursor()
+	m.diffAlgo = algo
+	if !m.hasRealFiles() {
+		return m, nil
+	}
+
+	file := m.selectedFile()
+	if file == "" {
+		return m, nil
+	}
+	// Algorithms shape hunks differently, so the same row index would land
+	// somewhere unrelated; keep the line instead.
+	m.anchorCursor()
+
+	m.rows = loadingRows("loading diff...")
+	m.hunks = nil
+	cmd := m.loadDiff(file)
+	return m, cmd
+}
+
+// toggleFunctionContext switches git's --function-context on or off and reloads
+// the selected diff so whole enclosing functions become visible.
+func (m model) toggleFunctionContext() (tea.Model, tea.Cmd) {
+	m.functionContext = !m.functionContext
 	if !m.hasRealFiles() {
 		return m, nil
 	}
@@ -258,107 +1266,364 @@ func (m model) cycleDiffAlgo() (tea.Model, tea.Cmd) {
 	if file == "" {
 		return m, nil
 	}
+	m.anchorCursor()
 
 	m.rows = loadingRows("loading diff...")
-	m.hunkStarts = nil
-	m.diffReq++
-	return m, loadDiffCmd(m.mode, m.diffAlgo, file, m.diffReq)
+	m.hunks = nil
+	cmd := m.loadDiff(file)
+	return m, cmd
+}
+
+// toggleFullFile switches between the compact hunk view and the whole file,
+// keeping the cursor on the same source line.
+func (m model) toggleFullFile() (tea.Model, tea.Cmd) {
+	m.fullFile = !m.fullFile
+	file := m.selectedFile()
+	if file == "" {
+		return m, nil
+	}
+
+	m.anchorCursor()
+	m.rows = loadingRows("loading diff...")
+	m.hunks = nil
+	cmd := m.loadDiff(file)
+	return m, cmd
+}
+
+// anchorCursor keeps the cursor on its line, at the same height in the pane,
+// through the reload that follows.
+func (m *model) anchorCursor() {
+	if m.diffLoading() || m.cursor < 0 || m.cursor >= len(m.rows) {
+		return
+	}
+	row := m.rows[m.cursor]
+	m.anchor = &row
+	metrics := ui.NewRowMetrics(m.renderModel())
+	m.anchorAbove = 0
+	for idx := m.diffScroll; idx < m.cursor; idx++ {
+		m.anchorAbove += metrics.Height(idx)
+	}
+}
+
+// toggleSyntax switches syntax highlighting. Turning it back on reloads the diff
+// only when the current one was loaded without spans.
+func (m model) toggleSyntax() (tea.Model, tea.Cmd) {
+	m.syntaxHighlight = !m.syntaxHighlight
+	file := m.selectedFile()
+	if !m.syntaxHighlight || m.syntax != nil || file == "" || !m.hasRealFiles() {
+		return m, nil
+	}
+
+	m.saveCursor()
+	m.rows = loadingRows("loading diff...")
+	m.hunks = nil
+	cmd := m.loadDiff(file)
+	return m, cmd
+}
+
+// loadLargeDiff opts the selected file out of the large-diff guard and reloads it.
+func (m model) loadLargeDiff() (tea.Model, tea.Cmd) {
+	file := m.selectedFile()
+	if file == "" || (m.guardedLines == 0 && m.guardedSize == 0) {
+		return m, nil
+	}
+
+	m.largeDiffOptIn[file] = true
+	m.guardedLines, m.guardedSize = 0, 0
+	m.rows = loadingRows("loading diff...")
+	m.hunks = nil
+	cmd := m.loadDiff(file)
+	return m, cmd
 }
 
 func (m model) toggleMode() (tea.Model, tea.Cmd) {
 	m.saveCursor()
+	m.togglePath = m.selectedPath()
 	m.mode = m.mode.Toggle()
 	m.noChanges = false
 	m.files = []string{"(loading...)"}
+	m.allFiles = nil
+	m.noMatches = false
+	m.totals, m.allTotals = ui.DiffTotals{}, ui.DiffTotals{}
 	m.fileStatuses = map[string]string{}
+	m.fileStats = nil
+	m.entries = nil
 	m.selected = 0
 	m.rows = loadingRows("loading...")
-	m.hunkStarts = nil
+	m.hunks = nil
 	m.cursor = 0
 	m.sidebarScroll = 0
 	m.diffScroll = 0
-	m.errMsg = ""
+	m.clearError()
 	m.filesReq++
-	return m, loadFilesCmd(m.mode, m.filesReq)
+	tick := m.startFilesTimer()
+	return m, tea.Batch(m.loadFiles(), tick)
 }
 
-func (m model) handleFilesFocusKey(key string) (tea.Model, tea.Cmd) {
+func (m model) handleFilesFocusKey(key string, count int) (tea.Model, tea.Cmd) {
 	switch key {
+	case "M", "A", "D", "?":
+		if m.statusFilter == key {
+			return m.setStatusFilter("")
+		}
+		return m.setStatusFilter(key)
 	case "up", "k":
-		cmd := m.moveSelection(-1)
+		cmd := m.moveSelection(-count)
 		return m, cmd
 	case "down", "j":
-		cmd := m.moveSelection(1)
+		cmd := m.moveSelection(count)
+		return m, cmd
+	case "pgup":
+		cmd := m.moveSelection(-m.sidebarPageSize())
 		return m, cmd
-	case "enter", "right":
-		m.focus = ui.FocusOld
+	case "pgdown":
+		cmd := m.moveSelection(m.sidebarPageSize())
+		return m, cmd
+	case "enter", " ":
+		if _, ok := m.selectedDir(); ok {
+			return m.toggleSelectedDir()
+		}
+		if key == " " {
+			return m.toggleReviewed()
+		}
+		m.setFocus(m.firstPane())
 		return m, nil
+	case "right":
+		m.setFocus(m.firstPane())
+		return m, nil
+	case "g":
+		cmd := m.startPendingKey(key, count)
+		return m, cmd
 	default:
 		return m, nil
 	}
 }
 
-func (m model) handleOldPaneKey(key string) (tea.Model, tea.Cmd) {
+func (m model) handleOldPaneKey(key string, count int) (tea.Model, tea.Cmd) {
 	switch key {
+	case "A":
+		// In the file list A filters by status instead.
+		return m.showAlgos()
 	case "up", "k":
-		m.moveCursor(-1)
+		if cmd, ok := m.advanceFile(-1, m.atLastRow(-1)); ok {
+			return m, cmd
+		}
+		m.moveCursor(-count)
 	case "down", "j":
-		m.moveCursor(1)
-	case "left":
-		m.focus = ui.FocusFiles
-	case "right":
-		m.focus = ui.FocusNew
+		if cmd, ok := m.advanceFile(1, m.atLastRow(1)); ok {
+			return m, cmd
+		}
+		m.moveCursor(count)
+	case "left", "right":
+		m.stepFocus(key == "right")
 	case "n":
-		m.jumpHunk(1)
+		if cmd, ok := m.advanceFile(1, !m.hasHunkAfter(m.cursor)); ok {
+			return m, cmd
+		}
+		m.jumpHunks(1, count)
 	case "p":
-		m.jumpHunk(-1)
-	case "g":
-		m.goTop()
+		if cmd, ok := m.advanceFile(-1, !m.hasHunkBefore(m.cursor)); ok {
+			return m, cmd
+		}
+		m.jumpHunks(-1, count)
+	case "N":
+		m.jumpChange(1, count)
+	case "P":
+		m.jumpChange(-1, count)
+	case "g", "z", "[", "]":
+		cmd := m.startPendingKey(key, count)
+		return m, cmd
 	case "G":
 		m.goBottom()
+	case "ctrl+d":
+		m.pageCursor(count * m.halfPageSize())
+	case "ctrl+u":
+		m.pageCursor(-count * m.halfPageSize())
+	case "ctrl+f", "pgdown":
+		m.pageCursor(m.diffPageSize())
+	case "ctrl+b", "pgup":
+		m.pageCursor(-m.diffPageSize())
 	}
 	return m, nil
 }
 
-func (m model) handleNewPaneKey(key string) (tea.Model, tea.Cmd) {
+func (m model) handleNewPaneKey(key string, count int) (tea.Model, tea.Cmd) {
 	switch key {
+	case "A":
+		// In the file list A filters by status instead.
+		return m.showAlgos()
 	case "up", "k":
-		m.moveCursor(-1)
+		if cmd, ok := m.advanceFile(-1, m.atLastRow(-1)); ok {
+			return m, cmd
+		}
+		m.moveCursor(-count)
 	case "down", "j":
-		m.moveCursor(1)
-	case "left":
-		m.focus = ui.FocusOld
-	case "right":
-		// no-op by spec
+		if cmd, ok := m.advanceFile(1, m.atLastRow(1)); ok {
+			return m, cmd
+		}
+		m.moveCursor(count)
+	case "left", "right":
+		m.stepFocus(key == "right")
 	case "n":
-		m.jumpHunk(1)
+		if cmd, ok := m.advanceFile(1, !m.hasHunkAfter(m.cursor)); ok {
+			return m, cmd
+		}
+		m.jumpHunks(1, count)
 	case "p":
-		m.jumpHunk(-1)
-	case "g":
-		m.goTop()
+		if cmd, ok := m.advanceFile(-1, !m.hasHunkBefore(m.cursor)); ok {
+			return m, cmd
+		}
+		m.jumpHunks(-1, count)
+	case "N":
+		m.jumpChange(1, count)
+	case "P":
+		m.jumpChange(-1, count)
+	case "g", "z", "[", "]":
+		cmd := m.startPendingKey(key, count)
+		return m, cmd
 	case "G":
 		m.goBottom()
+	case "ctrl+d":
+		m.pageCursor(count * m.halfPageSize())
+	case "ctrl+u":
+		m.pageCursor(-count * m.halfPageSize())
+	case "ctrl+f", "pgdown":
+		m.pageCursor(m.diffPageSize())
+	case "ctrl+b", "pgup":
+		m.pageCursor(-m.diffPageSize())
 	}
 	return m, nil
 }
 
-func (m model) View() string {
-	return ui.Render(ui.RenderModel{
-		Width:         m.width,
-		Height:        m.height,
-		ModeLabel:     m.mode.String(),
-		AlgoLabel:     m.diffAlgo.String(),
-		Focus:         m.focus,
-		Files:         m.files,
-		FileStatuses:  m.fileStatuses,
-		Selected:      m.selected,
-		SidebarScroll: m.sidebarScroll,
-		Rows:          m.rows,
-		Cursor:        m.cursor,
-		DiffScroll:    m.diffScroll,
-		SelectedFile:  m.selectedFile(),
-		Error:         m.errMsg,
-	})
+func (m model) View() (view string) {
+	defer m.catchViewPanic(&view)
+	return ui.Render(m.renderModel())
+}
+
+func (m *model) renderModel() ui.RenderModel {
+	hunks := m.hunks
+	if m.continuous != nil {
+		// The header counts the hunks of the cursor's file.
+		hunks = m.sectionHunks()
+	}
+	hunk := diff.HunkAt(hunks, m.cursor)
+	var hunkStart, hunkEnd int
+	if hunk >= 0 {
+		hunkStart, hunkEnd = hunks[hunk].RowStart, hunks[hunk].RowEnd
+	}
+	var theme *ui.Theme
+	if m.theme < len(m.themes) {
+		theme = &m.themes[m.theme]
+	}
+	loadingStatus, loadingHint := m.loadingStatus()
+	hidden, folds := m.hiddenRows()
+	files := m.files
+	if m.filesLoading() {
+		files = []string{m.filesPlaceholder()}
+	}
+	return ui.RenderModel{
+		Theme:            theme,
+		Cache:            m.renderCache,
+		Width:            m.width,
+		Height:           m.height,
+		ModeLabel:        m.modeLabel(),
+		AlgoLabel:        m.diffAlgo.String(),
+		Focus:            m.focus,
+		Files:            files,
+		Entries:          m.entries,
+		FileStatuses:     m.fileStatuses,
+		Selected:         m.selected,
+		SidebarScroll:    m.sidebarScroll,
+		Rows:             m.rows,
+		Cursor:           m.cursor,
+		DiffScroll:       m.diffScroll,
+		SelectedFile:     m.selectedFile(),
+		HunkIndex:        hunk,
+		HunkCount:        len(hunks),
+		HunkStart:        hunkStart,
+		HunkEnd:          hunkEnd,
+		Totals:           m.totals,
+		AllTotals:        m.allTotals,
+		DiffLoading:      m.diffLoading(),
+		FileLoads:        m.fileLoads(),
+		LoadingStatus:    loadingStatus,
+		LoadingHint:      loadingHint,
+		Blame:            m.cursorBlame(),
+		Repo:             m.repoLabel(),
+		RepoState:        m.repoState(),
+		FuncContext:      m.cursorFuncContext(),
+		FunctionMode:     m.functionContext,
+		FullFile:         m.fullFile,
+		TabWidth:         m.tabWidth,
+		SidebarWidth:     m.sidebarWidth,
+		Layout:           m.layout,
+		SwapPanes:        m.swapPanes,
+		Split:            m.split,
+		KeepPanes:        m.keepPanes,
+		Apart:            m.apart,
+		Highlight:        m.highlight,
+		SidebarTitle:     m.sidebarTitle(),
+		ShowHints:        m.showHints,
+		FileInfo:         m.fileInfoLine(),
+		HideBanner:       m.hideBanner,
+		Wrap:             m.wrap,
+		AutoAdvance:      m.autoAdvance,
+		HideUntracked:    m.hideUntracked,
+		Notice:           m.notice(),
+		Prompt:           m.notePrompt(),
+		NoteRows:         m.noteRows(),
+		BookmarkRows:     m.bookmarkRows(),
+		ConflictFiles:    m.conflictFiles,
+		PartlyStaged:     m.stagedParts,
+		ConflictMarkers:  m.conflictFiles[m.rowFile(m.cursor)],
+		Hidden:           hidden,
+		Folds:            folds,
+		Reviewed:         m.reviewedFiles(),
+		HiddenGenerated:  m.hiddenGenerated,
+		PendingKeys:      m.pendingKeys(),
+		ShowWhitespace:   m.showWhitespace,
+		Syntax:           m.visibleSyntax(),
+		WhitespaceErrors: m.whitespaceErrors,
+		InvisibleChanges: m.invisibleChanges > 0,
+		Error:            m.errMsg,
+		ErrorDetail:      m.lastErr != nil,
+		ErrorRetry:       m.failed != nil,
+		Overlay:          m.overlay,
+		PaneTitles:       m.paneTitles(),
+	}
+}
+
+// modeLabel names what the header says is shown: the mode, or the merge.
+func (m *model) modeLabel() string {
+	if m.merge != nil {
+		return "MERGE"
+	}
+	if file := m.selectedFile(); m.diffMode(file) != m.mode {
+		return m.mode.String() + " (file: " + git.Staged.String() + ")"
+	}
+	return m.mode.String()
+}
+
+// paneTitles are the panes' titles while they show other than OLD and NEW.
+func (m *model) paneTitles() [2]string {
+	if m.merge != nil {
+		return [2]string{"LOCAL", "REMOTE"}
+	}
+	return [2]string{}
+}
+
+// diffTotals sums the diffstat of files.
+func (m *model) diffTotals(files []string) ui.DiffTotals {
+	if !m.hasRealFiles() || m.fileStats == nil {
+		return ui.DiffTotals{}
+	}
+	totals := ui.DiffTotals{Files: len(files)}
+	for _, file := range files {
+		stat := m.fileStats[file]
+		totals.Added += stat.Added
+		totals.Deleted += stat.Deleted
+	}
+	return totals
 }
 
 func (m *model) moveSelection(delta int) tea.Cmd {
@@ -367,60 +1632,182 @@ func (m *model) moveSelection(delta int) tea.Cmd {
 	}
 
 	m.saveCursor()
-	next := clamp(m.selected+delta, 0, len(m.files)-1)
+	next := clamp(m.selected+delta, 0, m.sidebarLen()-1)
 	if next == m.selected {
 		return nil
 	}
 
 	m.selected = next
 	m.ensureSidebarVisible()
+	if m.continuous != nil {
+		return m.showSection(m.selectedPath())
+	}
+	if entry, ok := m.selectedDir(); ok {
+		return m.showDirectory(entry)
+	}
 	file := m.selectedFile()
 	if file == "" {
 		return nil
 	}
 
 	m.rows = loadingRows("loading diff...")
-	m.hunkStarts = nil
+	m.hunks = nil
 	m.cursor = 0
 	m.diffScroll = 0
-	m.diffReq++
-	return loadDiffCmd(m.mode, m.diffAlgo, file, m.diffReq)
+	return m.loadDiff(file)
 }
 
 func (m *model) moveCursor(delta int) {
 	if len(m.rows) == 0 {
 		return
 	}
-	m.cursor = clamp(m.cursor+delta, 0, len(m.rows)-1)
+	hidden, _ := m.hiddenRows()
+	m.cursor = stepVisible(hidden, m.cursor, delta, len(m.rows))
 	m.saveCursor()
 	m.ensureCursorVisible()
 }
 
-func (m *model) jumpHunk(direction int) {
-	if len(m.hunkStarts) == 0 {
+// pageCursor moves the cursor and the viewport together by delta rows, like
+// paging in less; both clamp at the ends of the diff.
+func (m *model) pageCursor(delta int) {
+	if len(m.rows) == 0 || delta == 0 {
+		return
+	}
+	// Count rows that show, so a fold taller than the step is passed over
+	// instead of the cursor landing inside it and snapping back.
+	hidden, _ := m.hiddenRows()
+	m.cursor = stepVisible(hidden, m.cursor, delta, len(m.rows))
+	m.diffScroll = stepVisible(hidden, m.diffScroll, delta, len(m.rows))
+	m.saveCursor()
+	m.ensureCursorVisible()
+}
+
+func (m *model) jumpHunks(direction, count int) {
+	for i := 0; i < count; i++ {
+		m.jumpHunk(direction)
+	}
+}
+
+// landing is where the cursor goes once the next diff loads.
+type landing int
+
+const (
+	// landSaved restores the file's saved cursor, or its first change.
+	landSaved landing = iota
+	landFirstChange
+	landLastHunk
+)
+
+// advanceFile moves to the next (direction > 0) or previous file when
+// auto-advance is on and atEdge says the motion ran off the current diff. The
+// next file opens on its first change, the previous one on its last hunk.
+// Nothing happens while a diff is loading, so held keys cannot skip files.
+func (m *model) advanceFile(direction int, atEdge bool) (tea.Cmd, bool) {
+	if m.continuous != nil || !m.autoAdvance || !atEdge || m.loadedReq != m.diffReq || !m.hasRealFiles() {
+		return nil, false
+	}
+	next := m.neighbourFile(direction)
+	if next < 0 {
+		return nil, false
+	}
+	cmd := m.moveSelection(next - m.selected)
+	m.landing = landFirstChange
+	if direction < 0 {
+		m.landing = landLastHunk
+	}
+	return cmd, true
+}
+
+func (m *model) hasHunkAfter(row int) bool {
+	return len(m.hunks) > 0 && m.hunks[len(m.hunks)-1].RowStart > row
+}
+
+func (m *model) hasHunkBefore(row int) bool {
+	return len(m.hunks) > 0 && m.hunks[0].RowStart < row
+}
+
+// jumpChange moves count change runs forward or back, skipping context. The
+// run starts are computed once per loaded diff.
+func (m *model) jumpChange(direction, count int) {
+	if len(m.changeStarts) == 0 {
 		return
 	}
+	var target int
+	if direction > 0 {
+		// First run starting after the cursor; a large count stops at the last.
+		target = sort.SearchInts(m.changeStarts, m.cursor+1)
+		if target >= len(m.changeStarts) {
+			return
+		}
+		target = clamp(target+count-1, 0, len(m.changeStarts)-1)
+	} else {
+		target = sort.SearchInts(m.changeStarts, m.cursor) - 1
+		if target < 0 {
+			return
+		}
+		target = clamp(target-count+1, 0, len(m.changeStarts)-1)
+	}
+	m.cursor = m.changeStarts[target]
+	m.saveCursor()
+	m.ensureCursorVisible()
+}
 
+// jumpHunk moves to the next or previous hunk header and scrolls it to a
+// quarter of the way down so the hunk body is visible below it.
+func (m *model) jumpHunk(direction int) {
+	target := -1
 	if direction > 0 {
-		for _, idx := range m.hunkStarts {
-			if idx > m.cursor {
-				m.cursor = idx
-				m.saveCursor()
-				m.ensureCursorVisible()
-				return
+		for _, hunk := range m.hunks {
+			if hunk.RowStart > m.cursor {
+				target = hunk.RowStart
+				break
 			}
 		}
+	} else {
+		for i := len(m.hunks) - 1; i >= 0; i-- {
+			if m.hunks[i].RowStart < m.cursor {
+				target = m.hunks[i].RowStart
+				break
+			}
+		}
+	}
+	if m.continuous != nil {
+		// A file in between whose diff has not loaded may have hunks of its
+		// own: stop at its header until they are known.
+		end := target
+		if end < 0 && direction > 0 {
+			end = len(m.rows)
+		}
+		if s, ok := m.unloadedSectionBefore(direction, end); ok {
+			target = s.start
+		}
+	}
+	if target < 0 {
 		return
 	}
+	m.cursor = target
+	m.unfoldAt(target)
+	m.saveCursor()
+	m.placeCursor(placeQuarter)
+}
 
-	for i := len(m.hunkStarts) - 1; i >= 0; i-- {
-		if m.hunkStarts[i] < m.cursor {
-			m.cursor = m.hunkStarts[i]
-			m.saveCursor()
-			m.ensureCursorVisible()
-			return
-		}
+// visibleSyntax returns the spans for the rows on screen, or nil when
+// highlighting is off or the rows were replaced since they were computed.
+func (m *model) visibleSyntax() []ui.RowSyntax {
+	if !m.syntaxHighlight || len(m.syntax) != len(m.rows) {
+		return nil
+	}
+	return m.syntax
+}
+
+// cursorFuncContext returns git's enclosing-function hint for the hunk under the
+// cursor, or "" when the cursor is outside a hunk or git found none.
+func (m *model) cursorFuncContext() string {
+	idx := diff.HunkAt(m.hunks, m.cursor)
+	if idx < 0 {
+		return ""
 	}
+	return m.hunks[idx].FuncContext
 }
 
 func (m *model) goTop() {
@@ -441,12 +1828,121 @@ func (m *model) goBottom() {
 	m.ensureCursorVisible()
 }
 
+// loadDiff starts loading file's diff under a fresh request id, applying the
+// large-diff guard unless the user already opted in for that file.
+func (m *model) loadDiff(file string) tea.Cmd {
+	return m.sendDiff(m.newDiffJob(file))
+}
+
+// newDiffJob is the request for file's diff in the current view, without a
+// request id.
+func (m *model) newDiffJob(file string) diffJob {
+	maxLines, maxBytes := m.largeDiffLines, m.largeFileBytes
+	if m.largeDiffOptIn[file] {
+		maxLines, maxBytes = 0, 0
+	}
+	status := m.fileStatuses[file]
+	if m.diffMode(file) != m.mode {
+		status = m.stagedParts[file]
+	}
+	return diffJob{
+		mode:     m.diffMode(file),
+		opts:     git.DiffOptions{Algo: m.diffAlgo, FunctionContext: m.functionContext, Context: m.contextLines},
+		file:     file,
+		status:   status,
+		maxLines: maxLines,
+		maxBytes: maxBytes,
+		fullFile: m.fullFile,
+		syntax:   m.syntaxHighlight,
+		protocol: m.imageProtocol,
+	}
+}
+
+// sendDiff runs job under a fresh request id, dropping whatever the panes
+// kept from the previous diff.
+func (m *model) sendDiff(job diffJob) tea.Cmd {
+	m.folds = nil
+	m.apart = nil
+	if m.continuous != nil {
+		return m.refreshSections(job)
+	}
+	if job.file != m.diffJob.file {
+		// An anchor is a line of the file being reloaded.
+		m.anchor = nil
+	}
+	m.diffReq++
+	job.req = m.diffReq
+	m.diffJob = job
+	m.landing = landSaved
+	m.guardedLines, m.guardedSize = 0, 0
+	m.preview = nil
+	m.syntax = nil
+	m.whitespaceErrors, m.invisibleChanges = 0, 0
+	m.changeStarts = nil
+	m.inFlight[job.file] = job.req
+	m.shownFile = ""
+	load := loadDiffCmd(job)
+	if m.merge != nil {
+		load = m.merge.diffCmd(job)
+	}
+	return tea.Batch(m.dismissImages(), load, m.startSpinner())
+}
+
+// nextTabWidth returns the tab width after current in tabWidths, wrapping
+// around; widths set by flag outside the list continue from the next larger one.
+func nextTabWidth(current int) int {
+	for _, width := range tabWidths {
+		if width > current {
+			return width
+		}
+	}
+	return tabWidths[0]
+}
+
+// cursorKey is one view of a file: the mode and algorithm shape its rows,
+// so each keeps its own position.
+type cursorKey struct {
+	file string
+	mode git.Mode
+	algo git.DiffAlgo
+}
+
+// cursorPos is a saved cursor row and the scroll offset it was seen at.
+type cursorPos struct {
+	cursor, scroll int
+}
+
+// saveCursor remembers the cursor and scroll of the shown diff. Nothing is
+// saved while a diff loads, when the panes hold only a placeholder, or in the
+// continuous view, whose rows are not one file's.
 func (m *model) saveCursor() {
 	file := m.selectedFile()
-	if file == "" {
+	if file == "" || m.diffLoading() || m.continuous != nil {
 		return
 	}
-	m.cursors[file] = m.cursor
+	pos := cursorPos{cursor: m.cursor, scroll: m.diffScroll}
+	m.cursors[cursorKey{file: file, mode: m.diffMode(file), algo: m.diffAlgo}] = pos
+	m.lastCursors[file] = pos
+}
+
+// savedCursor is file's position in the current view, or where it was last
+// left in another view when this one has none.
+func (m *model) savedCursor(file string) (cursorPos, bool) {
+	if pos, ok := m.cursors[cursorKey{file: file, mode: m.diffMode(file), algo: m.diffAlgo}]; ok {
+		return pos, true
+	}
+	pos, ok := m.lastCursors[file]
+	return pos, ok
+}
+
+// forgetCursor drops every position saved for file.
+func (m *model) forgetCursor(file string) {
+	for key := range m.cursors {
+		if key.file == file {
+			delete(m.cursors, key)
+		}
+	}
+	delete(m.lastCursors, file)
 }
 
 func (m *model) hasRealFiles() bool {
@@ -456,30 +1952,73 @@ func (m *model) hasRealFiles() bool {
 	if len(m.files) == 1 && m.files[0] == "(loading...)" {
 		return false
 	}
-	return true
+	return !m.noMatches
 }
 
 func (m *model) selectedFile() string {
+	if m.entries != nil {
+		if m.selected < 0 || m.selected >= len(m.entries) || m.entries[m.selected].Dir {
+			return ""
+		}
+		return m.entries[m.selected].Path
+	}
 	if !m.hasRealFiles() || m.selected < 0 || m.selected >= len(m.files) {
 		return ""
 	}
 	return m.files[m.selected]
 }
 
+// bodyHeight is the height left below the header and above the key-hint
+// footer, matching ui.Render's layout.
 func (m *model) bodyHeight() int {
-	if m.height <= 1 {
+	reserved := 1
+	if m.showHints {
+		reserved++
+	}
+	if ui.FileInfoShown(m.height, m.fileInfoLine()) {
+		reserved++
+	}
+	if m.height <= reserved {
 		return 1
 	}
-	return m.height - 1
+	return m.height - reserved
+}
+
+// diffPageSize is the number of rows one page of the diff panes shows.
+func (m *model) diffPageSize() int {
+	return ui.NewRowMetrics(m.renderModel()).Lines()
+}
+
+func (m *model) halfPageSize() int {
+	return (m.diffPageSize() + 1) / 2
+}
+
+// sidebarVisibleFiles is the number of file rows the sidebar shows, less the
+// bottom row ui.Render reserves for the hidden generated files.
+func (m *model) sidebarVisibleFiles() int {
+	visible := ui.SidebarVisibleFiles(m.bodyHeight(), ui.BannerShown(m.height, m.hideBanner))
+	if m.hiddenGenerated > 0 {
+		visible--
+	}
+	return visible
+}
+
+// sidebarPageSize is the number of files one page of the sidebar shows.
+func (m *model) sidebarPageSize() int {
+	size := m.sidebarVisibleFiles()
+	if size < 1 {
+		return 1
+	}
+	return size
 }
 
 func (m *model) ensureSidebarVisible() {
-	if len(m.files) == 0 {
+	if m.sidebarLen() == 0 {
 		m.sidebarScroll = 0
 		return
 	}
 
-	visible := ui.SidebarVisibleFiles(m.bodyHeight())
+	visible := m.sidebarVisibleFiles()
 	if visible < 1 {
 		visible = 1
 	}
@@ -491,7 +2030,7 @@ func (m *model) ensureSidebarVisible() {
 		m.sidebarScroll = m.selected - visible + 1
 	}
 
-	maxScroll := len(m.files) - visible
+	maxScroll := m.sidebarLen() - visible
 	if maxScroll < 0 {
 		maxScroll = 0
 	}
@@ -506,23 +2045,89 @@ func (m *model) ensureCursorVisible() {
 	}
 
 	m.cursor = clamp(m.cursor, 0, len(m.rows)-1)
-	visible := m.bodyHeight() - 1
-	if visible < 1 {
-		visible = 1
-	}
+	m.showCursorRow()
+	// Rows can span several lines in wrap mode, so scrolling counts the lines
+	// each row takes rather than rows.
+	metrics := ui.NewRowMetrics(m.renderModel())
+	visible := metrics.Lines()
 
 	if m.cursor < m.diffScroll {
 		m.diffScroll = m.cursor
 	}
-	if m.cursor >= m.diffScroll+visible {
-		m.diffScroll = m.cursor - visible + 1
+	if !rowsFit(metrics, m.diffScroll, m.cursor, visible) {
+		m.diffScroll = scrollStart(metrics, m.cursor, visible-metrics.Height(m.cursor))
 	}
 
-	maxScroll := len(m.rows) - visible
-	if maxScroll < 0 {
-		maxScroll = 0
+	m.diffScroll = clamp(m.diffScroll, 0, metrics.MaxScroll())
+}
+
+// scrollPlacement is where placeCursor puts the cursor row in the viewport.
+type scrollPlacement int
+
+const (
+	placeTop scrollPlacement = iota
+	// placeAfterContext keeps leadingContextLines visible above the cursor.
+	placeAfterContext
+	placeQuarter
+	placeCenter
+	placeBottom
+)
+
+// leadingContextLines is how much of what precedes the first change stays
+// visible when a file opens on it.
+const leadingContextLines = 2
+
+// placeCursor scrolls so the cursor row sits at placement, as far as the ends
+// of the diff allow.
+func (m *model) placeCursor(placement scrollPlacement) {
+	if len(m.rows) == 0 {
+		return
 	}
-	m.diffScroll = clamp(m.diffScroll, 0, maxScroll)
+	m.cursor = clamp(m.cursor, 0, len(m.rows)-1)
+	m.showCursorRow()
+	metrics := ui.NewRowMetrics(m.renderModel())
+	visible := metrics.Lines()
+	room := visible - metrics.Height(m.cursor)
+
+	above := 0
+	switch placement {
+	case placeAfterContext:
+		above = leadingContextLines
+	case placeQuarter:
+		above = visible / 4
+	case placeCenter:
+		above = room / 2
+	case placeBottom:
+		above = room
+	}
+	m.diffScroll = clamp(scrollStart(metrics, m.cursor, above), 0, metrics.MaxScroll())
+}
+
+// scrollStart returns the first row to show so that at most above lines are
+// drawn before row cursor.
+func scrollStart(metrics ui.RowMetrics, cursor, above int) int {
+	start := cursor
+	used := 0
+	for start > 0 && used+metrics.Height(start-1) <= above {
+		start--
+		used += metrics.Height(start)
+	}
+	return start
+}
+
+// rowsFit reports whether rows from through to fit in visible lines.
+func rowsFit(metrics ui.RowMetrics, from, to, visible int) bool {
+	if to-from >= visible {
+		return false
+	}
+	used := 0
+	for idx := from; idx <= to; idx++ {
+		used += metrics.Height(idx)
+		if used > visible {
+			return false
+		}
+	}
+	return true
 }
 
 func noDiffRows() []diff.Row {
@@ -533,6 +2138,57 @@ func loadingRows(message string) []diff.Row {
 	return []diff.Row{{Old: fmt.Sprintf("(%s)", message), New: fmt.Sprintf("(%s)", message), Kind: diff.Meta}}
 }
 
+func largeDiffRows(changed int) []diff.Row {
+	msg := fmt.Sprintf("(diff has %s changed lines — press L to load)", formatCount(changed))
+	return []diff.Row{{Old: msg, New: msg, Kind: diff.Meta}}
+}
+
+// largeFileRows is the placeholder for a file of size bytes, too large to
+// diff until L.
+func largeFileRows(size int64) []diff.Row {
+	msg := fmt.Sprintf("(file too large: %s — press L to diff anyway)", formatSize(size))
+	return []diff.Row{{Old: msg, New: msg, Kind: diff.Meta}}
+}
+
+// largestSide is the larger of the two sides' sizes.
+func largestSide(sizes git.FileSizes) int64 {
+	if sizes.Old > sizes.New {
+		return sizes.Old
+	}
+	return sizes.New
+}
+
+// formatCount renders n with thousands separators, e.g. 48201 -> "48,201".
+func formatCount(n int) string {
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	digits := strconv.Itoa(n)
+	var b []byte
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b = append(b, ',')
+		}
+		b = append(b, digits[i])
+	}
+	return string(b)
+}
+
+// appendNew appends the items of extra that are not in base yet.
+func appendNew(base, extra []string) []string {
+	seen := make(map[string]bool, len(base))
+	for _, item := range base {
+		seen[item] = true
+	}
+	for _, item := range extra {
+		if !seen[item] {
+			base = append(base, item)
+			seen[item] = true
+		}
+	}
+	return base
+}
+
 func indexOf(needle string, list []string) int {
 	for i := range list {
 		if list[i] == needle {
@@ -552,9 +2208,85 @@ func clamp(v, minV, maxV int) int {
 	return v
 }
 
+func parseOptions() options {
+	opts, warnings, _ := buildOptions(flag.CommandLine, os.Args[1:], os.Getenv)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "tdiff: %s\n", warning)
+	}
+	return opts
+}
+
 func main() {
-	p := tea.NewProgram(initialModel(), tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
-		fmt.Println(err)
+	os.Exit(run(parseOptions()))
+}
+
+// run starts tdiff with opts and returns its exit status.
+func run(opts options) int {
+	if opts.showVersion {
+		fmt.Println(versionString())
+		return exitOK
+	}
+	if opts.quiet {
+		return checkChanges(opts, os.Stderr)
+	}
+	if opts.list {
+		return listFiles(opts, os.Stdout, os.Stderr)
+	}
+	m := initialModel(opts)
+	if opts.merge {
+		session, err := startMerge(opts.mergeArgs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tdiff: %s\n", git.FriendlyError(err))
+			return exitError
+		}
+		m.merge, m.focus = session, ui.FocusNew
+	} else if path := defaultStatePath(os.Getenv); path != "" {
+		m.state = &stateStore{path: path}
+	}
+	progOpts := []tea.ProgramOption{tea.WithAltScreen()}
+	var screen io.Writer = os.Stdout
+	// --pick draws on the terminal itself so stdout carries only the path.
+	if opts.pick {
+		tty, err := openTTY()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tdiff: --pick needs a terminal: %v\n", err)
+			return exitError
+		}
+		defer tty.Close()
+		lipgloss.SetDefaultRenderer(lipgloss.NewRenderer(tty))
+		m.screen, screen = tty, tty
+		progOpts = append(progOpts, tea.WithInput(tty), tea.WithOutput(tty))
+	}
+	// Terminals that misreport their background get it set explicitly.
+	switch opts.background {
+	case backgroundLight:
+		lipgloss.SetHasDarkBackground(false)
+	case backgroundDark:
+		lipgloss.SetHasDarkBackground(true)
+	}
+	// lipgloss drops colors and attributes alike under NO_COLOR; on a
+	// terminal, bring the attributes back for the monochrome theme. Piped
+	// output stays plain.
+	if opts.noColor && lipgloss.ColorProfile() == termenv.Ascii && termenv.NewOutput(screen).ColorProfile() != termenv.Ascii {
+		lipgloss.SetColorProfile(termenv.ANSI)
+	}
+	p := tea.NewProgram(m, progOpts...)
+	m.crash.quit = p.Quit
+	final, err := p.Run()
+	if report := m.crash.crashed(); report != nil {
+		reportCrash(os.Stderr, report)
+		return exitCrash
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	fm, ok := final.(model)
+	if !ok {
+		return exitCrash
+	}
+	if fm.picked != "" {
+		fmt.Println(pickedPath(fm.picked))
 	}
+	return fm.exitStatus(opts.exitCode)
 }
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// mergeFiles are the files git mergetool hands over, in its order.
+type mergeFiles struct {
+	local, base, remote, merged string
+}
+
+// mergeSession is --merge: a three-way merge of one file whose conflicts
+// are settled one at a time and written to MERGED as they are.
+type mergeSession struct {
+	files mergeFiles
+	merge diff.Merge
+	// done is set once the file is marked resolved, which exits 0.
+	done bool
+}
+
+// startMerge merges args, LOCAL BASE REMOTE MERGED, for --merge.
+func startMerge(args []string) (*mergeSession, error) {
+	if len(args) != 4 {
+		return nil, errors.New("--merge needs LOCAL BASE REMOTE MERGED")
+	}
+	files := mergeFiles{local: args[0], base: args[1], remote: args[2], merged: args[3]}
+	out, err := git.MergeFile(files.local, files.base, files.remote)
+	if err != nil {
+		return nil, err
+	}
+	return &mergeSession{files: files, merge: diff.ParseMerge(out)}, nil
+}
+
+// filesCmd lists MERGED as the only file, in place of git's changed files.
+func (s *mergeSession) filesCmd(req int, mode git.Mode) tea.Cmd {
+	file := s.files.merged
+	return func() tea.Msg {
+		return filesLoadedMsg{req: req, mode: mode, files: []string{file}, statuses: map[string]string{}}
+	}
+}
+
+// diffCmd lays out the merge as it stands in place of MERGED's diff.
+func (s *mergeSession) diffCmd(job diffJob) tea.Cmd {
+	rows, hunks := s.merge.Rows()
+	return func() tea.Msg {
+		msg := diffLoadedMsg{req: job.req, mode: job.mode, algo: job.opts.Algo, file: job.file, rows: rows, hunks: hunks}
+		if job.syntax && len(rows) <= ui.SyntaxMaxRows {
+			msg.syntax = ui.HighlightRows(job.file, rows)
+		}
+		return msg
+	}
+}
+
+// mergeWrittenMsg reports how writing MERGED went; final is set when the
+// write marks the file resolved.
+type mergeWrittenMsg struct {
+	final bool
+	err   error
+}
+
+// writeCmd writes the merge as it stands to MERGED, keeping its mode.
+func (s *mergeSession) writeCmd(final bool) tea.Cmd {
+	path, text := s.files.merged, s.merge.Text()
+	return guardCmd(func() tea.Msg {
+		perm := os.FileMode(0o644)
+		if info, err := os.Stat(path); err == nil {
+			perm = info.Mode().Perm()
+		}
+		return mergeWrittenMsg{final: final, err: os.WriteFile(path, []byte(text), perm)}
+	}, func(err error) tea.Msg {
+		return mergeWrittenMsg{final: final, err: err}
+	})
+}
+
+// handleMergeSequence runs the --merge keys: go, gt and gb settle the
+// conflict under the cursor with LOCAL, REMOTE or both, gE edits it and gw
+// marks the file resolved and quits. It reports false for other sequences
+// and outside --merge.
+func (m model) handleMergeSequence(seq string) (tea.Model, tea.Cmd, bool) {
+	if m.merge == nil {
+		return m, nil, false
+	}
+	switch seq {
+	case "go", "gt", "gb":
+		chunk := m.cursorConflict()
+		if chunk == nil {
+			return m, nil, true
+		}
+		switch seq {
+		case "go":
+			chunk.Resolve(chunk.Ours)
+		case "gt":
+			chunk.Resolve(chunk.Theirs)
+		default:
+			chunk.Resolve(append(append([]string(nil), chunk.Ours...), chunk.Theirs...))
+		}
+		cmd := m.mergeChanged()
+		return m, cmd, true
+	case "gE":
+		next, cmd := m.editConflict()
+		return next, cmd, true
+	case "gw":
+		if open := m.merge.merge.Unresolved(); open > 0 {
+			m.flash = fmt.Sprintf("%d of %d conflicts unresolved: go, gt, gb or gE settles the one under the cursor", open, m.merge.merge.Conflicts())
+			return m, nil, true
+		}
+		return m, m.merge.writeCmd(true), true
+	}
+	return m, nil, false
+}
+
+// cursorConflict is the conflict the cursor is in, flashing a hint outside
+// them.
+func (m *model) cursorConflict() *diff.MergeChunk {
+	idx := -1
+	if !m.diffLoading() {
+		idx = diff.HunkAt(m.hunks, m.cursor)
+	}
+	chunk := m.merge.merge.Conflict(idx)
+	if idx < 0 || chunk == nil {
+		m.flash = "not in a conflict: n and p jump between them"
+		return nil
+	}
+	return chunk
+}
+
+// mergeChanged shows and writes a conflict just settled.
+func (m *model) mergeChanged() tea.Cmd {
+	m.saveCursor()
+	return tea.Batch(m.sendDiff(m.diffJob), m.merge.writeCmd(false))
+}
+
+func (m model) handleMergeWritten(msg mergeWrittenMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case msg.err != nil:
+		m.flash = "cannot write " + m.merge.files.merged + ": " + msg.err.Error()
+	case msg.final:
+		m.merge.done = true
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// mergeEditedMsg arrives when the editor opened on a conflict exits.
+type mergeEditedMsg struct {
+	chunk *diff.MergeChunk
+	path  string
+	err   error
+}
+
+// editConflict opens $VISUAL or $EDITOR on the conflict under the cursor,
+// with its markers while it is unresolved, and takes what is saved as its
+// result (gE).
+func (m model) editConflict() (tea.Model, tea.Cmd) {
+	chunk := m.cursorConflict()
+	if chunk == nil {
+		return m, nil
+	}
+	tmp, err := os.CreateTemp("", "tdiff-conflict-*")
+	if err != nil {
+		m.flash = "cannot edit the conflict: " + err.Error()
+		return m, nil
+	}
+	edit := diff.Merge{Chunks: []diff.MergeChunk{*chunk}}
+	_, err = tmp.WriteString(edit.Text())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		m.flash = "cannot edit the conflict: " + err.Error()
+		return m, nil
+	}
+	args := append(editorCommand(os.Getenv), tmp.Name())
+	path := tmp.Name()
+	run := tea.ExecProcess(exec.Command(args[0], args[1:]...), func(err error) tea.Msg {
+		return mergeEditedMsg{chunk: chunk, path: path, err: err}
+	})
+	return m, tea.Sequence(m.dismissImages(), run)
+}
+
+// editorCommand is $VISUAL, or $EDITOR, or vi, split into its arguments.
+func editorCommand(getenv func(string) string) []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if args := strings.Fields(getenv(name)); len(args) > 0 {
+			return args
+		}
+	}
+	return []string{"vi"}
+}
+
+func (m model) handleMergeEdited(msg mergeEditedMsg) (tea.Model, tea.Cmd) {
+	defer os.Remove(msg.path)
+	if msg.err != nil {
+		m.flash = "editor failed: " + msg.err.Error()
+		return m, m.drawImagesCmd()
+	}
+	content, err := os.ReadFile(msg.path)
+	if err != nil {
+		m.flash = "cannot read the edited conflict: " + err.Error()
+		return m, m.drawImagesCmd()
+	}
+	var lines []string
+	if text := strings.ReplaceAll(string(content), "\r\n", "\n"); text != "" {
+		lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+	if diff.CountConflictRegions(string(content)) > 0 {
+		m.flash = "the edit still has conflict markers; the conflict stays unresolved"
+		return m, m.drawImagesCmd()
+	}
+	msg.chunk.Resolve(lines)
+	return m, tea.Batch(m.mergeChanged(), m.drawImagesCmd())
+}
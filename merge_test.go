@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// mergeModel runs --merge over a file with two conflicts, writing MERGED to
+// a temporary directory.
+func mergeModel(t *testing.T) model {
+	t.Helper()
+	merged := filepath.Join(t.TempDir(), "merged.go")
+	text := "<<<<<<< LOCAL\nL1\n||||||| BASE\nb1\n=======\nR1\n>>>>>>> REMOTE\nsame\n<<<<<<< LOCAL\nL3\n||||||| BASE\nb3\n=======\nR3\n>>>>>>> REMOTE\n"
+	m := initialModel(defaultOptions())
+	m.width, m.height = 160, 50
+	m.merge = &mergeSession{files: mergeFiles{merged: merged}, merge: diff.ParseMerge(text)}
+	m.focus = ui.FocusNew
+	return loadMerge(t, m, m.Init())
+}
+
+// loadMerge runs cmd and the commands that follow from it, which in --merge
+// come back without git.
+func loadMerge(t *testing.T, m model, cmd tea.Cmd) model {
+	t.Helper()
+	for _, msg := range runCmds(cmd) {
+		switch msg.(type) {
+		case filesLoadedMsg, diffLoadedMsg, mergeWrittenMsg:
+			next, more := m.Update(msg)
+			m = loadMerge(t, next.(model), more)
+		}
+	}
+	return m
+}
+
+// runCmds runs cmd, and every command a batch or sequence of it holds,
+// returning the messages they produce.
+func runCmds(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	switch msg := cmd().(type) {
+	case tea.BatchMsg:
+		var msgs []tea.Msg
+		for _, c := range msg {
+			msgs = append(msgs, runCmds(c)...)
+		}
+		return msgs
+	default:
+		return []tea.Msg{msg}
+	}
+}
+
+func mergeKeys(t *testing.T, m model, seq string) (model, tea.Cmd) {
+	t.Helper()
+	var cmd tea.Cmd
+	for _, msg := range runeKeys(seq) {
+		var next tea.Model
+		next, cmd = m.Update(msg)
+		m = next.(model)
+	}
+	return m, cmd
+}
+
+func TestMerge_SettlesConflictsIntoMerged(t *testing.T) {
+	m := mergeModel(t)
+	if len(m.hunks) != 2 || m.renderModel().PaneTitles != [2]string{"LOCAL", "REMOTE"} {
+		t.Fatalf("hunks %+v", m.hunks)
+	}
+	m, _ = mergeKeys(t, m, "gw")
+	if !strings.HasPrefix(m.flash, "2 of 2 conflicts unresolved") {
+		t.Fatalf("gw with open conflicts flashed %q", m.flash)
+	}
+	if got := m.exitStatus(false); got != exitError {
+		t.Fatalf("exit status %d before resolving, want %d", got, exitError)
+	}
+
+	m.cursor = m.hunks[0].RowStart
+	m, cmd := mergeKeys(t, m, "gt")
+	m = loadMerge(t, m, cmd)
+	if m.rows[m.hunks[0].RowStart].Old != "@@ conflict 1/2: took REMOTE @@" {
+		t.Fatalf("header %q", m.rows[m.hunks[0].RowStart].Old)
+	}
+	m.cursor = m.hunks[1].RowStart + 1
+	m, cmd = mergeKeys(t, m, "gb")
+	m = loadMerge(t, m, cmd)
+	content, err := os.ReadFile(m.merge.files.merged)
+	if err != nil || string(content) != "R1\nsame\nL3\nR3\n" {
+		t.Fatalf("MERGED %q, %v", content, err)
+	}
+
+	m, cmd = mergeKeys(t, m, "gw")
+	msgs := runCmds(cmd)
+	if len(msgs) != 1 {
+		t.Fatalf("gw ran %v", msgs)
+	}
+	next, quit := m.Update(msgs[0])
+	m = next.(model)
+	if quit == nil || !m.merge.done || m.exitStatus(false) != exitOK {
+		t.Fatalf("gw did not mark the file resolved")
+	}
+}
+
+func TestMerge_KeysOutsideAConflict(t *testing.T) {
+	m := mergeModel(t)
+	m.cursor = m.hunks[0].RowEnd
+	m, cmd := mergeKeys(t, m, "go")
+	if cmd != nil || !strings.HasPrefix(m.flash, "not in a conflict") || m.merge.merge.Unresolved() != 2 {
+		t.Fatalf("go on a merged line: flash %q", m.flash)
+	}
+}
+
+func TestMerge_NoContinuousView(t *testing.T) {
+	m := mergeModel(t)
+	m, cmd := mergeKeys(t, m, "V")
+	if cmd != nil || m.continuous != nil || !strings.HasPrefix(m.flash, "--merge shows one file") {
+		t.Fatalf("V in --merge: continuous %v, flash %q", m.continuous != nil, m.flash)
+	}
+}
+
+func TestEditorCommand(t *testing.T) {
+	env := map[string]string{"EDITOR": "code --wait"}
+	if got := strings.Join(editorCommand(func(k string) string { return env[k] }), " "); got != "code --wait" {
+		t.Fatalf("editor %q", got)
+	}
+	env["VISUAL"] = "nvim"
+	if got := editorCommand(func(k string) string { return env[k] }); len(got) != 1 || got[0] != "nvim" {
+		t.Fatalf("editor %q, want $VISUAL first", got)
+	}
+	if got := editorCommand(func(string) string { return "" }); got[0] != "vi" {
+		t.Fatalf("editor %q", got)
+	}
+}
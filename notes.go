@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// notesFile is where w in the notes list writes them, in the git directory
+// so the export is not an untracked file in the review.
+const notesFile = "tdiff-notes.md"
+
+// note is a review comment on one line of a file's NEW side, with the line
+// as it read when the note was taken.
+type note struct {
+	File  string `json:"file"`
+	Line  int    `json:"line"`
+	Quote string `json:"quote"`
+	Text  string `json:"text"`
+}
+
+type noteKey struct {
+	file string
+	line int
+}
+
+// noteEdit is the note being typed and the line it goes on.
+type noteEdit struct {
+	key   noteKey
+	quote string
+	input textinput.Model
+}
+
+// startNote opens the prompt for the cursor line's note (c), filled with the
+// note it already has.
+func (m model) startNote() (tea.Model, tea.Cmd) {
+	file := m.rowFile(m.cursor)
+	if file == "" || m.diffLoading() || m.cursor < 0 || m.cursor >= len(m.rows) {
+		return m, nil
+	}
+	row := m.rows[m.cursor]
+	if row.Kind == diff.Meta || row.Kind == diff.HunkHeader || row.NewNo == nil {
+		m.flash = "notes go on lines of the NEW side"
+		return m, nil
+	}
+	key := noteKey{file, *row.NewNo}
+	input := textinput.New()
+	input.Prompt = ""
+	input.Placeholder = "note; enter saves, esc cancels, empty deletes"
+	if width := m.width - len([]rune(notePromptLabel(key))) - 1; width > 0 {
+		input.Width = width
+	}
+	input.SetValue(m.notes[key].Text)
+	input.Focus()
+	cmd := input.SetCursorMode(textinput.CursorStatic)
+	m.noteEdit = &noteEdit{key: key, quote: strings.TrimSpace(row.New), input: input}
+	return m, cmd
+}
+
+func notePromptLabel(key noteKey) string {
+	return fmt.Sprintf("note %s:%d: ", key.file, key.line)
+}
+
+// notePrompt is the header line while a note is typed.
+func (m *model) notePrompt() string {
+	if m.noteEdit == nil {
+		return ""
+	}
+	return notePromptLabel(m.noteEdit.key) + m.noteEdit.input.View()
+}
+
+// handleNoteKey edits the note being typed; enter saves it and esc drops it.
+func (m model) handleNoteKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		m.noteEdit = nil
+		return m, nil
+	case "enter":
+		edit := m.noteEdit
+		m.noteEdit = nil
+		text := strings.TrimSpace(edit.input.Value())
+		if m.notes == nil {
+			m.notes = map[noteKey]note{}
+		}
+		if text == "" {
+			if _, ok := m.notes[edit.key]; !ok {
+				return m, nil
+			}
+			delete(m.notes, edit.key)
+			m.flash = "note deleted"
+		} else {
+			m.notes[edit.key] = note{File: edit.key.file, Line: edit.key.line, Quote: edit.quote, Text: text}
+		}
+		return m, m.saveSession()
+	}
+	edit := *m.noteEdit
+	var cmd tea.Cmd
+	edit.input, cmd = edit.input.Update(msg)
+	m.noteEdit = &edit
+	return m, cmd
+}
+
+// sortedNotes is every note, by file and then line.
+func (m *model) sortedNotes() []note {
+	notes := make([]note, 0, len(m.notes))
+	for _, n := range m.notes {
+		notes = append(notes, n)
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if notes[i].File != notes[j].File {
+			return notes[i].File < notes[j].File
+		}
+		return notes[i].Line < notes[j].Line
+	})
+	return notes
+}
+
+// noteRows marks the rows of the shown diff that have notes.
+func (m *model) noteRows() map[int]bool {
+	if len(m.notes) == 0 || m.diffLoading() {
+		return nil
+	}
+	var rows map[int]bool
+	for idx, row := range m.rows {
+		if row.NewNo == nil || row.Kind == diff.Meta || row.Kind == diff.HunkHeader {
+			continue
+		}
+		if _, ok := m.notes[noteKey{m.rowFile(idx), *row.NewNo}]; ok {
+			if rows == nil {
+				rows = map[int]bool{}
+			}
+			rows[idx] = true
+		}
+	}
+	return rows
+}
+
+// noteLines are the notes list's lines, one per note.
+func noteLines(notes []note) []string {
+	lines := make([]string, len(notes))
+	for i, n := range notes {
+		lines[i] = fmt.Sprintf("%s:%d — %s — %s", n.File, n.Line, n.Quote, n.Text)
+	}
+	return lines
+}
+
+// showNotes opens the list of notes to jump to or export (ctrl+n).
+func (m model) showNotes() (tea.Model, tea.Cmd) {
+	if len(m.notes) == 0 {
+		m.flash = "no notes yet: c adds one on the cursor line"
+		return m, nil
+	}
+	m.noteList = m.sortedNotes()
+	m.overlay = &ui.Overlay{
+		Title:      fmt.Sprintf("NOTES (%d)  enter: jump  w: write %s  y: copy", len(m.noteList), notesFile),
+		Lines:      noteLines(m.noteList),
+		Selectable: true,
+	}
+	cmd := m.dismissImages()
+	return m, cmd
+}
+
+// handleNotesKey moves through the notes list, jumps to a note or exports
+// them all.
+func (m model) handleNotesKey(key string) (tea.Model, tea.Cmd) {
+	selected := m.overlay.Selected
+	switch key {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc", "q", "ctrl+n":
+		m.overlay, m.noteList = nil, nil
+		return m, m.drawImagesCmd()
+	case "enter":
+		n := m.noteList[selected]
+		m.overlay, m.noteList = nil, nil
+		line := n.Line
+		cmd := m.jumpTo(n.File, nil, &line)
+		return m, tea.Batch(cmd, m.drawImagesCmd())
+	case "w":
+		path, err := git.GitDirPath(notesFile)
+		if err == nil {
+			err = os.WriteFile(path, []byte(m.notesMarkdown()), 0o644)
+		}
+		if err != nil {
+			m.flash = "cannot write notes: " + firstLine(err.Error())
+		} else {
+			m.flash = "wrote notes to " + path
+		}
+		return m, nil
+	case "y":
+		copyToClipboard(m.screen, m.notesMarkdown())
+		m.flash = fmt.Sprintf("copied %d notes as Markdown", len(m.noteList))
+		return m, nil
+	}
+	m.selectListItem(listSelection(key, selected, len(m.noteList), ui.OverlayVisibleLines(m.bodyHeight())))
+	return m, nil
+}
+
+// notesMarkdown is every note as a Markdown list, one item per note:
+// file:line, the line it is on, and the note.
+func (m *model) notesMarkdown() string {
+	var b strings.Builder
+	title := "Review notes"
+	if label := m.repoLabel(); label != "" {
+		title += ": " + label
+	}
+	b.WriteString("# " + title + "\n\n")
+	for _, n := range m.sortedNotes() {
+		fmt.Fprintf(&b, "- %s — %s — %s\n", markdownCode(fmt.Sprintf("%s:%d", n.File, n.Line)), markdownCode(n.Quote), n.Text)
+	}
+	return b.String()
+}
+
+// markdownCode quotes s as inline code, fencing it with more backticks than
+// it contains in a row.
+func markdownCode(s string) string {
+	if s == "" {
+		return "` `"
+	}
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if longest > 0 {
+		return fence + " " + s + " " + fence
+	}
+	return fence + s + fence
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func typeKeys(t *testing.T, m model, keys ...tea.KeyMsg) model {
+	t.Helper()
+	for _, key := range keys {
+		next, _ := m.handleKeyMsg(key)
+		m = next.(model)
+	}
+	return m
+}
+
+func TestNotes_TypedOnNewLineAndMarked(t *testing.T) {
+	m := loadedModel(2)
+	m.loadedReq = m.diffReq
+	one, two := 1, 2
+	m.rows = []diff.Row{
+		{Old: "@@ -1 +1,2 @@", New: "@@ -1 +1,2 @@", Kind: diff.HunkHeader},
+		{OldNo: &one, NewNo: &one, Old: "a", New: "a", Kind: diff.Context},
+		{NewNo: &two, New: "\tb := 2", Kind: diff.Add},
+	}
+	m.cursor = 0
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("c")})
+	if m.noteEdit != nil || m.flash == "" {
+		t.Fatal("c on a hunk header opened a note")
+	}
+
+	m.cursor = 2
+	m = typeKeys(t, m,
+		tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("c")},
+		tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("why q?")},
+	)
+	if !strings.HasPrefix(m.notePrompt(), "note "+m.selectedFile()+":2: why q?") {
+		t.Fatalf("prompt %q", m.notePrompt())
+	}
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	want := note{File: m.selectedFile(), Line: 2, Quote: "b := 2", Text: "why q?"}
+	if got := m.notes[noteKey{want.File, 2}]; got != want || m.noteEdit != nil {
+		t.Fatalf("note %+v, want %+v", got, want)
+	}
+	if rows := m.noteRows(); len(rows) != 1 || !rows[2] {
+		t.Fatalf("note rows %v", rows)
+	}
+
+	// The prompt comes back filled; emptying it deletes the note, esc keeps it.
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("c")}, tea.KeyMsg{Type: tea.KeyEsc})
+	if len(m.notes) != 1 {
+		t.Fatal("esc changed the note")
+	}
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("c")}, tea.KeyMsg{Type: tea.KeyCtrlU}, tea.KeyMsg{Type: tea.KeyEnter})
+	if len(m.notes) != 0 {
+		t.Fatalf("empty note kept: %v", m.notes)
+	}
+}
+
+func TestNotes_ListJumpsToNote(t *testing.T) {
+	m := loadedModel(3)
+	m.loadedReq = m.diffReq
+	first, last := m.files[0], m.files[2]
+	m.notes = map[noteKey]note{
+		{last, 7}:  {File: last, Line: 7, Text: "later"},
+		{first, 3}: {File: first, Line: 3, Text: "sooner"},
+	}
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyCtrlN})
+	if m.overlay == nil || len(m.noteList) != 2 || m.noteList[0].File != first {
+		t.Fatalf("notes list not opened in order: %+v", m.noteList)
+	}
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")}, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	if m.overlay.Selected != 1 {
+		t.Fatalf("selected %d, want the last note", m.overlay.Selected)
+	}
+	req := m.diffReq
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.overlay != nil || m.selectedFile() != last || m.diffReq == req {
+		t.Fatalf("enter did not open %s", last)
+	}
+	if m.anchor == nil || m.anchor.NewNo == nil || *m.anchor.NewNo != 7 {
+		t.Fatal("the noted line is not anchored for the diff being loaded")
+	}
+}
+
+func TestNotesMarkdown(t *testing.T) {
+	m := loadedModel(1)
+	m.repo = &git.RepoInfo{Name: "tdiff", Branch: "main"}
+	m.notes = map[noteKey]note{
+		{"b.go", 2}: {File: "b.go", Line: 2, Quote: "x := `y`", Text: "use a const"},
+		{"a.go", 9}: {File: "a.go", Line: 9, Quote: "return nil", Text: "wrap the error"},
+	}
+	want := "# Review notes: tdiff@main\n\n" +
+		"- `a.go:9` — `return nil` — wrap the error\n" +
+		"- `b.go:2` — `` x := `y` `` — use a const\n"
+	if got := m.notesMarkdown(); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDefaultStatePath(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(k string) string { return vars[k] }
+	}
+	if got, want := defaultStatePath(env(map[string]string{"XDG_STATE_HOME": "/x", "HOME": "/h"})), filepath.Join("/x", "tdiff", "state.json"); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got, want := defaultStatePath(env(map[string]string{"HOME": "/h"})), filepath.Join("/h", ".local", "state", "tdiff", "state.json"); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got := defaultStatePath(env(nil)); got != "" {
+		t.Fatalf("no HOME: got %q", got)
+	}
+}
+
+func TestSession_NotesPersistPerBranch(t *testing.T) {
+	store := &stateStore{path: filepath.Join(t.TempDir(), "tdiff", "state.json")}
+	open := func(branch string) model {
+		m := loadedModel(1)
+		m.state = store
+		m.repo = &git.RepoInfo{Root: "/src/tdiff", Name: "tdiff", Branch: branch}
+		msg := m.openSession()().(sessionLoadedMsg)
+		if msg.err != nil {
+			t.Fatal(msg.err)
+		}
+		next, _ := m.handleSessionLoaded(msg)
+		return next.(model)
+	}
+
+	m := open("main")
+	m.notes[noteKey{"a.go", 1}] = note{File: "a.go", Line: 1, Text: "keep me"}
+	if msg := m.saveSession()(); msg != nil {
+		t.Fatalf("save: %v", msg.(stateSavedMsg).err)
+	}
+	if got := open("main").notes; len(got) != 1 || got[noteKey{"a.go", 1}].Text != "keep me" {
+		t.Fatalf("notes not restored: %v", got)
+	}
+	if got := open("topic").notes; len(got) != 0 {
+		t.Fatalf("another branch sees the notes: %v", got)
+	}
+
+	// A save overtaken by a later one is dropped.
+	stale := m.saveSession()
+	delete(m.notes, noteKey{"a.go", 1})
+	_ = m.saveSession()()
+	_ = stale()
+	if got := open("main").notes; len(got) != 0 {
+		t.Fatalf("stale save won: %v", got)
+	}
+}
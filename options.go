@@ -0,0 +1,320 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+)
+
+// Hints for what a setting accepts, shown when a value is rejected.
+const (
+	wantMode      = "worktree or staged"
+	wantAlgo      = "default, histogram or patience"
+	wantCount     = "a number, 0 or more"
+	wantBool      = "true or false"
+	wantSize      = "a size such as 5MB or 512K, 0 or more"
+	wantUntracked = "all or no"
+	wantPaneOrder = "old-new or new-old"
+)
+
+func defaultOptions() options {
+	return options{
+		largeDiffLines: defaultLargeDiffLines,
+		largeFileBytes: defaultLargeFileBytes,
+		tabWidth:       ui.DefaultTabWidth,
+		algo:           git.DiffHistogram,
+		context:        git.DefaultContext,
+		themes:         ui.BuiltinThemes(),
+		listFormat:     defaultListFormat,
+	}
+}
+
+// buildOptions resolves every option from, in order of precedence, the
+// command line, TDIFF_* environment variables, the config file and the
+// built-in defaults. A bad value never stops tdiff from starting: it is
+// returned as a warning and the next layer down wins. The error is only set
+// when fs rejects args and is not set to exit on its own.
+func buildOptions(fs *flag.FlagSet, args []string, getenv func(string) string) (options, []string, error) {
+	opts := defaultOptions()
+	configPath := fs.String("config", "", "config file to read instead of $XDG_CONFIG_HOME/tdiff/config.toml")
+	mode := fs.String("mode", "", "initial mode: "+wantMode)
+	algo := fs.String("algo", "", "initial diff algorithm: "+wantAlgo)
+	theme := fs.String("theme", "", "color theme: "+opts.themeNames()+" or one from the config file")
+	context := fs.Int("context", opts.context, "lines of context around changes")
+	largeDiffLines := fs.Int("max-diff-lines", opts.largeDiffLines, "changed-line count above which a diff waits for L before loading (0 disables the guard)")
+	maxFileSize := fs.String("max-file-size", "5MB", "file size above which a diff waits for L before git is asked for it, e.g. 512K or 20MB (0 disables the guard)")
+	tabWidth := fs.Int("tab-width", opts.tabWidth, "columns per tab stop when rendering tabs")
+	autoAdvance := fs.Bool("auto-advance", false, "continue into the next/previous file when moving past either end of a diff")
+	noHints := fs.Bool("no-hints", false, "start without the key-hint footer (K toggles it)")
+	noBanner := fs.Bool("no-banner", false, "start without the sidebar banner (B toggles it)")
+	ignored := fs.Bool("ignored", false, "also list ignored files in worktree mode (I toggles)")
+	untracked := fs.String("untracked", "", "untracked files in the worktree list: all, or no to hide them without git looking for them (t toggles)")
+	skipped := fs.Bool("skipped", false, "also list skip-worktree and assume-unchanged files that differ on disk, in worktree mode (F toggles)")
+	light := fs.Bool("light", false, "use colors for a light background instead of asking the terminal")
+	dark := fs.Bool("dark", false, "use colors for a dark background instead of asking the terminal")
+	noColor := fs.Bool("no-color", false, "draw with bold, reverse and dim only, as when NO_COLOR is set")
+	ascii := fs.Bool("ascii", false, "draw borders, banner and markers with plain ASCII characters")
+	exitCode := fs.Bool("exit-code", false, "exit 1 if there were changes to show and 0 if not, like git diff --exit-code; errors exit 2")
+	quiet := fs.Bool("quiet", false, "skip the TUI and only report changes through the exit status; implies --exit-code")
+	list := fs.Bool("list", false, "print the files the sidebar would show, one per line, and quit without the TUI")
+	listFormat := fs.String("format", defaultListFormat, "line format for --list: %s status, %p path, %a added and %d deleted lines")
+	staged := fs.Bool("staged", false, "start in staged mode; the same as --mode=staged")
+	showVersion := fs.Bool("version", false, "print the version and build information and quit")
+	fs.BoolVar(showVersion, "v", false, "shorthand for --version")
+	merge := fs.Bool("merge", false, "resolve a conflicted file as git mergetool: tdiff --merge LOCAL BASE REMOTE MERGED; exits 0 only once it is marked resolved")
+	pick := fs.Bool("pick", false, "print the file chosen with enter to stdout and quit, drawing on the terminal instead; q and esc print nothing and exit 1")
+	if err := fs.Parse(args); err != nil {
+		return opts, nil, err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var warnings []string
+	path, required := *configPath, true
+	if path == "" {
+		path, required = defaultConfigPath(getenv), false
+	}
+	cfg, unknown, err := loadConfig(path, required)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("%v; ignoring the file", err))
+	}
+	for _, key := range unknown {
+		warnings = append(warnings, fmt.Sprintf("%s: unknown setting %q", path, key))
+	}
+	warnings = append(warnings, addThemes(&opts, cfg, path)...)
+	warnings = append(warnings, applyConfig(&opts, cfg, path)...)
+	warnings = append(warnings, applyEnv(&opts, getenv)...)
+
+	if set["mode"] && !opts.setMode(*mode) {
+		warnings = append(warnings, invalidSetting("--mode", *mode, wantMode))
+	}
+	if *staged {
+		opts.mode = git.Staged
+	}
+	if set["algo"] && !opts.setAlgo(*algo) {
+		warnings = append(warnings, invalidSetting("--algo", *algo, wantAlgo))
+	}
+	if set["theme"] && !opts.setTheme(*theme) {
+		warnings = append(warnings, invalidSetting("--theme", *theme, opts.themeNames()))
+	}
+	if set["context"] && !opts.setContext(*context) {
+		warnings = append(warnings, invalidSetting("--context", strconv.Itoa(*context), wantCount))
+	}
+	if set["max-diff-lines"] {
+		opts.largeDiffLines = *largeDiffLines
+	}
+	if set["max-file-size"] && !opts.setMaxFileSize(*maxFileSize) {
+		warnings = append(warnings, invalidSetting("--max-file-size", *maxFileSize, wantSize))
+	}
+	if set["tab-width"] && *tabWidth > 0 {
+		opts.tabWidth = *tabWidth
+	}
+	if set["auto-advance"] {
+		opts.autoAdvance = *autoAdvance
+	}
+	if set["no-hints"] {
+		opts.noHints = *noHints
+	}
+	if set["no-banner"] {
+		opts.noBanner = *noBanner
+	}
+	if set["ignored"] {
+		opts.ignored = *ignored
+	}
+	if set["skipped"] {
+		opts.skipped = *skipped
+	}
+	if set["untracked"] && !opts.setUntracked(*untracked) {
+		warnings = append(warnings, invalidSetting("--untracked", *untracked, wantUntracked))
+	}
+	switch {
+	case *light && *dark:
+		warnings = append(warnings, "--light and --dark contradict each other; ignoring both")
+	case *light:
+		opts.background = backgroundLight
+	case *dark:
+		opts.background = backgroundDark
+	}
+	if set["no-color"] {
+		opts.noColor = *noColor
+	}
+	if set["ascii"] {
+		opts.ascii = *ascii
+	}
+	opts.showVersion = *showVersion
+	opts.pick = *pick
+	opts.merge = *merge
+	opts.mergeArgs = fs.Args()
+	opts.list = *list
+	opts.listFormat = *listFormat
+	opts.quiet = *quiet
+	opts.exitCode = *exitCode || *quiet
+	if opts.noColor {
+		opts.themes = []ui.Theme{ui.MonochromeTheme()}
+		opts.theme = 0
+	}
+	if opts.ascii {
+		for i := range opts.themes {
+			opts.themes[i] = opts.themes[i].ASCII()
+		}
+	}
+	return opts, warnings, nil
+}
+
+// applyEnv overrides opts with the TDIFF_* variables that are set.
+func applyEnv(opts *options, getenv func(string) string) []string {
+	var warnings []string
+	if v := getenv("TDIFF_MODE"); v != "" && !opts.setMode(v) {
+		warnings = append(warnings, invalidSetting("TDIFF_MODE", v, wantMode))
+	}
+	if v := getenv("TDIFF_ALGO"); v != "" && !opts.setAlgo(v) {
+		warnings = append(warnings, invalidSetting("TDIFF_ALGO", v, wantAlgo))
+	}
+	if v := getenv("TDIFF_THEME"); v != "" && !opts.setTheme(v) {
+		warnings = append(warnings, invalidSetting("TDIFF_THEME", v, opts.themeNames()))
+	}
+	if v := getenv("TDIFF_CONTEXT"); v != "" {
+		if n, err := strconv.Atoi(v); err != nil || !opts.setContext(n) {
+			warnings = append(warnings, invalidSetting("TDIFF_CONTEXT", v, wantCount))
+		}
+	}
+	if v := getenv("TDIFF_NO_BANNER"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			opts.noBanner = b
+		} else {
+			warnings = append(warnings, invalidSetting("TDIFF_NO_BANNER", v, wantBool))
+		}
+	}
+	// NO_COLOR is the cross-tool convention: any value turns color off.
+	if getenv("NO_COLOR") != "" {
+		opts.noColor = true
+	}
+	return warnings
+}
+
+// background overrides the terminal's own report of its background color,
+// which adaptive theme colors are chosen by.
+type background int
+
+const (
+	backgroundAuto background = iota
+	backgroundLight
+	backgroundDark
+)
+
+func invalidSetting(source, value, want string) string {
+	return fmt.Sprintf("invalid %s %q (want %s); ignoring it", source, value, want)
+}
+
+// setMode, setAlgo and setContext apply a setting from any source and report
+// whether the value was valid; opts is left alone when it was not.
+func (o *options) setMode(s string) bool {
+	switch strings.ToLower(s) {
+	case "worktree":
+		o.mode = git.Worktree
+	case "staged":
+		o.mode = git.Staged
+	default:
+		return false
+	}
+	return true
+}
+
+// setUntracked takes git's --untracked-files words: "no" hides untracked
+// files and "all" (or "normal") lists them.
+func (o *options) setUntracked(s string) bool {
+	switch strings.ToLower(s) {
+	case "all", "normal":
+		o.hideUntracked = false
+	case "no":
+		o.hideUntracked = true
+	default:
+		return false
+	}
+	return true
+}
+
+func (o *options) setAlgo(s string) bool {
+	algo, ok := git.ParseDiffAlgo(s)
+	if ok {
+		o.algo = algo
+	}
+	return ok
+}
+
+func (o *options) setContext(n int) bool {
+	if n < 0 {
+		return false
+	}
+	o.context = n
+	return true
+}
+
+// setMaxFileSize sets the size guard from a byte count with an optional K,
+// M or G unit, e.g. "5MB"; the units are powers of 1024.
+func (o *options) setMaxFileSize(value string) bool {
+	size, ok := parseSize(value)
+	if ok {
+		o.largeFileBytes = size
+	}
+	return ok
+}
+
+func parseSize(value string) (int64, bool) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	scale := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			scale = 1 << 10
+		case 'M':
+			scale = 1 << 20
+		case 'G':
+			scale = 1 << 30
+		}
+	}
+	if scale > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || !(n >= 0) || math.IsInf(n, 1) {
+		return 0, false
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, which no int64 holds.
+	size := n * float64(scale)
+	if size >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(size), true
+}
+
+func (o *options) setTheme(name string) bool {
+	i := o.themeIndex(name)
+	if i < 0 {
+		return false
+	}
+	o.theme = i
+	return true
+}
+
+func (o *options) themeIndex(name string) int {
+	for i, theme := range o.themes {
+		if strings.EqualFold(theme.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (o *options) themeNames() string {
+	names := make([]string, len(o.themes))
+	for i, theme := range o.themes {
+		names[i] = theme.Name
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/git"
+)
+
+// resolve runs buildOptions with a config file holding cfg (none when empty)
+// and only the given environment.
+func resolve(t *testing.T, cfg string, env map[string]string, args ...string) (options, []string) {
+	t.Helper()
+	dir := t.TempDir()
+	if cfg != "" {
+		if err := os.MkdirAll(filepath.Join(dir, "tdiff"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "tdiff", "config.toml"), []byte(cfg), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	getenv := func(key string) string {
+		if key == "XDG_CONFIG_HOME" {
+			return dir
+		}
+		return env[key]
+	}
+	fs := flag.NewFlagSet("tdiff", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	opts, warnings, err := buildOptions(fs, args, getenv)
+	if err != nil {
+		t.Fatalf("buildOptions: %v", err)
+	}
+	return opts, warnings
+}
+
+func TestBuildOptions_Defaults(t *testing.T) {
+	opts, warnings := resolve(t, "", nil)
+	if len(warnings) != 0 {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
+	if opts.mode != git.Worktree || opts.algo != git.DiffHistogram || opts.context != git.DefaultContext {
+		t.Fatalf("got mode %v, algo %v, context %d", opts.mode, opts.algo, opts.context)
+	}
+	if opts.largeDiffLines != defaultLargeDiffLines {
+		t.Fatalf("got max-diff-lines %d", opts.largeDiffLines)
+	}
+	if opts.pick {
+		t.Fatal("--pick is on by default")
+	}
+	if opts, _ = resolve(t, "", nil, "--pick"); !opts.pick {
+		t.Fatal("--pick was not applied")
+	}
+	if opts, _ = resolve(t, "", nil, "-v"); !opts.showVersion {
+		t.Fatal("-v did not ask for the version")
+	}
+	if opts, _ = resolve(t, "", nil, "--list", "--staged"); !opts.list || opts.mode != git.Staged || opts.listFormat != defaultListFormat {
+		t.Fatalf("--list --staged: list %v, mode %v, format %q", opts.list, opts.mode, opts.listFormat)
+	}
+}
+
+func TestBuildOptions_Precedence(t *testing.T) {
+	cfg := "mode = \"staged\"\nalgorithm = \"patience\"\ncontext = 5\n"
+	env := map[string]string{"TDIFF_ALGO": "default", "TDIFF_CONTEXT": "7"}
+
+	// Config over defaults.
+	opts, _ := resolve(t, cfg, nil)
+	if opts.mode != git.Staged || opts.algo != git.DiffPatience || opts.context != 5 {
+		t.Fatalf("config: got mode %v, algo %v, context %d", opts.mode, opts.algo, opts.context)
+	}
+
+	// Environment over config, config still fills the rest.
+	opts, _ = resolve(t, cfg, env)
+	if opts.mode != git.Staged || opts.algo != git.DiffDefault || opts.context != 7 {
+		t.Fatalf("env: got mode %v, algo %v, context %d", opts.mode, opts.algo, opts.context)
+	}
+
+	// Flags over everything.
+	opts, _ = resolve(t, cfg, env, "--mode=worktree", "--context=0")
+	if opts.mode != git.Worktree || opts.algo != git.DiffDefault || opts.context != 0 {
+		t.Fatalf("flags: got mode %v, algo %v, context %d", opts.mode, opts.algo, opts.context)
+	}
+}
+
+func TestBuildOptions_InvalidValuesFallBack(t *testing.T) {
+	cfg := "algorithm = \"patience\"\ncontext = -1\n"
+	env := map[string]string{"TDIFF_ALGO": "myers", "TDIFF_MODE": "index", "TDIFF_CONTEXT": "lots"}
+	opts, warnings := resolve(t, cfg, env, "--algo=fast")
+
+	// Each bad layer is skipped, so the last valid one below it wins.
+	if opts.algo != git.DiffPatience || opts.mode != git.Worktree || opts.context != git.DefaultContext {
+		t.Fatalf("got mode %v, algo %v, context %d", opts.mode, opts.algo, opts.context)
+	}
+	want := []string{"context", "TDIFF_MODE", "TDIFF_ALGO", "TDIFF_CONTEXT", "--algo"}
+	if len(warnings) != len(want) {
+		t.Fatalf("got warnings %q, want one each for %v", warnings, want)
+	}
+	for i, source := range want {
+		if !strings.Contains(warnings[i], source) {
+			t.Fatalf("warning %d = %q, want it to name %s", i, warnings[i], source)
+		}
+	}
+}
+
+func TestBuildOptions_MaxFileSize(t *testing.T) {
+	if opts, _ := resolve(t, "", nil); opts.largeFileBytes != defaultLargeFileBytes {
+		t.Fatalf("default %d", opts.largeFileBytes)
+	}
+	opts, warnings := resolve(t, "max-file-size = \"512K\"\n", nil)
+	if opts.largeFileBytes != 512<<10 || len(warnings) != 0 {
+		t.Fatalf("config: %d, warnings %q", opts.largeFileBytes, warnings)
+	}
+	if opts, _ = resolve(t, "max-file-size = \"512K\"\n", nil, "--max-file-size=1.5mb"); opts.largeFileBytes != 3<<19 {
+		t.Fatalf("flag: %d", opts.largeFileBytes)
+	}
+	if opts, _ = resolve(t, "", nil, "--max-file-size=0"); opts.largeFileBytes != 0 {
+		t.Fatalf("0 did not disable the guard: %d", opts.largeFileBytes)
+	}
+	opts, warnings = resolve(t, "", nil, "--max-file-size=huge")
+	if opts.largeFileBytes != defaultLargeFileBytes || len(warnings) != 1 || !strings.Contains(warnings[0], "--max-file-size") {
+		t.Fatalf("bad value: %d, warnings %q", opts.largeFileBytes, warnings)
+	}
+	for _, tooBig := range []string{"8589934592G", "1e300", "9223372036854775807"} {
+		opts, warnings = resolve(t, "", nil, "--max-file-size="+tooBig)
+		if opts.largeFileBytes != defaultLargeFileBytes || len(warnings) != 1 {
+			t.Fatalf("%s: %d, warnings %q", tooBig, opts.largeFileBytes, warnings)
+		}
+	}
+}
+
+func TestBuildOptions_Untracked(t *testing.T) {
+	if opts, _ := resolve(t, "", nil, "--untracked=no"); !opts.hideUntracked {
+		t.Fatal("--untracked=no did not hide untracked files")
+	}
+	if opts, _ := resolve(t, "show-untracked = false\n", nil, "--untracked=all"); opts.hideUntracked {
+		t.Fatal("--untracked=all did not win over the config")
+	}
+	opts, warnings := resolve(t, "", nil, "--untracked=some")
+	if opts.hideUntracked || len(warnings) != 1 || !strings.Contains(warnings[0], "--untracked") {
+		t.Fatalf("bad value: hidden %v, warnings %q", opts.hideUntracked, warnings)
+	}
+}
+
+func TestBuildOptions_BrokenConfigUsesDefaults(t *testing.T) {
+	opts, warnings := resolve(t, "mode = staged\n", map[string]string{"TDIFF_CONTEXT": "9"})
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "config.toml") {
+		t.Fatalf("got warnings %q", warnings)
+	}
+	if opts.mode != git.Worktree || opts.context != 9 {
+		t.Fatalf("got mode %v, context %d", opts.mode, opts.context)
+	}
+}
+
+func TestBuildOptions_Themes(t *testing.T) {
+	cfg := "theme = \"gruvbox\"\n[themes.night]\nbase = \"solarized\"\nold = \"#ff0000\"\n[themes.broken]\nold = \"red\"\n"
+	opts, warnings := resolve(t, cfg, nil)
+	if got := opts.themes[opts.theme].Name; got != "gruvbox" {
+		t.Fatalf("config theme = %s, want gruvbox", got)
+	}
+	if opts.themeIndex("night") < 0 || opts.themeIndex("broken") >= 0 {
+		t.Fatalf("got themes %s, want night added and broken skipped", opts.themeNames())
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "broken") {
+		t.Fatalf("got warnings %q", warnings)
+	}
+
+	opts, _ = resolve(t, cfg, map[string]string{"TDIFF_THEME": "night"})
+	if got := opts.themes[opts.theme].Name; got != "night" {
+		t.Fatalf("env theme = %s, want night", got)
+	}
+	opts, _ = resolve(t, cfg, map[string]string{"TDIFF_THEME": "night"}, "--theme=monochrome")
+	if got := opts.themes[opts.theme].Name; got != "monochrome" {
+		t.Fatalf("flag theme = %s, want monochrome", got)
+	}
+}
+
+func TestBuildOptions_NoColorAndASCII(t *testing.T) {
+	opts, _ := resolve(t, "theme = \"gruvbox\"\n", map[string]string{"NO_COLOR": "1"})
+	if !opts.noColor || len(opts.themes) != 1 || opts.themes[opts.theme].Name != "monochrome" {
+		t.Fatalf("NO_COLOR: got noColor %v, themes %s", opts.noColor, opts.themeNames())
+	}
+	opts, _ = resolve(t, "", nil, "--no-color")
+	if !opts.noColor || opts.themes[opts.theme].Name != "monochrome" {
+		t.Fatalf("--no-color: got noColor %v, themes %s", opts.noColor, opts.themeNames())
+	}
+
+	opts, _ = resolve(t, "ascii = true\n", nil)
+	if !opts.ascii || len(opts.themes) != len(defaultOptions().themes) {
+		t.Fatalf("config ascii: got ascii %v, themes %s", opts.ascii, opts.themeNames())
+	}
+	opts, _ = resolve(t, "ascii = true\n", nil, "--ascii=false")
+	if opts.ascii {
+		t.Fatal("--ascii=false did not override the config file")
+	}
+}
+
+func TestBuildOptions_Banner(t *testing.T) {
+	if opts, _ := resolve(t, "banner = false\n", nil); !opts.noBanner {
+		t.Fatal("config banner = false did not hide the banner")
+	}
+	if opts, _ := resolve(t, "banner = false\n", map[string]string{"TDIFF_NO_BANNER": "0"}); opts.noBanner {
+		t.Fatal("TDIFF_NO_BANNER=0 did not override the config file")
+	}
+	opts, warnings := resolve(t, "", map[string]string{"TDIFF_NO_BANNER": "maybe"}, "--no-banner")
+	if !opts.noBanner || len(warnings) != 1 {
+		t.Fatalf("got noBanner %v, warnings %q", opts.noBanner, warnings)
+	}
+}
+
+func TestBuildOptions_PaneOrderAndSplit(t *testing.T) {
+	opts, warnings := resolve(t, "pane-order = \"new-old\"\nsplit = 30\n", nil)
+	if !opts.swapPanes || opts.split != 30 || len(warnings) != 0 {
+		t.Fatalf("got swap %v, split %d, warnings %q", opts.swapPanes, opts.split, warnings)
+	}
+	opts, warnings = resolve(t, "pane-order = \"sideways\"\nsplit = 95\n", nil)
+	if opts.swapPanes || opts.split != 0 || len(warnings) != 2 {
+		t.Fatalf("got swap %v, split %d, warnings %q", opts.swapPanes, opts.split, warnings)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// paneOrder is the sidebar and the diff panes in the order they are drawn,
+// left to right, or top to bottom when stacked.
+func (m *model) paneOrder() [3]ui.Focus {
+	if m.swapPanes {
+		return [3]ui.Focus{ui.FocusFiles, ui.FocusNew, ui.FocusOld}
+	}
+	return [3]ui.Focus{ui.FocusFiles, ui.FocusOld, ui.FocusNew}
+}
+
+// firstPane is the diff pane drawn next to the sidebar.
+func (m *model) firstPane() ui.Focus {
+	return m.paneOrder()[1]
+}
+
+// stepFocus moves focus to the next pane in drawing order, or the previous
+// one, stopping at either end.
+func (m *model) stepFocus(forward bool) {
+	order := m.paneOrder()
+	for i, focus := range order {
+		if focus != m.focus {
+			continue
+		}
+		switch {
+		case forward && i+1 < len(order):
+			m.setFocus(order[i+1])
+		case !forward && i > 0:
+			m.setFocus(order[i-1])
+		}
+		return
+	}
+}
+
+// swapPaneOrder draws NEW before OLD, or back again (~). Focus stays on the
+// pane it was on.
+func (m model) swapPaneOrder() (tea.Model, tea.Cmd) {
+	m.swapPanes = !m.swapPanes
+	m.flash = "panes: OLD | NEW"
+	if m.swapPanes {
+		m.flash = "panes: NEW | OLD"
+	}
+	return m, m.drawImagesCmd()
+}
+
+// moveSplit moves the border between side-by-side panes delta percent of
+// their width to the right ({ and }), whichever pane is on the left.
+func (m model) moveSplit(delta int) (tea.Model, tea.Cmd) {
+	if m.stacked() {
+		m.flash = "stacked panes take the full width: | switches to side by side"
+		return m, nil
+	}
+	if m.swapPanes {
+		delta = -delta
+	}
+	m.split = ui.ClampSplit(m.split + delta)
+	m.flash = fmt.Sprintf("split: OLD %d%% | NEW %d%%", m.split, 100-m.split)
+	m.ensureCursorVisible()
+	return m, m.drawImagesCmd()
+}
+
+// toggleKeepPanes keeps both panes at the split for files whose lines are
+// all on one side, or lets the empty pane collapse again (=).
+func (m model) toggleKeepPanes() (tea.Model, tea.Cmd) {
+	m.keepPanes = !m.keepPanes
+	m.flash = "panes with no lines collapse: = keeps both"
+	if m.keepPanes {
+		m.flash = "both panes stay open: = collapses a pane with no lines"
+	}
+	m.ensureCursorVisible()
+	return m, m.drawImagesCmd()
+}
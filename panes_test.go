@@ -0,0 +1,159 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestPanes_FocusFollowsTheDrawnOrder(t *testing.T) {
+	m := reviewModel()
+	right, left := tea.KeyMsg{Type: tea.KeyRight}, tea.KeyMsg{Type: tea.KeyLeft}
+	m = update(t, m, runeKeys("~")...)
+	if !m.swapPanes {
+		t.Fatal("~ did not swap the panes")
+	}
+	m.focus = ui.FocusFiles
+	var got []ui.Focus
+	for i := 0; i < 3; i++ {
+		m = typeKeys(t, m, right)
+		got = append(got, m.focus)
+	}
+	if got[0] != ui.FocusNew || got[1] != ui.FocusOld || got[2] != ui.FocusOld {
+		t.Fatalf("right went through %v, want NEW, OLD and stay", got)
+	}
+	m = typeKeys(t, m, left, left, left)
+	if m.focus != ui.FocusFiles {
+		t.Fatalf("left ended on %v", m.focus)
+	}
+
+	m.layout = ui.LayoutStacked
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyShiftDown})
+	if m.focus != ui.FocusNew {
+		t.Fatalf("shift+down from the strip focused %v, want the NEW pane on top", m.focus)
+	}
+}
+
+func TestPanes_SplitMovesTheBorderAndKeepsItsLimits(t *testing.T) {
+	m := reviewModel()
+	m = update(t, m, runeKeys("{{")...)
+	if m.split != 30 {
+		t.Fatalf("split %d after {{, want 30", m.split)
+	}
+	m = update(t, m, runeKeys("}}}}}}}}")...)
+	if m.split != ui.MaxSplit {
+		t.Fatalf("split %d, want it held at %d", m.split, ui.MaxSplit)
+	}
+	// With NEW on the left, { still moves the border left: NEW shrinks.
+	m = update(t, m, runeKeys("~{")...)
+	if m.split != ui.MaxSplit {
+		t.Fatalf("split %d, want OLD held at %d", m.split, ui.MaxSplit)
+	}
+	m = update(t, m, runeKeys("}")...)
+	if m.split != ui.MaxSplit-ui.SplitStep {
+		t.Fatalf("split %d, want OLD to give up a step", m.split)
+	}
+	oldRect, newRect := ui.PaneRowRects(m.renderModel())
+	if newRect.X > oldRect.X || oldRect.Width <= newRect.Width {
+		t.Fatalf("rects old %+v, new %+v", oldRect, newRect)
+	}
+}
+
+func TestPanes_EqualsKeepsBothPanes(t *testing.T) {
+	m := reviewModel()
+	one := 1
+	m.rows = []diff.Row{{NewNo: &one, New: "new file", Kind: diff.Add}}
+	oldRect, _ := ui.PaneRowRects(m.renderModel())
+	m = update(t, m, runeKeys("=")...)
+	kept, _ := ui.PaneRowRects(m.renderModel())
+	if !m.keepPanes || kept.Width <= oldRect.Width {
+		t.Fatalf("= left OLD %d wide, collapsed it was %d", kept.Width, oldRect.Width)
+	}
+}
+
+func TestPanes_SidebarResizesWithinItsLimits(t *testing.T) {
+	m := reviewModel()
+	m = update(t, m, runeKeys(">")...)
+	if m.sidebarWidth != 40 {
+		t.Fatalf("sidebar %d after >, want the default 38 and a step", m.sidebarWidth)
+	}
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyCtrlLeft}, tea.KeyMsg{Type: tea.KeyCtrlLeft})
+	if m.sidebarWidth != 36 {
+		t.Fatalf("sidebar %d after two ctrl+left, want 36", m.sidebarWidth)
+	}
+	oldRect, _ := ui.PaneRowRects(m.renderModel())
+	for i := 0; i < 20; i++ {
+		m = update(t, m, runeKeys("<")...)
+	}
+	if m.sidebarWidth != ui.MinSidebarWidth {
+		t.Fatalf("sidebar %d, want it held at %d", m.sidebarWidth, ui.MinSidebarWidth)
+	}
+	if narrow, _ := ui.PaneRowRects(m.renderModel()); narrow.X != oldRect.X-(36-ui.MinSidebarWidth) {
+		t.Fatalf("OLD pane at column %d, was %d with a 36-column sidebar", narrow.X, oldRect.X)
+	}
+	for i := 0; i < 80; i++ {
+		m = update(t, m, runeKeys(">")...)
+	}
+	if m.sidebarWidth != m.width-20 {
+		t.Fatalf("sidebar %d, want the panes left 20 columns", m.sidebarWidth)
+	}
+	// A terminal too narrow for the chosen width shows less of it, and
+	// resizing starts from what is on screen.
+	m = update(t, m, tea.WindowSizeMsg{Width: 110, Height: 50})
+	if got := ui.SidebarWidth(m.width, m.sidebarWidth); got != 90 {
+		t.Fatalf("sidebar drawn %d wide in 110 columns, want 90", got)
+	}
+	m = update(t, m, runeKeys("<")...)
+	if m.sidebarWidth != 88 {
+		t.Fatalf("sidebar %d after < in 110 columns, want 88", m.sidebarWidth)
+	}
+}
+
+func TestPanes_StackedOnNarrowTerminals(t *testing.T) {
+	m := reviewModel()
+	m = update(t, m, tea.WindowSizeMsg{Width: ui.StackedBelowWidth - 1, Height: 50})
+	oldRect, newRect := ui.PaneRowRects(m.renderModel())
+	if oldRect.X != newRect.X || oldRect.Width != newRect.Width || oldRect.Y >= newRect.Y {
+		t.Fatalf("stacked rects old %+v, new %+v; want OLD above NEW", oldRect, newRect)
+	}
+	if oldRect.Width < m.width-4 {
+		t.Fatalf("stacked pane %d wide in %d columns, want the full width", oldRect.Width, m.width)
+	}
+	for i, line := range strings.Split(m.View(), "\n") {
+		if w := lipgloss.Width(line); w > m.width {
+			t.Fatalf("line %d is %d wide in %d columns", i, w, m.width)
+		}
+	}
+	// The strip steps through files with left and right.
+	m.focus = ui.FocusFiles
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyRight})
+	if m.selectedFile() != "b.go" || m.focus != ui.FocusFiles {
+		t.Fatalf("right on the strip selected %s with focus %v", m.selectedFile(), m.focus)
+	}
+	stackedPage := m.diffPageSize()
+
+	m = update(t, m, runeKeys("|")...)
+	if m.layout != ui.LayoutSideBySide {
+		t.Fatalf("| from auto gave %v", m.layout)
+	}
+	oldRect, newRect = ui.PaneRowRects(m.renderModel())
+	if oldRect.Y != newRect.Y || oldRect.X >= newRect.X {
+		t.Fatalf("side-by-side rects old %+v, new %+v", oldRect, newRect)
+	}
+	if m.diffPageSize() <= stackedPage {
+		t.Fatalf("page %d side by side, %d stacked; want stacked panes to page by their own height", m.diffPageSize(), stackedPage)
+	}
+	m = update(t, m, runeKeys("||")...)
+	if m.layout != ui.LayoutAuto {
+		t.Fatalf("| cycled to %v, want auto again", m.layout)
+	}
+	// Auto lays out side by side once the terminal is wide enough.
+	m = update(t, m, tea.WindowSizeMsg{Width: ui.StackedBelowWidth, Height: 50})
+	if m.stacked() {
+		t.Fatalf("stacked at %d columns", m.width)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pickHint is the header notice while --pick waits for a choice.
+const pickHint = "enter: print this file's path and quit; q: cancel"
+
+// pickFile quits with the selected file chosen, for main to print (enter
+// under --pick). Directories in the tree still fold as usual.
+func (m model) pickFile() (tea.Model, tea.Cmd) {
+	m.picked = m.selectedFile()
+	return m, tea.Quit
+}
+
+// pickedPath is file as the shell that started tdiff can open it: relative
+// to the working directory, or absolute when that fails.
+func pickedPath(file string) string {
+	path := git.WorktreePath(file)
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// openTTY opens the controlling terminal so --pick can draw there and keep
+// stdout for the chosen path.
+func openTTY() (*os.File, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
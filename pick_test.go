@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestPick_EnterChoosesSelectedFile(t *testing.T) {
+	opts := defaultOptions()
+	opts.pick = true
+	m := initialModel(opts)
+	next, _ := m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{"a.go", "b.go"}, statuses: map[string]string{"a.go": "M", "b.go": "M"}})
+	m = next.(model)
+	m.selected = 1
+	next, cmd := m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyEnter})
+	if got := next.(model).picked; got != "b.go" || cmd == nil {
+		t.Fatalf("picked %q, quit %v", got, cmd != nil)
+	}
+}
+
+func TestPick_EscCancels(t *testing.T) {
+	m := loadedModel(2)
+	if _, cmd := m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyEsc}); cmd != nil {
+		t.Fatal("esc quit outside --pick")
+	}
+	m.pick = true
+	next, cmd := m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyEsc})
+	if cmd == nil || next.(model).picked != "" {
+		t.Fatal("esc under --pick did not quit without a file")
+	}
+}
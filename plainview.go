@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/term"
+)
+
+// plainViewCommand prints a diff to the normal screen, where the terminal's
+// own selection works on it, and waits for a key. It runs through tea.Exec,
+// which leaves the alt screen first and restores the TUI afterwards.
+type plainViewCommand struct {
+	lines  []string
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func (c *plainViewCommand) SetStdin(r io.Reader)  { c.stdin = r }
+func (c *plainViewCommand) SetStdout(w io.Writer) { c.stdout = w }
+func (c *plainViewCommand) SetStderr(io.Writer)   {}
+
+func (c *plainViewCommand) Run() error {
+	out := bufio.NewWriter(c.stdout)
+	for _, line := range c.lines {
+		fmt.Fprintln(out, diff.EscapeControl(line))
+	}
+	fmt.Fprint(out, "\n-- press any key to return to tdiff --")
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	return waitForKey(c.stdin)
+}
+
+// waitForKey reads one key from in, or one line when in is not a terminal
+// that can be put in raw mode.
+func waitForKey(in io.Reader) error {
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		if state, err := term.MakeRaw(int(f.Fd())); err == nil {
+			defer term.Restore(int(f.Fd()), state)
+			_, err := f.Read(make([]byte, 1))
+			return err
+		}
+	}
+	_, err := bufio.NewReader(in).ReadString('\n')
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// plainViewDoneMsg arrives when the TUI is back from the plain view.
+type plainViewDoneMsg struct {
+	err error
+}
+
+// showPlainView prints the selected file's diff outside the alt screen
+// (ctrl+s) so it can be selected and copied with the terminal's own
+// selection.
+func (m model) showPlainView() (tea.Model, tea.Cmd) {
+	file := m.selectedFile()
+	if file == "" || m.diffLoading() {
+		return m, nil
+	}
+	title := fmt.Sprintf("%s (%s)", file, m.mode)
+	lines := append([]string{title, ""}, diff.UnifiedLines(m.rows)...)
+	exec := tea.Exec(&plainViewCommand{lines: lines}, func(err error) tea.Msg {
+		return plainViewDoneMsg{err: err}
+	})
+	cmd := tea.Sequence(m.dismissImages(), exec)
+	return m, cmd
+}
+
+func (m model) handlePlainViewDone(msg plainViewDoneMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.flash = "plain view failed: " + msg.err.Error()
+	}
+	return m, m.drawImagesCmd()
+}
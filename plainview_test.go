@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPlainView_PrintsDiffAndWaitsForKey(t *testing.T) {
+	cmd := &plainViewCommand{lines: []string{"a.go (WORKTREE)", "", "-old\x1b[31m", "+new"}}
+	var out bytes.Buffer
+	cmd.SetStdin(strings.NewReader("\n"))
+	cmd.SetStdout(&out)
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	if strings.Contains(got, "\x1b") {
+		t.Fatalf("control characters were printed raw: %q", got)
+	}
+	for _, want := range []string{"a.go (WORKTREE)\n", "+new\n", "press any key"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("output %q is missing %q", got, want)
+		}
+	}
+}
+
+func TestPlainView_NeedsALoadedDiff(t *testing.T) {
+	m := loadedModel(2)
+	m.loadedReq = m.diffReq
+	if _, cmd := m.showPlainView(); cmd == nil {
+		t.Fatal("ctrl+s on a loaded diff did nothing")
+	}
+	m.diffReq++
+	if _, cmd := m.showPlainView(); cmd != nil {
+		t.Fatal("ctrl+s opened the plain view while the diff was loading")
+	}
+}
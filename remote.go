@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// remoteHost is a web UI whose file URLs tdiff knows how to build.
+type remoteHost struct {
+	// blob goes between the repository and the ref, anchor before the line.
+	blob, anchor string
+}
+
+var (
+	gitHub    = remoteHost{blob: "/blob/", anchor: "#L"}
+	gitLab    = remoteHost{blob: "/-/blob/", anchor: "#L"}
+	bitbucket = remoteHost{blob: "/src/", anchor: "#lines-"}
+)
+
+// hostFor picks the web UI by the remote's host name; self-hosted GitLab and
+// GitHub Enterprise usually carry the product in it.
+func hostFor(host string) (remoteHost, bool) {
+	host = strings.ToLower(host)
+	switch {
+	case strings.Contains(host, "github"):
+		return gitHub, true
+	case strings.Contains(host, "gitlab"):
+		return gitLab, true
+	case strings.Contains(host, "bitbucket"):
+		return bitbucket, true
+	}
+	return remoteHost{}, false
+}
+
+// parseRemote splits a remote URL into its host and repository path, e.g.
+// "github.com" and "owner/repo", from https, ssh:// and scp-like
+// git@host:owner/repo.git forms alike.
+func parseRemote(remote string) (host, repo string, ok bool) {
+	remote = strings.TrimSpace(remote)
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil || u.Hostname() == "" {
+			return "", "", false
+		}
+		host, repo = u.Hostname(), u.Path
+	} else {
+		// scp-like syntax: [user@]host:path.
+		at := strings.LastIndexByte(remote, '@')
+		colon := strings.IndexByte(remote, ':')
+		if colon < 0 || colon < at {
+			return "", "", false
+		}
+		host, repo = remote[at+1:colon], remote[colon+1:]
+	}
+	repo = strings.TrimSuffix(strings.Trim(repo, "/"), ".git")
+	if host == "" || repo == "" {
+		return "", "", false
+	}
+	return host, repo, true
+}
+
+// webURL is the page showing file at ref on the remote's web UI, anchored at
+// line when it is positive. For remotes it does not recognize, known is
+// false and the result is the remote and file for the clipboard instead.
+func webURL(remote, ref, file string, line int) (link string, known bool) {
+	host, repo, ok := parseRemote(remote)
+	web, known := hostFor(host)
+	if !ok || !known {
+		link = strings.TrimSpace(remote) + " " + file
+		if line > 0 {
+			link += fmt.Sprintf(":%d", line)
+		}
+		return link, false
+	}
+	link = "https://" + host + "/" + repo + web.blob + escapePath(ref) + "/" + escapePath(file)
+	if line > 0 {
+		link += fmt.Sprintf("%s%d", web.anchor, line)
+	}
+	return link, true
+}
+
+func escapePath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// remoteURLMsg reports the web URL for the cursor line: opened in the
+// browser, or to be copied.
+type remoteURLMsg struct {
+	url    string
+	opened bool
+	err    error
+}
+
+// openRemote opens the selected file at the cursor line on origin's web UI
+// (O), or copies the URL to the clipboard instead when toClipboard is set
+// (ctrl+o).
+func (m model) openRemote(toClipboard bool) (tea.Model, tea.Cmd) {
+	file := m.selectedFile()
+	if file == "" {
+		return m, nil
+	}
+	ref := ""
+	if m.repo != nil && !m.repo.Unborn {
+		ref = m.repo.Branch
+	}
+	line := 0
+	if m.cursor >= 0 && m.cursor < len(m.rows) && m.rows[m.cursor].NewNo != nil {
+		line = *m.rows[m.cursor].NewNo
+	}
+	return m, guardCmd(func() tea.Msg {
+		remote, err := git.RemoteURL("origin")
+		if err != nil {
+			return remoteURLMsg{err: err}
+		}
+		if ref == "" {
+			return remoteURLMsg{err: errors.New("no commit to link to yet")}
+		}
+		link, known := webURL(remote, ref, file, line)
+		if toClipboard || !known {
+			return remoteURLMsg{url: link}
+		}
+		if err := openURL(link); err != nil {
+			return remoteURLMsg{url: link, err: err}
+		}
+		return remoteURLMsg{url: link, opened: true}
+	}, func(err error) tea.Msg {
+		return remoteURLMsg{err: err}
+	})
+}
+
+func (m model) handleRemoteURL(msg remoteURLMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case msg.err != nil && msg.url == "":
+		m.flash = "no web URL: " + firstLine(git.FriendlyError(msg.err))
+	case msg.opened:
+		m.flash = "opened " + msg.url
+	case msg.err != nil:
+		copyToClipboard(m.screen, msg.url)
+		m.flash = "cannot open a browser; copied " + msg.url
+	default:
+		copyToClipboard(m.screen, msg.url)
+		m.flash = "copied " + msg.url
+	}
+	return m, nil
+}
+
+// openURL hands link to the platform's opener without waiting for it.
+func openURL(link string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", link)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", link)
+	default:
+		cmd = exec.Command("xdg-open", link)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() { _ = cmd.Wait() }()
+	return nil
+}
+
+// copyToClipboard sets the terminal's clipboard with OSC 52, which works
+// over ssh and needs no clipboard tool.
+func copyToClipboard(w io.Writer, text string) {
+	_, _ = io.WriteString(w, "\x1b]52;c;"+base64.StdEncoding.EncodeToString([]byte(text))+"\a")
+}
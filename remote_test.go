@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestWebURL(t *testing.T) {
+	for _, tc := range []struct {
+		remote string
+		line   int
+		want   string
+		known  bool
+	}{
+		{"https://github.com/PedroElizalde01/tdiff.git", 42, "https://github.com/PedroElizalde01/tdiff/blob/main/ui/ui.go#L42", true},
+		{"git@github.com:PedroElizalde01/tdiff.git", 42, "https://github.com/PedroElizalde01/tdiff/blob/main/ui/ui.go#L42", true},
+		{"ssh://git@github.example.com:2222/team/tdiff", 0, "https://github.example.com/team/tdiff/blob/main/ui/ui.go", true},
+		{"https://gitlab.com/group/sub/tdiff.git", 42, "https://gitlab.com/group/sub/tdiff/-/blob/main/ui/ui.go#L42", true},
+		{"git@gitlab.company.net:group/tdiff.git", 7, "https://gitlab.company.net/group/tdiff/-/blob/main/ui/ui.go#L7", true},
+		{"https://jane@bitbucket.org/team/tdiff.git", 42, "https://bitbucket.org/team/tdiff/src/main/ui/ui.go#lines-42", true},
+		{"git@bitbucket.org:team/tdiff.git", 42, "https://bitbucket.org/team/tdiff/src/main/ui/ui.go#lines-42", true},
+		{"git@git.example.org:team/tdiff.git", 42, "git@git.example.org:team/tdiff.git ui/ui.go:42", false},
+		{"/srv/git/tdiff.git", 0, "/srv/git/tdiff.git ui/ui.go", false},
+	} {
+		got, known := webURL(tc.remote, "main", "ui/ui.go", tc.line)
+		if got != tc.want || known != tc.known {
+			t.Errorf("webURL(%q) = %q, %v; want %q, %v", tc.remote, got, known, tc.want, tc.known)
+		}
+	}
+}
+
+func TestWebURL_EscapesRefAndPath(t *testing.T) {
+	got, _ := webURL("git@github.com:o/r.git", "feature/a b", "docs/read me#1.md", 3)
+	if want := "https://github.com/o/r/blob/feature/a%20b/docs/read%20me%231.md#L3"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestRemoteURL_CopyWritesOSC52(t *testing.T) {
+	m := loadedModel(1)
+	var screen bytes.Buffer
+	m.screen = &screen
+	link := "https://github.com/o/r/blob/main/a.go#L3"
+	next, _ := m.handleRemoteURL(remoteURLMsg{url: link})
+	m = next.(model)
+	if want := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(link)) + "\a"; screen.String() != want {
+		t.Fatalf("wrote %q, want %q", screen.String(), want)
+	}
+	if m.notice() != "copied "+link {
+		t.Fatalf("notice %q", m.notice())
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// resolveChoice is the side of a conflicted file the confirmation overlay
+// asks to take.
+type resolveChoice struct {
+	file   string
+	theirs bool
+}
+
+// winner names the side that wins, to start a sentence.
+func (c resolveChoice) winner() string {
+	if c.theirs {
+		return "Their side"
+	}
+	return "Our side"
+}
+
+func (c resolveChoice) side() string {
+	if c.theirs {
+		return "theirs"
+	}
+	return "ours"
+}
+
+// resolvedMsg reports how taking a side of file went.
+type resolvedMsg struct {
+	choice resolveChoice
+	err    error
+}
+
+// handleResolveSequence runs go and gt, which take our or their side of the
+// selected conflicted file. It reports false for other sequences.
+func (m model) handleResolveSequence(seq string) (tea.Model, tea.Cmd, bool) {
+	switch seq {
+	case "go":
+		next, cmd := m.confirmResolve(false)
+		return next, cmd, true
+	case "gt":
+		next, cmd := m.confirmResolve(true)
+		return next, cmd, true
+	}
+	return m, nil, false
+}
+
+// sidebarSequence reports whether seq acts on the selected file when typed
+// in the sidebar, where g only starts go and gt.
+func sidebarSequence(seq string) bool {
+	return seq[0] != 'g' || seq == "go" || seq == "gt"
+}
+
+// confirmResolve asks before the selected conflicted file is replaced with
+// one side of the merge, saying how many conflicts that throws away.
+func (m model) confirmResolve(theirs bool) (tea.Model, tea.Cmd) {
+	file := m.selectedFile()
+	if file == "" {
+		return m, nil
+	}
+	if !m.unmerged[file] {
+		m.flash = file + " is not conflicted"
+		return m, nil
+	}
+	choice := resolveChoice{file: file, theirs: theirs}
+	discards := "its conflicts"
+	if content, err := os.ReadFile(git.WorktreePath(file)); err == nil {
+		discards = conflictRegionsText(diff.CountConflictRegions(string(content)))
+	}
+	m.resolving = &choice
+	m.overlay = &ui.Overlay{
+		Title: "take " + choice.side() + ": " + file,
+		Lines: []string{
+			fmt.Sprintf("%s wins for all of %s, discarding %s,", choice.winner(), file, discards),
+			"and the result is staged.",
+			"",
+			"y/enter: resolve  n/esc: cancel",
+		},
+	}
+	cmd := m.dismissImages()
+	return m, cmd
+}
+
+func conflictRegionsText(n int) string {
+	if n == 1 {
+		return "1 conflicted region"
+	}
+	return fmt.Sprintf("%d conflicted regions", n)
+}
+
+// handleResolveKey takes the side the overlay asks about, or cancels.
+func (m model) handleResolveKey(key string) (tea.Model, tea.Cmd) {
+	choice := *m.resolving
+	switch key {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "y", "enter":
+		m.overlay, m.resolving = nil, nil
+		return m, guardCmd(func() tea.Msg {
+			return resolvedMsg{choice: choice, err: git.TakeSide(choice.file, choice.theirs)}
+		}, func(err error) tea.Msg {
+			return resolvedMsg{choice: choice, err: err}
+		})
+	case "n", "esc", "q":
+		m.overlay, m.resolving = nil, nil
+		return m, m.drawImagesCmd()
+	}
+	return m, nil
+}
+
+func (m model) handleResolved(msg resolvedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.flash = "cannot take " + msg.choice.side() + ": " + firstLine(git.FriendlyError(msg.err))
+		return m, m.drawImagesCmd()
+	}
+	delete(m.unmerged, msg.choice.file)
+	m.flash = fmt.Sprintf("took %s for %s and staged it", msg.choice.side(), msg.choice.file)
+	m.filesReq++
+	return m, tea.Batch(m.loadFiles(), m.drawImagesCmd())
+}
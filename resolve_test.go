@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/ui"
+)
+
+func TestResolve_ConfirmsBeforeTakingASide(t *testing.T) {
+	m := reviewModel()
+	m = update(t, m, runeKeys("go")...)
+	if m.overlay != nil || !strings.Contains(m.flash, "not conflicted") {
+		t.Fatalf("go on a clean file: overlay %v, flash %q", m.overlay, m.flash)
+	}
+
+	m.unmerged = map[string]bool{m.selectedFile(): true}
+	file := m.selectedFile()
+	m = update(t, m, runeKeys("gt")...)
+	if m.resolving == nil || !m.resolving.theirs || m.resolving.file != file {
+		t.Fatalf("resolving %+v, want theirs for %s", m.resolving, file)
+	}
+	if lines := strings.Join(m.overlay.Lines, "\n"); !strings.Contains(lines, "Their side wins for all of "+file) {
+		t.Fatalf("overlay says %q", lines)
+	}
+	m = update(t, m, runeKeys("n")...)
+	if m.overlay != nil || m.resolving != nil {
+		t.Fatal("n did not cancel")
+	}
+
+	req := m.filesReq
+	m = update(t, m, resolvedMsg{choice: resolveChoice{file: file}, err: errors.New("boom")})
+	if m.filesReq != req || !strings.HasPrefix(m.flash, "cannot take ours") {
+		t.Fatalf("failure reloaded files or flashed %q", m.flash)
+	}
+	m = update(t, m, resolvedMsg{choice: resolveChoice{file: file}})
+	if m.filesReq != req+1 || m.unmerged[file] {
+		t.Fatalf("success did not reload the files: req %d, unmerged %v", m.filesReq, m.unmerged)
+	}
+}
+
+func TestResolve_SidebarTakesOnlyFileSequences(t *testing.T) {
+	m := reviewModel()
+	m.focus = ui.FocusFiles
+	m.rows = []diff.Row{{Old: "a", New: "a", Kind: diff.Context}, {Old: "b", New: "b", Kind: diff.Context}}
+	m.cursor = 1
+	m = update(t, m, runeKeys("gg")...)
+	if m.cursor != 1 || m.pendingKey != "" {
+		t.Fatalf("gg in the sidebar: cursor %d, pending %q", m.cursor, m.pendingKey)
+	}
+	m = update(t, m, runeKeys("gt")...)
+	if !strings.Contains(m.flash, "not conflicted") {
+		t.Fatalf("gt in the sidebar flashed %q", m.flash)
+	}
+}
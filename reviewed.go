@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// reviewedFile is a file ticked off in one mode, with the DiffBlobs name of
+// the diff that was reviewed. Once the diff changes the mark no longer
+// counts.
+type reviewedFile struct {
+	File   string `json:"file"`
+	Staged bool   `json:"staged,omitempty"`
+	Blobs  string `json:"blobs"`
+}
+
+type reviewKey struct {
+	mode git.Mode
+	file string
+}
+
+func (r reviewedFile) key() reviewKey {
+	mode := git.Worktree
+	if r.Staged {
+		mode = git.Staged
+	}
+	return reviewKey{mode, r.File}
+}
+
+// isReviewed reports whether the diff file's panes show was marked
+// reviewed: its staged side once + switched it over.
+func (m *model) isReviewed(file string) bool {
+	mode := m.diffMode(file)
+	blobs, ok := m.reviewed[reviewKey{mode, file}]
+	return ok && blobs == m.blobsIn(mode)[file]
+}
+
+// blobsIn are the DiffBlobs names of the listed files' diffs in mode, which
+// is the view's mode or, for files showing their staged side, Staged.
+func (m *model) blobsIn(mode git.Mode) map[string]string {
+	if mode != m.mode {
+		return m.stagedBlobs
+	}
+	return m.fileBlobs
+}
+
+// reviewedFiles are the listed files marked reviewed, for the sidebar.
+func (m *model) reviewedFiles() map[string]bool {
+	if len(m.reviewed) == 0 || !m.hasRealFiles() {
+		return nil
+	}
+	var files map[string]bool
+	for _, file := range m.files {
+		if m.isReviewed(file) {
+			if files == nil {
+				files = map[string]bool{}
+			}
+			files[file] = true
+		}
+	}
+	return files
+}
+
+// reviewProgress is the sidebar title's "reviewed 7/23", or "" before
+// anything is reviewed.
+func (m *model) reviewProgress() string {
+	if len(m.reviewed) == 0 || m.noChanges {
+		return ""
+	}
+	done := 0
+	for _, file := range m.allFiles {
+		if m.isReviewed(file) {
+			done++
+		}
+	}
+	if done == 0 {
+		return ""
+	}
+	return fmt.Sprintf("reviewed %d/%d", done, len(m.allFiles))
+}
+
+// toggleReviewed ticks the selected file off or back on (space in the
+// sidebar). Reviewed files sort to the bottom, so ticking one off selects
+// the file that moves up into its place.
+func (m model) toggleReviewed() (tea.Model, tea.Cmd) {
+	file := m.selectedFile()
+	if file == "" || !m.hasRealFiles() {
+		return m, nil
+	}
+	key := reviewKey{m.diffMode(file), file}
+	reviewed := !m.isReviewed(file)
+	if m.reviewed == nil {
+		m.reviewed = map[reviewKey]string{}
+	}
+	if reviewed {
+		m.reviewed[key] = m.reviewBlobs(file)
+	} else {
+		delete(m.reviewed, key)
+	}
+	m.saveCursor()
+	selected := m.selected
+	m.applyFileFilters()
+	if reviewed {
+		m.selected = clamp(selected, 0, m.sidebarLen()-1)
+	} else {
+		m.selectPath(file)
+	}
+	m.ensureSidebarVisible()
+	save := m.saveSession()
+	if m.selectedFile() == file {
+		return m, save
+	}
+	return m, tea.Batch(m.showSelection(), save)
+}
+
+// reviewBlobs is the DiffBlobs name of the diff file's panes show.
+// Listings only carry the names once something is reviewed, so the first
+// mark asks git for its own.
+func (m *model) reviewBlobs(file string) string {
+	mode := m.diffMode(file)
+	if blobs, ok := m.blobsIn(mode)[file]; ok {
+		return blobs
+	}
+	names, err := git.DiffBlobs(mode, []string{file})
+	if err != nil {
+		return ""
+	}
+	known := &m.fileBlobs
+	if mode != m.mode {
+		known = &m.stagedBlobs
+	}
+	if *known == nil {
+		*known = map[string]string{}
+	}
+	(*known)[file] = names[file]
+	return names[file]
+}
+
+// forgetStaleReviews drops the marks in the current mode of files whose
+// diff changed or that have no changes left. It reports whether any went.
+func (m *model) forgetStaleReviews() bool {
+	if len(m.reviewed) == 0 || !m.blobsListed {
+		return false
+	}
+	forgot := false
+	for key, blobs := range m.reviewed {
+		if key.mode != m.mode {
+			continue
+		}
+		if current, ok := m.fileBlobs[key.file]; !ok || current != blobs {
+			delete(m.reviewed, key)
+			forgot = true
+		}
+	}
+	return forgot
+}
+
+// sortedReviewed is every reviewed mark, for the state file.
+func (m *model) sortedReviewed() []reviewedFile {
+	files := make([]reviewedFile, 0, len(m.reviewed))
+	for key, blobs := range m.reviewed {
+		files = append(files, reviewedFile{File: key.file, Staged: key.mode == git.Staged, Blobs: blobs})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].File != files[j].File {
+			return files[i].File < files[j].File
+		}
+		return !files[i].Staged && files[j].Staged
+	})
+	return files
+}
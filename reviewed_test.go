@@ -0,0 +1,112 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// reviewModel lists a.go, b.go and c.go with one blob name each.
+func reviewModel() model {
+	m := initialModel(defaultOptions())
+	m.width, m.height = 160, 50
+	files := []string{"a.go", "b.go", "c.go"}
+	blobs := map[string]string{"a.go": "1..2", "b.go": "3..4", "c.go": "5..6"}
+	next, _ := m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: files, statuses: map[string]string{}, blobs: blobs})
+	return next.(model)
+}
+
+func TestReviewed_SpaceTicksFileOff(t *testing.T) {
+	m := reviewModel()
+	m.selected = 0
+	space := tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")}
+	m = typeKeys(t, m, space)
+	if got := strings.Join(m.files, " "); got != "b.go c.go a.go" {
+		t.Fatalf("files %q, want the reviewed one last", got)
+	}
+	if m.selectedFile() != "b.go" {
+		t.Fatalf("selected %s, want the file that moved up", m.selectedFile())
+	}
+	if got := m.sidebarTitle(); !strings.HasSuffix(got, " · reviewed 1/3") {
+		t.Fatalf("title %q", got)
+	}
+	if got := m.reviewedFiles(); len(got) != 1 || !got["a.go"] {
+		t.Fatalf("reviewed rows %v", got)
+	}
+
+	m.selected = 2
+	m = typeKeys(t, m, space)
+	if got := strings.Join(m.files, " "); got != "a.go b.go c.go" || m.selectedFile() != "a.go" {
+		t.Fatalf("unticking gave %q with %s selected", got, m.selectedFile())
+	}
+	if got := m.sidebarTitle(); strings.Contains(got, "reviewed") {
+		t.Fatalf("title %q still counts reviews", got)
+	}
+}
+
+func TestReviewed_ChangedDiffLosesMark(t *testing.T) {
+	m := reviewModel()
+	m.reviewed = map[reviewKey]string{
+		{git.Worktree, "a.go"}: "1..2",
+		{git.Worktree, "b.go"}: "3..4",
+		{git.Staged, "c.go"}:   "old..mark",
+	}
+	m.filesReq++
+	next, _ := m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{"a.go", "b.go"}, statuses: map[string]string{},
+		blobs: map[string]string{"a.go": "1..2", "b.go": "3..9"}})
+	m = next.(model)
+	if !m.isReviewed("a.go") || m.isReviewed("b.go") {
+		t.Fatal("marks do not follow the diffs")
+	}
+	if _, ok := m.reviewed[reviewKey{git.Staged, "c.go"}]; !ok || len(m.reviewed) != 2 {
+		t.Fatalf("reviewed %v, want b.go dropped and the staged mark kept", m.reviewed)
+	}
+}
+
+func TestReviewed_BlobsListedOnlyWhileMarked(t *testing.T) {
+	m := reviewModel()
+	if m.newFilesJob().blobs {
+		t.Fatal("listing asks for blob names with nothing reviewed")
+	}
+	m.reviewed = map[reviewKey]string{{git.Worktree, "a.go"}: "1..2"}
+	if !m.newFilesJob().blobs {
+		t.Fatal("listing leaves out the blob names the marks need")
+	}
+
+	// A listing without the names keeps the marks rather than forgetting
+	// them all.
+	m.filesReq++
+	next, _ := m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{"a.go", "b.go"}, statuses: map[string]string{}})
+	m = next.(model)
+	if len(m.reviewed) != 1 {
+		t.Fatalf("reviewed %v after a listing without blob names", m.reviewed)
+	}
+}
+
+func TestSession_ReviewedPersist(t *testing.T) {
+	store := &stateStore{path: filepath.Join(t.TempDir(), "state.json")}
+	open := func() model {
+		m := reviewModel()
+		m.state = store
+		m.repo = &git.RepoInfo{Root: "/src/tdiff", Branch: "main"}
+		next, _ := m.handleSessionLoaded(m.openSession()().(sessionLoadedMsg))
+		return next.(model)
+	}
+	m := open()
+	m.selected = 0
+	next, cmd := m.toggleReviewed()
+	m = next.(model)
+	if cmd == nil {
+		t.Fatal("toggling did not save")
+	}
+	if msg := m.saveSession()(); msg != nil {
+		t.Fatalf("save: %v", msg.(stateSavedMsg).err)
+	}
+	m = open()
+	if !m.isReviewed("a.go") || m.files[2] != "a.go" {
+		t.Fatalf("reviewed file not restored last: %v", m.files)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// toggleScrollLock lets the focused pane scroll on its own, leaving the
+// other where it is, or lines both panes up again at the focused pane's
+// place (ctrl+l).
+func (m model) toggleScrollLock() (tea.Model, tea.Cmd) {
+	if m.apart != nil {
+		m.apart = nil
+		m.ensureCursorVisible()
+		m.flash = "scroll lock on: both panes show the same rows"
+		return m, nil
+	}
+	if m.focus != ui.FocusOld && m.focus != ui.FocusNew {
+		m.flash = "focus OLD or NEW to scroll it on its own"
+		return m, nil
+	}
+	other := ui.FocusOld
+	if m.focus == ui.FocusOld {
+		other = ui.FocusNew
+	}
+	m.apart = &ui.PaneApart{Pane: other, Scroll: m.diffScroll, Cursor: m.cursor}
+	m.flash = "scroll lock off: only the focused pane moves; ctrl+l lines them up"
+	return m, nil
+}
+
+// setFocus focuses f. With the scroll lock off, the cursor and scroll are
+// the focused pane's, so moving to the other pane swaps them with the ones
+// it was left at.
+func (m *model) setFocus(f ui.Focus) {
+	m.focus = f
+	a := m.apart
+	if a == nil || a.Pane != f {
+		return
+	}
+	left := ui.PaneApart{Scroll: m.diffScroll, Cursor: m.cursor}
+	left.Pane = ui.FocusOld
+	if f == ui.FocusOld {
+		left.Pane = ui.FocusNew
+	}
+	m.cursor = clamp(a.Cursor, 0, len(m.rows)-1)
+	m.diffScroll = a.Scroll
+	m.apart = &left
+	m.ensureCursorVisible()
+}
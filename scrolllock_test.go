@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestScrollLock_PanesMoveApartAndLineUpAgain(t *testing.T) {
+	m := reviewModel()
+	m.rows = nil
+	for i := 1; i <= 200; i++ {
+		no := i
+		line := fmt.Sprintf("line %d", i)
+		m.rows = append(m.rows, diff.Row{OldNo: &no, NewNo: &no, Old: line, New: line, Kind: diff.Context})
+	}
+	m.focus = ui.FocusNew
+	ctrlL := tea.KeyMsg{Type: tea.KeyCtrlL}
+	m = typeKeys(t, m, ctrlL)
+	if m.apart == nil || m.apart.Pane != ui.FocusOld {
+		t.Fatalf("ctrl+l left apart %+v", m.apart)
+	}
+	m = update(t, m, runeKeys("120j")...)
+	if m.cursor != 120 || m.apart.Cursor != 0 || m.apart.Scroll != 0 || m.diffScroll == 0 {
+		t.Fatalf("NEW at %d (scroll %d), OLD left at %+v", m.cursor, m.diffScroll, m.apart)
+	}
+
+	newScroll := m.diffScroll
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyLeft})
+	if m.focus != ui.FocusOld || m.cursor != 0 || m.diffScroll != 0 {
+		t.Fatalf("OLD took cursor %d, scroll %d", m.cursor, m.diffScroll)
+	}
+	if a := m.apart; a.Pane != ui.FocusNew || a.Cursor != 120 || a.Scroll != newScroll {
+		t.Fatalf("NEW left at %+v", a)
+	}
+	m = update(t, m, runeKeys("3j")...)
+
+	m = typeKeys(t, m, ctrlL)
+	if m.apart != nil || m.cursor != 3 {
+		t.Fatalf("relocking kept apart %+v, cursor %d; want OLD's place", m.apart, m.cursor)
+	}
+}
+
+func TestScrollLock_FocusLeavesEarlierModelsAlone(t *testing.T) {
+	m := reviewModel()
+	m.focus = ui.FocusNew
+	m.cursor = 2
+	m.apart = &ui.PaneApart{Pane: ui.FocusOld}
+	before := m
+	m.setFocus(ui.FocusOld)
+	if a := before.apart; a.Pane != ui.FocusOld || a.Cursor != 0 {
+		t.Fatalf("switching panes rewrote the earlier model's apart: %+v", a)
+	}
+	if a := m.apart; a.Pane != ui.FocusNew || a.Cursor != 2 {
+		t.Fatalf("NEW left at %+v", a)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/PedroElizalde01/tdiff/git"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// diffMode is the mode file's diff is shown in: the staged side of a
+// worktree file once + switched it over, the view's mode otherwise. The
+// continuous view shows every file the one way.
+func (m *model) diffMode(file string) git.Mode {
+	if m.mode == git.Worktree && m.continuous == nil && m.stagedView[file] {
+		return git.Staged
+	}
+	return m.mode
+}
+
+// setStagedParts keeps a file list's staged sides, forgetting the staged
+// view of files with nothing staged any more.
+func (m *model) setStagedParts(staged map[string]string) {
+	m.stagedParts = staged
+	for file := range m.stagedView {
+		if staged[file] == "" {
+			delete(m.stagedView, file)
+		}
+	}
+}
+
+// toggleFileStaged switches the selected worktree file's panes between its
+// unstaged changes and the ones already staged (+), leaving the mode and
+// the other files as they are.
+func (m model) toggleFileStaged() (tea.Model, tea.Cmd) {
+	file := m.selectedFile()
+	switch {
+	case m.merge != nil || file == "" || m.noChanges:
+		return m, nil
+	case m.mode != git.Worktree:
+		m.flash = "+ is for worktree files: staged mode already shows what is staged"
+		return m, nil
+	case m.continuous != nil:
+		m.flash = "+ shows one file's staged changes: V leaves the continuous view"
+		return m, nil
+	case m.stagedParts[file] == "" && !m.stagedView[file]:
+		m.flash = "nothing of " + file + " is staged"
+		return m, nil
+	}
+	m.saveCursor()
+	if m.stagedView == nil {
+		m.stagedView = map[string]bool{}
+	}
+	if m.stagedView[file] {
+		delete(m.stagedView, file)
+		m.flash = file + ": unstaged changes"
+	} else {
+		m.stagedView[file] = true
+		m.flash = file + ": staged changes (git diff --cached), + for the unstaged ones"
+	}
+	if len(m.reviewed) > 0 {
+		// Each side has its own reviewed mark, which moves the file in the
+		// list when only one of them is set.
+		m.applyFileFilters()
+		m.selectPath(file)
+		m.ensureSidebarVisible()
+	}
+	cmd := m.loadDiff(file)
+	return m, cmd
+}
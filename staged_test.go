@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestFileStaged_PlusShowsTheStagedSideOfOneFile(t *testing.T) {
+	m := initialModel(defaultOptions())
+	m.width, m.height = 160, 50
+	m = update(t, m, filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{"a.go", "b.go"}, statuses: map[string]string{"a.go": "M", "b.go": "M"}, staged: map[string]string{"a.go": "A"}})
+	if got := m.renderModel().PartlyStaged["a.go"]; got != "A" {
+		t.Fatalf("a.go staged side %q", got)
+	}
+
+	m = update(t, m, runeKeys("+")[0])
+	if m.diffMode("a.go") != git.Staged || m.diffMode("b.go") != git.Worktree || m.mode != git.Worktree {
+		t.Fatalf("modes: a.go %v, b.go %v, view %v", m.diffMode("a.go"), m.diffMode("b.go"), m.mode)
+	}
+	if m.diffJob.mode != git.Staged || m.diffJob.status != "A" {
+		t.Fatalf("diff job %+v, want a.go's staged side", m.diffJob)
+	}
+	if !strings.Contains(m.modeLabel(), "STAGED") {
+		t.Fatalf("mode label %q does not say the file shows staged changes", m.modeLabel())
+	}
+	m = update(t, m, diffLoadedMsg{req: m.diffReq, mode: git.Worktree, algo: m.diffAlgo, file: "a.go", rows: noDiffRows()})
+	if m.loadedReq == m.diffReq {
+		t.Fatal("the unstaged diff was taken for the staged side")
+	}
+
+	m = update(t, m, runeKeys("j")[0], runeKeys("+")[0])
+	if m.diffMode("b.go") != git.Worktree || !strings.HasPrefix(m.flash, "nothing of b.go") {
+		t.Fatalf("b.go: mode %v, flash %q", m.diffMode("b.go"), m.flash)
+	}
+
+	m = update(t, m, filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{"a.go", "b.go"}, statuses: map[string]string{"a.go": "M", "b.go": "M"}})
+	if m.diffMode("a.go") != git.Worktree {
+		t.Fatal("a.go kept its staged view with nothing staged")
+	}
+}
+
+func TestFileStaged_OnlyInTheWorktree(t *testing.T) {
+	m := reviewModel()
+	m.mode = git.Staged
+	m = update(t, m, runeKeys("+")[0])
+	if m.diffMode("a.go") != git.Staged || !strings.HasPrefix(m.flash, "+ is for worktree files") {
+		t.Fatalf("staged mode: flash %q", m.flash)
+	}
+}
+
+func TestFileStaged_ReviewedMarkFollowsTheShownSide(t *testing.T) {
+	m := initialModel(defaultOptions())
+	m.width, m.height = 160, 50
+	m.reviewed = map[reviewKey]string{{git.Worktree, "b.go"}: "3..4"}
+	m = update(t, m, filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{"a.go", "b.go"}, statuses: map[string]string{"a.go": "M", "b.go": "M"},
+		staged: map[string]string{"a.go": "M"}, blobs: map[string]string{"a.go": "1..2", "b.go": "3..4"}, stagedBlobs: map[string]string{"a.go": "1..5"}})
+	m.selectPath("a.go")
+	space := tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")}
+	m = update(t, m, runeKeys("+")[0], space)
+	if got := m.reviewed[reviewKey{git.Staged, "a.go"}]; got != "1..5" || !m.isReviewed("a.go") {
+		t.Fatalf("reviewed %v, want a.go's staged diff marked", m.reviewed)
+	}
+	if _, ok := m.reviewed[reviewKey{git.Worktree, "a.go"}]; ok {
+		t.Fatal("the unstaged side was marked too")
+	}
+
+	m.selectPath("a.go")
+	m = update(t, m, runeKeys("+")[0])
+	if m.isReviewed("a.go") {
+		t.Fatal("a.go's unstaged diff reads as reviewed")
+	}
+	if got := strings.Join(m.files, " "); got != "a.go b.go" || m.selectedFile() != "a.go" {
+		t.Fatalf("files %q with %s selected, want a.go back in front", got, m.selectedFile())
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// stashDoneMsg reports how a stash action went: done says what it did, e.g.
+// "stashed a.go" or "dropped stash@{0}".
+type stashDoneMsg struct {
+	done string
+	err  error
+}
+
+// stashesLoadedMsg carries git stash list for the stash list overlay.
+type stashesLoadedMsg struct {
+	stashes []git.Stash
+	err     error
+}
+
+// stashShownMsg carries what a stash entry changes, for the overlay to show
+// in place of the list.
+type stashShownMsg struct {
+	action stashAction
+	text   string
+	err    error
+}
+
+// stashAction is a pop, apply or drop the overlay asks to confirm, or the
+// entry it shows.
+type stashAction struct {
+	verb  string
+	stash git.Stash
+	// selected is the list row to go back to on cancel.
+	selected int
+}
+
+func stashCmd(done string, run func() error) tea.Cmd {
+	return guardCmd(func() tea.Msg {
+		return stashDoneMsg{done: done, err: run()}
+	}, func(err error) tea.Msg {
+		return stashDoneMsg{done: done, err: err}
+	})
+}
+
+// stashFile sets the selected file's changes aside (S).
+func (m model) stashFile() (tea.Model, tea.Cmd) {
+	file := m.selectedFile()
+	if file == "" || m.noChanges {
+		return m, nil
+	}
+	untracked := m.fileStatuses[file] == "?"
+	return m, stashCmd("stashed "+file, func() error {
+		return git.StashFile(file, untracked)
+	})
+}
+
+// stashHunk sets the hunk under the cursor aside as a stash entry of its
+// own, leaving the rest of the file as it is (gS).
+func (m *model) stashHunk() tea.Cmd {
+	file := m.rowFile(m.cursor)
+	if m.diffMode(file) != git.Worktree {
+		m.flash = "hunks are stashed from the worktree: s switches to it"
+		if m.mode == git.Worktree {
+			m.flash = "hunks are stashed from the worktree: + goes back to the file's unstaged changes"
+		}
+		return nil
+	}
+	rows, offset, ok := m.fileRows(file)
+	idx := diff.HunkAt(m.hunks, m.cursor)
+	if !ok || idx < 0 {
+		m.flash = "no hunk under the cursor to stash"
+		return nil
+	}
+	hunk := m.hunks[idx]
+	hunk.RowStart -= offset
+	hunk.RowEnd -= offset
+	patch, err := diff.BuildPatch(file, []diff.Hunk{hunk}, rows, hunk.Range())
+	if err != nil {
+		m.flash = "nothing to stash: " + err.Error()
+		return nil
+	}
+	message := fmt.Sprintf("%s @@ -%d,%d +%d,%d @@", file, hunk.OldStart, hunk.OldLines, hunk.NewStart, hunk.NewLines)
+	return stashCmd("stashed a hunk of "+file, func() error {
+		return git.StashPatch(patch, message)
+	})
+}
+
+// handleStashSequence runs gS in the diff panes. It reports false for other
+// sequences.
+func (m model) handleStashSequence(seq string) (tea.Model, tea.Cmd, bool) {
+	if seq != "gS" || (m.focus != ui.FocusOld && m.focus != ui.FocusNew) {
+		return m, nil, false
+	}
+	cmd := m.stashHunk()
+	return m, cmd, true
+}
+
+func (m model) handleStashDone(msg stashDoneMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		// Reloading the files would clear the error from the header.
+		m.setError(msg.err)
+		return m, nil
+	}
+	m.flash = msg.done
+	m.filesReq++
+	cmds := []tea.Cmd{m.loadFiles()}
+	if m.stashList != nil {
+		cmds = append(cmds, listStashesCmd())
+	}
+	return m, tea.Batch(cmds...)
+}
+
+func listStashesCmd() tea.Cmd {
+	return guardCmd(func() tea.Msg {
+		stashes, err := git.ListStashes()
+		return stashesLoadedMsg{stashes: stashes, err: err}
+	}, func(err error) tea.Msg {
+		return stashesLoadedMsg{err: err}
+	})
+}
+
+// showStashes opens the stash list to pop, apply or drop entries from (Z).
+func (m model) showStashes() (tea.Model, tea.Cmd) {
+	return m, listStashesCmd()
+}
+
+func (m model) handleStashesLoaded(msg stashesLoadedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.setError(msg.err)
+		return m, nil
+	}
+	if len(msg.stashes) == 0 {
+		if m.stashList != nil {
+			m.overlay, m.stashList, m.stashConfirm = nil, nil, nil
+			return m, m.drawImagesCmd()
+		}
+		m.flash = "no stashes: S stashes the selected file and gS the cursor's hunk"
+		return m, nil
+	}
+	selected := 0
+	if m.stashList != nil && m.overlay != nil {
+		selected = m.overlay.Selected
+	}
+	m.stashList, m.stashConfirm, m.stashShown = msg.stashes, nil, nil
+	m.overlay = stashesOverlay(m.stashList, selected)
+	cmd := m.dismissImages()
+	return m, cmd
+}
+
+func stashesOverlay(stashes []git.Stash, selected int) *ui.Overlay {
+	lines := make([]string, len(stashes))
+	for i, s := range stashes {
+		lines[i] = s.Ref + "  " + s.Subject
+	}
+	title := fmt.Sprintf("STASHES (%d)  enter: show  p: pop  a: apply  d: drop", len(stashes))
+	return &ui.Overlay{Title: title, Lines: lines, Selectable: true, Selected: clamp(selected, 0, len(stashes)-1)}
+}
+
+// handleStashesKey moves through the stash list and asks to confirm a pop,
+// apply or drop of the selected entry.
+func (m model) handleStashesKey(key string) (tea.Model, tea.Cmd) {
+	selected := m.overlay.Selected
+	verb := ""
+	switch key {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc", "q", "Z":
+		m.overlay, m.stashList = nil, nil
+		return m, m.drawImagesCmd()
+	case "p":
+		verb = "pop"
+	case "a":
+		verb = "apply"
+	case "d":
+		verb = "drop"
+	case "enter":
+		return m, showStashCmd(stashAction{verb: "show", stash: m.stashList[selected], selected: selected})
+	default:
+		m.selectListItem(listSelection(key, selected, len(m.stashList), ui.OverlayVisibleLines(m.bodyHeight())))
+		return m, nil
+	}
+	action := stashAction{verb: verb, stash: m.stashList[selected], selected: selected}
+	m.stashConfirm = &action
+	m.overlay = &ui.Overlay{
+		Title: verb + " " + action.stash.Ref,
+		Lines: []string{action.stash.Subject, "", stashConsequence(verb), "", "y/enter: " + verb + "  n/esc: back"},
+	}
+	return m, nil
+}
+
+// stashDone is what each stash action did, for the header.
+var stashDone = map[string]string{"pop": "popped", "apply": "applied", "drop": "dropped"}
+
+func stashConsequence(verb string) string {
+	switch verb {
+	case "pop":
+		return "Its changes go back into the worktree and the entry is dropped."
+	case "apply":
+		return "Its changes go back into the worktree and the entry is kept."
+	}
+	return "The entry and its changes are thrown away."
+}
+
+// handleStashConfirmKey runs the action the overlay asks about, or goes
+// back to the list.
+func (m model) handleStashConfirmKey(key string) (tea.Model, tea.Cmd) {
+	action := *m.stashConfirm
+	switch key {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "y", "enter":
+		m.stashConfirm = nil
+		m.overlay = stashesOverlay(m.stashList, action.selected)
+		return m, stashCmd(stashDone[action.verb]+" "+action.stash.Ref, func() error {
+			return git.StashAction(action.verb, action.stash.Ref)
+		})
+	case "n", "esc", "q":
+		m.stashConfirm = nil
+		m.overlay = stashesOverlay(m.stashList, action.selected)
+	}
+	return m, nil
+}
+
+func showStashCmd(action stashAction) tea.Cmd {
+	return guardCmd(func() tea.Msg {
+		text, err := git.StashContents(action.stash.Ref)
+		return stashShownMsg{action: action, text: text, err: err}
+	}, func(err error) tea.Msg {
+		return stashShownMsg{action: action, err: err}
+	})
+}
+
+// handleStashShown shows the entry's changes in place of the list, unless
+// the list closed while they loaded.
+func (m model) handleStashShown(msg stashShownMsg) (tea.Model, tea.Cmd) {
+	if m.stashList == nil || m.stashConfirm != nil {
+		return m, nil
+	}
+	if msg.err != nil {
+		m.setError(msg.err)
+		return m, nil
+	}
+	action := msg.action
+	m.stashShown = &action
+	m.overlay = &ui.Overlay{
+		Title: action.stash.Ref + "  " + action.stash.Subject + "  esc: back  p: pop  a: apply  d: drop",
+		Lines: strings.Split(strings.TrimRight(msg.text, "\n"), "\n"),
+	}
+	return m, nil
+}
+
+// handleStashShownKey scrolls through the entry's changes, goes back to the
+// list, or asks to pop, apply or drop the entry shown.
+func (m model) handleStashShownKey(key string) (tea.Model, tea.Cmd) {
+	action := *m.stashShown
+	switch key {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc", "q", "enter":
+		m.stashShown = nil
+		m.overlay = stashesOverlay(m.stashList, action.selected)
+	case "p", "a", "d":
+		m.stashShown = nil
+		m.overlay = stashesOverlay(m.stashList, action.selected)
+		return m.handleStashesKey(key)
+	default:
+		m.scrollOverlay(key)
+	}
+	return m, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestStash_ListConfirmsBeforeActing(t *testing.T) {
+	m := reviewModel()
+	m = update(t, m, stashesLoadedMsg{})
+	if m.overlay != nil || !strings.HasPrefix(m.flash, "no stashes") {
+		t.Fatalf("empty list: overlay %v, flash %q", m.overlay, m.flash)
+	}
+
+	stashes := []git.Stash{{Ref: "stash@{0}", Subject: "WIP on main: 1234567 one"}, {Ref: "stash@{1}", Subject: "On main: a.go"}}
+	m = update(t, m, stashesLoadedMsg{stashes: stashes})
+	if m.overlay == nil || len(m.overlay.Lines) != 2 || !m.overlay.Selectable {
+		t.Fatalf("overlay %+v", m.overlay)
+	}
+	m = update(t, m, runeKeys("jd")...)
+	if m.stashConfirm == nil || m.stashConfirm.verb != "drop" || m.stashConfirm.stash.Ref != "stash@{1}" {
+		t.Fatalf("confirm %+v", m.stashConfirm)
+	}
+	m = update(t, m, runeKeys("n")...)
+	if m.stashConfirm != nil || m.overlay == nil || m.overlay.Selected != 1 {
+		t.Fatalf("n did not go back to the list: %+v", m.overlay)
+	}
+
+	m = update(t, m, runeKeys("p")...)
+	next, cmd := m.Update(runeKeys("y")[0])
+	m = next.(model)
+	if cmd == nil || m.stashConfirm != nil || m.stashList == nil {
+		t.Fatal("y did not pop with the list kept open")
+	}
+
+	req := m.filesReq
+	m = update(t, m, stashDoneMsg{done: "popped stash@{1}", err: errors.New("error: conflict")})
+	if m.errMsg != "error: conflict" || m.filesReq != req {
+		t.Fatalf("failure: error %q, files req %d", m.errMsg, m.filesReq)
+	}
+	m = update(t, m, stashDoneMsg{done: "popped stash@{1}"})
+	if m.flash != "popped stash@{1}" || m.filesReq != req+1 {
+		t.Fatalf("success: flash %q, files req %d", m.flash, m.filesReq)
+	}
+
+	// The reloaded list drops the popped entry; an empty one closes.
+	m = update(t, m, stashesLoadedMsg{stashes: stashes[:1]})
+	if len(m.overlay.Lines) != 1 || m.overlay.Selected != 0 {
+		t.Fatalf("reloaded overlay %+v", m.overlay)
+	}
+	m = update(t, m, stashesLoadedMsg{})
+	if m.overlay != nil || m.stashList != nil {
+		t.Fatal("an empty list stayed open")
+	}
+}
+
+func TestStash_HunkNeedsTheWorktree(t *testing.T) {
+	m := foldModel(t)
+	m.cursor = 5
+	next, cmd := m.Update(runeKeys("g")[0])
+	m = next.(model)
+	next, cmd = m.Update(runeKeys("S")[0])
+	m = next.(model)
+	if cmd == nil {
+		t.Fatal("gS did not stash the hunk")
+	}
+	m.mode = git.Staged
+	m = update(t, m, runeKeys("gS")...)
+	if !strings.HasPrefix(m.flash, "hunks are stashed from the worktree") {
+		t.Fatalf("flash %q", m.flash)
+	}
+}
+
+func TestStash_EnterShowsTheEntry(t *testing.T) {
+	m := reviewModel()
+	m.height = 12
+	stashes := []git.Stash{{Ref: "stash@{0}", Subject: "WIP on main: 1234567 one"}, {Ref: "stash@{1}", Subject: "On main: a.go"}}
+	m = update(t, m, stashesLoadedMsg{stashes: stashes})
+	m = update(t, m, runeKeys("j")...)
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(model)
+	if cmd == nil || m.stashShown != nil {
+		t.Fatal("enter did not load the entry")
+	}
+
+	text := " a.go | 20 +\n 1 file changed\n\ndiff --git a/a.go b/a.go\n" + strings.Repeat("+line\n", 20)
+	m = update(t, m, stashShownMsg{action: stashAction{verb: "show", stash: stashes[1], selected: 1}, text: text})
+	if m.stashShown == nil || m.overlay.Selectable || len(m.overlay.Lines) != 24 || !strings.HasPrefix(m.overlay.Title, "stash@{1}") {
+		t.Fatalf("overlay %+v", m.overlay)
+	}
+	m = update(t, m, runeKeys("jj")...)
+	if m.overlay.Scroll != 2 {
+		t.Fatalf("j scrolled to %d", m.overlay.Scroll)
+	}
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyEsc})
+	if m.stashShown != nil || m.overlay == nil || !m.overlay.Selectable || m.overlay.Selected != 1 {
+		t.Fatalf("esc did not go back to the list: %+v", m.overlay)
+	}
+
+	m = update(t, m, stashShownMsg{action: stashAction{verb: "show", stash: stashes[1], selected: 1}, text: text})
+	m = update(t, m, runeKeys("d")...)
+	if m.stashShown != nil || m.stashConfirm == nil || m.stashConfirm.verb != "drop" || m.stashConfirm.stash.Ref != "stash@{1}" {
+		t.Fatalf("d on the shown entry: confirm %+v", m.stashConfirm)
+	}
+}
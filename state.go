@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// session is what tdiff keeps between runs for one repository and branch.
+type session struct {
+	Notes     []note         `json:"notes,omitempty"`
+	Bookmarks []bookmark     `json:"bookmarks,omitempty"`
+	Reviewed  []reviewedFile `json:"reviewed,omitempty"`
+}
+
+func (s session) empty() bool {
+	return len(s.Notes) == 0 && len(s.Bookmarks) == 0 && len(s.Reviewed) == 0
+}
+
+// stateFile is the layout of the state file: sessions keyed by sessionKey.
+type stateFile struct {
+	Sessions map[string]session `json:"sessions"`
+}
+
+// defaultStatePath is $XDG_STATE_HOME/tdiff/state.json, falling back to
+// ~/.local/state when XDG_STATE_HOME is unset.
+func defaultStatePath(getenv func(string) string) string {
+	dir := getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home := getenv("HOME")
+		if home == "" {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "tdiff", "state.json")
+}
+
+// stateStore reads and writes the state file. Saves run as commands, so it
+// numbers them and drops any that arrive after a later one was written. A
+// nil store keeps nothing.
+type stateStore struct {
+	path string
+
+	mu    sync.Mutex
+	saved int
+}
+
+func readStateFile(path string) (stateFile, error) {
+	var state stateFile
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, errors.New(path + ": " + err.Error())
+	}
+	return state, nil
+}
+
+func (s *stateStore) load(key string) (session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := readStateFile(s.path)
+	return state.Sessions[key], err
+}
+
+// save replaces key's session with sess unless save seq was overtaken. The
+// file is replaced whole so a crash never leaves half of it.
+func (s *stateStore) save(seq int, key string, sess session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seq <= s.saved {
+		return nil
+	}
+	s.saved = seq
+	state, err := readStateFile(s.path)
+	if err != nil {
+		return err
+	}
+	if state.Sessions == nil {
+		state.Sessions = map[string]session{}
+	}
+	if sess.empty() {
+		delete(state.Sessions, key)
+	} else {
+		state.Sessions[key] = sess
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// sessionKey names the session of the repository at root on branch.
+func sessionKey(root, branch string) string {
+	return root + "@" + branch
+}
+
+// sessionLoadedMsg carries the saved session for key.
+type sessionLoadedMsg struct {
+	key     string
+	session session
+	err     error
+}
+
+// stateSavedMsg reports a failed save; successful ones send nothing.
+type stateSavedMsg struct {
+	err error
+}
+
+// openSession loads the session for the repository and branch the file list
+// came from, when they differ from the one open.
+func (m *model) openSession() tea.Cmd {
+	if m.state == nil || m.repo == nil || m.repo.Root == "" {
+		return nil
+	}
+	key := sessionKey(m.repo.Root, m.repo.Branch)
+	if key == m.sessionKey {
+		return nil
+	}
+	m.sessionKey = key
+	m.sessionLoaded = false
+	m.notes, m.bookmarks, m.reviewed = nil, nil, nil
+	store := m.state
+	return guardCmd(func() tea.Msg {
+		sess, err := store.load(key)
+		return sessionLoadedMsg{key: key, session: sess, err: err}
+	}, func(err error) tea.Msg {
+		return sessionLoadedMsg{key: key, err: err}
+	})
+}
+
+func (m model) handleSessionLoaded(msg sessionLoadedMsg) (tea.Model, tea.Cmd) {
+	if msg.key != m.sessionKey {
+		return m, nil
+	}
+	if msg.err != nil {
+		// Saving now would overwrite whatever could not be read.
+		m.flash = "cannot read saved state: " + firstLine(msg.err.Error())
+		return m, nil
+	}
+	m.sessionLoaded = true
+	// Whatever was added before the session arrived is kept over what was
+	// saved.
+	notes, bookmarks, reviewed := m.notes, m.bookmarks, m.reviewed
+	m.notes = map[noteKey]note{}
+	for _, n := range msg.session.Notes {
+		m.notes[noteKey{n.File, n.Line}] = n
+	}
+	for k, n := range notes {
+		m.notes[k] = n
+	}
+	m.bookmarks = map[bookmarkKey]bookmark{}
+	for _, b := range msg.session.Bookmarks {
+		m.bookmarks[b.key()] = b
+	}
+	for k, b := range bookmarks {
+		m.bookmarks[k] = b
+	}
+	m.reviewed = map[reviewKey]string{}
+	for _, r := range msg.session.Reviewed {
+		m.reviewed[r.key()] = r.Blobs
+	}
+	for k, blobs := range reviewed {
+		m.reviewed[k] = blobs
+	}
+	stale := m.forgetStaleReviews()
+	// Reviewed files sort last.
+	cmd := m.refilter()
+	if len(m.reviewed) > 0 && !m.blobsListed && m.hasRealFiles() {
+		// The listing came without the names the marks are checked against.
+		m.filesReq++
+		cmd = tea.Batch(cmd, m.loadFiles())
+	}
+	if stale || len(notes) > 0 || len(bookmarks) > 0 || len(reviewed) > 0 {
+		cmd = tea.Batch(cmd, m.saveSession())
+	}
+	return m, cmd
+}
+
+// saveSession writes the open session to the state file.
+func (m *model) saveSession() tea.Cmd {
+	if m.state == nil || !m.sessionLoaded {
+		return nil
+	}
+	m.stateSeq++
+	seq, key, store := m.stateSeq, m.sessionKey, m.state
+	sess := session{Notes: m.sortedNotes(), Bookmarks: m.sortedBookmarks(), Reviewed: m.sortedReviewed()}
+	return guardCmd(func() tea.Msg {
+		if err := store.save(seq, key, sess); err != nil {
+			return stateSavedMsg{err: err}
+		}
+		return nil
+	}, func(err error) tea.Msg {
+		return stateSavedMsg{err: err}
+	})
+}
+
+func (m model) handleStateSaved(msg stateSavedMsg) (tea.Model, tea.Cmd) {
+	m.flash = "cannot save state: " + firstLine(msg.err.Error())
+	return m, nil
+}
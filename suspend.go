@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// suspendCommand is run through tea.Exec, which hands the terminal back to
+// the shell for as long as tdiff is stopped and takes it again on resume.
+type suspendCommand struct{}
+
+func (suspendCommand) Run() error          { return suspendProcess() }
+func (suspendCommand) SetStdin(io.Reader)  {}
+func (suspendCommand) SetStdout(io.Writer) {}
+func (suspendCommand) SetStderr(io.Writer) {}
+
+// resumedMsg arrives once tdiff runs again after ctrl+z.
+type resumedMsg struct {
+	err error
+}
+
+// suspend puts tdiff in the background as ctrl+z does for other programs.
+func (m model) suspend() (tea.Model, tea.Cmd) {
+	m.saveCursor()
+	return m, tea.Exec(suspendCommand{}, func(err error) tea.Msg {
+		return resumedMsg{err: err}
+	})
+}
+
+// handleResumed reloads the file list, and with it the selected diff,
+// since the shell was probably used to change them.
+func (m model) handleResumed(msg resumedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.flash = "cannot suspend: " + msg.err.Error()
+		return m, nil
+	}
+	m.saveCursor()
+	m.filesReq++
+	return m, m.loadFiles()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResumed_ReloadsKeepingSelection(t *testing.T) {
+	m := loadedModel(5)
+	m.selected = 2
+	file, req := m.selectedFile(), m.filesReq
+	next, cmd := m.handleResumed(resumedMsg{})
+	m = next.(model)
+	if m.filesReq == req || cmd == nil {
+		t.Fatal("resuming did not reload the file list")
+	}
+	next, _ = m.handleFilesLoaded(filesLoadedMsg{req: m.filesReq, mode: m.mode, files: m.allFiles, statuses: m.fileStatuses})
+	m = next.(model)
+	if got := m.selectedFile(); got != file {
+		t.Fatalf("selected %q after resuming, want %q", got, file)
+	}
+}
+
+func TestResumed_ReportsFailedSuspend(t *testing.T) {
+	m := loadedModel(1)
+	req := m.filesReq
+	next, _ := m.handleResumed(resumedMsg{err: errors.New("job control is not available")})
+	m = next.(model)
+	if m.filesReq != req || m.notice() != "cannot suspend: job control is not available" {
+		t.Fatalf("notice = %q, filesReq %d -> %d", m.notice(), req, m.filesReq)
+	}
+}
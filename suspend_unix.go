@@ -0,0 +1,27 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// suspendProcess stops tdiff's process group, as the terminal would on
+// ctrl+z outside raw mode, and returns once a SIGCONT resumes it.
+func suspendProcess() error {
+	if signal.Ignored(syscall.SIGTSTP) {
+		// Nothing would stop us, and nothing would send SIGCONT.
+		return errors.New("job control is not available")
+	}
+	cont := make(chan os.Signal, 1)
+	signal.Notify(cont, syscall.SIGCONT)
+	defer signal.Stop(cont)
+	if err := syscall.Kill(0, syscall.SIGTSTP); err != nil {
+		return err
+	}
+	<-cont
+	return nil
+}
@@ -0,0 +1,8 @@
+package main
+
+import "errors"
+
+// suspendProcess is not possible on Windows, which has no job control.
+func suspendProcess() error {
+	return errors.New("not supported on Windows")
+}
@@ -0,0 +1,176 @@
+package ui
+
+import (
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// maxCachedRows bounds the styled diff rows a RenderCache keeps; past it the
+// cache starts over rather than tracking which rows were used last.
+const maxCachedRows = 4096
+
+// RenderCache keeps what one frame drew that the next is likely to draw
+// again: the banner, sidebar rows and styled diff rows. Keep one across
+// frames in RenderModel.Cache; a nil cache draws everything afresh. Entries
+// are dropped when anything they were drawn from changes, so the cache never
+// needs clearing by hand. It is not safe for concurrent use.
+type RenderCache struct {
+	banner    string
+	bannerKey bannerKey
+
+	styles  styleKey
+	sidebar map[sidebarKey]string
+
+	// rows and syntax are the slices the cached pane rows were drawn from,
+	// held so their addresses identify them until they are replaced.
+	rows   []diff.Row
+	syntax []RowSyntax
+	panes  paneKey
+	lines  map[lineKey]paneRowLines
+
+	noRows     []diff.Row
+	oldNoWidth int
+	newNoWidth int
+
+	sideRows       []diff.Row
+	hasOld, hasNew bool
+}
+
+// styleKey is what styled output depends on besides its own inputs.
+type styleKey struct {
+	theme   *Theme
+	profile termenv.Profile
+	dark    bool
+}
+
+type bannerKey struct {
+	theme         *Theme
+	width, height int
+}
+
+type sidebarKey struct {
+	indent, marker, label, staged, name, warning, stat string
+	width                                              int
+	selected, focused                                  bool
+}
+
+// paneKey is every RenderModel setting a styled diff row depends on.
+type paneKey struct {
+	showWhitespace bool
+	tabWidth       int
+	wrap           bool
+	highlight      ChangeHighlight
+}
+
+type lineKey struct {
+	idx                int
+	oldWidth, newWidth int
+	cursor             bool
+	// active marks the header of the cursor's hunk, drawn brighter.
+	active bool
+	fold   Fold
+}
+
+// paneRowLines is one row drawn into both panes; wrapped rows take several
+// lines.
+type paneRowLines struct {
+	old, new []string
+}
+
+// sync drops the entries m no longer matches. Render calls it once per
+// frame, before drawing anything.
+func (c *RenderCache) sync(m RenderModel) {
+	if c == nil {
+		return
+	}
+	styles := styleKey{theme: m.theme(), profile: lipgloss.ColorProfile(), dark: lipgloss.HasDarkBackground()}
+	if styles != c.styles {
+		c.styles = styles
+		c.sidebar = nil
+		c.lines = nil
+	}
+	panes := paneKey{showWhitespace: m.ShowWhitespace, tabWidth: m.TabWidth, wrap: m.Wrap, highlight: m.Highlight}
+	if panes != c.panes || !sameRows(c.rows, m.Rows) || !sameSyntax(c.syntax, m.Syntax) {
+		c.panes, c.rows, c.syntax = panes, m.Rows, m.Syntax
+		c.lines = nil
+	}
+}
+
+// bannerBlock returns the banner fitted to width×height.
+func (c *RenderCache) bannerBlock(t *Theme, width, height int) string {
+	if c == nil {
+		return fitBlock(renderBannerContent(t, width, height), width, height)
+	}
+	key := bannerKey{theme: t, width: width, height: height}
+	if c.banner == "" || key != c.bannerKey {
+		c.banner, c.bannerKey = fitBlock(renderBannerContent(t, width, height), width, height), key
+	}
+	return c.banner
+}
+
+// sidebarRow returns r rendered in width cells.
+func (c *RenderCache) sidebarRow(r sidebarRow, width int, selected, focused bool) string {
+	if c == nil {
+		return r.render(width, selected, focused)
+	}
+	key := sidebarKey{r.indent, r.marker, r.label, r.staged, r.name, r.warning, r.stat, width, selected, focused}
+	if line, ok := c.sidebar[key]; ok {
+		return line
+	}
+	if c.sidebar == nil || len(c.sidebar) >= maxCachedRows {
+		c.sidebar = map[sidebarKey]string{}
+	}
+	line := r.render(width, selected, focused)
+	c.sidebar[key] = line
+	return line
+}
+
+// paneRow returns the styled lines of a diff row, drawing them on a miss.
+func (c *RenderCache) paneRow(key lineKey, draw func() paneRowLines) paneRowLines {
+	if c == nil {
+		return draw()
+	}
+	if lines, ok := c.lines[key]; ok {
+		return lines
+	}
+	if c.lines == nil || len(c.lines) >= maxCachedRows {
+		c.lines = map[lineKey]paneRowLines{}
+	}
+	lines := draw()
+	c.lines[key] = lines
+	return lines
+}
+
+// lineNumberWidths is lineNumberWidth of rows for both sides, worked out
+// once per set of rows.
+func (c *RenderCache) lineNumberWidths(rows []diff.Row) (int, int) {
+	if c == nil {
+		return lineNumberWidth(rows, true), lineNumberWidth(rows, false)
+	}
+	if c.noRows == nil || !sameRows(c.noRows, rows) {
+		c.noRows = rows
+		c.oldNoWidth, c.newNoWidth = lineNumberWidth(rows, true), lineNumberWidth(rows, false)
+	}
+	return c.oldNoWidth, c.newNoWidth
+}
+
+// sides is rowSides of rows, worked out again only when rows change.
+func (c *RenderCache) sides(rows []diff.Row) (bool, bool) {
+	if c == nil {
+		return rowSides(rows)
+	}
+	if c.sideRows == nil || !sameRows(c.sideRows, rows) {
+		c.sideRows = rows
+		c.hasOld, c.hasNew = rowSides(rows)
+	}
+	return c.hasOld, c.hasNew
+}
+
+func sameRows(a, b []diff.Row) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+func sameSyntax(a, b []RowSyntax) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
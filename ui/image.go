@@ -0,0 +1,125 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ImageProtocol is a terminal inline-graphics protocol.
+type ImageProtocol int
+
+const (
+	ImageNone ImageProtocol = iota
+	ImageKitty
+	ImageITerm
+)
+
+const kittyChunkSize = 4096
+
+// DetectImageProtocol guesses the inline-image protocol from the environment.
+// Terminals that cannot be identified get ImageNone.
+func DetectImageProtocol() ImageProtocol {
+	term := os.Getenv("TERM")
+	program := os.Getenv("TERM_PROGRAM")
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || strings.Contains(term, "kitty") || program == "ghostty":
+		return ImageKitty
+	case program == "iTerm.app" || program == "WezTerm" || os.Getenv("LC_TERMINAL") == "iTerm2":
+		return ImageITerm
+	default:
+		return ImageNone
+	}
+}
+
+// IsImageFile reports whether path has an extension tdiff can preview.
+func IsImageFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+		return true
+	default:
+		return false
+	}
+}
+
+// PrepareImage converts data into the payload format the protocol expects. The
+// kitty protocol only accepts PNG, so other formats are decoded and re-encoded.
+func PrepareImage(protocol ImageProtocol, data []byte) ([]byte, error) {
+	switch protocol {
+	case ImageITerm:
+		return data, nil
+	case ImageKitty:
+		if bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) {
+			return data, nil
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, errors.New("terminal does not support inline images")
+	}
+}
+
+// ImageEscape returns the escape sequence that draws a prepared image scaled
+// into rect. The cursor is saved and restored around it so the next frame is
+// unaffected.
+func ImageEscape(protocol ImageProtocol, data []byte, rect Rect) string {
+	if len(data) == 0 || rect.Width <= 0 || rect.Height <= 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b7")
+	fmt.Fprintf(&b, "\x1b[%d;%dH", rect.Y+1, rect.X+1)
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	switch protocol {
+	case ImageKitty:
+		// q=2 suppresses replies, which would otherwise arrive as key input.
+		for i := 0; i < len(encoded); i += kittyChunkSize {
+			end := i + kittyChunkSize
+			if end > len(encoded) {
+				end = len(encoded)
+			}
+			more := 1
+			if end == len(encoded) {
+				more = 0
+			}
+			if i == 0 {
+				fmt.Fprintf(&b, "\x1b_Ga=T,f=100,q=2,C=1,c=%d,r=%d,m=%d;%s\x1b\\", rect.Width, rect.Height, more, encoded[i:end])
+			} else {
+				fmt.Fprintf(&b, "\x1b_Gm=%d;%s\x1b\\", more, encoded[i:end])
+			}
+		}
+	case ImageITerm:
+		fmt.Fprintf(&b, "\x1b]1337;File=inline=1;size=%d;width=%d;height=%d;preserveAspectRatio=1:%s\a", len(data), rect.Width, rect.Height, encoded)
+	default:
+		return ""
+	}
+
+	b.WriteString("\x1b8")
+	return b.String()
+}
+
+// ClearImagesEscape removes previously drawn images where the protocol keeps
+// them on a separate layer. iTerm2 images live in cells and vanish on repaint.
+func ClearImagesEscape(protocol ImageProtocol) string {
+	if protocol == ImageKitty {
+		return "\x1b_Ga=d,d=A,q=2\x1b\\"
+	}
+	return ""
+}
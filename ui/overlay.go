@@ -0,0 +1,98 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Overlay is a titled, scrollable box of text drawn in place of the sidebar
+// and panes, such as the full output of a failed git command.
+type Overlay struct {
+	Title string
+	Lines []string
+	// Scroll is the first wrapped line shown; Render clamps it to MaxScroll.
+	Scroll int
+	// Selectable highlights Lines[Selected], for lists to pick from.
+	Selectable bool
+	Selected   int
+}
+
+// OverlayVisibleLines is how many text lines an overlay shows in a body of
+// height rows, below its border and title.
+func OverlayVisibleLines(height int) int {
+	return intMax(height-3, 1)
+}
+
+// MaxScroll is the largest useful Scroll for o in a body of width×height
+// cells.
+func (o Overlay) MaxScroll(width, height int) int {
+	lines, _ := o.wrap(width)
+	return intMax(len(lines)-OverlayVisibleLines(height), 0)
+}
+
+// ScrollToSelected is the Scroll closest to o.Scroll that shows all of the
+// selected line.
+func (o Overlay) ScrollToSelected(width, height int) int {
+	_, owners := o.wrap(width)
+	first, last := -1, -1
+	for i, owner := range owners {
+		if owner == o.Selected {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	scroll := o.Scroll
+	if first < 0 {
+		return scroll
+	}
+	visible := OverlayVisibleLines(height)
+	if last >= scroll+visible {
+		scroll = last - visible + 1
+	}
+	if first < scroll {
+		scroll = first
+	}
+	return scroll
+}
+
+// wrap breaks o's lines to fit inside its border with a space either side.
+// owners holds the index in o.Lines each wrapped line came from.
+func (o Overlay) wrap(width int) (lines []string, owners []int) {
+	textWidth := intMax(width-4, 1)
+	wrap := lipgloss.NewStyle().Width(textWidth)
+	for i, line := range o.Lines {
+		line = diff.EscapeControl(strings.ReplaceAll(line, "\t", "    "))
+		if lipgloss.Width(line) <= textWidth {
+			lines, owners = append(lines, line), append(owners, i)
+			continue
+		}
+		for _, part := range strings.Split(wrap.Render(line), "\n") {
+			lines, owners = append(lines, part), append(owners, i)
+		}
+	}
+	return lines, owners
+}
+
+// renderOverlay draws o as a focused box filling width×height.
+func renderOverlay(t *Theme, o Overlay, width, height int) string {
+	innerWidth, innerHeight := intMax(width-2, 1), intMax(height-2, 1)
+	lines, owners := o.wrap(width)
+	visible := OverlayVisibleLines(height)
+	scroll := intMin(intMax(o.Scroll, 0), intMax(len(lines)-visible, 0))
+
+	content := make([]string, 0, innerHeight)
+	content = append(content, t.title.Render(fitWidth(o.Title, innerWidth)))
+	for i := scroll; i < scroll+visible && i < len(lines); i++ {
+		line := fitWidth(" "+lines[i], innerWidth)
+		if o.Selectable && owners[i] == o.Selected {
+			line = t.selectedFocused.Render(line)
+		}
+		content = append(content, line)
+	}
+	box := t.borderHot.Render(fitBlock(strings.Join(content, "\n"), innerWidth, innerHeight))
+	return withScrollbar(box, t.borderHot, t.glyphs.thumb, 2, visible, len(lines), visible, scroll)
+}
@@ -0,0 +1,55 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// scrollbarThumb is drawn over a box's right border; the border's own style
+// still colors it, so focus highlighting is unchanged.
+const scrollbarThumb = "▐"
+
+// scrollThumb places a thumb on a track of track lines for a list of total
+// items of which visible fit at once, scrolled to offset. ok is false when
+// everything fits and no scrollbar should be drawn.
+func scrollThumb(track, total, visible, offset int) (start, size int, ok bool) {
+	if track < 1 || visible < 1 || total <= visible {
+		return 0, 0, false
+	}
+	size = track * visible / total
+	if size < 1 {
+		size = 1
+	}
+	maxOffset := total - visible
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > maxOffset {
+		offset = maxOffset
+	}
+	start = ((track-size)*offset + maxOffset/2) / maxOffset
+	return start, size, true
+}
+
+// withScrollbar draws a thumb into the right border of a box rendered with
+// border, on a track of track lines starting top lines below its first line.
+func withScrollbar(box string, border lipgloss.Style, thumb string, top, track, total, visible, offset int) string {
+	right := border.GetBorderStyle().Right
+	lines := strings.Split(box, "\n")
+	if top+track > len(lines) {
+		track = len(lines) - top
+	}
+	start, size, ok := scrollThumb(track, total, visible, offset)
+	if !ok {
+		return box
+	}
+	for i := top + start; i < top+start+size; i++ {
+		at := strings.LastIndex(lines[i], right)
+		if at < 0 {
+			continue
+		}
+		lines[i] = lines[i][:at] + thumb + lines[i][at+len(right):]
+	}
+	return strings.Join(lines, "\n")
+}
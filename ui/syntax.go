@@ -0,0 +1,173 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// SyntaxMaxRows is the row count above which diffs are not highlighted, since
+// tokenizing very large files would delay showing the diff.
+const SyntaxMaxRows = 5000
+
+const syntaxStyleName = "monokai"
+
+// Span colors bytes [Start, End) of a line with a syntax foreground.
+type Span struct {
+	Start int
+	End   int
+	Color lipgloss.Color
+}
+
+// RowSyntax holds syntax spans for both sides of one diff row.
+type RowSyntax struct {
+	Old []Span
+	New []Span
+}
+
+// syntaxStyles caches one style per token color so rendering a frame does not
+// rebuild styles for every token.
+var syntaxStyles = map[lipgloss.Color]lipgloss.Style{}
+
+// Language names the language of file as highlighting detects it from the
+// name, or "" when no lexer matches.
+func Language(file string) string {
+	if lexer := lexers.Match(file); lexer != nil {
+		return lexer.Config().Name
+	}
+	return ""
+}
+
+// HighlightRows tokenizes both sides of rows with the lexer matching file's
+// name and returns spans parallel to rows. Each side is tokenized as one text
+// so multi-line constructs such as block comments color correctly. It returns
+// nil when no lexer matches.
+func HighlightRows(file string, rows []diff.Row) []RowSyntax {
+	lexer := lexers.Match(file)
+	if lexer == nil || len(rows) == 0 {
+		return nil
+	}
+	lexer = chroma.Coalesce(lexer)
+	style := styles.Get(syntaxStyleName)
+
+	out := make([]RowSyntax, len(rows))
+	oldIdx := make([]int, 0, len(rows))
+	newIdx := make([]int, 0, len(rows))
+	for i, row := range rows {
+		if row.Kind == diff.Meta || row.Kind == diff.HiddenMeta || row.Kind == diff.HunkHeader {
+			continue
+		}
+		if row.OldNo != nil {
+			oldIdx = append(oldIdx, i)
+		}
+		if row.NewNo != nil {
+			newIdx = append(newIdx, i)
+		}
+	}
+
+	oldSpans := highlightSide(lexer, style, rows, oldIdx, true)
+	for j, i := range oldIdx {
+		out[i].Old = oldSpans[j]
+	}
+	newSpans := highlightSide(lexer, style, rows, newIdx, false)
+	for j, i := range newIdx {
+		out[i].New = newSpans[j]
+	}
+	return out
+}
+
+func highlightSide(lexer chroma.Lexer, style *chroma.Style, rows []diff.Row, indices []int, old bool) [][]Span {
+	spans := make([][]Span, len(indices))
+	for j := range spans {
+		// Non-nil marks the line as highlighted even when no token is colored.
+		spans[j] = make([]Span, 0)
+	}
+	if len(indices) == 0 {
+		return spans
+	}
+
+	lines := make([]string, len(indices))
+	for j, i := range indices {
+		if old {
+			lines[j] = rows[i].Old
+		} else {
+			lines[j] = rows[i].New
+		}
+	}
+
+	iter, err := lexer.Tokenise(nil, strings.Join(lines, "\n")+"\n")
+	if err != nil {
+		return spans
+	}
+
+	// Plain text keeps the terminal's own foreground so light themes stay legible.
+	plain := style.Get(chroma.Text).Colour
+	line, col := 0, 0
+	for _, token := range iter.Tokens() {
+		colour := style.Get(token.Type).Colour
+		if colour == plain {
+			colour = 0
+		}
+		parts := strings.Split(token.Value, "\n")
+		for p, part := range parts {
+			if p > 0 {
+				line++
+				col = 0
+			}
+			if line >= len(lines) {
+				break
+			}
+			if part != "" && colour.IsSet() {
+				spans[line] = append(spans[line], Span{Start: col, End: col + len(part), Color: lipgloss.Color(colour.String())})
+			}
+			col += len(part)
+		}
+	}
+	return spans
+}
+
+// renderSyntax renders line[start:end] in base style, applying span colors as
+// foreground where they overlap.
+func renderSyntax(line paneText, start, end int, spans []Span, base lipgloss.Style) string {
+	if start >= end {
+		return ""
+	}
+
+	var b strings.Builder
+	pos := start
+	for _, span := range spans {
+		if span.End <= pos || span.Start >= end {
+			continue
+		}
+		from := span.Start
+		if from < pos {
+			from = pos
+		}
+		to := span.End
+		if to > end {
+			to = end
+		}
+		if from > pos {
+			b.WriteString(line.render(pos, from, base))
+		}
+		b.WriteString(line.render(from, to, syntaxStyle(span.Color)))
+		pos = to
+	}
+	if pos < end {
+		b.WriteString(line.render(pos, end, base))
+	}
+	return b.String()
+}
+
+func syntaxStyle(color lipgloss.Color) lipgloss.Style {
+	if style, ok := syntaxStyles[color]; ok {
+		return style
+	}
+	style := lipgloss.NewStyle().Foreground(color)
+	syntaxStyles[color] = style
+	return style
+}
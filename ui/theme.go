@@ -0,0 +1,507 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// Theme is every style the UI draws with. Render takes it from RenderModel,
+// so switching themes only changes what is passed in.
+type Theme struct {
+	Name string
+
+	header            lipgloss.Style
+	title             lipgloss.Style
+	selectedFocused   lipgloss.Style
+	selectedUnfocused lipgloss.Style
+
+	meta         lipgloss.Style
+	hunk         lipgloss.Style
+	activeHunk   lipgloss.Style
+	hunkMarker   lipgloss.Style
+	context      lipgloss.Style
+	oldLine      lipgloss.Style
+	newLine      lipgloss.Style
+	cursor       lipgloss.Style
+	oldWord      lipgloss.Style
+	newWord      lipgloss.Style
+	oldNoNewline lipgloss.Style
+	newNoNewline lipgloss.Style
+	// edited colors the line numbers and ~ gutter marker of edited lines.
+	edited lipgloss.Style
+	// oldTint and newTint fill the background of changed lines when tint is
+	// set; see lineTint.
+	oldTint lipgloss.Style
+	newTint lipgloss.Style
+	tint    bool
+
+	whitespaceError lipgloss.Style
+	conflict        lipgloss.Style
+	truncated       lipgloss.Style
+	hint            lipgloss.Style
+
+	// status colors the sidebar labels by git status; see statusStyle.
+	status       map[string]lipgloss.Style
+	deletedName  lipgloss.Style
+	reviewedName lipgloss.Style
+
+	borderDim lipgloss.Style
+	borderHot lipgloss.Style
+
+	glyphs glyphSet
+	banner []string
+	// markers prefixes changed lines with +, - or ~ so they read without
+	// color; see gutterMarker.
+	markers bool
+}
+
+// glyphSet is the non-text characters the UI draws.
+type glyphSet struct {
+	thumb      string
+	hunkMarker string
+	bullet     string
+	expanded   string
+	collapsed  string
+	prev       string
+	next       string
+	more       string
+	loading    string
+	loaded     string
+	noNewline  string
+	tab        string
+	trailing   string
+	nbsp       string
+	minus      string
+	note       string
+	bookmark   string
+	reviewed   string
+	warning    string
+}
+
+var unicodeGlyphs = glyphSet{
+	thumb:      scrollbarThumb,
+	hunkMarker: "▎",
+	bullet:     "●",
+	expanded:   "▾ ",
+	collapsed:  "▸ ",
+	prev:       " ◂ ",
+	next:       " ▸",
+	more:       "…",
+	loading:    "…",
+	loaded:     "·",
+	noNewline:  "⏎ missing",
+	tab:        "→",
+	trailing:   "·",
+	nbsp:       "␣",
+	minus:      "−",
+	note:       "¶",
+	bookmark:   "◆",
+	reviewed:   "✓ ",
+	warning:    "⚠",
+}
+
+var asciiGlyphs = glyphSet{
+	thumb:      "#",
+	hunkMarker: ":",
+	bullet:     "*",
+	expanded:   "v ",
+	collapsed:  "> ",
+	prev:       " < ",
+	next:       " >",
+	more:       "~",
+	loading:    "...",
+	loaded:     ".",
+	noNewline:  "\\ missing",
+	tab:        ">",
+	trailing:   ".",
+	nbsp:       "_",
+	minus:      "-",
+	note:       "*",
+	bookmark:   "'",
+	reviewed:   "x ",
+	warning:    "!",
+}
+
+var asciiBanner = []string{
+	" _____ ____ ___ _____ _____ ",
+	"|_   _|  _ \\_ _|  ___|  ___|",
+	"  | | | | | | || |_  | |_   ",
+	"  | | | |_| | ||  _| |  _|  ",
+	"  |_| |____/___|_|   |_|    ",
+	"",
+}
+
+var asciiBorder = lipgloss.Border{
+	Top: "-", Bottom: "-", Left: "|", Right: "|",
+	TopLeft: "+", TopRight: "+", BottomLeft: "+", BottomRight: "+",
+}
+
+// asciiHotBorder marks the focused pane where colors alone would not.
+var asciiHotBorder = lipgloss.Border{
+	Top: "=", Bottom: "=", Left: "|", Right: "|",
+	TopLeft: "+", TopRight: "+", BottomLeft: "+", BottomRight: "+",
+}
+
+// ASCII returns t drawn with plain ASCII borders, banner and glyphs, for
+// terminals whose fonts lack box-drawing and block characters.
+func (t Theme) ASCII() Theme {
+	t.glyphs = asciiGlyphs
+	t.banner = asciiBanner
+	t.borderDim = t.borderDim.Copy().Border(asciiBorder)
+	t.borderHot = t.borderHot.Copy().Border(asciiHotBorder)
+	return t
+}
+
+// Plain reports whether t draws without color: the monochrome theme, or any
+// theme when the terminal's color profile has none, as when output is piped
+// or NO_COLOR is set.
+func (t *Theme) Plain() bool {
+	return t.markers || lipgloss.ColorProfile() == termenv.Ascii
+}
+
+// palette is the handful of colors a theme is built from. Built-in palettes
+// use adaptive colors, so one theme suits dark and light backgrounds alike.
+type palette struct {
+	meta            lipgloss.TerminalColor
+	hunk            lipgloss.TerminalColor
+	activeHunk      lipgloss.TerminalColor
+	old             lipgloss.TerminalColor
+	new             lipgloss.TerminalColor
+	cursor          lipgloss.TerminalColor
+	oldWord         lipgloss.TerminalColor
+	newWord         lipgloss.TerminalColor
+	wordText        lipgloss.TerminalColor
+	oldTint         lipgloss.TerminalColor
+	newTint         lipgloss.TerminalColor
+	whitespaceError lipgloss.TerminalColor
+	modified        lipgloss.TerminalColor
+	renamed         lipgloss.TerminalColor
+	untracked       lipgloss.TerminalColor
+	border          lipgloss.TerminalColor
+	borderFocused   lipgloss.TerminalColor
+
+	// bold draws changed lines, word highlights and status labels in bold.
+	bold bool
+	// tint fills changed lines with the faint oldTint and newTint
+	// backgrounds, under the word highlights.
+	tint bool
+}
+
+// paletteKeys names the palette colors for themes defined in the config file.
+var paletteKeys = map[string]func(*palette) *lipgloss.TerminalColor{
+	"meta":             func(p *palette) *lipgloss.TerminalColor { return &p.meta },
+	"hunk":             func(p *palette) *lipgloss.TerminalColor { return &p.hunk },
+	"active-hunk":      func(p *palette) *lipgloss.TerminalColor { return &p.activeHunk },
+	"old":              func(p *palette) *lipgloss.TerminalColor { return &p.old },
+	"new":              func(p *palette) *lipgloss.TerminalColor { return &p.new },
+	"cursor":           func(p *palette) *lipgloss.TerminalColor { return &p.cursor },
+	"old-word":         func(p *palette) *lipgloss.TerminalColor { return &p.oldWord },
+	"new-word":         func(p *palette) *lipgloss.TerminalColor { return &p.newWord },
+	"word-text":        func(p *palette) *lipgloss.TerminalColor { return &p.wordText },
+	"old-tint":         func(p *palette) *lipgloss.TerminalColor { return &p.oldTint },
+	"new-tint":         func(p *palette) *lipgloss.TerminalColor { return &p.newTint },
+	"whitespace-error": func(p *palette) *lipgloss.TerminalColor { return &p.whitespaceError },
+	"modified":         func(p *palette) *lipgloss.TerminalColor { return &p.modified },
+	"renamed":          func(p *palette) *lipgloss.TerminalColor { return &p.renamed },
+	"untracked":        func(p *palette) *lipgloss.TerminalColor { return &p.untracked },
+	"border":           func(p *palette) *lipgloss.TerminalColor { return &p.border },
+	"border-focused":   func(p *palette) *lipgloss.TerminalColor { return &p.borderFocused },
+}
+
+// adaptive picks dark on dark backgrounds and light on light ones.
+func adaptive(dark, light string) lipgloss.AdaptiveColor {
+	return lipgloss.AdaptiveColor{Dark: dark, Light: light}
+}
+
+// Light variants darken what would wash out on a light background, the
+// yellows and the pale borders, and swap the dark word-highlight and cursor
+// backgrounds for pale ones. Word highlights are strong enough to stand out
+// from the line colors around them, not only from the terminal background.
+var palettes = map[string]palette{
+	"default": {
+		meta:            adaptive("8", "244"),
+		hunk:            adaptive("3", "130"),
+		activeHunk:      adaptive("11", "166"),
+		old:             adaptive("1", "124"),
+		new:             adaptive("2", "28"),
+		cursor:          adaptive("236", "254"),
+		oldWord:         adaptive("88", "217"),
+		newWord:         adaptive("28", "157"),
+		wordText:        adaptive("255", "232"),
+		oldTint:         adaptive("52", "224"),
+		newTint:         adaptive("22", "194"),
+		whitespaceError: adaptive("1", "210"),
+		modified:        adaptive("3", "130"),
+		renamed:         adaptive("4", "25"),
+		untracked:       adaptive("5", "90"),
+		border:          adaptive("8", "250"),
+		borderFocused:   adaptive("7", "240"),
+	},
+	"solarized": {
+		meta:            adaptive("#586e75", "#93a1a1"),
+		hunk:            adaptive("#b58900", "#b58900"),
+		activeHunk:      adaptive("#cb4b16", "#cb4b16"),
+		old:             adaptive("#dc322f", "#dc322f"),
+		new:             adaptive("#859900", "#859900"),
+		cursor:          adaptive("#073642", "#eee8d5"),
+		oldWord:         adaptive("#5c1f1e", "#f5cfc6"),
+		newWord:         adaptive("#3b4500", "#e1e8b8"),
+		wordText:        adaptive("#fdf6e3", "#002b36"),
+		oldTint:         adaptive("#3b1d1f", "#fae6e0"),
+		newTint:         adaptive("#26300a", "#eef2d8"),
+		whitespaceError: adaptive("#dc322f", "#f2a7a0"),
+		modified:        adaptive("#b58900", "#b58900"),
+		renamed:         adaptive("#268bd2", "#268bd2"),
+		untracked:       adaptive("#d33682", "#d33682"),
+		border:          adaptive("#586e75", "#93a1a1"),
+		borderFocused:   adaptive("#93a1a1", "#586e75"),
+	},
+	"gruvbox": {
+		meta:            adaptive("#928374", "#928374"),
+		hunk:            adaptive("#d79921", "#b57614"),
+		activeHunk:      adaptive("#fabd2f", "#af3a03"),
+		old:             adaptive("#fb4934", "#9d0006"),
+		new:             adaptive("#b8bb26", "#79740e"),
+		cursor:          adaptive("#3c3836", "#ebdbb2"),
+		oldWord:         adaptive("#5a1e1b", "#f2c3b3"),
+		newWord:         adaptive("#3d4220", "#dde0a8"),
+		wordText:        adaptive("#fbf1c7", "#282828"),
+		oldTint:         adaptive("#3c1f1e", "#f9e0d6"),
+		newTint:         adaptive("#32361a", "#ecefcf"),
+		whitespaceError: adaptive("#cc241d", "#ea9a8f"),
+		modified:        adaptive("#d79921", "#b57614"),
+		renamed:         adaptive("#83a598", "#076678"),
+		untracked:       adaptive("#d3869b", "#8f3f71"),
+		border:          adaptive("#665c54", "#bdae93"),
+		borderFocused:   adaptive("#a89984", "#7c6f64"),
+	},
+	// high-contrast uses the bright ANSI colors, black text on bright word
+	// highlights and bold for everything that changed.
+	"high-contrast": {
+		meta:            adaptive("250", "238"),
+		hunk:            adaptive("11", "94"),
+		activeHunk:      adaptive("14", "19"),
+		old:             adaptive("9", "124"),
+		new:             adaptive("10", "22"),
+		cursor:          adaptive("238", "252"),
+		oldWord:         adaptive("9", "9"),
+		newWord:         adaptive("10", "10"),
+		wordText:        adaptive("16", "16"),
+		oldTint:         adaptive("52", "224"),
+		newTint:         adaptive("22", "194"),
+		whitespaceError: adaptive("13", "13"),
+		modified:        adaptive("11", "94"),
+		renamed:         adaptive("12", "20"),
+		untracked:       adaptive("13", "90"),
+		border:          adaptive("250", "240"),
+		borderFocused:   adaptive("15", "16"),
+		bold:            true,
+	},
+	// colorblind avoids red against green: orange for old, blue for new,
+	// from the Okabe-Ito palette, which stays distinct under the common
+	// forms of color blindness.
+	"colorblind": {
+		meta:            adaptive("244", "244"),
+		hunk:            adaptive("#cc79a7", "#9c4b7c"),
+		activeHunk:      adaptive("#f0e442", "#8a6d00"),
+		old:             adaptive("#e69f00", "#b35a00"),
+		new:             adaptive("#56b4e9", "#0072b2"),
+		cursor:          adaptive("236", "254"),
+		oldWord:         adaptive("#7a4a00", "#ffd59e"),
+		newWord:         adaptive("#00507d", "#bfe0f5"),
+		wordText:        adaptive("#ffffff", "#000000"),
+		oldTint:         adaptive("#3d2800", "#ffeacc"),
+		newTint:         adaptive("#002a42", "#e0f0fa"),
+		whitespaceError: adaptive("#d55e00", "#f0b08a"),
+		modified:        adaptive("#f0e442", "#8a6d00"),
+		renamed:         adaptive("#cc79a7", "#9c4b7c"),
+		untracked:       adaptive("#009e73", "#00704f"),
+		border:          adaptive("240", "250"),
+		borderFocused:   adaptive("250", "240"),
+	},
+}
+
+func newTheme(name string, p palette) Theme {
+	fg := func(c lipgloss.TerminalColor) lipgloss.Style { return lipgloss.NewStyle().Foreground(c) }
+	border := lipgloss.NewStyle().Border(lipgloss.NormalBorder())
+	t := Theme{
+		Name:              name,
+		header:            lipgloss.NewStyle().Bold(true),
+		title:             lipgloss.NewStyle().Bold(true),
+		selectedFocused:   lipgloss.NewStyle().Bold(true).Reverse(true),
+		selectedUnfocused: lipgloss.NewStyle().Bold(true),
+
+		meta:         fg(p.meta),
+		hunk:         fg(p.hunk).Bold(true),
+		activeHunk:   fg(p.activeHunk).Bold(true),
+		hunkMarker:   fg(p.hunk),
+		context:      lipgloss.NewStyle(),
+		oldLine:      fg(p.old),
+		newLine:      fg(p.new),
+		cursor:       lipgloss.NewStyle().Background(p.cursor),
+		oldWord:      lipgloss.NewStyle().Background(p.oldWord).Foreground(p.wordText),
+		newWord:      lipgloss.NewStyle().Background(p.newWord).Foreground(p.wordText),
+		oldNoNewline: fg(p.old).Faint(true),
+		newNoNewline: fg(p.new).Faint(true),
+		edited:       fg(p.modified).Faint(true),
+		oldTint:      lipgloss.NewStyle().Background(p.oldTint),
+		newTint:      lipgloss.NewStyle().Background(p.newTint),
+		tint:         p.tint,
+
+		whitespaceError: lipgloss.NewStyle().Background(p.whitespaceError),
+		conflict:        fg(p.activeHunk).Bold(true).Reverse(true),
+		truncated:       fg(p.meta),
+		hint:            fg(p.meta),
+
+		status: map[string]lipgloss.Style{
+			"A": fg(p.new),
+			"D": fg(p.old),
+			"M": fg(p.modified),
+			"R": fg(p.renamed),
+			"T": fg(p.renamed),
+			"?": fg(p.untracked),
+			"I": fg(p.meta),
+			"S": fg(p.activeHunk),
+			// Conflicted files stop a merge, so their label is the loudest.
+			"C": fg(p.old).Bold(true).Reverse(true),
+		},
+		deletedName:  lipgloss.NewStyle().Faint(true).Strikethrough(true),
+		reviewedName: lipgloss.NewStyle().Faint(true),
+
+		borderDim: border.Copy().BorderForeground(p.border),
+		borderHot: border.Copy().BorderForeground(p.borderFocused),
+
+		glyphs: unicodeGlyphs,
+		banner: sidebarBannerLines,
+	}
+	if p.bold {
+		for _, style := range []*lipgloss.Style{&t.oldLine, &t.newLine, &t.oldWord, &t.newWord} {
+			*style = style.Copy().Bold(true)
+		}
+		for status, style := range t.status {
+			t.status[status] = style.Copy().Bold(true)
+		}
+	}
+	return t
+}
+
+// MonochromeTheme tells changes apart by attributes alone.
+func MonochromeTheme() Theme {
+	plain := lipgloss.NewStyle()
+	none := lipgloss.NoColor{}
+	t := newTheme("monochrome", palette{
+		meta: none, hunk: none, activeHunk: none, old: none, new: none, cursor: none,
+		oldWord: none, newWord: none, wordText: none, oldTint: none, newTint: none, whitespaceError: none,
+		modified: none, renamed: none, untracked: none, border: none, borderFocused: none,
+	})
+	t.meta = plain.Copy().Faint(true)
+	t.hunk = plain.Copy().Bold(true)
+	t.activeHunk = plain.Copy().Bold(true).Underline(true)
+	t.hunkMarker = plain
+	t.oldLine = plain.Copy().Faint(true)
+	t.newLine = plain.Copy().Bold(true)
+	t.cursor = plain.Copy().Underline(true)
+	t.oldWord = plain.Copy().Reverse(true).Faint(true)
+	t.newWord = plain.Copy().Reverse(true)
+	t.oldNoNewline = plain.Copy().Faint(true)
+	t.newNoNewline = plain.Copy().Faint(true)
+	t.whitespaceError = plain.Copy().Reverse(true)
+	t.truncated = plain.Copy().Faint(true)
+	t.hint = plain.Copy().Faint(true)
+	t.status = map[string]lipgloss.Style{"A": plain.Copy().Bold(true), "I": plain.Copy().Faint(true)}
+	// Without colors the focused pane gets a heavier border instead.
+	t.borderDim = lipgloss.NewStyle().Border(lipgloss.NormalBorder())
+	t.borderHot = lipgloss.NewStyle().Border(lipgloss.ThickBorder())
+	t.markers = true
+	return t
+}
+
+// DefaultTheme is used when RenderModel has no theme.
+var DefaultTheme = newTheme("default", palettes["default"])
+
+// BuiltinThemes returns the themes tdiff ships with, default first.
+func BuiltinThemes() []Theme {
+	return []Theme{
+		DefaultTheme,
+		newTheme("solarized", palettes["solarized"]),
+		newTheme("gruvbox", palettes["gruvbox"]),
+		newTheme("high-contrast", palettes["high-contrast"]),
+		newTheme("colorblind", palettes["colorblind"]),
+		MonochromeTheme(),
+	}
+}
+
+var colorRE = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// CustomTheme builds a theme from base, one of the built-in color themes,
+// with the given colors replaced. Keys name palette colors such as "old" or
+// "border-focused"; values are "#rrggbb" or an ANSI color number and apply on
+// dark and light backgrounds alike. The "tint" key is instead "true" or
+// "false", turning the changed-line backgrounds on or off.
+func CustomTheme(name, base string, colors map[string]string) (Theme, error) {
+	if base == "" {
+		base = "default"
+	}
+	p, ok := palettes[base]
+	if !ok {
+		return Theme{}, fmt.Errorf("theme %s: unknown base %q (want %s)", name, base, strings.Join(paletteNames(), ", "))
+	}
+	for key, value := range colors {
+		if key == "tint" {
+			tint, err := strconv.ParseBool(value)
+			if err != nil {
+				return Theme{}, fmt.Errorf("theme %s: invalid tint %q (want true or false)", name, value)
+			}
+			p.tint = tint
+			continue
+		}
+		field, ok := paletteKeys[key]
+		if !ok {
+			return Theme{}, fmt.Errorf("theme %s: unknown color %q", name, key)
+		}
+		if n, err := strconv.Atoi(value); !colorRE.MatchString(value) && (err != nil || n < 0 || n > 255) {
+			return Theme{}, fmt.Errorf("theme %s: invalid %s color %q (want #rrggbb or 0-255)", name, key, value)
+		}
+		*field(&p) = lipgloss.Color(value)
+	}
+	return newTheme(name, p), nil
+}
+
+func paletteNames() []string {
+	names := make([]string, 0, len(palettes))
+	for name := range palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lineTint is the background row takes in the OLD or NEW pane: the old tint
+// behind deleted and edited lines, the new tint behind added and edited ones.
+func (t *Theme) lineTint(row diff.Row, oldPane bool) (lipgloss.Style, bool) {
+	if !t.tint || t.Plain() || row.Kind == diff.Meta || row.Kind == diff.HiddenMeta || row.Kind == diff.HunkHeader || keptFromBase(row, oldPane) {
+		return lipgloss.Style{}, false
+	}
+	switch {
+	case oldPane && (isPureDeletion(row) || isEditRow(row)):
+		return t.oldTint, true
+	case !oldPane && (isPureAddition(row) || isEditRow(row)):
+		return t.newTint, true
+	}
+	return lipgloss.Style{}, false
+}
+
+// statusStyle colors a sidebar status label; unknown statuses look modified.
+func (t *Theme) statusStyle(status string) lipgloss.Style {
+	if style, ok := t.status[status]; ok {
+		return style
+	}
+	return t.status["M"]
+}
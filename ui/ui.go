@@ -28,6 +28,142 @@ func (f Focus) String() string {
 	}
 }
 
+// Layout arranges the sidebar and the OLD/NEW panes.
+type Layout int
+
+const (
+	// LayoutAuto stacks the panes on terminals narrower than StackedBelowWidth.
+	LayoutAuto Layout = iota
+	LayoutSideBySide
+	LayoutStacked
+)
+
+// ChangeHighlight is how edit rows show what changed between their sides.
+type ChangeHighlight int
+
+const (
+	// HighlightWords marks the changed words of every edit row.
+	HighlightWords ChangeHighlight = iota
+	// HighlightLines colors edit rows as a whole deleted line and a whole
+	// added one.
+	HighlightLines
+	// HighlightAuto marks words unless the row was mostly rewritten, where
+	// word marks would cover most of it anyway.
+	HighlightAuto
+)
+
+// rewrittenBelow is the diff.SimilarityTokens score under which
+// HighlightAuto draws an edit row as whole lines.
+const rewrittenBelow = 0.6
+
+func (h ChangeHighlight) String() string {
+	switch h {
+	case HighlightLines:
+		return "line"
+	case HighlightAuto:
+		return "auto"
+	default:
+		return "word"
+	}
+}
+
+// Next returns the highlight after h in the order word, line, auto.
+func (h ChangeHighlight) Next() ChangeHighlight {
+	switch h {
+	case HighlightWords:
+		return HighlightLines
+	case HighlightLines:
+		return HighlightAuto
+	default:
+		return HighlightWords
+	}
+}
+
+// FileLoad is how far a file's diff has loaded, marked after its sidebar row.
+type FileLoad int
+
+const (
+	FileNotLoaded FileLoad = iota
+	// FileLoading marks a file whose diff request is outstanding.
+	FileLoading
+	// FileLoaded marks a file whose diff is held and shows without waiting.
+	FileLoaded
+)
+
+// PaneApart is where the pane that is not being scrolled was left while the
+// scroll lock is off.
+type PaneApart struct {
+	Pane   Focus
+	Scroll int
+	Cursor int
+}
+
+// DefaultSplit gives each side-by-side pane half the width. MinSplit and
+// MaxSplit keep either pane from shrinking to nothing, and SplitStep is how
+// far one resize moves the split.
+const (
+	DefaultSplit = 50
+	MinSplit     = 20
+	MaxSplit     = 80
+	SplitStep    = 10
+)
+
+// ClampSplit keeps the percentage OLD takes within MinSplit and MaxSplit, and
+// turns 0 into DefaultSplit.
+func ClampSplit(split int) int {
+	switch {
+	case split == 0:
+		return DefaultSplit
+	case split < MinSplit:
+		return MinSplit
+	case split > MaxSplit:
+		return MaxSplit
+	}
+	return split
+}
+
+// StackedBelowWidth is the terminal width under which LayoutAuto stacks the
+// panes, since side-by-side panes would be only a few dozen columns each.
+const StackedBelowWidth = 100
+
+func (l Layout) String() string {
+	switch l {
+	case LayoutSideBySide:
+		return "side-by-side"
+	case LayoutStacked:
+		return "stacked"
+	default:
+		return "auto"
+	}
+}
+
+// Next returns the layout after l in the order auto, side-by-side, stacked.
+func (l Layout) Next() Layout {
+	switch l {
+	case LayoutAuto:
+		return LayoutSideBySide
+	case LayoutSideBySide:
+		return LayoutStacked
+	default:
+		return LayoutAuto
+	}
+}
+
+// ResolveLayout returns the layout used on a terminal width columns wide,
+// never LayoutAuto.
+func ResolveLayout(l Layout, width int) Layout {
+	if l != LayoutAuto {
+		return l
+	}
+	if width < StackedBelowWidth {
+		return LayoutStacked
+	}
+	return LayoutSideBySide
+}
+
+// DefaultTabWidth is the tab stop interval used when none is configured.
+const DefaultTabWidth = 4
+
 type RenderModel struct {
 	Width         int
 	Height        int
@@ -42,30 +178,144 @@ type RenderModel struct {
 	Cursor        int
 	DiffScroll    int
 	SelectedFile  string
-	Error         string
-}
-
-var (
-	headerStyle = lipgloss.NewStyle().Bold(true)
-	titleStyle  = lipgloss.NewStyle().Bold(true)
+	// SidebarWidth is the chosen sidebar width; zero picks one from Width.
+	SidebarWidth int
+	// Entries, when set, replaces Files in the sidebar with a directory tree;
+	// Selected and SidebarScroll then index Entries.
+	Entries []SidebarEntry
+	// SidebarTitle replaces FilesTitle above the file list, e.g. to name the
+	// current sort.
+	SidebarTitle string
+	// Layout selects side-by-side or stacked panes.
+	Layout Layout
+	// SwapPanes draws NEW left of OLD, or above it when stacked.
+	SwapPanes bool
+	// Split is the percentage of the width side-by-side panes give OLD, 0
+	// for DefaultSplit; see ClampSplit.
+	Split int
+	// Apart, when set, scrolls the panes separately: the pane it names is
+	// drawn from its Scroll with its Cursor, and the other from DiffScroll
+	// with Cursor.
+	Apart *PaneApart
+	// KeepPanes draws both side-by-side panes at the split even when every
+	// row is on one side; otherwise the empty pane collapses to a strip.
+	KeepPanes bool
+	// Highlight is how edit rows mark their changes.
+	Highlight ChangeHighlight
+	// ShowHints reserves the bottom line for key hints of the focused pane.
+	ShowHints bool
+	// FileInfo describes the selected file on a line under the header; see
+	// FileInfoShown.
+	FileInfo string
+	// HideBanner gives the banner's rows to the file list; see BannerShown.
+	HideBanner bool
+	// HunkIndex is the zero-based hunk under the cursor, or -1 outside hunks.
+	HunkIndex int
+	HunkCount int
+	// HunkStart and HunkEnd are the rows [HunkStart, HunkEnd) of the cursor's
+	// hunk, marked in the panes' first column. They are equal outside hunks.
+	HunkStart int
+	HunkEnd   int
+	// Totals is the diffstat of the listed files and AllTotals that of every
+	// changed file; the header shows AllTotals in parentheses when they differ.
+	Totals    DiffTotals
+	AllTotals DiffTotals
+	// DiffLoading hides the cursor position until the selected diff arrives.
+	DiffLoading bool
+	// FileLoads marks files in the sidebar by how far their diffs have
+	// loaded; files it leaves out are unmarked.
+	FileLoads map[string]FileLoad
+	// LoadingStatus follows the OLD title while the diff loads, e.g. a
+	// spinner and the time taken so far; LoadingHint follows the NEW title.
+	LoadingStatus string
+	LoadingHint   string
+	// Blame is who last changed the cursor's NEW line, e.g. "a1b2c3d Jane
+	// Doe 2026-09-30"; it follows the NEW title when LoadingHint is empty.
+	Blame string
+	// FuncContext is the enclosing function reported by git for the cursor's hunk.
+	FuncContext string
+	// FunctionMode reports whether hunks were loaded with --function-context.
+	FunctionMode bool
+	// FullFile reports whether the whole file is shown instead of hunks only.
+	FullFile bool
+	// TabWidth is the tab stop interval; zero means DefaultTabWidth.
+	TabWidth int
+	// Wrap soft-wraps long rows over several lines instead of truncating them.
+	Wrap bool
+	// AutoAdvance reports whether motions continue into neighbouring files.
+	AutoAdvance bool
+	// HideUntracked reports that untracked files are left out of Files.
+	HideUntracked bool
+	// Notice is a warning kept in the header, e.g. that a list was capped.
+	Notice string
+	// Prompt, when set, replaces the header with a line being typed, such as
+	// a review note.
+	Prompt string
+	// NoteRows marks the rows with review notes in the NEW pane's first
+	// column.
+	NoteRows map[int]bool
+	// BookmarkRows marks the bookmarked rows in the OLD pane's first column.
+	BookmarkRows map[int]bool
+	// ConflictFiles are the files whose added lines leave conflict markers,
+	// flagged in the sidebar; ConflictMarkers badges the header when the
+	// cursor's file is one of them.
+	ConflictFiles   map[string]bool
+	ConflictMarkers bool
+	// Hidden marks the rows folded away, which take no lines; nil hides none.
+	Hidden []bool
+	// Folds are the folded hunks by header row, summed up after the header.
+	Folds map[int]Fold
+	// Reviewed files are dimmed in the sidebar behind a check mark.
+	Reviewed map[string]bool
+	// PartlyStaged are the worktree files with changes staged as well, marked
+	// with a "+" in a column after the label, e.g. "[M]+".
+	PartlyStaged map[string]string
+	// Repo is "repo@branch" at the start of the header; RepoState badges an
+	// operation in progress, e.g. "MERGING".
+	Repo      string
+	RepoState string
+	// HiddenGenerated counts generated files left out of Files; the sidebar
+	// shows them as one row below the list.
+	HiddenGenerated int
+	// PendingKeys is the count or prefix key typed so far, e.g. "15" or "g".
+	PendingKeys string
+	// ShowWhitespace draws tabs, trailing spaces and non-breaking spaces as glyphs.
+	ShowWhitespace bool
+	// Syntax holds token colors parallel to Rows, or nil when highlighting is
+	// off or unavailable for the file.
+	Syntax []RowSyntax
+	// WhitespaceErrors counts added lines with whitespace errors.
+	WhitespaceErrors int
+	// InvisibleChanges badges the header when the file has edits that look
+	// the same on screen; see diff.MarkInvisibleChanges.
+	InvisibleChanges bool
+	Error            string
+	// ErrorDetail reports that more about Error can be shown, and adds a
+	// hint for it to the header.
+	ErrorDetail bool
+	// ErrorRetry adds a hint that the failed load can be retried.
+	ErrorRetry bool
+	// Overlay, when set, is drawn in place of the sidebar and panes.
+	Overlay *Overlay
+	// PaneTitles replace OLD and NEW above the panes when set, e.g. LOCAL and
+	// REMOTE for a merge.
+	PaneTitles [2]string
 
-	selectedFocusedStyle   = lipgloss.NewStyle().Bold(true).Reverse(true)
-	selectedUnfocusedStyle = lipgloss.NewStyle().Bold(true)
-
-	metaStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
-	hunkStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true)
-	contextStyle = lipgloss.NewStyle()
-	oldLineStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
-	newLineStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
-	cursorStyle  = lipgloss.NewStyle().Background(lipgloss.Color("236"))
-
-	oldWordHighlight = lipgloss.NewStyle().Background(lipgloss.Color("52")).Foreground(lipgloss.Color("255"))
-	newWordHighlight = lipgloss.NewStyle().Background(lipgloss.Color("22")).Foreground(lipgloss.Color("255"))
+	// Theme is the styles to draw with; nil means DefaultTheme.
+	Theme *Theme
+	// Cache carries drawn parts over from the previous frame; nil draws
+	// everything afresh.
+	Cache *RenderCache
+}
 
-	statusStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
-	borderDimStyle = lipgloss.NewStyle().Border(lipgloss.NormalBorder()).BorderForeground(lipgloss.Color("8"))
-	borderHotStyle = lipgloss.NewStyle().Border(lipgloss.NormalBorder()).BorderForeground(lipgloss.Color("7"))
+func (m RenderModel) theme() *Theme {
+	if m.Theme == nil {
+		return &DefaultTheme
+	}
+	return m.Theme
+}
 
+var (
 	sidebarBannerTopPadding    = 1
 	sidebarBannerBottomPadding = 1
 	sidebarBannerLines         = []string{
@@ -78,72 +328,564 @@ var (
 	}
 )
 
+// MinWidth and MinHeight are the smallest terminal the panes are drawn in;
+// anything smaller shows a notice instead of overlapping borders.
+const (
+	MinWidth  = 60
+	MinHeight = 15
+)
+
+// TooSmall reports whether a width×height terminal is below the usable minimum.
+func TooSmall(width, height int) bool {
+	return width < MinWidth || height < MinHeight
+}
+
 func Render(m RenderModel) string {
 	if m.Width <= 0 || m.Height <= 0 {
 		return ""
 	}
+	if TooSmall(m.Width, m.Height) {
+		return renderTooSmall(m.Width, m.Height)
+	}
 	if len(m.Files) == 0 {
 		m.Files = []string{"(no changes)"}
 	}
 	if len(m.Rows) == 0 {
 		m.Rows = []diff.Row{{Old: "(no diff)", New: "(no diff)", Kind: diff.Meta}}
 	}
+	m.Cache.sync(m)
+
+	t := m.theme()
+	header := renderHeader(m)
+	if m.Prompt != "" {
+		header = m.Prompt
+	}
+	headerLine := t.header.Render(fitWidth(header, m.Width))
+	if FileInfoShown(m.Height, m.FileInfo) {
+		headerLine += "\n" + t.meta.Render(fitWidth(diff.EscapeControl(m.FileInfo), m.Width))
+	}
+
+	l := computeLayout(m)
+	var body string
+	if m.Overlay != nil {
+		body = renderOverlay(t, *m.Overlay, m.Width, l.bodyHeight)
+	} else {
+		body = renderBody(m, l)
+	}
+
+	if m.ShowHints {
+		return lipgloss.JoinVertical(lipgloss.Left, headerLine, body, renderHints(m, m.Width))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, headerLine, body)
+}
+
+// renderBody is the sidebar, or the file strip when stacked, and both panes.
+func renderBody(m RenderModel, l layout) string {
+	t := m.theme()
+	oldRowWidth, newRowWidth := l.rowWidths()
+	oldPaneContent, newPaneContent := renderPanes(m, oldRowWidth, newRowWidth, l.paneContentHeight)
+	oldBorder, newBorder := sectionBorder(t, m.Focus == FocusOld), sectionBorder(t, m.Focus == FocusNew)
+	oldPane := oldBorder.Render(fitBlock(oldPaneContent, l.oldContentWidth, l.paneContentHeight))
+	newPane := newBorder.Render(fitBlock(newPaneContent, l.newContentWidth, l.newBoxHeight-2))
+	// Both panes have the same rows, so their thumbs are the same size; the
+	// track is the rows below each pane's title.
+	metrics := NewRowMetrics(m)
+	visibleRows := len(m.Rows) - metrics.MaxScroll()
+	oldScroll, newScroll := m.DiffScroll, m.DiffScroll
+	if a := m.Apart; a != nil && a.Pane == FocusOld {
+		oldScroll = a.Scroll
+	} else if a != nil {
+		newScroll = a.Scroll
+	}
+	oldPane = withScrollbar(oldPane, oldBorder, t.glyphs.thumb, 2, l.paneContentHeight-1, len(m.Rows), visibleRows, oldScroll)
+	newPane = withScrollbar(newPane, newBorder, t.glyphs.thumb, 2, l.newBoxHeight-3, len(m.Rows), visibleRows, newScroll)
+	switch {
+	case l.collapseOld:
+		oldPane = oldBorder.Render(collapsedStrip(t, "OLD", l.paneContentHeight))
+	case l.collapseNew:
+		newPane = newBorder.Render(collapsedStrip(t, "NEW", l.paneContentHeight))
+	}
+
+	first, second := oldPane, newPane
+	if m.SwapPanes {
+		first, second = newPane, oldPane
+	}
+	if l.stacked {
+		return lipgloss.JoinVertical(lipgloss.Left, renderFileStrip(m, m.Width), first, second)
+	}
+	sidebar := renderSidebar(m, l.sidebarWidth, l.bodyHeight)
+	return lipgloss.JoinHorizontal(lipgloss.Top, sidebar, first, second)
+}
+
+// DiffTotals is the aggregate diffstat of a set of files.
+type DiffTotals struct {
+	Files   int
+	Added   int
+	Deleted int
+}
+
+// String formats totals like "23 files, +412 −118".
+func (t DiffTotals) String() string {
+	return t.format(unicodeGlyphs.minus)
+}
 
-	headerText := fmt.Sprintf("TDiff | mode: %s | algo: %s | focus: %s", strings.ToUpper(m.ModeLabel), strings.ToLower(m.AlgoLabel), m.Focus.String())
+func (t DiffTotals) format(minus string) string {
+	return fmt.Sprintf("%d %s, +%d %s%d", t.Files, pluralFiles(t.Files), t.Added, minus, t.Deleted)
+}
+
+// Fold is what a folded hunk changed, shown after its header like
+// "(+8 −3)".
+type Fold struct {
+	Added   int
+	Deleted int
+}
+
+func (f Fold) format(minus string) string {
+	return fmt.Sprintf("(+%d %s%d)", f.Added, minus, f.Deleted)
+}
+
+func pluralFiles(n int) string {
+	if n == 1 {
+		return "file"
+	}
+	return "files"
+}
+
+// headerSegment is one " | "-separated part of the header. Segments with a
+// higher drop value are removed first when the header does not fit; zero is
+// never dropped.
+type headerSegment struct {
+	text string
+	drop int
+}
+
+// renderHeader lays out the header segments, dropping the least important
+// ones on narrow terminals so the mode, focus and any error stay readable.
+func renderHeader(m RenderModel) string {
+	segments := []headerSegment{{"TDiff", 0}}
+	add := func(text string, drop int) {
+		segments = append(segments, headerSegment{text, drop})
+	}
+	if m.Repo != "" {
+		add(diff.EscapeControl(m.Repo), 2)
+	}
+	if m.RepoState != "" {
+		add(m.RepoState, 1)
+	}
+	if m.ConflictMarkers {
+		add(m.theme().glyphs.warning+" conflict markers present", 1)
+	}
+	add("mode: "+strings.ToUpper(m.ModeLabel), 0)
+	add("algo: "+strings.ToLower(m.AlgoLabel), 2)
+	add("focus: "+m.Focus.String(), 0)
+	if m.PendingKeys != "" {
+		add("keys: "+m.PendingKeys, 1)
+	}
+	if m.Totals.Files > 0 {
+		minus := m.theme().glyphs.minus
+		totals := m.Totals.format(minus)
+		if m.AllTotals != m.Totals {
+			totals += " (" + m.AllTotals.format(minus) + ")"
+		}
+		add(totals, 4)
+	}
+	if m.FunctionMode {
+		add("-W", 5)
+	}
+	if m.FullFile {
+		add("full file", 5)
+	}
+	if m.Syntax != nil {
+		add("syntax", 6)
+	}
+	if m.ShowWhitespace {
+		add("whitespace", 6)
+	}
+	if m.Wrap {
+		add("wrap", 6)
+	}
+	if m.AutoAdvance {
+		add("auto-advance", 6)
+	}
+	if m.HideUntracked {
+		add("untracked hidden", 5)
+	}
+	if m.Layout != LayoutAuto {
+		add("layout: "+m.Layout.String(), 6)
+	}
+	if m.Apart != nil {
+		add("scroll lock off", 2)
+	}
+	if m.SwapPanes {
+		add("panes: new|old", 6)
+	}
+	if split := ClampSplit(m.Split); split != DefaultSplit && ResolveLayout(m.Layout, m.Width) == LayoutSideBySide {
+		// Shares read left to right, as the panes are drawn.
+		if m.SwapPanes {
+			split = 100 - split
+		}
+		add(fmt.Sprintf("split: %d/%d", split, 100-split), 6)
+	}
+	if m.Highlight != HighlightWords {
+		add("changes: "+m.Highlight.String(), 6)
+	}
+	if name := m.theme().Name; name != DefaultTheme.Name {
+		add("theme: "+name, 6)
+	}
 	if m.SelectedFile != "" {
-		headerText += " | file: " + m.SelectedFile
+		add(fmt.Sprintf("file %d/%d", selectedFileIndex(m)+1, len(m.Files)), 4)
+		add("file: "+diff.EscapeControl(m.SelectedFile), 3)
+	}
+	if position := cursorPosition(m); position != "" {
+		add(position, 3)
+	}
+	if m.WhitespaceErrors > 0 {
+		add(fmt.Sprintf("whitespace errors: %d", m.WhitespaceErrors), 5)
+	}
+	if m.InvisibleChanges {
+		add(m.theme().glyphs.warning+" contains invisible or lookalike character changes", 1)
+	}
+	if m.FuncContext != "" {
+		add("in "+diff.EscapeControl(m.FuncContext), 7)
+	}
+	if m.Notice != "" {
+		add(m.Notice, 1)
+	}
+	if m.ErrorDetail {
+		add("e: details", 0)
+	}
+	if m.ErrorRetry {
+		add("r: retry", 0)
 	}
 	if m.Error != "" {
-		headerText += " | error: " + m.Error
+		add("error: "+m.Error, 0)
+	}
+
+	for {
+		text := joinHeader(segments)
+		worst := -1
+		for i, segment := range segments {
+			if segment.drop > 0 && (worst < 0 || segment.drop >= segments[worst].drop) {
+				worst = i
+			}
+		}
+		if lipgloss.Width(text) <= m.Width {
+			return text
+		}
+		if worst < 0 {
+			// Only an error is left too long; clip it rather than let the
+			// header wrap onto the panes.
+			return truncateWidth(text, m.Width-1) + m.theme().glyphs.more
+		}
+		segments = append(segments[:worst], segments[worst+1:]...)
+	}
+}
+
+func joinHeader(segments []headerSegment) string {
+	parts := make([]string, len(segments))
+	for i, segment := range segments {
+		parts[i] = segment.text
+	}
+	return strings.Join(parts, " | ")
+}
+
+// cursorPosition reports the cursor row and hunk, e.g. "L 248/1032 · hunk
+// 3/7", or "" while the diff is loading.
+func cursorPosition(m RenderModel) string {
+	if m.DiffLoading || m.SelectedFile == "" {
+		return ""
+	}
+	position := fmt.Sprintf("L %d/%d", m.Cursor+1, len(m.Rows))
+	if m.HunkCount > 0 {
+		position += " · hunk " + hunkPosition(m.HunkIndex, m.HunkCount)
+	}
+	return position
+}
+
+// keyHints lists the bindings most useful in the focused pane, most important
+// first.
+func keyHints(m RenderModel) []string {
+	if m.Overlay != nil {
+		return []string{"↑/↓ scroll", "g/G top/bottom", "esc close", "ctrl+c quit"}
+	}
+	stacked := ResolveLayout(m.Layout, m.Width) == LayoutStacked
+	if m.Focus == FocusFiles {
+		if stacked {
+			return []string{"←/→ file", "⇧↓ diff", "s mode", "a algo", "q quit"}
+		}
+		return []string{"↑/↓ select", "enter diff", "s mode", "a algo", "q quit"}
+	}
+	pane := "←/→ pane"
+	if stacked {
+		pane = "⇧↑/⇧↓ pane"
+	}
+	return []string{"n/p hunk", "g/G top/bottom", pane, "q quit"}
+}
+
+// renderHints joins as many hints as fit in width, ending in "…" when some had
+// to be dropped, so hints are never cut mid-word.
+func renderHints(m RenderModel, width int) string {
+	const sep = " · "
+	t := m.theme()
+	hints := keyHints(m)
+	for n := len(hints); n > 0; n-- {
+		text := strings.Join(hints[:n], sep)
+		if n < len(hints) {
+			text += sep + t.glyphs.more
+		}
+		if lipgloss.Width(text) <= width {
+			return t.hint.Render(fitWidth(text, width))
+		}
+	}
+	return t.hint.Render(fitWidth(t.glyphs.more, width))
+}
+
+// renderTooSmall centers the minimum-size notice, wrapping it on very narrow
+// terminals and dropping lines that do not fit.
+func renderTooSmall(width, height int) string {
+	text := fmt.Sprintf("terminal too small (need ≥ %d×%d, have %d×%d)", MinWidth, MinHeight, width, height)
+	text = lipgloss.NewStyle().Width(width).Align(lipgloss.Center).Render(text)
+	lines := strings.Split(text, "\n")
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	return lipgloss.Place(width, height, lipgloss.Center, lipgloss.Center, strings.Join(lines, "\n"))
+}
+
+// layout holds the computed geometry of one frame.
+type layout struct {
+	// stacked puts a one-line file strip above the OLD pane and NEW below it;
+	// sidebarWidth is then 0.
+	stacked           bool
+	bodyHeight        int
+	sidebarWidth      int
+	oldPaneWidth      int
+	newPaneWidth      int
+	paneContentHeight int
+	// newBoxHeight is the NEW pane's height including borders. Stacked panes
+	// split the body unevenly when it has an odd number of lines.
+	newBoxHeight    int
+	oldContentWidth int
+	newContentWidth int
+	// collapseOld and collapseNew narrow a pane with no lines to show to a
+	// strip; see collapsedPanes.
+	collapseOld bool
+	collapseNew bool
+}
+
+// collapsedPaneWidth is the width of a collapsed pane, borders included.
+const collapsedPaneWidth = 3
+
+// rowWidths is how wide the panes draw their rows. A collapsed pane's rows
+// are laid out at the other pane's width and not shown.
+func (l layout) rowWidths() (int, int) {
+	switch {
+	case l.collapseOld:
+		return l.newContentWidth, l.newContentWidth
+	case l.collapseNew:
+		return l.oldContentWidth, l.oldContentWidth
+	}
+	return l.oldContentWidth, l.newContentWidth
+}
+
+// collapsedPanes reports whether the side-by-side panes of m collapse OLD,
+// when every line shown is an addition, or NEW, when every one is a deletion.
+func collapsedPanes(m RenderModel) (bool, bool) {
+	if m.KeepPanes {
+		return false, false
+	}
+	hasOld, hasNew := m.Cache.sides(m.Rows)
+	return hasNew && !hasOld, hasOld && !hasNew
+}
+
+// rowSides reports whether any row has a line on the OLD side and on the NEW
+// side.
+func rowSides(rows []diff.Row) (bool, bool) {
+	hasOld, hasNew := false, false
+	for _, row := range rows {
+		hasOld = hasOld || row.OldNo != nil
+		hasNew = hasNew || row.NewNo != nil
+		if hasOld && hasNew {
+			break
+		}
+	}
+	return hasOld, hasNew
+}
+
+// collapsedStrip is the inside of a collapsed pane: its title written down
+// a column.
+func collapsedStrip(t *Theme, title string, height int) string {
+	lines := make([]string, height)
+	for i := range lines {
+		lines[i] = " "
+		if i < len(title) {
+			lines[i] = t.title.Render(title[i : i+1])
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func computeLayout(m RenderModel) layout {
+	var l layout
+	l.bodyHeight = m.Height - 1
+	if m.ShowHints {
+		l.bodyHeight--
+	}
+	if FileInfoShown(m.Height, m.FileInfo) {
+		l.bodyHeight--
+	}
+	if l.bodyHeight < 1 {
+		l.bodyHeight = 1
 	}
-	headerLine := headerStyle.Render(fitWidth(headerText, m.Width))
 
-	bodyHeight := m.Height - 1
-	if bodyHeight < 1 {
-		bodyHeight = 1
+	if ResolveLayout(m.Layout, m.Width) == LayoutStacked {
+		return computeStackedLayout(m, l)
 	}
 
-	sidebarWidth := calcSidebarWidth(m.Width)
-	mainWidth := m.Width - sidebarWidth
+	l.sidebarWidth = SidebarWidth(m.Width, m.SidebarWidth)
+	mainWidth := m.Width - l.sidebarWidth
 	if mainWidth < 4 {
 		mainWidth = 4
-		sidebarWidth = m.Width - mainWidth
-		if sidebarWidth < 1 {
-			sidebarWidth = 1
+		l.sidebarWidth = m.Width - mainWidth
+		if l.sidebarWidth < 1 {
+			l.sidebarWidth = 1
 		}
 	}
 
-	leftPaneWidth := (mainWidth - 1) / 2
-	rightPaneWidth := mainWidth - 1 - leftPaneWidth
-	if leftPaneWidth < 1 {
-		leftPaneWidth = 1
+	l.oldPaneWidth = (mainWidth - 1) * ClampSplit(m.Split) / 100
+	l.collapseOld, l.collapseNew = collapsedPanes(m)
+	switch {
+	case l.collapseOld:
+		l.oldPaneWidth = collapsedPaneWidth
+	case l.collapseNew:
+		l.oldPaneWidth = mainWidth - 1 - collapsedPaneWidth
+	}
+	l.newPaneWidth = mainWidth - 1 - l.oldPaneWidth
+	if l.oldPaneWidth < 1 {
+		l.oldPaneWidth = 1
 	}
-	if rightPaneWidth < 1 {
-		rightPaneWidth = 1
+	if l.newPaneWidth < 1 {
+		l.newPaneWidth = 1
 	}
 
-	sidebar := renderSidebar(m, sidebarWidth, bodyHeight)
+	l.paneContentHeight = l.bodyHeight - 2
+	if l.paneContentHeight < 1 {
+		l.paneContentHeight = 1
+	}
+	l.newBoxHeight = l.paneContentHeight + 2
+	l.oldContentWidth = l.oldPaneWidth - 2
+	if l.oldContentWidth < 1 {
+		l.oldContentWidth = 1
+	}
+	l.newContentWidth = l.newPaneWidth - 2
+	if l.newContentWidth < 1 {
+		l.newContentWidth = 1
+	}
+	return l
+}
 
-	paneContentHeight := bodyHeight - 2
-	if paneContentHeight < 1 {
-		paneContentHeight = 1
+// computeStackedLayout gives both panes the full width and splits the body
+// below the file strip between them. Rows stay aligned, so both panes show as
+// many rows as the shorter one fits.
+func computeStackedLayout(m RenderModel, l layout) layout {
+	l.stacked = true
+	l.oldPaneWidth = m.Width
+	l.newPaneWidth = m.Width
+	panes := l.bodyHeight - fileStripHeight
+	oldBoxHeight := panes / 2
+	l.newBoxHeight = panes - oldBoxHeight
+	l.paneContentHeight = oldBoxHeight - 2
+	if l.paneContentHeight < 1 {
+		l.paneContentHeight = 1
 	}
-	oldContentWidth := leftPaneWidth - 2
-	if oldContentWidth < 1 {
-		oldContentWidth = 1
+	if l.newBoxHeight < l.paneContentHeight+2 {
+		l.newBoxHeight = l.paneContentHeight + 2
 	}
-	newContentWidth := rightPaneWidth - 2
-	if newContentWidth < 1 {
-		newContentWidth = 1
+	l.oldContentWidth = m.Width - 2
+	if l.oldContentWidth < 1 {
+		l.oldContentWidth = 1
 	}
+	l.newContentWidth = l.oldContentWidth
+	return l
+}
 
-	oldPaneContent, newPaneContent := renderPanes(m, oldContentWidth, newContentWidth, paneContentHeight)
-	oldPane := sectionBorder(m.Focus == FocusOld).Render(fitBlock(oldPaneContent, oldContentWidth, paneContentHeight))
-	newPane := sectionBorder(m.Focus == FocusNew).Render(fitBlock(newPaneContent, newContentWidth, paneContentHeight))
+// fileStripHeight is the height of the stacked layout's file selector.
+const fileStripHeight = 1
 
-	body := lipgloss.JoinHorizontal(lipgloss.Top, sidebar, oldPane, newPane)
+// renderFileStrip is the stacked layout's stand-in for the sidebar: the
+// selected file and its position in the list, on one line.
+func renderFileStrip(m RenderModel, width int) string {
+	row := sidebarRow{theme: m.theme(), name: "(no changes)"}
+	position := fmt.Sprintf("FILE %d/%d", selectedFileIndex(m)+1, len(m.Files))
+	switch {
+	case m.Entries != nil && m.Selected >= 0 && m.Selected < len(m.Entries):
+		// The strip has no indentation to show the parents, so use full paths.
+		entry := m.Entries[m.Selected]
+		row = m.markFileRow(sidebarFileRow(m.theme(), entry.Path, entry.Status), entry.Path)
+		if entry.Dir {
+			position = "DIR"
+			entry.Name = entry.Path
+			entry.Depth = 0
+			row = sidebarEntryRow(m.theme(), entry)
+		}
+	case m.Selected >= 0 && m.Selected < len(m.Files):
+		row = m.markFileRow(sidebarFileRow(m.theme(), m.Files[m.Selected], m.FileStatuses[m.Files[m.Selected]]), m.Files[m.Selected])
+	}
+	glyphs := m.theme().glyphs
+	row.indent = position + glyphs.prev
+	if row.stat != "" {
+		row.stat += glyphs.next
+	} else {
+		row.name += glyphs.next
+	}
+	return row.render(width, true, m.Focus == FocusFiles)
+}
 
-	return lipgloss.JoinVertical(lipgloss.Left, headerLine, body)
+// Rect is a screen region in zero-based terminal cells.
+type Rect struct {
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
+// PaneRowRects returns the regions of the OLD and NEW panes below the title
+// line, i.e. where diff rows are drawn.
+func PaneRowRects(m RenderModel) (Rect, Rect) {
+	l := computeLayout(m)
+	// header line + top border + pane title
+	top := 3
+	if FileInfoShown(m.Height, m.FileInfo) {
+		top++
+	}
+	height := l.paneContentHeight - 1
+	if height < 0 {
+		height = 0
+	}
+	if l.stacked {
+		top += fileStripHeight
+		oldRect := Rect{X: 1, Y: top, Width: l.oldContentWidth, Height: height}
+		newRect := Rect{X: 1, Y: top + l.paneContentHeight + 2, Width: l.newContentWidth, Height: height}
+		if m.SwapPanes {
+			newRect.Y = top
+			oldRect.Y = top + l.newBoxHeight
+		}
+		return oldRect, newRect
+	}
+	oldRect := Rect{X: l.sidebarWidth + 1, Y: top, Width: l.oldContentWidth, Height: height}
+	newRect := Rect{X: l.sidebarWidth + l.oldPaneWidth + 1, Y: top, Width: l.newContentWidth, Height: height}
+	if m.SwapPanes {
+		newRect.X = l.sidebarWidth + 1
+		oldRect.X = l.sidebarWidth + l.newPaneWidth + 1
+	}
+	return oldRect, newRect
+}
+
+func hunkPosition(index, count int) string {
+	if index < 0 {
+		return fmt.Sprintf("-/%d", count)
+	}
+	return fmt.Sprintf("%d/%d", index+1, count)
 }
 
 func renderSidebar(m RenderModel, width, height int) string {
@@ -151,7 +893,7 @@ func renderSidebar(m RenderModel, width, height int) string {
 		return ""
 	}
 
-	bannerBoxHeight, filesBoxHeight := splitSidebarHeights(height)
+	bannerBoxHeight, filesBoxHeight := splitSidebarHeights(height, BannerShown(m.Height, m.HideBanner))
 	filesContentWidth := width - 2
 	if filesContentWidth < 1 {
 		filesContentWidth = 1
@@ -159,7 +901,7 @@ func renderSidebar(m RenderModel, width, height int) string {
 
 	sections := make([]string, 0, 2)
 	if bannerBoxHeight > 0 {
-		banner := fitBlock(renderBannerContent(width, bannerBoxHeight), width, bannerBoxHeight)
+		banner := m.Cache.bannerBlock(m.theme(), width, bannerBoxHeight)
 		sections = append(sections, banner)
 	}
 
@@ -168,7 +910,10 @@ func renderSidebar(m RenderModel, width, height int) string {
 		if filesContentHeight < 1 {
 			filesContentHeight = 1
 		}
-		files := sectionBorder(m.Focus == FocusFiles).Render(fitBlock(renderFilesContent(m, filesContentWidth, filesContentHeight), filesContentWidth, filesContentHeight))
+		border := sectionBorder(m.theme(), m.Focus == FocusFiles)
+		files := border.Render(fitBlock(renderFilesContent(m, filesContentWidth, filesContentHeight), filesContentWidth, filesContentHeight))
+		listHeight := sidebarListHeight(m, filesContentHeight)
+		files = withScrollbar(files, border, m.theme().glyphs.thumb, 2, listHeight, sidebarRows(m), listHeight, m.SidebarScroll)
 		sections = append(sections, files)
 	}
 	if len(sections) == 0 {
@@ -177,12 +922,12 @@ func renderSidebar(m RenderModel, width, height int) string {
 	return lipgloss.JoinVertical(lipgloss.Left, sections...)
 }
 
-func renderBannerContent(width, height int) string {
+func renderBannerContent(t *Theme, width, height int) string {
 	lines := make([]string, 0, height)
 	for i := 0; i < sidebarBannerTopPadding && len(lines) < height; i++ {
 		lines = append(lines, fitWidth("", width))
 	}
-	for _, bannerLine := range sidebarBannerLines {
+	for _, bannerLine := range t.banner {
 		if len(lines) >= height {
 			break
 		}
@@ -197,30 +942,58 @@ func renderBannerContent(width, height int) string {
 	return strings.Join(lines, "\n")
 }
 
-func renderFilesContent(m RenderModel, width, height int) string {
-	lines := make([]string, 0, height)
-	lines = append(lines, titleStyle.Render(fitWidth("FILES CHANGED", width)))
+// sidebarListHeight is how many rows of the file list fit below the title and
+// the hidden-generated note.
+func sidebarListHeight(m RenderModel, height int) int {
 	listHeight := height - 1
+	if m.HiddenGenerated > 0 {
+		listHeight--
+	}
 	if listHeight < 0 {
 		listHeight = 0
 	}
+	return listHeight
+}
+
+// sidebarRows is the length of the file list, counting tree rows when the
+// tree view is on.
+func sidebarRows(m RenderModel) int {
+	if m.Entries != nil {
+		return len(m.Entries)
+	}
+	return len(m.Files)
+}
+
+func renderFilesContent(m RenderModel, width, height int) string {
+	lines := make([]string, 0, height)
+	title := m.SidebarTitle
+	if title == "" {
+		title = FilesTitle
+	}
+	lines = append(lines, m.theme().title.Render(fitWidth(title, width)))
+	listHeight := sidebarListHeight(m, height)
 
 	for i := 0; i < listHeight; i++ {
 		idx := m.SidebarScroll + i
-		line := ""
-		if idx >= 0 && idx < len(m.Files) {
-			line = renderSidebarFile(m.Files[idx], m.FileStatuses[m.Files[idx]])
-		}
-		line = fitWidth(line, width)
-
-		if idx == m.Selected {
-			if m.Focus == FocusFiles {
-				line = selectedFocusedStyle.Render(line)
-			} else {
-				line = selectedUnfocusedStyle.Render(line)
+		row := sidebarRow{theme: m.theme()}
+		if m.Entries != nil {
+			if idx >= 0 && idx < len(m.Entries) {
+				row = sidebarEntryRow(m.theme(), m.Entries[idx])
+				if !m.Entries[idx].Dir {
+					row = m.markFileRow(row, m.Entries[idx].Path)
+				}
 			}
+		} else if idx >= 0 && idx < len(m.Files) {
+			row = m.markFileRow(sidebarFileRow(m.theme(), m.Files[idx], m.FileStatuses[m.Files[idx]]), m.Files[idx])
 		}
-		lines = append(lines, line)
+		if len(m.PartlyStaged) > 0 && row.label != "" && row.staged == "" {
+			row.staged = " "
+		}
+		lines = append(lines, m.Cache.sidebarRow(row, width, idx == m.Selected, m.Focus == FocusFiles))
+	}
+	if m.HiddenGenerated > 0 && len(lines) < height {
+		hidden := fmt.Sprintf("(%d generated %s hidden · E)", m.HiddenGenerated, pluralFiles(m.HiddenGenerated))
+		lines = append(lines, m.theme().truncated.Render(fitWidth(hidden, width)))
 	}
 	for len(lines) < height {
 		lines = append(lines, fitWidth("", width))
@@ -228,12 +1001,163 @@ func renderFilesContent(m RenderModel, width, height int) string {
 	return strings.Join(lines, "\n")
 }
 
-func renderSidebarFile(path, status string) string {
-	if path == "(loading...)" || path == "(no changes)" {
-		return path
+// sidebarRow is one sidebar line kept as separate parts, so a selected row
+// can restyle them as a whole instead of nesting escape codes.
+type sidebarRow struct {
+	theme      *Theme
+	indent     string
+	marker     string
+	label      string
+	labelStyle lipgloss.Style
+	// staged is the column after the label: "+" for a partly staged file, a
+	// space that keeps the other names in line with it, or nothing while no
+	// file is partly staged.
+	staged    string
+	name      string
+	nameStyle lipgloss.Style
+	// warning follows the name in the conflict style.
+	warning string
+	stat    string
+}
+
+// sidebarFileRow is a file's status label and path. Placeholders such as
+// "(loading...)" have no label.
+func sidebarFileRow(t *Theme, path, status string) sidebarRow {
+	if strings.HasPrefix(path, "(loading...") || path == "(no changes)" || strings.HasPrefix(path, "(no files match filter") {
+		return sidebarRow{theme: t, name: path}
+	}
+	row := sidebarRow{
+		theme:      t,
+		label:      "[" + statusLabel(status) + "]",
+		labelStyle: t.statusStyle(status),
+		name:       diff.EscapeControl(path),
+	}
+	switch status {
+	case "D":
+		row.nameStyle = t.deletedName
+	case "S":
+		// git itself shows no change here, so the row says why it is listed.
+		row.name += " (skipped)"
+	}
+	return row
+}
+
+// sidebarEntryRow is a tree row: a file by its basename, or a directory with an
+// expand marker, the status its files share and their diffstat.
+func sidebarEntryRow(t *Theme, entry SidebarEntry) sidebarRow {
+	row := sidebarFileRow(t, entry.Name, entry.Status)
+	row.indent = strings.Repeat("  ", entry.Depth)
+	if entry.Dir {
+		row.marker = t.glyphs.expanded
+		if entry.Collapsed {
+			row.marker = t.glyphs.collapsed
+		}
+		row.name = diff.EscapeControl(entry.Name) + "/"
+		row.nameStyle = lipgloss.NewStyle()
+		row.stat = fmt.Sprintf("+%d %s%d", entry.Totals.Added, t.glyphs.minus, entry.Totals.Deleted)
 	}
-	label := statusLabel(status)
-	return statusStyle.Render("["+label+"]") + " " + path
+	return row
+}
+
+// markFileRow adds what the sidebar knows about path to its file row: the
+// FileLoads marker, a warning for leftover conflict markers, a + after the
+// label of a partly staged file and a check mark when it is reviewed.
+func (m RenderModel) markFileRow(row sidebarRow, path string) sidebarRow {
+	if m.ConflictFiles[path] {
+		row.warning = m.theme().glyphs.warning
+	}
+	if m.PartlyStaged[path] != "" && row.label != "" {
+		row.staged = "+"
+	}
+	if m.Reviewed[path] {
+		row.name = m.theme().glyphs.reviewed + row.name
+		row.nameStyle = m.theme().reviewedName
+	}
+	switch m.FileLoads[path] {
+	case FileLoading:
+		row.stat = m.theme().glyphs.loading
+	case FileLoaded:
+		row.stat = m.theme().glyphs.loaded
+	}
+	return row
+}
+
+func (r sidebarRow) plain() string {
+	text := r.indent + r.marker
+	if r.label != "" {
+		text += r.label + r.staged + " "
+	}
+	text += r.name
+	if r.warning != "" {
+		text += " " + r.warning
+	}
+	if r.stat != "" {
+		text += " " + r.stat
+	}
+	return text
+}
+
+// render lays the row out in width cells. The selected row is drawn from plain
+// segments placed side by side rather than one selection style wrapped around
+// already colored text, which some terminals garble. Its label is its own
+// segment in the selection style plus the status color, and a bullet in the
+// status color in front keeps the status visible either way.
+func (r sidebarRow) render(width int, selected, focused bool) string {
+	if selected {
+		style := r.theme.selectedUnfocused
+		if focused {
+			style = r.theme.selectedFocused
+		}
+		bullet := " "
+		if r.label != "" {
+			bullet = r.labelStyle.Render(r.theme.glyphs.bullet)
+		}
+		line := fitWidth(r.plain(), width-1)
+		head := r.indent + r.marker
+		tag := r.label + r.staged
+		if r.label == "" || !strings.HasPrefix(line, head+tag) {
+			return bullet + style.Render(line)
+		}
+		label := style.Copy().Foreground(r.labelStyle.GetForeground())
+		rest := line[len(head)+len(tag):]
+		return bullet + renderSegment(style, head) + label.Render(tag) + style.Render(rest)
+	}
+
+	text := r.indent + r.marker
+	if r.label != "" {
+		text += r.labelStyle.Render(r.label+r.staged) + " "
+	}
+	text += r.nameStyle.Render(r.name)
+	if r.warning != "" {
+		text += " " + r.theme.conflict.Render(r.warning)
+	}
+	if r.stat != "" {
+		text += " " + r.theme.meta.Render(r.stat)
+	}
+	return fitWidth(text, width)
+}
+
+// renderSegment is style.Render that leaves an empty segment empty instead of
+// emitting a bare escape sequence.
+func renderSegment(style lipgloss.Style, text string) string {
+	if text == "" {
+		return ""
+	}
+	return style.Render(text)
+}
+
+// selectedFileIndex returns the position of SelectedFile in Files, which
+// differs from Selected in the tree view, or -1 when no file is selected.
+func selectedFileIndex(m RenderModel) int {
+	if m.Entries == nil {
+		return m.Selected
+	}
+	for i, file := range m.Files {
+		if file == m.SelectedFile {
+			return i
+		}
+	}
+	return -1
 }
 
 func statusLabel(status string) string {
@@ -248,17 +1172,27 @@ func statusLabel(status string) string {
 		return "R"
 	case "?":
 		return "U"
+	case "I":
+		return "I"
+	case "S":
+		return "S"
+	case "C":
+		return "C"
+	case "T":
+		return "T"
 	default:
 		return "·"
 	}
 }
 
-func SidebarVisibleFiles(sidebarHeight int) int {
+// SidebarVisibleFiles is the number of file rows a sidebar of sidebarHeight
+// lines shows, with or without the banner above them.
+func SidebarVisibleFiles(sidebarHeight int, banner bool) int {
 	if sidebarHeight <= 0 {
 		return 0
 	}
 
-	_, filesHeight := splitSidebarHeights(sidebarHeight)
+	_, filesHeight := splitSidebarHeights(sidebarHeight, banner)
 	if filesHeight < 3 {
 		return 0
 	}
@@ -280,13 +1214,33 @@ func intMin(a, b int) int {
 	return b
 }
 
-func splitSidebarHeights(total int) (int, int) {
+// BannerMinHeight is the terminal height below which the banner is left out,
+// since its rows are then worth more as file rows.
+const BannerMinHeight = 25
+
+// FileInfoMinHeight is the terminal height below which the file info line is
+// left out, so a short terminal keeps the row for the diff.
+const FileInfoMinHeight = 20
+
+// FileInfoShown reports whether info gets its line under the header in a
+// terminal of height lines.
+func FileInfoShown(height int, info string) bool {
+	return info != "" && height >= FileInfoMinHeight
+}
+
+// BannerShown reports whether the sidebar draws the banner in a terminal of
+// height lines when the user has or has not hidden it.
+func BannerShown(height int, hide bool) bool {
+	return !hide && height >= BannerMinHeight
+}
+
+func splitSidebarHeights(total int, showBanner bool) (int, int) {
 	if total <= 0 {
 		return 0, 0
 	}
 
 	minFilesHeight := 3 // border + at least title
-	if total <= minFilesHeight {
+	if !showBanner || total <= minFilesHeight {
 		return 0, total
 	}
 
@@ -321,93 +1275,322 @@ func fitBlock(content string, width, height int) string {
 	return strings.Join(lines, "\n")
 }
 
-func sectionBorder(focused bool) lipgloss.Style {
+func sectionBorder(t *Theme, focused bool) lipgloss.Style {
 	if focused {
-		return borderHotStyle
+		return t.borderHot
 	}
-	return borderDimStyle
+	return t.borderDim
 }
 
 func renderPanes(m RenderModel, leftWidth, rightWidth, height int) (string, string) {
 	oldLines := make([]string, 0, height)
 	newLines := make([]string, 0, height)
-	oldLines = append(oldLines, titleStyle.Render(fitWidth("OLD", leftWidth)))
-	newLines = append(newLines, titleStyle.Render(fitWidth("NEW", rightWidth)))
+	t := m.theme()
+	oldTitle, newTitle := "OLD", "NEW"
+	if m.PaneTitles != [2]string{} {
+		oldTitle, newTitle = m.PaneTitles[0], m.PaneTitles[1]
+	}
+	if m.LoadingStatus != "" {
+		oldTitle += " " + m.LoadingStatus
+	}
+	if m.LoadingHint != "" {
+		newTitle += " " + m.LoadingHint
+	} else if m.Blame != "" {
+		newTitle += " " + diff.EscapeControl(m.Blame)
+	}
+	oldLines = append(oldLines, t.title.Render(fitWidth(oldTitle, leftWidth)))
+	newLines = append(newLines, t.title.Render(fitWidth(newTitle, rightWidth)))
 
 	contentHeight := height - 1
 	if contentHeight < 1 {
 		return strings.Join(oldLines, "\n"), strings.Join(newLines, "\n")
 	}
 
-	oldNoWidth := lineNumberWidth(m.Rows, true)
-	newNoWidth := lineNumberWidth(m.Rows, false)
+	// The first column is kept for the current hunk's marker.
+	leftWidth -= hunkMarkerWidth
+	rightWidth -= hunkMarkerWidth
+	oldRows, newRows := renderPaneRows(m, m.DiffScroll, m.Cursor, leftWidth, rightWidth, contentHeight)
+	if a := m.Apart; a != nil {
+		apartOld, apartNew := renderPaneRows(m, a.Scroll, a.Cursor, leftWidth, rightWidth, contentHeight)
+		if a.Pane == FocusOld {
+			oldRows = apartOld
+		} else {
+			newRows = apartNew
+		}
+	}
+	oldLines = append(oldLines, oldRows...)
+	newLines = append(newLines, newRows...)
+	return strings.Join(oldLines, "\n"), strings.Join(newLines, "\n")
+}
+
+// renderPaneRows draws height lines of both panes from row start down, with
+// the cursor on row cursorRow.
+func renderPaneRows(m RenderModel, start, cursorRow, leftWidth, rightWidth, height int) ([]string, []string) {
+	oldLines := make([]string, 0, height)
+	newLines := make([]string, 0, height)
+	t := m.theme()
+	oldNoWidth, newNoWidth := m.Cache.lineNumberWidths(m.Rows)
 	showCursor := m.Focus == FocusOld || m.Focus == FocusNew
 
-	for i := 0; i < contentHeight; i++ {
-		idx := m.DiffScroll + i
+	metrics := NewRowMetrics(m)
+	for idx := start; len(oldLines) < height; idx++ {
 		if idx < 0 || idx >= len(m.Rows) {
-			oldLines = append(oldLines, fitWidth("", leftWidth))
-			newLines = append(newLines, fitWidth("", rightWidth))
+			oldLines = append(oldLines, fitWidth("", leftWidth+hunkMarkerWidth))
+			newLines = append(newLines, fitWidth("", rightWidth+hunkMarkerWidth))
 			continue
 		}
 
-		row := m.Rows[idx]
-		cursor := showCursor && idx == m.Cursor
-		oldText := row.Old
-		newText := row.New
-		if isEditRow(row) {
-			oldText, newText = inlineHighlight(row.Old, row.New)
+		if idx < len(m.Hidden) && m.Hidden[idx] {
+			continue
 		}
 
-		oldLines = append(oldLines, renderPaneLine(row, oldText, row.OldNo, oldNoWidth, leftWidth, cursor, true))
-		newLines = append(newLines, renderPaneLine(row, newText, row.NewNo, newNoWidth, rightWidth, cursor, false))
+		cursor := showCursor && idx == cursorRow
+		marker := hunkMarker(m, idx)
+		active := idx == m.HunkStart && m.HunkEnd > m.HunkStart
+		drawn := m.Cache.paneRow(lineKey{idx: idx, oldWidth: leftWidth, newWidth: rightWidth, cursor: cursor, active: active, fold: m.Folds[idx]}, func() paneRowLines {
+			if m.Wrap {
+				oldRow, newRow := renderWrappedRow(m, metrics, idx, cursor)
+				return paneRowLines{old: oldRow, new: newRow}
+			}
+			row := m.Rows[idx]
+			oldLine, newLine := rowPaneTexts(m, row)
+			oldText, newText := renderRowText(m, idx, oldLine, newLine)
+			return paneRowLines{
+				old: []string{renderPaneLine(t, row, oldText, row.OldNo, oldNoWidth, leftWidth, cursor, true)},
+				new: []string{renderPaneLine(t, row, newText, row.NewNo, newNoWidth, rightWidth, cursor, false)},
+			}
+		})
+		oldRow, newRow := drawn.old, drawn.new
+		if room := height - len(oldLines); len(oldRow) > room {
+			oldRow, newRow = oldRow[:room], newRow[:room]
+		}
+		for k := range oldRow {
+			oldMarker, newMarker := marker, marker
+			if k == 0 && m.BookmarkRows[idx] {
+				oldMarker = t.hunkMarker.Render(t.glyphs.bookmark)
+			}
+			if k == 0 && m.NoteRows[idx] {
+				newMarker = t.hunkMarker.Render(t.glyphs.note)
+			}
+			oldLines = append(oldLines, oldMarker+oldRow[k])
+			newLines = append(newLines, newMarker+newRow[k])
+		}
 	}
+	return oldLines, newLines
+}
 
-	return strings.Join(oldLines, "\n"), strings.Join(newLines, "\n")
+// hunkMarkerWidth is the pane column taken by the current hunk's marker.
+const hunkMarkerWidth = 1
+
+// hunkMarker is drawn in front of the cursor's row and outside its background,
+// so the cursor row keeps its own style.
+func hunkMarker(m RenderModel, idx int) string {
+	if idx >= m.HunkStart && idx < m.HunkEnd {
+		t := m.theme()
+		return t.hunkMarker.Render(t.glyphs.hunkMarker)
+	}
+	return " "
+}
+
+// rowPaneTexts prepares both sides of row for rendering.
+func rowPaneTexts(m RenderModel, row diff.Row) (paneText, paneText) {
+	glyphs := m.ShowWhitespace && row.Kind != diff.Meta && row.Kind != diff.HiddenMeta && row.Kind != diff.HunkHeader
+	if row.InvisibleChange {
+		oldText, _ := escapeInvisible(row.Old, row.InvisibleOld)
+		newText, _ := escapeInvisible(row.New, row.InvisibleNew)
+		return newPaneText(oldText, glyphs, m.TabWidth, m.theme()), newPaneText(newText, glyphs, m.TabWidth, m.theme())
+	}
+	return newPaneText(row.Old, glyphs, m.TabWidth, m.theme()), newPaneText(row.New, glyphs, m.TabWidth, m.theme())
+}
+
+// escapeInvisible writes the characters at ranges of line as codepoints, e.g.
+// "<U+200B>", and returns where each one ended up in the escaped text.
+func escapeInvisible(line string, ranges []diff.Range) (string, []diff.Range) {
+	var b strings.Builder
+	escaped := make([]diff.Range, 0, len(ranges))
+	pos := 0
+	for _, r := range ranges {
+		b.WriteString(line[pos:r.Start])
+		start := b.Len()
+		b.WriteString(diff.EscapeLookalike(line[r.Start:r.End]))
+		escaped = append(escaped, diff.Range{Start: start, End: b.Len()})
+		pos = r.End
+	}
+	b.WriteString(line[pos:])
+	return b.String(), escaped
+}
+
+// renderInvisibleChange draws an edit pair whose lines look alike in the
+// pane colors, with the escaped invisible characters that tell them apart
+// in the word highlight.
+func renderInvisibleChange(row diff.Row, oldLine, newLine paneText) (string, string) {
+	t := oldLine.theme
+	_, oldRanges := escapeInvisible(row.Old, row.InvisibleOld)
+	_, newRanges := escapeInvisible(row.New, row.InvisibleNew)
+	return renderMarked(oldLine, oldRanges, t.oldLine, t.oldWord), renderMarked(newLine, newRanges, t.newLine, t.newWord)
+}
+
+// renderMarked renders line in style, with the parts inside ranges in mark.
+func renderMarked(line paneText, ranges []diff.Range, style, mark lipgloss.Style) string {
+	var b strings.Builder
+	pos := 0
+	for _, r := range ranges {
+		b.WriteString(line.render(pos, r.Start, style))
+		b.WriteString(line.render(r.Start, r.End, mark))
+		pos = r.End
+	}
+	b.WriteString(line.render(pos, len(line.text), style))
+	return b.String()
+}
+
+// renderRowText styles both sides of row idx: word highlights or whole-line
+// colors for edit rows, syntax colors for context and the pane color for
+// everything else.
+func renderRowText(m RenderModel, idx int, oldLine, newLine paneText) (string, string) {
+	row := m.Rows[idx]
+	var syntax RowSyntax
+	// Syntax colors would bring back color a plain theme leaves out.
+	if idx < len(m.Syntax) && !m.theme().Plain() {
+		syntax = m.Syntax[idx]
+	}
+	switch {
+	case row.ConflictMarker:
+		t := m.theme()
+		return oldLine.render(0, len(row.Old), paneStyle(t, row, true)), newLine.render(0, len(row.New), t.conflict)
+	case row.InvisibleChange:
+		return renderInvisibleChange(row, oldLine, newLine)
+	case row.BaseOld || row.BaseNew:
+		return renderMergeSides(m, row, oldLine, newLine, syntax)
+	case isEditRow(row) && highlightsWords(m.Highlight, row):
+		return inlineHighlight(oldLine, newLine, syntax, row.WhitespaceErrors)
+	case isEditRow(row):
+		t := m.theme()
+		return oldLine.render(0, len(row.Old), t.oldLine),
+			renderWhitespaceErrors(newLine, 0, len(row.New), row.WhitespaceErrors, func(from, to int) string {
+				return newLine.render(from, to, t.newLine)
+			})
+	case row.Kind == diff.Context:
+		return renderSyntax(oldLine, 0, len(row.Old), syntax.Old, oldLine.theme.context),
+			renderSyntax(newLine, 0, len(row.New), syntax.New, newLine.theme.context)
+	default:
+		t := m.theme()
+		oldStyle := paneStyle(t, row, true)
+		newStyle := paneStyle(t, row, false)
+		if row.Kind == diff.HunkHeader && idx == m.HunkStart && m.HunkEnd > m.HunkStart {
+			oldStyle, newStyle = t.activeHunk, t.activeHunk
+		}
+		oldText := oldLine.render(0, len(row.Old), oldStyle)
+		newText := renderWhitespaceErrors(newLine, 0, len(row.New), row.WhitespaceErrors, func(from, to int) string {
+			return newLine.render(from, to, newStyle)
+		})
+		if fold, ok := m.Folds[idx]; ok && row.Kind == diff.HunkHeader {
+			summary := " " + t.meta.Render(fold.format(t.glyphs.minus))
+			if oldLine.endsText() {
+				oldText += summary
+			}
+			if newLine.endsText() {
+				newText += summary
+			}
+		}
+		return oldText, newText
+	}
+}
+
+// renderMergeSides draws a --merge conflict row with a side that kept its
+// line from BASE: that side reads as context, the other in its pane's color.
+func renderMergeSides(m RenderModel, row diff.Row, oldLine, newLine paneText, syntax RowSyntax) (string, string) {
+	t := m.theme()
+	oldText := renderSyntax(oldLine, 0, len(row.Old), syntax.Old, oldLine.theme.context)
+	if !row.BaseOld {
+		oldText = oldLine.render(0, len(row.Old), t.oldLine)
+	}
+	newText := renderSyntax(newLine, 0, len(row.New), syntax.New, newLine.theme.context)
+	if !row.BaseNew {
+		newText = newLine.render(0, len(row.New), t.newLine)
+	}
+	return oldText, newText
+}
+
+// keptFromBase reports whether the pane's side of row is a line a --merge
+// side kept from BASE.
+func keptFromBase(row diff.Row, oldPane bool) bool {
+	if oldPane {
+		return row.BaseOld
+	}
+	return row.BaseNew
 }
 
-func renderPaneLine(row diff.Row, text string, no *int, noWidth, width int, cursor bool, oldPane bool) string {
+func renderPaneLine(t *Theme, row diff.Row, text string, no *int, noWidth, width int, cursor bool, oldPane bool) string {
 	noText := ""
 	if no != nil {
 		noText = strconv.Itoa(*no)
 	}
-	style := paneStyle(row, oldPane)
-	text = style.Render(text)
-	line := formatPaneCell(noText, text, noWidth, width)
+	line := formatPaneCell(t, row, oldPane, noText, text, paneSuffix(t, row, oldPane), noWidth, width)
+	return finishPaneLine(t, row, line, oldPane, cursor)
+}
 
+// finishPaneLine draws the cursor over a laid-out pane line, or else the
+// theme's tint behind a changed one.
+func finishPaneLine(t *Theme, row diff.Row, line string, oldPane, cursor bool) string {
 	if cursor {
-		line = cursorStyle.Render(line)
+		return t.cursor.Render(line)
+	}
+	if tint, ok := t.lineTint(row, oldPane); ok {
+		return fillBackground(line, tint)
 	}
 	return line
 }
 
-func paneStyle(row diff.Row, oldPane bool) lipgloss.Style {
+// fillBackground paints style's background across all of line, padding
+// included. Every reset inside line reopens style, so the styled pieces keep
+// it behind them unless they set a background of their own.
+func fillBackground(line string, style lipgloss.Style) string {
+	open, _, ok := strings.Cut(style.Render("x"), "x")
+	if !ok || open == "" {
+		return line
+	}
+	return open + strings.ReplaceAll(line, sgrReset, sgrReset+open) + sgrReset
+}
+
+// paneSuffix returns the line-ending badges shown after one side of row.
+func paneSuffix(t *Theme, row diff.Row, oldPane bool) string {
+	suffix := ""
+	if diff.LineEndingChanged(row) && ((oldPane && row.CRLFOld) || (!oldPane && row.CRLFNew)) {
+		suffix += lineEndBadge(t, "CR", oldPane)
+	}
+	if (oldPane && row.NoNewlineOld) || (!oldPane && row.NoNewlineNew) {
+		suffix += noNewlineBadge(t, oldPane)
+	}
+	return suffix
+}
+
+func paneStyle(t *Theme, row diff.Row, oldPane bool) lipgloss.Style {
 	switch row.Kind {
-	case diff.Meta:
-		return metaStyle
-	case diff.Hunk:
-		return hunkStyle
+	case diff.Meta, diff.HiddenMeta:
+		return t.meta
+	case diff.HunkHeader:
+		return t.hunk
 	case diff.Context:
-		return contextStyle
+		return t.context
 	}
 
 	if oldPane {
 		if isPureDeletion(row) {
-			return oldLineStyle
+			return t.oldLine
 		}
 		if isEditRow(row) {
-			return contextStyle
+			return t.context
 		}
-		return contextStyle
+		return t.context
 	}
 
 	if isPureAddition(row) {
-		return newLineStyle
+		return t.newLine
 	}
 	if isEditRow(row) {
-		return contextStyle
+		return t.context
 	}
-	return contextStyle
+	return t.context
 }
 
 func lineNumberWidth(rows []diff.Row, old bool) int {
@@ -433,46 +1616,168 @@ func lineNumberWidth(rows []diff.Row, old bool) int {
 	return width
 }
 
-func calcSidebarWidth(totalWidth int) int {
-	width := 34
-	if totalWidth < 90 {
-		width = 30
-	}
-	if totalWidth > 140 {
-		width = 38
+// SidebarEntry is one row of the sidebar's tree view: a directory, or a file
+// shown by its basename under its parent.
+type SidebarEntry struct {
+	// Path is the file's full path, or the directory's without a trailing slash.
+	Path string
+	// Name is the displayed basename. A directory holding only one
+	// subdirectory is merged with it, e.g. "internal/server".
+	Name      string
+	Depth     int
+	Dir       bool
+	Collapsed bool
+	// Status is the file's status; for a directory it is the status shared by
+	// every file below it, or "" when they differ.
+	Status string
+	// Totals is the diffstat of the files below a directory.
+	Totals DiffTotals
+}
+
+// FilesTitle is the sidebar's default title.
+const FilesTitle = "FILES CHANGED"
+
+// MinSidebarWidth is the narrowest the sidebar can be resized to.
+const MinSidebarWidth = 16
+
+// SidebarWidth returns the sidebar width for a terminal totalWidth columns
+// wide. A preferred width of zero is picked from the terminal width; any width
+// is clamped so the panes keep at least 20 columns, which lets a chosen width
+// survive the terminal shrinking and growing back.
+func SidebarWidth(totalWidth, preferred int) int {
+	width := preferred
+	if width <= 0 {
+		width = defaultSidebarWidth(totalWidth)
 	}
 	maxAllowed := totalWidth - 20
-	if maxAllowed < 16 {
-		maxAllowed = 16
+	if maxAllowed < MinSidebarWidth {
+		maxAllowed = MinSidebarWidth
 	}
 	if width > maxAllowed {
 		width = maxAllowed
 	}
-	if width < 16 {
-		width = 16
+	if width < MinSidebarWidth {
+		width = MinSidebarWidth
 	}
 	return width
 }
 
+func defaultSidebarWidth(totalWidth int) int {
+	if totalWidth < 90 {
+		return 30
+	}
+	if totalWidth > 140 {
+		return 38
+	}
+	return 34
+}
+
 func fitWidth(s string, width int) string {
 	if width <= 0 {
 		return ""
 	}
-	return lipgloss.NewStyle().MaxWidth(width).Width(width).Render(s)
+	// Lines that are already exactly width wide, as most are by the time
+	// fitBlock sees them, come back unchanged.
+	if !strings.ContainsAny(s, "\t\n") && lipgloss.Width(s) == width {
+		return s
+	}
+	return fitWidthSlow(s, width)
 }
 
-func formatPaneCell(noText, text string, noWidth, width int) string {
-	prefix := fmt.Sprintf("%*s ", noWidth, noText)
-	contentWidth := width - lipgloss.Width(prefix)
+// fitWidthSlow cuts or pads each line of s to exactly width cells, with
+// tabs drawn as four spaces as lipgloss draws them.
+func fitWidthSlow(s string, width int) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		line = strings.ReplaceAll(line, "\t", "    ")
+		lines[i] = padWidth(truncateWidth(line, width), width)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sgrReset is the escape sequence that ends a lipgloss style.
+const sgrReset = "\x1b[0m"
+
+// formatPaneCell lays out a line number with its gutter marker, text and an
+// optional suffix badge. Lines without a number, such as wrapped continuations,
+// leave the gutter blank. The text is clipped first so the badge stays visible
+// on long lines, and a clipped line ends in "…" so hidden content is not
+// mistaken for the end of the line. Panes do not scroll sideways, so only the
+// right edge is ever marked.
+func formatPaneCell(t *Theme, row diff.Row, oldPane bool, noText, text, suffix string, noWidth, width int) string {
+	prefix := fmt.Sprintf("%*s", noWidth, noText)
+	gutter := " "
+	if noText != "" {
+		gutter = gutterMarker(t, row, oldPane)
+		if isEditPair(row) && !keptFromBase(row, oldPane) && !t.Plain() {
+			prefix = t.edited.Render(prefix)
+		}
+	}
+	prefix += gutter
+	contentWidth := width - lipgloss.Width(prefix) - lipgloss.Width(suffix)
 	if contentWidth < 0 {
 		contentWidth = 0
 	}
-	text = lipgloss.NewStyle().MaxWidth(contentWidth).Render(text)
-	return fitWidth(prefix+text, width)
+	if contentWidth > 0 && lipgloss.Width(text) > contentWidth {
+		// A wide character cut at the edge leaves a cell, filled after the
+		// "…" so the badge stays in its column.
+		text = padWidth(truncateWidth(text, contentWidth-1)+t.truncated.Render(t.glyphs.more), contentWidth)
+	}
+	text = truncateWidth(text, contentWidth)
+	return fitWidth(prefix+text+suffix, width)
+}
+
+// noNewlineBadge marks a line missing its trailing newline. The badge takes the
+// pane's removal/addition color so "newline added" (badge on OLD) and "newline
+// removed" (badge on NEW) read differently at a glance.
+func noNewlineBadge(t *Theme, oldPane bool) string {
+	return lineEndBadge(t, t.glyphs.noNewline, oldPane)
+}
+
+// lineEndBadge renders a line-ending marker such as the "CR" of a line whose
+// only change is LF↔CRLF, in the pane's removal/addition color.
+func lineEndBadge(t *Theme, label string, oldPane bool) string {
+	if oldPane {
+		return " " + t.oldNoNewline.Render(label)
+	}
+	return " " + t.newNoNewline.Render(label)
+}
+
+// gutterMarker is the column between a line number and its text: ~ on both
+// sides of an edited line, and + or - on added and removed lines when the
+// theme is plain, so changes read without color.
+func gutterMarker(t *Theme, row diff.Row, oldPane bool) string {
+	if keptFromBase(row, oldPane) {
+		return " "
+	}
+	if !t.Plain() {
+		if isEditPair(row) {
+			return t.edited.Render("~")
+		}
+		return " "
+	}
+	switch {
+	case isEditPair(row):
+		return "~"
+	case oldPane && isPureDeletion(row):
+		return "-"
+	case !oldPane && isPureAddition(row):
+		return "+"
+	}
+	return " "
+}
+
+// isEditPair reports whether row pairs a removed line with the line that
+// replaced it: both sides numbered, with different text.
+func isEditPair(row diff.Row) bool {
+	if row.Kind == diff.Meta || row.Kind == diff.HiddenMeta || row.Kind == diff.HunkHeader || row.Kind == diff.Context {
+		return false
+	}
+	return row.OldNo != nil && row.NewNo != nil && row.Old != row.New
 }
 
 func isEditRow(row diff.Row) bool {
-	if row.Kind == diff.Meta || row.Kind == diff.Hunk {
+	if row.Kind == diff.Meta || row.Kind == diff.HiddenMeta || row.Kind == diff.HunkHeader {
 		return false
 	}
 	if row.Old == "" || row.New == "" {
@@ -481,26 +1786,210 @@ func isEditRow(row diff.Row) bool {
 	return row.Old != row.New
 }
 
-func inlineHighlight(oldText, newText string) (string, string) {
-	ops := diff.DiffTokens(diff.Tokenize(oldText), diff.Tokenize(newText))
+// highlightsWords reports whether edit row marks its changed words under h.
+func highlightsWords(h ChangeHighlight, row diff.Row) bool {
+	switch h {
+	case HighlightLines:
+		return false
+	case HighlightAuto:
+		return diff.SimilarityTokens(diff.Tokenize(strings.TrimSpace(row.Old)), diff.Tokenize(strings.TrimSpace(row.New))) >= rewrittenBelow
+	}
+	return true
+}
+
+// inlineHighlight marks the changed words of an edit row. Unchanged words take
+// syntax colors when spans are available and the pane's red/green otherwise.
+// Whitespace errors on the new side are drawn over either.
+func inlineHighlight(oldLine, newLine paneText, syntax RowSyntax, wsErrors []diff.Range) (string, string) {
+	ops := diff.DiffTokens(diff.Tokenize(oldLine.text), diff.Tokenize(newLine.text))
+	t := oldLine.theme
 	var oldBuilder strings.Builder
 	var newBuilder strings.Builder
+	oldPos, newPos := 0, 0
 
 	for _, op := range ops {
 		switch op.Kind {
 		case diff.Equal:
-			oldBuilder.WriteString(oldLineStyle.Render(op.Tok))
-			newBuilder.WriteString(newLineStyle.Render(op.Tok))
+			oldBuilder.WriteString(renderEqualToken(oldLine, oldPos, oldPos+len(op.Tok), syntax.Old, t.oldLine))
+			newBuilder.WriteString(renderWhitespaceErrors(newLine, newPos, newPos+len(op.Tok), wsErrors, func(from, to int) string {
+				return renderEqualToken(newLine, from, to, syntax.New, t.newLine)
+			}))
+			oldPos += len(op.Tok)
+			newPos += len(op.Tok)
 		case diff.Delete:
-			oldBuilder.WriteString(oldWordHighlight.Render(op.Tok))
+			oldBuilder.WriteString(oldLine.render(oldPos, oldPos+len(op.Tok), t.oldWord))
+			oldPos += len(op.Tok)
 		case diff.Insert:
-			newBuilder.WriteString(newWordHighlight.Render(op.Tok))
+			newBuilder.WriteString(renderWhitespaceErrors(newLine, newPos, newPos+len(op.Tok), wsErrors, func(from, to int) string {
+				return newLine.render(from, to, t.newWord)
+			}))
+			newPos += len(op.Tok)
 		}
 	}
 
 	return oldBuilder.String(), newBuilder.String()
 }
 
+// renderWhitespaceErrors renders line[start:end], painting the parts inside
+// ranges with the error background and passing the rest to render.
+func renderWhitespaceErrors(line paneText, start, end int, ranges []diff.Range, render func(from, to int) string) string {
+	var b strings.Builder
+	pos := start
+	for _, r := range ranges {
+		if r.End <= pos || r.Start >= end {
+			continue
+		}
+		from, to := r.Start, r.End
+		if from < pos {
+			from = pos
+		}
+		if to > end {
+			to = end
+		}
+		if from > pos {
+			b.WriteString(render(pos, from))
+		}
+		b.WriteString(line.render(from, to, line.theme.whitespaceError))
+		pos = to
+	}
+	if pos < end {
+		b.WriteString(render(pos, end))
+	}
+	return b.String()
+}
+
+func renderEqualToken(line paneText, from, to int, spans []Span, fallback lipgloss.Style) string {
+	if spans == nil {
+		return line.render(from, to, fallback)
+	}
+	return renderSyntax(line, from, to, spans, line.theme.context)
+}
+
+// paneText is one side of a row as it is rendered. Tabs expand to the next
+// tab stop, and with glyphs enabled tabs, trailing spaces and non-breaking
+// spaces are drawn as visible symbols. The substitution happens per rendered
+// piece, after word-diff tokenization, so byte offsets into text stay valid.
+type paneText struct {
+	text     string
+	glyphs   bool
+	tabWidth int
+	theme    *Theme
+	// lo and hi limit rendering to one visual line of a wrapped row.
+	lo, hi int
+	// trailing is the offset where the line's trailing whitespace begins.
+	trailing int
+}
+
+func newPaneText(text string, glyphs bool, tabWidth int, theme *Theme) paneText {
+	if tabWidth <= 0 {
+		tabWidth = DefaultTabWidth
+	}
+	line := paneText{text: text, glyphs: glyphs, tabWidth: tabWidth, theme: theme, hi: len(text), trailing: len(text)}
+	if glyphs {
+		line.trailing = len(strings.TrimRight(text, " \t"))
+	}
+	return line
+}
+
+// endsText reports whether line is the visual line its text ends on.
+func (p paneText) endsText() bool {
+	return p.hi == len(p.text) && (p.lo < p.hi || p.lo == 0)
+}
+
+// column returns the display column at which text[i] starts.
+func (l paneText) column(i int) int {
+	col := 0
+	rest := l.text[:i]
+	for {
+		tab := strings.IndexByte(rest, '\t')
+		if tab < 0 {
+			return col + lipgloss.Width(diff.EscapeControl(rest))
+		}
+		col += lipgloss.Width(diff.EscapeControl(rest[:tab]))
+		col += l.tabWidth - col%l.tabWidth
+		rest = rest[tab+1:]
+	}
+}
+
+// render styles text[from:to], drawing whitespace glyphs in the dim meta color
+// over the piece's own background. Control characters are always escaped.
+func (l paneText) render(from, to int, style lipgloss.Style) string {
+	if from < l.lo {
+		from = l.lo
+	}
+	if to > l.hi {
+		to = l.hi
+	}
+	if from >= to {
+		return ""
+	}
+	piece := l.text[from:to]
+	if !strings.Contains(piece, "\t") && (!l.glyphs || !strings.ContainsAny(piece, " \u00a0")) {
+		return style.Render(diff.EscapeControl(piece))
+	}
+
+	var b strings.Builder
+	var glyphStyle *lipgloss.Style
+	col := l.column(from)
+	start := from
+	flush := func(end int) {
+		if start < end {
+			text := diff.EscapeControl(l.text[start:end])
+			b.WriteString(style.Render(text))
+			col += lipgloss.Width(text)
+		}
+	}
+	for i := from; i < to; {
+		glyph, size := "", 1
+		if l.text[i] == '\t' || l.glyphs {
+			glyph, size = whitespaceGlyph(l.theme.glyphs, l.text, i, i >= l.trailing)
+		}
+		if glyph == "" {
+			i++
+			continue
+		}
+		flush(i)
+
+		width := 1
+		if l.text[i] == '\t' {
+			width = l.tabWidth - col%l.tabWidth
+			if !l.glyphs {
+				glyph = " "
+			}
+			glyph += strings.Repeat(" ", width-1)
+		}
+		if !l.glyphs {
+			b.WriteString(style.Render(glyph))
+		} else {
+			if glyphStyle == nil {
+				s := style.Copy().Foreground(l.theme.meta.GetForeground())
+				glyphStyle = &s
+			}
+			b.WriteString(glyphStyle.Render(glyph))
+		}
+		col += width
+		i += size
+		start = i
+	}
+	flush(to)
+	return b.String()
+}
+
+// whitespaceGlyph returns the symbol for the whitespace at text[i] and its byte
+// length, or "" when the byte is drawn as is.
+func whitespaceGlyph(g glyphSet, text string, i int, trailing bool) (string, int) {
+	switch {
+	case text[i] == '\t':
+		return g.tab, 1
+	case text[i] == ' ' && trailing:
+		return g.trailing, 1
+	case strings.HasPrefix(text[i:], "\u00a0"):
+		return g.nbsp, len("\u00a0")
+	default:
+		return "", 0
+	}
+}
+
 func isPureDeletion(row diff.Row) bool {
 	return row.OldNo != nil && row.NewNo == nil
 }
@@ -0,0 +1,1050 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+func TestRender_TooSmall(t *testing.T) {
+	sizes := []struct{ width, height int }{{1, 1}, {20, 5}, {42, 8}, {59, 40}, {200, 14}}
+	for _, size := range sizes {
+		m := RenderModel{Width: size.width, Height: size.height, Files: []string{"a.go"}}
+		got := Render(m)
+		if again := Render(m); again != got {
+			t.Fatalf("%dx%d: output not stable", size.width, size.height)
+		}
+		lines := strings.Split(got, "\n")
+		if len(lines) != size.height {
+			t.Fatalf("%dx%d: got %d lines", size.width, size.height, len(lines))
+		}
+		for _, line := range lines {
+			if w := lipgloss.Width(line); w > size.width {
+				t.Fatalf("%dx%d: line %q is %d wide", size.width, size.height, line, w)
+			}
+		}
+		if size.height >= 3 && !strings.Contains(strings.Join(strings.Fields(got), " "), "too small") {
+			t.Fatalf("%dx%d: missing notice in %q", size.width, size.height, got)
+		}
+	}
+}
+
+func TestRender_MinimumSizeDrawsPanes(t *testing.T) {
+	got := Render(RenderModel{Width: MinWidth, Height: MinHeight, Files: []string{"a.go"}})
+	if strings.Contains(got, "too small") {
+		t.Fatalf("minimum size should render normally, got %q", got)
+	}
+	if n := strings.Count(got, "\n") + 1; n != MinHeight {
+		t.Fatalf("got %d lines, want %d", n, MinHeight)
+	}
+}
+
+func TestRenderHints_DropsWholeHints(t *testing.T) {
+	m := RenderModel{Width: 120, Focus: FocusFiles}
+	if got := strings.TrimSpace(renderHints(m, 120)); got != "↑/↓ select · enter diff · s mode · a algo · q quit" {
+		t.Fatalf("unexpected hints %q", got)
+	}
+	if got := strings.TrimSpace(renderHints(m, 30)); got != "↑/↓ select · enter diff · …" {
+		t.Fatalf("unexpected truncated hints %q", got)
+	}
+}
+
+func TestRender_HintsKeepHeight(t *testing.T) {
+	got := Render(RenderModel{Width: 100, Height: 20, Files: []string{"a.go"}, ShowHints: true})
+	lines := strings.Split(got, "\n")
+	if len(lines) != 20 {
+		t.Fatalf("got %d lines, want 20", len(lines))
+	}
+	if !strings.Contains(lines[19], "q quit") {
+		t.Fatalf("last line should hold hints, got %q", lines[19])
+	}
+}
+
+func TestRenderHeader_DropsLowPrioritySegmentsFirst(t *testing.T) {
+	m := RenderModel{
+		Width:        200,
+		ModeLabel:    "worktree",
+		AlgoLabel:    "histogram",
+		Files:        []string{"a.go", "b.go"},
+		Selected:     1,
+		SelectedFile: "b.go",
+		Rows:         make([]diff.Row, 40),
+		Cursor:       9,
+		HunkIndex:    1,
+		HunkCount:    3,
+		FuncContext:  "func main()",
+		Error:        "exit status 128",
+	}
+	got := renderHeader(m)
+	want := "TDiff | mode: WORKTREE | algo: histogram | focus: files | file 2/2 | file: b.go | L 10/40 · hunk 2/3 | in func main() | error: exit status 128"
+	if got != want {
+		t.Fatalf("got %q\nwant %q", got, want)
+	}
+
+	m.Width = 70
+	if got := renderHeader(m); got != "TDiff | mode: WORKTREE | focus: files | error: exit status 128" {
+		t.Fatalf("narrow header %q", got)
+	}
+
+	m.DiffLoading = true
+	m.Width = 200
+	if got := renderHeader(m); strings.Contains(got, "L 10/40") {
+		t.Fatalf("position shown while loading: %q", got)
+	}
+}
+
+func TestRenderHeader_RepoAndState(t *testing.T) {
+	m := RenderModel{Width: 200, ModeLabel: "worktree", AlgoLabel: "histogram", Repo: "tdiff@main", RepoState: "MERGING"}
+	if got, want := renderHeader(m), "TDiff | tdiff@main | MERGING | mode: WORKTREE | algo: histogram | focus: files"; got != want {
+		t.Fatalf("got %q\nwant %q", got, want)
+	}
+	m.Width = 50
+	if got, want := renderHeader(m), "TDiff | MERGING | mode: WORKTREE | focus: files"; got != want {
+		t.Fatalf("narrow header %q, want %q", got, want)
+	}
+}
+
+func TestScrollThumb(t *testing.T) {
+	cases := []struct {
+		track, total, visible, offset int
+		start, size                   int
+		ok                            bool
+	}{
+		{track: 10, total: 5, visible: 10, offset: 0, ok: false},
+		{track: 10, total: 10, visible: 10, offset: 0, ok: false},
+		{track: 10, total: 100, visible: 10, offset: 0, start: 0, size: 1, ok: true},
+		{track: 10, total: 100, visible: 10, offset: 90, start: 9, size: 1, ok: true},
+		{track: 10, total: 20, visible: 10, offset: 5, start: 3, size: 5, ok: true},
+		{track: 10, total: 20, visible: 10, offset: 50, start: 5, size: 5, ok: true},
+	}
+	for _, c := range cases {
+		start, size, ok := scrollThumb(c.track, c.total, c.visible, c.offset)
+		if ok != c.ok || (ok && (start != c.start || size != c.size)) {
+			t.Fatalf("scrollThumb(%d, %d, %d, %d) = %d, %d, %v; want %d, %d, %v",
+				c.track, c.total, c.visible, c.offset, start, size, ok, c.start, c.size, c.ok)
+		}
+	}
+}
+
+func TestRender_ScrollbarOnlyWhenOverflowing(t *testing.T) {
+	m := RenderModel{Width: 100, Height: 30, Files: []string{"a.go"}, Rows: make([]diff.Row, 5)}
+	if got := Render(m); strings.Contains(got, scrollbarThumb) {
+		t.Fatalf("short diff should have no scrollbar")
+	}
+	m.Rows = make([]diff.Row, 500)
+	got := Render(m)
+	if !strings.Contains(got, scrollbarThumb) {
+		t.Fatalf("long diff should have a scrollbar")
+	}
+	for _, line := range strings.Split(got, "\n") {
+		if w := lipgloss.Width(line); w != m.Width {
+			t.Fatalf("line %q is %d wide, want %d", line, w, m.Width)
+		}
+	}
+}
+
+var sgrRE = regexp.MustCompile(`\x1b\[([0-9;]*)m`)
+
+func TestSidebarRow_SelectedModifiedFileEscapes(t *testing.T) {
+	profile, dark := lipgloss.ColorProfile(), lipgloss.HasDarkBackground()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	lipgloss.SetHasDarkBackground(true)
+	defer lipgloss.SetColorProfile(profile)
+	defer lipgloss.SetHasDarkBackground(dark)
+
+	line := sidebarFileRow(&DefaultTheme, "main.go", "M").render(20, true, true)
+
+	if rest := sgrRE.ReplaceAllString(line, ""); strings.Contains(rest, "\x1b") {
+		t.Fatalf("malformed escape sequence in %q", line)
+	} else if rest != "●[M] main.go        " {
+		t.Fatalf("got text %q", rest)
+	}
+	// Every styled segment is closed before the next one opens, so no color is
+	// nested inside the selection's reverse video.
+	open := false
+	labelColored := false
+	for _, match := range sgrRE.FindAllStringSubmatch(line, -1) {
+		params := match[1]
+		if params == "0" || params == "" {
+			open = false
+			continue
+		}
+		if open {
+			t.Fatalf("nested escape sequence %q in %q", params, line)
+		}
+		open = true
+		fields := strings.Split(params, ";")
+		if containsString(fields, "7") && containsString(fields, "33") {
+			labelColored = true
+		}
+	}
+	if open {
+		t.Fatalf("unterminated style in %q", line)
+	}
+	if !labelColored {
+		t.Fatalf("selected label lost its status color: %q", line)
+	}
+}
+
+func TestSidebarRow_StatusLabelsAreColored(t *testing.T) {
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	defer lipgloss.SetColorProfile(profile)
+
+	labelSGR := map[string]string{}
+	for _, status := range []string{"A", "D", "M", "R", "?"} {
+		line := sidebarFileRow(&DefaultTheme, "f.go", status).render(30, false, false)
+		if rest := sgrRE.ReplaceAllString(line, ""); !strings.HasPrefix(rest, "["+statusLabel(status)+"] f.go") || lipgloss.Width(line) != 30 {
+			t.Fatalf("%s row %q", status, rest)
+		}
+		match := sgrRE.FindStringSubmatch(line)
+		if match == nil || strings.Index(line, match[0]) != 0 {
+			t.Fatalf("%s label is not colored: %q", status, line)
+		}
+		for other, sgr := range labelSGR {
+			if sgr == match[1] {
+				t.Fatalf("%s and %s labels share the style %q", status, other, sgr)
+			}
+		}
+		labelSGR[status] = match[1]
+	}
+	// Deleted files are struck through so they read as gone without color.
+	deleted := sidebarFileRow(&DefaultTheme, "f.go", "D").render(30, false, false)
+	var struck bool
+	for _, match := range sgrRE.FindAllStringSubmatch(deleted, -1) {
+		struck = struck || containsString(strings.Split(match[1], ";"), "9")
+	}
+	if !struck {
+		t.Fatalf("deleted name is not struck through: %q", deleted)
+	}
+	if got, want := sidebarFileRow(&DefaultTheme, "f.go", "Z").labelStyle.Render("x"), DefaultTheme.status["M"].Render("x"); got != want {
+		t.Fatalf("unknown status styled %q, want the modified style %q", got, want)
+	}
+}
+
+func containsString(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRender_EveryBuiltinTheme(t *testing.T) {
+	one := 1
+	rows := []diff.Row{
+		{Old: "@@ -1 +1 @@", New: "@@ -1 +1 @@", Kind: diff.HunkHeader},
+		{Old: "old line", New: "new line", OldNo: &one, NewNo: &one, Kind: diff.Context},
+	}
+	for _, theme := range BuiltinThemes() {
+		theme := theme
+		got := Render(RenderModel{Width: 100, Height: 20, Files: []string{"a.go"}, FileStatuses: map[string]string{"a.go": "M"}, Rows: rows, Theme: &theme})
+		if n := strings.Count(got, "\n") + 1; n != 20 {
+			t.Fatalf("%s: got %d lines", theme.Name, n)
+		}
+		if theme.Name != DefaultTheme.Name && !strings.Contains(got, "theme: "+theme.Name) {
+			t.Fatalf("%s: header does not name the theme", theme.Name)
+		}
+	}
+}
+
+func TestCustomTheme_RejectsBadColors(t *testing.T) {
+	if _, err := CustomTheme("mine", "gruvbox", map[string]string{"old": "#cc0000", "cursor": "235"}); err != nil {
+		t.Fatalf("valid theme rejected: %v", err)
+	}
+	bad := []struct {
+		base   string
+		colors map[string]string
+	}{
+		{"nope", nil},
+		{"monochrome", nil},
+		{"", map[string]string{"olde": "1"}},
+		{"", map[string]string{"old": "red"}},
+		{"", map[string]string{"old": "256"}},
+		{"", map[string]string{"tint": "maybe"}},
+	}
+	for _, c := range bad {
+		if _, err := CustomTheme("mine", c.base, c.colors); err == nil {
+			t.Fatalf("CustomTheme(base %q, %v) should fail", c.base, c.colors)
+		}
+	}
+}
+
+func TestRenderPaneLine_TintFillsChangedLines(t *testing.T) {
+	profile, dark := lipgloss.ColorProfile(), lipgloss.HasDarkBackground()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	lipgloss.SetHasDarkBackground(true)
+	defer lipgloss.SetColorProfile(profile)
+	defer lipgloss.SetHasDarkBackground(dark)
+
+	theme, err := CustomTheme("delta", "default", map[string]string{"tint": "true", "new-tint": "22"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := 1
+	added := diff.Row{New: "fresh", NewNo: &one, Kind: diff.Add}
+	context := diff.Row{Old: "same", New: "same", OldNo: &one, NewNo: &one, Kind: diff.Context}
+	const width = 20
+	tinted := func(line string) bool {
+		return strings.HasPrefix(line, "\x1b[48;5;22m") && strings.HasSuffix(line, sgrReset)
+	}
+
+	line := renderPaneLine(&theme, added, theme.newLine.Render("fresh"), added.NewNo, 3, width, false, false)
+	if !tinted(line) || lipgloss.Width(line) != width {
+		t.Fatalf("added line %q is not tinted across the pane", line)
+	}
+	// The text's own style ends in a reset; the tint reopens behind the padding.
+	if parts := strings.Split(line, sgrReset); !strings.HasPrefix(parts[1], "\x1b[48;5;22m") {
+		t.Fatalf("tint not reopened after the text in %q", line)
+	}
+	if line := renderPaneLine(&theme, added, "fresh", added.NewNo, 3, width, true, false); tinted(line) {
+		t.Fatalf("cursor row %q kept the tint", line)
+	}
+	if line := renderPaneLine(&theme, context, "same", context.NewNo, 3, width, false, false); tinted(line) {
+		t.Fatalf("context row %q is tinted", line)
+	}
+	if line := renderPaneLine(&DefaultTheme, added, "fresh", added.NewNo, 3, width, false, false); tinted(line) {
+		t.Fatalf("default theme tints: %q", line)
+	}
+}
+
+func TestTheme_AdaptsToBackground(t *testing.T) {
+	profile, dark := lipgloss.ColorProfile(), lipgloss.HasDarkBackground()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	defer lipgloss.SetColorProfile(profile)
+	defer lipgloss.SetHasDarkBackground(dark)
+
+	render := func(darkBackground bool) string {
+		lipgloss.SetHasDarkBackground(darkBackground)
+		return DefaultTheme.cursor.Render("x") + DefaultTheme.newWord.Render("x")
+	}
+	onDark, onLight := render(true), render(false)
+	if !strings.Contains(onDark, "48;5;236") || !strings.Contains(onDark, "48;5;28") {
+		t.Fatalf("dark background: got %q", onDark)
+	}
+	if !strings.Contains(onLight, "48;5;254") || !strings.Contains(onLight, "48;5;157") {
+		t.Fatalf("light background: got %q", onLight)
+	}
+}
+
+func TestPalettes_SetEveryColor(t *testing.T) {
+	for name, p := range palettes {
+		p := p
+		for key, field := range paletteKeys {
+			if *field(&p) == nil {
+				t.Errorf("palette %s leaves %s unset", name, key)
+			}
+		}
+	}
+	for _, name := range []string{"high-contrast", "colorblind"} {
+		if _, ok := palettes[name]; !ok {
+			t.Errorf("missing built-in palette %s", name)
+		}
+	}
+}
+
+func TestGutterMarker_OnlyWithoutColor(t *testing.T) {
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	defer lipgloss.SetColorProfile(profile)
+
+	one := 1
+	deleted := diff.Row{Old: "gone", OldNo: &one, Kind: diff.Del}
+	edited := diff.Row{Old: "a", New: "b", OldNo: &one, NewNo: &one, Kind: diff.Add}
+	added := diff.Row{New: "new", NewNo: &one, Kind: diff.Add}
+
+	if got := gutterMarker(&DefaultTheme, deleted, true); got != " " {
+		t.Fatalf("color theme marker = %q, want none", got)
+	}
+	// Edited lines are marked in every theme, in color where there is some.
+	emptied := diff.Row{Old: "x", OldNo: &one, NewNo: &one, Kind: diff.Add}
+	for _, row := range []diff.Row{edited, emptied} {
+		cell := formatPaneCell(&DefaultTheme, row, false, "1", row.New, "", 3, 10)
+		if got := sgrRE.ReplaceAllString(cell, ""); got != fmt.Sprintf("%-10s", "  1~"+row.New) {
+			t.Fatalf("edited cell %q", got)
+		}
+		if cell == sgrRE.ReplaceAllString(cell, "") {
+			t.Fatalf("edited cell %q has no color", cell)
+		}
+	}
+	if got := sgrRE.ReplaceAllString(formatPaneCell(&DefaultTheme, edited, false, "", "b", "", 3, 10), ""); got != "    b     " {
+		t.Fatalf("continuation cell %q kept the marker", got)
+	}
+	// In --merge, the side that kept BASE's line is left unmarked.
+	kept := diff.Row{Old: "keep", New: "remote edit", OldNo: &one, NewNo: &one, Kind: diff.Add, BaseOld: true}
+	mono := MonochromeTheme()
+	for _, tc := range []struct {
+		row     diff.Row
+		oldPane bool
+		want    string
+	}{
+		{deleted, true, "-"},
+		{added, false, "+"},
+		{edited, true, "~"},
+		{edited, false, "~"},
+		{kept, true, " "},
+		{kept, false, "~"},
+	} {
+		if got := gutterMarker(&mono, tc.row, tc.oldPane); got != tc.want {
+			t.Fatalf("monochrome marker for %+v = %q, want %q", tc.row, got, tc.want)
+		}
+	}
+
+	lipgloss.SetColorProfile(termenv.Ascii)
+	if got := gutterMarker(&DefaultTheme, deleted, true); got != "-" {
+		t.Fatalf("marker without color profile = %q, want -", got)
+	}
+}
+
+func TestRenderRowText_ChangeHighlight(t *testing.T) {
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	defer lipgloss.SetColorProfile(profile)
+
+	one := 1
+	small := diff.Row{Old: "total := a + b", New: "total := a + c", OldNo: &one, NewNo: &one, Kind: diff.Add}
+	rewritten := diff.Row{Old: "return nil", New: "log.Fatal(err)", OldNo: &one, NewNo: &one, Kind: diff.Add}
+	whole := func(row diff.Row) (string, string) {
+		return DefaultTheme.oldLine.Render(row.Old), DefaultTheme.newLine.Render(row.New)
+	}
+	for _, tc := range []struct {
+		highlight ChangeHighlight
+		row       diff.Row
+		words     bool
+	}{
+		{HighlightWords, rewritten, true},
+		{HighlightLines, small, false},
+		{HighlightAuto, small, true},
+		{HighlightAuto, rewritten, false},
+	} {
+		m := RenderModel{Rows: []diff.Row{tc.row}, Highlight: tc.highlight}
+		oldLine, newLine := rowPaneTexts(m, tc.row)
+		gotOld, gotNew := renderRowText(m, 0, oldLine, newLine)
+		wantOld, wantNew := whole(tc.row)
+		if isWhole := gotOld == wantOld && gotNew == wantNew; isWhole == tc.words {
+			t.Errorf("%s highlight of %q: whole lines %v, want %v", tc.highlight, tc.row.New, isWhole, !tc.words)
+		}
+	}
+}
+
+func TestRenderPanes_FoldedHunkShowsHeaderAndSummary(t *testing.T) {
+	one, two := 1, 2
+	rows := []diff.Row{
+		{Old: "@@ -1 +1 @@", New: "@@ -1 +1 @@", Kind: diff.HunkHeader},
+		{OldNo: &one, NewNo: &one, Old: "hidden old", New: "hidden new", Kind: diff.Add},
+		{NewNo: &two, New: "hidden add", Kind: diff.Add},
+		{Old: "@@ -9 +10 @@", New: "@@ -9 +10 @@", Kind: diff.HunkHeader},
+	}
+	m := RenderModel{
+		Rows:   rows,
+		Hidden: []bool{false, true, true, false},
+		Folds:  map[int]Fold{0: {Added: 2, Deleted: 1}},
+	}
+	oldPane, newPane := renderPanes(m, 40, 40, 6)
+	if strings.Contains(oldPane+newPane, "hidden") {
+		t.Fatalf("folded rows drawn:\n%s\n%s", oldPane, newPane)
+	}
+	lines := strings.Split(newPane, "\n")
+	if !strings.Contains(lines[1], "@@ -1 +1 @@ (+2 −1)") || !strings.Contains(lines[2], "@@ -9 +10 @@") {
+		t.Fatalf("NEW pane %q, want the folded header with its summary and then the next hunk", lines)
+	}
+	if metrics := NewRowMetrics(m); metrics.Height(1) != 0 || metrics.Height(0) != 1 {
+		t.Fatalf("heights %d %d", metrics.Height(0), metrics.Height(1))
+	}
+}
+
+func TestRender_ASCIITheme(t *testing.T) {
+	one := 1
+	rows := []diff.Row{
+		{Old: "@@ -1 +1 @@", New: "@@ -1 +1 @@", Kind: diff.HunkHeader},
+		{Old: "old line", OldNo: &one, Kind: diff.Del, NoNewlineOld: true},
+	}
+	theme := DefaultTheme.ASCII()
+	got := sgrRE.ReplaceAllString(Render(RenderModel{Width: 100, Height: 30, Files: []string{"a.go"}, FileStatuses: map[string]string{"a.go": "M"}, Rows: rows, Theme: &theme, HunkEnd: 2}), "")
+	for _, r := range got {
+		if r >= 0x2190 && r <= 0x25ff {
+			t.Fatalf("ASCII render contains %q:\n%s", r, got)
+		}
+	}
+	if !strings.Contains(got, asciiBanner[1]) || !strings.Contains(got, "+---") {
+		t.Fatalf("missing ASCII banner or borders:\n%s", got)
+	}
+}
+
+func TestRender_FileInfoLine(t *testing.T) {
+	m := RenderModel{Width: 100, Height: FileInfoMinHeight, Files: []string{"a.go"}, FileInfo: "1.2 KB · Go"}
+	lines := strings.Split(Render(m), "\n")
+	if len(lines) != m.Height || !strings.HasPrefix(lines[1], "1.2 KB · Go") {
+		t.Fatalf("info line missing or the body did not make room: %d lines, second %q", len(lines), lines[1])
+	}
+	if old, _ := PaneRowRects(m); old.Y != 4 {
+		t.Fatalf("rows start at %d, want below the info line", old.Y)
+	}
+	m.Height--
+	lines = strings.Split(Render(m), "\n")
+	if len(lines) != m.Height || strings.Contains(lines[1], "1.2 KB") {
+		t.Fatalf("info line drawn on a short terminal: %q", lines[1])
+	}
+}
+
+func TestRender_SwappedPanesAndSplit(t *testing.T) {
+	m := RenderModel{Width: 140, Height: 20, HideBanner: true, Files: []string{"a.go"}, SwapPanes: true, Split: 30}
+	oldRect, newRect := PaneRowRects(m)
+	if newRect.X >= oldRect.X || newRect.Width <= oldRect.Width {
+		t.Fatalf("want a wide NEW pane left of OLD: old %+v, new %+v", oldRect, newRect)
+	}
+	title := strings.Split(Render(m), "\n")[2]
+	if newAt, oldAt := strings.Index(title, "NEW"), strings.Index(title, "OLD"); newAt < 0 || oldAt < newAt {
+		t.Fatalf("titles out of order: %q", title)
+	}
+	if header := renderHeader(m); !strings.Contains(header, "panes: new|old") || !strings.Contains(header, "split: 70/30") {
+		t.Fatalf("header %q", header)
+	}
+	for i, line := range strings.Split(Render(m), "\n") {
+		if w := lipgloss.Width(line); w != m.Width {
+			t.Fatalf("line %d is %d wide: %q", i, w, line)
+		}
+	}
+
+	m.Layout = LayoutStacked
+	oldRect, newRect = PaneRowRects(m)
+	if newRect.Y >= oldRect.Y {
+		t.Fatalf("want NEW above OLD: old %+v, new %+v", oldRect, newRect)
+	}
+}
+
+func TestRender_OneSidedDiffsCollapseTheEmptyPane(t *testing.T) {
+	one, two := 1, 2
+	added := []diff.Row{{Old: "@@ -0,0 +1,2 @@", New: "@@ -0,0 +1,2 @@", Kind: diff.HunkHeader}, {NewNo: &one, New: "a", Kind: diff.Add}, {NewNo: &two, New: "b", Kind: diff.Add}}
+	deleted := []diff.Row{{OldNo: &one, Old: "a", Kind: diff.Del}}
+	for _, wrap := range []bool{false, true} {
+		m := RenderModel{Width: 120, Height: 20, HideBanner: true, Files: []string{"a.go"}, Rows: added, Wrap: wrap}
+		oldRect, newRect := PaneRowRects(m)
+		if oldRect.Width != collapsedPaneWidth-2 || newRect.X != oldRect.X+collapsedPaneWidth {
+			t.Fatalf("wrap %v: added file, old %+v, new %+v", wrap, oldRect, newRect)
+		}
+		for i, line := range strings.Split(Render(m), "\n") {
+			if w := lipgloss.Width(line); w != m.Width {
+				t.Fatalf("wrap %v: line %d is %d wide: %q", wrap, i, w, line)
+			}
+		}
+
+		m.Rows = deleted
+		oldRect, newRect = PaneRowRects(m)
+		if newRect.Width != collapsedPaneWidth-2 || oldRect.Width <= newRect.Width {
+			t.Fatalf("wrap %v: deleted file, old %+v, new %+v", wrap, oldRect, newRect)
+		}
+
+		m.KeepPanes = true
+		if oldRect, newRect = PaneRowRects(m); newRect.Width-oldRect.Width > 1 {
+			t.Fatalf("wrap %v: kept panes, old %+v, new %+v", wrap, oldRect, newRect)
+		}
+	}
+}
+
+func TestRender_ApartPanesStartAtTheirOwnRows(t *testing.T) {
+	var rows []diff.Row
+	for i := 1; i <= 50; i++ {
+		no := i
+		line := fmt.Sprintf("line %d", i)
+		rows = append(rows, diff.Row{OldNo: &no, NewNo: &no, Old: line, New: line, Kind: diff.Context})
+	}
+	m := RenderModel{Width: 120, Height: 20, HideBanner: true, Files: []string{"a.go"}, Rows: rows, Focus: FocusNew, Cursor: 2, Apart: &PaneApart{Pane: FocusOld, Scroll: 30, Cursor: 31}}
+	oldPane, newPane := renderPanes(m, 40, 40, 10)
+	oldLines, newLines := strings.Split(oldPane, "\n"), strings.Split(newPane, "\n")
+	if !strings.Contains(oldLines[1], "31 line 31") || !strings.Contains(newLines[1], "1 line 1") {
+		t.Fatalf("first rows: OLD %q, NEW %q", oldLines[1], newLines[1])
+	}
+	if header := renderHeader(m); !strings.Contains(header, "scroll lock off") {
+		t.Fatalf("header %q", header)
+	}
+}
+
+func TestSidebar_BannerToggle(t *testing.T) {
+	withBanner, without := SidebarVisibleFiles(30, true), SidebarVisibleFiles(30, false)
+	if bannerRows := sidebarBannerTopPadding + len(sidebarBannerLines) + sidebarBannerBottomPadding; without-withBanner != bannerRows {
+		t.Fatalf("hiding the banner gained %d file rows, want %d", without-withBanner, bannerRows)
+	}
+	if BannerShown(BannerMinHeight-1, false) || !BannerShown(BannerMinHeight, false) || BannerShown(BannerMinHeight, true) {
+		t.Fatal("BannerShown ignores the height threshold or the toggle")
+	}
+
+	m := RenderModel{Width: 100, Height: 30, Files: []string{"a.go"}}
+	const bannerStart = "████████╗"
+	if got := Render(m); !strings.Contains(got, bannerStart) {
+		t.Fatal("banner missing at full height")
+	}
+	m.HideBanner = true
+	got := Render(m)
+	if strings.Contains(got, bannerStart) {
+		t.Fatal("banner drawn while hidden")
+	}
+	if lines := strings.Split(got, "\n"); !strings.Contains(lines[2], "FILES CHANGED") {
+		t.Fatalf("file list does not start at the top of the sidebar:\n%s", got)
+	}
+}
+
+func TestSidebar_FileLoadMarkers(t *testing.T) {
+	m := RenderModel{
+		Width: 100, Height: 20, HideBanner: true,
+		Files:        []string{"loading.go", "shown.go", "plain.go"},
+		FileStatuses: map[string]string{"loading.go": "M", "shown.go": "M", "plain.go": "M"},
+		FileLoads:    map[string]FileLoad{"loading.go": FileLoading, "shown.go": FileLoaded},
+		Selected:     1,
+	}
+	content := renderFilesContent(m, 30, 10)
+	for _, want := range []string{"loading.go …", "shown.go ·"} {
+		if !strings.Contains(content, want) {
+			t.Fatalf("sidebar missing %q:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "plain.go …") || strings.Contains(content, "plain.go ·") {
+		t.Fatalf("unloaded file is marked:\n%s", content)
+	}
+}
+
+func TestSidebar_ReviewedFilesChecked(t *testing.T) {
+	m := RenderModel{
+		Width: 100, Height: 20, HideBanner: true,
+		Files:        []string{"open.go", "done.go"},
+		FileStatuses: map[string]string{"open.go": "M", "done.go": "M"},
+		Reviewed:     map[string]bool{"done.go": true},
+	}
+	content := renderFilesContent(m, 30, 10)
+	check := m.theme().glyphs.reviewed
+	if !strings.Contains(content, check+"done.go") || strings.Contains(content, check+"open.go") {
+		t.Fatalf("want only done.go checked:\n%s", content)
+	}
+}
+
+func TestSidebar_ConflictedFilesLabel(t *testing.T) {
+	m := RenderModel{
+		Width: 100, Height: 20, HideBanner: true,
+		Files:        []string{"conf.go", "main.go"},
+		FileStatuses: map[string]string{"conf.go": "C", "main.go": "M"},
+		Selected:     1,
+	}
+	if content := renderFilesContent(m, 40, 10); !strings.Contains(content, "[C] conf.go") {
+		t.Fatalf("want the conflicted file labeled C:\n%s", content)
+	}
+}
+
+func TestSidebar_PartlyStagedFilesGainAPlus(t *testing.T) {
+	m := RenderModel{
+		Width: 100, Height: 20, HideBanner: true,
+		Files:        []string{"a.go", "b.go"},
+		FileStatuses: map[string]string{"a.go": "M", "b.go": "M"},
+		PartlyStaged: map[string]string{"a.go": "M"},
+		Selected:     1,
+	}
+	content := renderFilesContent(m, 40, 10)
+	if !strings.Contains(content, "[M]+ a.go") || !strings.Contains(content, "[M]  b.go") {
+		t.Fatalf("want only a.go marked as partly staged, both names in line:\n%s", content)
+	}
+	if content := renderFilesContent(RenderModel{Width: 100, Height: 20, HideBanner: true, Files: []string{"b.go"}, FileStatuses: map[string]string{"b.go": "M"}}, 40, 10); !strings.Contains(content, "[M] b.go") {
+		t.Fatalf("want no staged column while nothing is partly staged:\n%s", content)
+	}
+}
+
+func TestSidebar_SkippedFilesSaySo(t *testing.T) {
+	m := RenderModel{
+		Width: 100, Height: 20, HideBanner: true,
+		Files:        []string{"config/local.env", "main.go"},
+		FileStatuses: map[string]string{"config/local.env": "S", "main.go": "M"},
+		Selected:     1,
+	}
+	content := renderFilesContent(m, 40, 10)
+	if !strings.Contains(content, "[S] config/local.env (skipped)") || strings.Contains(content, "main.go (skipped)") {
+		t.Fatalf("want only the skipped file marked:\n%s", content)
+	}
+	m.Entries = []SidebarEntry{
+		{Path: "config", Name: "config", Dir: true, Status: "S"},
+		{Path: "config/local.env", Name: "local.env", Depth: 1, Status: "S"},
+	}
+	m.Selected = 0
+	content = renderFilesContent(m, 40, 10)
+	if !strings.Contains(content, "config/") || strings.Contains(content, "(skipped)/") {
+		t.Fatalf("directory row took the file's marker:\n%s", content)
+	}
+}
+
+func TestRender_ConflictMarkersStandOut(t *testing.T) {
+	one := 1
+	marker := diff.Row{NewNo: &one, New: "<<<<<<< HEAD", Kind: diff.Add, ConflictMarker: true}
+	m := RenderModel{
+		Width: 100, Height: 20, HideBanner: true,
+		Files:           []string{"clean.go", "merged.go"},
+		FileStatuses:    map[string]string{"clean.go": "M", "merged.go": "M"},
+		Rows:            []diff.Row{marker},
+		ConflictFiles:   map[string]bool{"merged.go": true},
+		ConflictMarkers: true,
+	}
+	oldLine, newLine := rowPaneTexts(m, marker)
+	if _, got := renderRowText(m, 0, oldLine, newLine); got != DefaultTheme.conflict.Render(marker.New) {
+		t.Fatalf("marker drawn as %q", got)
+	}
+	warning := m.theme().glyphs.warning
+	content := renderFilesContent(m, 30, 10)
+	if !strings.Contains(content, "merged.go "+warning) || strings.Contains(content, "clean.go "+warning) {
+		t.Fatalf("want only merged.go flagged:\n%s", content)
+	}
+	if header := renderHeader(m); !strings.Contains(header, warning+" conflict markers present") {
+		t.Fatalf("header %q has no conflict badge", header)
+	}
+}
+
+func TestRender_InvisibleChangesAreEscaped(t *testing.T) {
+	one := 1
+	rows := []diff.Row{{OldNo: &one, NewNo: &one, Old: "ab", New: "a\u200bb", Kind: diff.Context}}
+	diff.MarkInvisibleChanges(rows)
+	m := RenderModel{Width: 100, Height: 20, HideBanner: true, Files: []string{"a.go"}, Rows: rows, InvisibleChanges: true}
+	oldLine, newLine := rowPaneTexts(m, rows[0])
+	oldText, newText := renderRowText(m, 0, oldLine, newLine)
+	if want := DefaultTheme.oldLine.Render("ab"); oldText != want {
+		t.Fatalf("old side %q, want %q", oldText, want)
+	}
+	if want := DefaultTheme.newLine.Render("a") + DefaultTheme.newWord.Render("<U+200B>") + DefaultTheme.newLine.Render("b"); newText != want {
+		t.Fatalf("new side %q, want %q", newText, want)
+	}
+	if header := renderHeader(m); !strings.Contains(header, "contains invisible or lookalike character changes") {
+		t.Fatalf("header %q has no invisible change notice", header)
+	}
+}
+
+func TestRender_OverlayReplacesPanes(t *testing.T) {
+	m := RenderModel{
+		Width: 80, Height: 20, Files: []string{"a.go"},
+		Error:       "fatal: " + strings.Repeat("very long error ", 10),
+		ErrorDetail: true,
+		Overlay:     &Overlay{Title: "GIT ERROR", Lines: []string{"$ git diff", strings.Repeat("output ", 30)}},
+	}
+	got := Render(m)
+	lines := strings.Split(got, "\n")
+	if len(lines) != m.Height {
+		t.Fatalf("rendered %d lines, want %d:\n%s", len(lines), m.Height, got)
+	}
+	if !strings.Contains(lines[0], "e: details") {
+		t.Fatalf("header lost the details hint: %q", lines[0])
+	}
+	if strings.Contains(got, "OLD") || !strings.Contains(got, "GIT ERROR") || !strings.Contains(got, "$ git diff") {
+		t.Fatalf("overlay not drawn in place of the panes:\n%s", got)
+	}
+	if wrapped, _ := (Overlay{Lines: m.Overlay.Lines}).wrap(m.Width); len(wrapped) < 3 {
+		t.Fatalf("long overlay line wrapped into %d lines, want it split", len(wrapped))
+	}
+}
+
+func TestOverlay_ScrollToSelected(t *testing.T) {
+	o := Overlay{Lines: make([]string, 30), Selectable: true}
+	o.Lines[20] = strings.Repeat("wraps ", 20)
+	// 10 rows of body show 7 lines; line 20 takes two at width 80.
+	for _, c := range []struct{ selected, scroll, want int }{
+		{5, 0, 0},
+		{20, 0, 15},
+		{21, 15, 16},
+		{3, 16, 3},
+	} {
+		o.Selected, o.Scroll = c.selected, c.scroll
+		if got := o.ScrollToSelected(80, 10); got != c.want {
+			t.Errorf("selected %d from scroll %d: scroll %d, want %d", c.selected, c.scroll, got, c.want)
+		}
+	}
+}
+
+func TestRender_NoteMarkerAndPrompt(t *testing.T) {
+	one, two := 1, 2
+	m := RenderModel{
+		Width: 80, Height: 16, HideBanner: true, Files: []string{"a.go"},
+		Rows: []diff.Row{
+			{OldNo: &one, NewNo: &one, Old: "a", New: "a", Kind: diff.Context},
+			{NewNo: &two, New: "b", Kind: diff.Add},
+		},
+		NoteRows: map[int]bool{1: true},
+		Prompt:   "note a.go:2: why?",
+	}
+	lines := strings.Split(Render(m), "\n")
+	if !strings.HasPrefix(lines[0], "note a.go:2: why?") {
+		t.Fatalf("prompt not in place of the header: %q", lines[0])
+	}
+	note := m.theme().glyphs.note
+	var marked []string
+	for _, line := range lines[1:] {
+		if strings.Contains(line, note) {
+			marked = append(marked, line)
+		}
+	}
+	if len(marked) != 1 || !strings.Contains(marked[0], "2") || !strings.Contains(marked[0], "b") {
+		t.Fatalf("want only NEW line 2 marked with %q:\n%s", note, strings.Join(lines, "\n"))
+	}
+}
+
+// benchmarkModel is a 500-row diff of a mid-sized change: context, edits,
+// additions and deletions in hunks, with 60 files in the sidebar.
+func benchmarkModel() RenderModel {
+	var rows []diff.Row
+	files := make([]string, 60)
+	statuses := map[string]string{}
+	for i := range files {
+		files[i] = fmt.Sprintf("pkg/module%02d/file%02d.go", i/6, i)
+		statuses[files[i]] = "M"
+	}
+	for len(rows) < 500 {
+		header := fmt.Sprintf("@@ -%d,20 +%d,20 @@ func handler%d()", len(rows), len(rows), len(rows))
+		rows = append(rows, diff.Row{Old: header, New: header, Kind: diff.HunkHeader})
+		for k := 0; k < 20 && len(rows) < 500; k++ {
+			n := len(rows)
+			oldNo, newNo := n, n
+			text := fmt.Sprintf("\tresult := compute(%d, values[%d]) // keep the totals in step", n, k)
+			switch k % 5 {
+			case 1:
+				rows = append(rows, diff.Row{Old: text, OldNo: &oldNo, Kind: diff.Del})
+			case 2:
+				rows = append(rows, diff.Row{New: text, NewNo: &newNo, Kind: diff.Add})
+			case 3:
+				rows = append(rows, diff.Row{Old: text, New: strings.Replace(text, "compute", "calculate", 1), OldNo: &oldNo, NewNo: &newNo, Kind: diff.Add})
+			default:
+				rows = append(rows, diff.Row{Old: text, New: text, OldNo: &oldNo, NewNo: &newNo, Kind: diff.Context})
+			}
+		}
+	}
+	return RenderModel{
+		Width: 160, Height: 50, Files: files, FileStatuses: statuses, Selected: 7,
+		Rows: rows, Focus: FocusNew, ShowHints: true, HunkIndex: 0, HunkCount: 24, HunkStart: 0, HunkEnd: 21,
+	}
+}
+
+// BenchmarkRender moves the cursor through the diff one row per frame, as
+// holding j does.
+func BenchmarkRender(b *testing.B) {
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	defer lipgloss.SetColorProfile(profile)
+
+	m := benchmarkModel()
+	m.Cache = &RenderCache{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m.Cursor = i % len(m.Rows)
+		m.DiffScroll = m.Cursor / 40 * 40
+		Render(m)
+	}
+}
+
+func TestRenderCache_MatchesUncached(t *testing.T) {
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	defer lipgloss.SetColorProfile(profile)
+
+	cached, plain := benchmarkModel(), benchmarkModel()
+	cached.Cache = &RenderCache{}
+	themes := BuiltinThemes()
+	steps := []func(m *RenderModel){
+		func(m *RenderModel) { m.Cursor = 3 },
+		func(m *RenderModel) { m.Cursor = 4; m.Selected = 8 },
+		func(m *RenderModel) { m.Theme = &themes[1] },
+		func(m *RenderModel) { m.ShowWhitespace = true },
+		func(m *RenderModel) { m.Wrap = true; m.Width = 120 },
+		func(m *RenderModel) { m.Rows = append([]diff.Row(nil), m.Rows[:100]...); m.Cursor = 50 },
+		func(m *RenderModel) { m.HideBanner = true; m.Focus = FocusFiles },
+	}
+	for i, step := range steps {
+		step(&cached)
+		step(&plain)
+		if got, want := Render(cached), Render(plain); got != want {
+			t.Fatalf("step %d: cached render differs from uncached", i)
+		}
+	}
+}
+
+func TestRenderCache_ActiveHunkHeaderFollowsTheHunk(t *testing.T) {
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	defer lipgloss.SetColorProfile(profile)
+
+	cached, plain := benchmarkModel(), benchmarkModel()
+	cached.Cache = &RenderCache{}
+	Render(cached)
+	for _, m := range []*RenderModel{&cached, &plain} {
+		m.Cursor, m.HunkIndex, m.HunkStart, m.HunkEnd = 22, 1, 21, 42
+	}
+	if got, want := Render(cached), Render(plain); got != want {
+		t.Fatalf("cached render kept the old hunk header highlighted")
+	}
+}
+
+func TestRender_WideCharactersKeepEveryLineWidth(t *testing.T) {
+	one, two := 1, 2
+	files := []string{"文档/日本語のファイル名とても長い.go", "emoji/👍🏽👨‍👩‍👧❤️.md", "a.go"}
+	rows := []diff.Row{
+		{Old: "fmt.Println(\"こんにちは世界、長い行はここで切れるはずです\")", New: "fmt.Println(\"こんにちは世界、長い行はここで切れるはずですよ\")", OldNo: &one, NewNo: &one, Kind: diff.Add},
+		{Old: "status := \"👍🏽👍🏽👍🏽 family 👨‍👩‍👧 love ❤️❤️❤️ on a line longer than the pane\"", New: "ok", OldNo: &two, NewNo: &two, Kind: diff.Add},
+		{New: "中文\t制表符和😀表情混在一起的很长的一行文本内容", NewNo: &two, Kind: diff.Add},
+	}
+	for _, width := range []int{80, 97, 120, 131} {
+		for _, wrap := range []bool{false, true} {
+			m := RenderModel{Width: width, Height: 20, Files: files, FileStatuses: map[string]string{files[0]: "M"}, Rows: rows, Wrap: wrap}
+			for i, line := range strings.Split(Render(m), "\n") {
+				if w := lipgloss.Width(line); w != width {
+					t.Fatalf("width %d, wrap %v: line %d is %d wide: %q", width, wrap, i, w, line)
+				}
+			}
+		}
+	}
+}
+
+func TestTruncateWidth_NeverSplitsAWideCharacterOrCluster(t *testing.T) {
+	cases := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"日本語", 3, "日"},
+		{"日本語", 4, "日本"},
+		{"a👍🏽b", 3, "a"},
+		{"a👍🏽b", 5, "a👍🏽"},
+		{"x👨‍👩‍👧", 4, "x"},
+		{"éé", 1, "é"},
+		{"\x1b[1m日本\x1b[0m", 3, "\x1b[1m日\x1b[0m"},
+	}
+	for _, c := range cases {
+		if got := truncateWidth(c.in, c.width); got != c.want {
+			t.Errorf("truncateWidth(%q, %d) = %q, want %q", c.in, c.width, got, c.want)
+		}
+		if got := fitWidth(c.in, c.width); lipgloss.Width(got) != c.width || strings.Contains(got, "\n") {
+			t.Errorf("fitWidth(%q, %d) = %q, %d wide", c.in, c.width, got, lipgloss.Width(got))
+		}
+	}
+}
+
+func TestFormatPaneCell_MarksClippedLines(t *testing.T) {
+	one := 1
+	row := diff.Row{OldNo: &one, NewNo: &one, Kind: diff.Context}
+	cases := []struct {
+		name, text, suffix, want string
+	}{
+		{"fits", "abcdefgh", "", "  1 abcdefgh"},
+		{"one over", "abcdefghi", "", "  1 abcdefg…"},
+		{"wide runes", "日本語日本", "", "  1 日本語… "},
+		{"styled", "\x1b[1mabcdefghij\x1b[0m", "", "  1 abcdefg…"},
+		{"badge kept", "abcdefghij", " CR", "  1 abcd… CR"},
+	}
+	for _, c := range cases {
+		cell := formatPaneCell(&DefaultTheme, row, false, "1", c.text, c.suffix, 3, 12)
+		if got := sgrRE.ReplaceAllString(cell, ""); got != c.want {
+			t.Errorf("%s: cell %q, want %q", c.name, got, c.want)
+		}
+		if w := lipgloss.Width(cell); w != 12 {
+			t.Errorf("%s: cell is %d wide, want 12", c.name, w)
+		}
+	}
+}
+
+func TestWrapBreaks(t *testing.T) {
+	cases := []struct {
+		name  string
+		text  string
+		width int
+		want  []int
+	}{
+		{"empty", "", 5, []int{0}},
+		{"fits", "abc", 5, []int{0}},
+		{"exact width", "abcde", 5, []int{0}},
+		{"one over", "abcdef", 5, []int{0, 5}},
+		{"several lines", "abcdefghijk", 4, []int{0, 4, 8}},
+		{"wide runes", "日本語", 4, []int{0, 6}},
+		{"wide rune not split", "a日本", 2, []int{0, 1, 4}},
+		{"tab to the next stop", "\tab", 5, []int{0, 2}},
+		{"tab after text", "ab\tc", 3, []int{0, 2}},
+		{"no room", "ab", 0, []int{0, 1}},
+	}
+	for _, c := range cases {
+		got := newPaneText(c.text, false, 4, &DefaultTheme).wrapBreaks(c.width)
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("%s: %q in %d cells breaks at %v, want %v", c.name, c.text, c.width, got, c.want)
+		}
+	}
+}
+
+func TestWrapWindow(t *testing.T) {
+	breaks := []int{0, 4, 8}
+	for k, want := range [][2]int{{0, 4}, {4, 8}, {8, 10}, {10, 10}} {
+		if lo, hi := wrapWindow(breaks, k, 10); lo != want[0] || hi != want[1] {
+			t.Errorf("line %d: [%d, %d), want %v", k, lo, hi, want)
+		}
+	}
+}
+
+// wrapRows is a context row of one line, then an added line long enough to
+// wrap, then another short one.
+func wrapRows(long string) []diff.Row {
+	one, two, three := 1, 2, 3
+	return []diff.Row{
+		{OldNo: &one, NewNo: &one, Old: "first", New: "first", Kind: diff.Context},
+		{NewNo: &two, New: long, Kind: diff.Add},
+		{OldNo: &two, NewNo: &three, Old: "last", New: "last", Kind: diff.Context},
+	}
+}
+
+func TestRender_WrapContinuationLinesAlignWithTheText(t *testing.T) {
+	long := strings.Repeat("abcdefghij", 12)
+	m := RenderModel{Width: 120, Height: 20, HideBanner: true, Files: []string{"a.go"}, Rows: wrapRows(long), Wrap: true, KeepPanes: true}
+	metrics := NewRowMetrics(m)
+	if metrics.Height(0) != 1 || metrics.Height(1) < 2 {
+		t.Fatalf("heights %d, %d", metrics.Height(0), metrics.Height(1))
+	}
+	_, newLines := renderWrappedRow(m, metrics, 1, false)
+	if len(newLines) != metrics.Height(1) {
+		t.Fatalf("%d lines for a row %d high", len(newLines), metrics.Height(1))
+	}
+	first := sgrRE.ReplaceAllString(newLines[0], "")
+	textAt := strings.Index(first, "abcdefghij")
+	if !strings.HasPrefix(strings.TrimSpace(first), "2") || textAt < 0 {
+		t.Fatalf("first line %q", first)
+	}
+	var text string
+	for i, line := range newLines {
+		plain := sgrRE.ReplaceAllString(line, "")
+		if i > 0 && strings.TrimSpace(plain[:textAt]) != "" {
+			t.Fatalf("continuation %d has a gutter: %q", i, plain)
+		}
+		if lipgloss.Width(line) != lipgloss.Width(newLines[0]) {
+			t.Fatalf("line %d is %d wide, the first %d", i, lipgloss.Width(line), lipgloss.Width(newLines[0]))
+		}
+		text += strings.TrimRight(plain[textAt:], " ")
+	}
+	if text != long {
+		t.Fatalf("wrapped text reads %q", text)
+	}
+	oldLines, _ := renderWrappedRow(m, metrics, 1, false)
+	if len(oldLines) != len(newLines) {
+		t.Fatalf("OLD has %d lines, NEW %d", len(oldLines), len(newLines))
+	}
+}
+
+func TestRowMetrics_MaxScrollCountsWrappedLines(t *testing.T) {
+	var rows []diff.Row
+	for i := 1; i <= 40; i++ {
+		no := i
+		rows = append(rows, diff.Row{OldNo: &no, NewNo: &no, Old: "x", New: strings.Repeat("y", 70), Kind: diff.Add})
+	}
+	m := RenderModel{Width: 120, Height: 20, HideBanner: true, Files: []string{"a.go"}, Rows: rows}
+	plain := NewRowMetrics(m)
+	if got := plain.MaxScroll(); got != len(rows)-plain.Lines() {
+		t.Fatalf("unwrapped max scroll %d, want %d", got, len(rows)-plain.Lines())
+	}
+	m.Wrap = true
+	wrapped := NewRowMetrics(m)
+	height := wrapped.Height(0)
+	if height < 2 {
+		t.Fatalf("rows are %d high", height)
+	}
+	if got, want := wrapped.MaxScroll(), len(rows)-wrapped.Lines()/height; got != want {
+		t.Fatalf("wrapped max scroll %d, want %d (%d lines of %d-line rows)", got, want, wrapped.Lines(), height)
+	}
+}
@@ -0,0 +1,79 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/uniseg"
+)
+
+// truncateWidth cuts s, which may hold escape sequences, to at most width
+// cells as lipgloss.Width counts them. It only cuts between grapheme
+// clusters, so a wide character or an emoji with its modifiers is dropped
+// whole rather than split, leaving the line a cell short when one straddles
+// the edge. Escape sequences past the cut are kept so styles still end.
+func truncateWidth(s string, width int) string {
+	if lipgloss.Width(s) <= width {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	used, full, state := 0, false, -1
+	for s != "" {
+		if s[0] == '\x1b' {
+			n := escapeLen(s)
+			b.WriteString(s[:n])
+			s, state = s[n:], -1
+			continue
+		}
+		end := strings.IndexByte(s, '\x1b')
+		if end < 0 {
+			end = len(s)
+		}
+		text := s[:end]
+		s = s[end:]
+		for text != "" && !full {
+			var cluster string
+			cluster, text, _, state = uniseg.FirstGraphemeClusterInString(text, state)
+			w := clusterWidth(cluster)
+			if used+w > width {
+				full = true
+				break
+			}
+			b.WriteString(cluster)
+			used += w
+		}
+	}
+	return b.String()
+}
+
+// escapeLen is the length of the escape sequence s starts with, ending at
+// the first letter as lipgloss.Width reads them.
+func escapeLen(s string) int {
+	for i := 1; i < len(s); i++ {
+		if c := s[i]; (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// clusterWidth counts a grapheme cluster's cells rune by rune, the way
+// lipgloss.Width and the renderer do, so a cut line measures what they
+// measure.
+func clusterWidth(cluster string) int {
+	w := 0
+	for _, r := range cluster {
+		w += runewidth.RuneWidth(r)
+	}
+	return w
+}
+
+// padWidth fills s out with spaces to width cells.
+func padWidth(s string, width int) string {
+	if pad := width - lipgloss.Width(s); pad > 0 {
+		return s + strings.Repeat(" ", pad)
+	}
+	return s
+}
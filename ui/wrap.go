@@ -0,0 +1,171 @@
+package ui
+
+import (
+	"strconv"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// RowMetrics maps diff rows to the terminal lines they occupy in the panes.
+// Without wrapping every row is one line; in wrap mode a row is as tall as its
+// longer side.
+type RowMetrics struct {
+	m          RenderModel
+	lines      int
+	oldWidth   int
+	newWidth   int
+	oldNoWidth int
+	newNoWidth int
+}
+
+// NewRowMetrics measures the panes of m. Line-number gutters are only scanned
+// in wrap mode, where they affect how much text fits on a line.
+func NewRowMetrics(m RenderModel) RowMetrics {
+	l := computeLayout(m)
+	oldWidth, newWidth := l.rowWidths()
+	metrics := RowMetrics{m: m, lines: l.paneContentHeight - 1, oldWidth: oldWidth - hunkMarkerWidth, newWidth: newWidth - hunkMarkerWidth}
+	if metrics.lines < 1 {
+		metrics.lines = 1
+	}
+	if m.Wrap {
+		metrics.oldNoWidth, metrics.newNoWidth = m.Cache.lineNumberWidths(m.Rows)
+	}
+	return metrics
+}
+
+// Lines is the number of terminal lines available for rows in each pane.
+func (r RowMetrics) Lines() int {
+	return r.lines
+}
+
+// Height returns how many terminal lines row idx occupies; folded rows take
+// none.
+func (r RowMetrics) Height(idx int) int {
+	if idx >= 0 && idx < len(r.m.Hidden) && r.m.Hidden[idx] {
+		return 0
+	}
+	if !r.m.Wrap || idx < 0 || idx >= len(r.m.Rows) {
+		return 1
+	}
+	oldBreaks, newBreaks := r.breaks(idx)
+	return intMax(len(oldBreaks), len(newBreaks))
+}
+
+// MaxScroll returns the first row of the last full page.
+func (r RowMetrics) MaxScroll() int {
+	start := len(r.m.Rows) - 1
+	if start <= 0 {
+		return 0
+	}
+	used := r.Height(start)
+	for start > 0 && used+r.Height(start-1) <= r.lines {
+		start--
+		used += r.Height(start)
+	}
+	return start
+}
+
+// breaks returns the byte offsets where each visual line of row idx starts on
+// the old and new side.
+func (r RowMetrics) breaks(idx int) ([]int, []int) {
+	row := r.m.Rows[idx]
+	oldLine, newLine := rowPaneTexts(r.m, row)
+	oldBreaks := oldLine.wrapBreaks(wrapWidth(r.oldWidth, r.oldNoWidth, paneSuffix(r.m.theme(), row, true)))
+	newBreaks := newLine.wrapBreaks(wrapWidth(r.newWidth, r.newNoWidth, paneSuffix(r.m.theme(), row, false)))
+	return oldBreaks, newBreaks
+}
+
+// wrapWidth is the room left for text once the gutter and the badge, which
+// stays on the side's last line, are taken.
+func wrapWidth(width, noWidth int, suffix string) int {
+	return width - noWidth - 1 - lipgloss.Width(suffix)
+}
+
+// wrapBreaks splits the line into visual lines of at most width cells and
+// returns the byte offset each one starts at. Tabs and escaped control
+// characters are measured as they will be drawn.
+func (l paneText) wrapBreaks(width int) []int {
+	if width < 1 {
+		width = 1
+	}
+	breaks := []int{0}
+	col, lineCol := 0, 0
+	for i, r := range l.text {
+		var w int
+		switch {
+		case r == '\t':
+			w = l.tabWidth - col%l.tabWidth
+		case r < 0x20 || (r >= 0x7f && r <= 0x9f):
+			w = lipgloss.Width(diff.EscapeControl(string(r)))
+		default:
+			w = runewidth.RuneWidth(r)
+		}
+		if lineCol > 0 && lineCol+w > width {
+			breaks = append(breaks, i)
+			lineCol = 0
+		}
+		col += w
+		lineCol += w
+	}
+	return breaks
+}
+
+// renderWrappedRow renders row idx across as many lines as its longer side
+// needs. Continuation lines leave the gutter blank and the shorter side is
+// padded with empty lines so both panes stay aligned.
+func renderWrappedRow(m RenderModel, metrics RowMetrics, idx int, cursor bool) ([]string, []string) {
+	row := m.Rows[idx]
+	oldLine, newLine := rowPaneTexts(m, row)
+	oldBreaks, newBreaks := metrics.breaks(idx)
+	height := intMax(len(oldBreaks), len(newBreaks))
+	t := m.theme()
+	oldSuffix, newSuffix := paneSuffix(t, row, true), paneSuffix(t, row, false)
+
+	oldLines := make([]string, 0, height)
+	newLines := make([]string, 0, height)
+	for k := 0; k < height; k++ {
+		oldLine.lo, oldLine.hi = wrapWindow(oldBreaks, k, len(row.Old))
+		newLine.lo, newLine.hi = wrapWindow(newBreaks, k, len(row.New))
+		oldText, newText := renderRowText(m, idx, oldLine, newLine)
+		oldLines = append(oldLines, wrappedCell(t, row, true, oldText, oldSuffix, k, len(oldBreaks), metrics.oldNoWidth, metrics.oldWidth, cursor))
+		newLines = append(newLines, wrappedCell(t, row, false, newText, newSuffix, k, len(newBreaks), metrics.newNoWidth, metrics.newWidth, cursor))
+	}
+	return oldLines, newLines
+}
+
+// wrapWindow returns the byte range of visual line k, or an empty range past
+// the side's last line.
+func wrapWindow(breaks []int, k, length int) (int, int) {
+	if k >= len(breaks) {
+		return length, length
+	}
+	if k+1 < len(breaks) {
+		return breaks[k], breaks[k+1]
+	}
+	return breaks[k], length
+}
+
+func wrappedCell(t *Theme, row diff.Row, oldPane bool, text, suffix string, k, count, noWidth, width int, cursor bool) string {
+	no := row.NewNo
+	if oldPane {
+		no = row.OldNo
+	}
+	noText := ""
+	if k == 0 && no != nil {
+		noText = strconv.Itoa(*no)
+	}
+	if k != count-1 {
+		suffix = ""
+	}
+	line := formatPaneCell(t, row, oldPane, noText, text, suffix, noWidth, width)
+	return finishPaneLine(t, row, line, oldPane, cursor)
+}
+
+func intMax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
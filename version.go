@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// version, commit and date identify a release build. They are set with
+// -ldflags "-X main.version=v1.2.0 -X main.commit=... -X main.date=...";
+// builds without them fall back to what the Go toolchain recorded.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// versionString is the --version line, e.g.
+// "tdiff v1.2.0 (commit 1a2b3c4, built 2026-10-14T11:21:08Z)".
+func versionString() string {
+	info, _ := debug.ReadBuildInfo()
+	v, c, d := buildVersion(version, commit, date, info)
+	s := "tdiff " + v
+	switch {
+	case c != "" && d != "":
+		s += fmt.Sprintf(" (commit %s, built %s)", c, d)
+	case c != "":
+		s += fmt.Sprintf(" (commit %s)", c)
+	case d != "":
+		s += fmt.Sprintf(" (built %s)", d)
+	}
+	return s
+}
+
+// buildVersion fills whatever the linker flags left empty from info: the
+// module version for go install builds, and the VCS revision and commit time
+// for builds from a checkout, marked "-dirty" when it had local changes.
+func buildVersion(v, c, d string, info *debug.BuildInfo) (string, string, string) {
+	if info != nil {
+		if v == "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		vcs := map[string]string{}
+		for _, setting := range info.Settings {
+			vcs[setting.Key] = setting.Value
+		}
+		if c == "" && vcs["vcs.revision"] != "" {
+			c = vcs["vcs.revision"]
+			if len(c) > 12 {
+				c = c[:12]
+			}
+			if vcs["vcs.modified"] == "true" {
+				c += "-dirty"
+			}
+		}
+		if d == "" {
+			d = vcs["vcs.time"]
+		}
+	}
+	if v == "" {
+		v = "devel"
+	}
+	return v, c, d
+}
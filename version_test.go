@@ -0,0 +1,33 @@
+package main
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestBuildVersion(t *testing.T) {
+	info := &debug.BuildInfo{
+		Main: debug.Module{Version: "(devel)"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "8733102f1e2d3c4b5a69788766554433221100ff"},
+			{Key: "vcs.time", Value: "2026-10-14T11:21:08Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+	for _, tc := range []struct {
+		name             string
+		v, c, d          string
+		info             *debug.BuildInfo
+		wantV, wantC, wD string
+	}{
+		{"ldflags win", "v1.2.0", "1a2b3c4", "2026-10-01", info, "v1.2.0", "1a2b3c4", "2026-10-01"},
+		{"checkout build", "", "", "", info, "devel", "8733102f1e2d-dirty", "2026-10-14T11:21:08Z"},
+		{"go install", "", "", "", &debug.BuildInfo{Main: debug.Module{Version: "v1.3.0"}}, "v1.3.0", "", ""},
+		{"no build info", "", "", "", nil, "devel", "", ""},
+	} {
+		v, c, d := buildVersion(tc.v, tc.c, tc.d, tc.info)
+		if v != tc.wantV || c != tc.wantC || d != tc.wD {
+			t.Errorf("%s: got %q, %q, %q; want %q, %q, %q", tc.name, v, c, d, tc.wantV, tc.wantC, tc.wD)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// worktreePlace is where a worktree was left when the picker switched away
+// from it: the selected path and what the model keeps per file, so switching
+// back picks up there.
+type worktreePlace struct {
+	path           string
+	cursors        map[cursorKey]cursorPos
+	lastCursors    map[string]cursorPos
+	collapsed      map[string]bool
+	folds          map[foldKey]bool
+	largeDiffOptIn map[string]bool
+	notes          map[noteKey]note
+	bookmarks      map[bookmarkKey]bookmark
+	reviewed       map[reviewKey]string
+}
+
+// worktreesLoadedMsg carries git worktree list for the worktree picker.
+type worktreesLoadedMsg struct {
+	worktrees []git.WorktreeInfo
+	err       error
+}
+
+// showWorktrees opens the picker of the repository's worktrees (ctrl+g).
+func (m model) showWorktrees() (tea.Model, tea.Cmd) {
+	if m.merge != nil {
+		m.flash = "--merge shows one file: there are no worktrees to switch between"
+		return m, nil
+	}
+	return m, guardCmd(func() tea.Msg {
+		worktrees, err := git.ListWorktrees()
+		return worktreesLoadedMsg{worktrees: worktrees, err: err}
+	}, func(err error) tea.Msg {
+		return worktreesLoadedMsg{err: err}
+	})
+}
+
+func (m model) handleWorktreesLoaded(msg worktreesLoadedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.setError(msg.err)
+		return m, nil
+	}
+	var worktrees []git.WorktreeInfo
+	for _, wt := range msg.worktrees {
+		// A bare repository has no worktree to show changes in.
+		if !wt.Bare {
+			worktrees = append(worktrees, wt)
+		}
+	}
+	if len(worktrees) < 2 {
+		m.flash = "no other worktrees: git worktree add makes one"
+		return m, nil
+	}
+	current, selected := m.currentWorktree(), 0
+	lines := make([]string, len(worktrees))
+	for i, wt := range worktrees {
+		mark := "  "
+		if wt.Path == current {
+			mark, selected = "* ", i
+		}
+		lines[i] = mark + wt.Path + "  " + worktreeBranch(wt)
+	}
+	m.worktreeList = worktrees
+	m.overlay = &ui.Overlay{
+		Title:      fmt.Sprintf("WORKTREES (%d)  enter: switch", len(worktrees)),
+		Lines:      lines,
+		Selectable: true,
+		Selected:   selected,
+	}
+	cmd := m.dismissImages()
+	return m, cmd
+}
+
+// worktreeBranch names what a worktree has checked out, for the picker.
+func worktreeBranch(wt git.WorktreeInfo) string {
+	if wt.Branch != "" {
+		return "[" + wt.Branch + "]"
+	}
+	head := wt.Head
+	if len(head) > 7 {
+		head = head[:7]
+	}
+	return "(detached at " + head + ")"
+}
+
+// handleWorktreesKey moves through the picker and switches to the selected
+// worktree.
+func (m model) handleWorktreesKey(key string) (tea.Model, tea.Cmd) {
+	switch key {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc", "q", "ctrl+g":
+		m.overlay, m.worktreeList = nil, nil
+		return m, m.drawImagesCmd()
+	case "enter":
+		path := m.worktreeList[m.overlay.Selected].Path
+		m.overlay, m.worktreeList = nil, nil
+		return m.switchWorktree(path)
+	}
+	m.selectListItem(listSelection(key, m.overlay.Selected, len(m.worktreeList), ui.OverlayVisibleLines(m.bodyHeight())))
+	return m, nil
+}
+
+// currentWorktree is the path of the worktree git runs in, "" until the
+// repository is known.
+func (m *model) currentWorktree() string {
+	switch {
+	case m.worktree != "":
+		return m.worktree
+	case m.homeWorktree != "":
+		return m.homeWorktree
+	case m.repo != nil:
+		return m.repo.Root
+	}
+	return ""
+}
+
+// switchWorktree runs git in the worktree at path from now on, keeping the
+// place left in the current one and going back to the one left in path.
+func (m model) switchWorktree(path string) (tea.Model, tea.Cmd) {
+	current := m.currentWorktree()
+	if path == current {
+		return m, m.drawImagesCmd()
+	}
+	if m.homeWorktree == "" {
+		m.homeWorktree = current
+	}
+	m.saveCursor()
+	if m.worktreePlaces == nil {
+		m.worktreePlaces = map[string]worktreePlace{}
+	}
+	m.worktreePlaces[current] = worktreePlace{
+		path:           m.selectedPath(),
+		cursors:        m.cursors,
+		lastCursors:    m.lastCursors,
+		collapsed:      m.collapsed,
+		folds:          m.folds,
+		largeDiffOptIn: m.largeDiffOptIn,
+		notes:          m.notes,
+		bookmarks:      m.bookmarks,
+		reviewed:       m.reviewed,
+	}
+	place, ok := m.worktreePlaces[path]
+	if !ok {
+		place = worktreePlace{
+			cursors:        map[cursorKey]cursorPos{},
+			lastCursors:    map[string]cursorPos{},
+			collapsed:      map[string]bool{},
+			largeDiffOptIn: map[string]bool{},
+		}
+	}
+	m.cursors, m.lastCursors, m.collapsed = place.cursors, place.lastCursors, place.collapsed
+	m.folds, m.largeDiffOptIn = place.folds, place.largeDiffOptIn
+	m.notes, m.bookmarks, m.reviewed = place.notes, place.bookmarks, place.reviewed
+
+	// The worktree tdiff started in keeps running git where it was started,
+	// so its paths read as they did before.
+	m.worktree = path
+	if path == m.homeWorktree {
+		m.worktree = ""
+	}
+	git.SetWorktree(m.worktree)
+	m.repo = nil
+	m.applyNoChangesState()
+	m.files = []string{"(loading...)"}
+	m.rows = loadingRows("loading...")
+	m.togglePath = place.path
+	m.flash = "switched to worktree " + path
+	m.filesReq++
+	tick := m.startFilesTimer()
+	return m, tea.Batch(m.loadFiles(), tick, m.drawImagesCmd())
+}
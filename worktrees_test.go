@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/git"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestWorktrees_SwitchingBackRestoresThePlace(t *testing.T) {
+	t.Cleanup(func() { git.SetWorktree("") })
+	m := reviewModel()
+	m.repo = &git.RepoInfo{Root: "/src/tdiff", Name: "tdiff", Branch: "main"}
+	m.selected = 1
+	key := cursorKey{file: "b.go", mode: m.mode, algo: m.diffAlgo}
+	m.cursors[key] = cursorPos{cursor: 4}
+	m.collapsed["dir"] = true
+
+	worktrees := []git.WorktreeInfo{
+		{Path: "/src/tdiff", Branch: "main"},
+		{Path: "/src/bare", Bare: true},
+		{Path: "/src/tdiff-feat", Head: "1a2b3c4d5e6f"},
+	}
+	m = update(t, m, worktreesLoadedMsg{worktrees: worktrees})
+	if m.overlay == nil || len(m.overlay.Lines) != 2 || m.overlay.Selected != 0 {
+		t.Fatalf("picker %+v", m.overlay)
+	}
+	if got := m.overlay.Lines[1]; got != "  /src/tdiff-feat  (detached at 1a2b3c4)" {
+		t.Fatalf("line %q", got)
+	}
+
+	req := m.filesReq
+	m = update(t, m, runeKeys("j")[0], tea.KeyMsg{Type: tea.KeyEnter})
+	if m.overlay != nil || m.worktree != "/src/tdiff-feat" || m.filesReq != req+1 {
+		t.Fatalf("switch: overlay %v, worktree %q, files req %d", m.overlay, m.worktree, m.filesReq)
+	}
+	if len(m.cursors) != 0 || len(m.collapsed) != 0 {
+		t.Fatalf("the new worktree kept the old one's place: %v %v", m.cursors, m.collapsed)
+	}
+	feat := git.RepoInfo{Root: "/src/tdiff-feat", Name: "tdiff-feat", Branch: "feat"}
+	m = update(t, m, filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{"x.go", "y.go"}, statuses: map[string]string{}, repo: feat, repoOK: true})
+	if got := m.repoLabel(); got != "tdiff-feat@feat in /src/tdiff-feat" {
+		t.Fatalf("label %q", got)
+	}
+	if m.selectedFile() != "x.go" {
+		t.Fatalf("selected %s", m.selectedFile())
+	}
+
+	m = update(t, m, worktreesLoadedMsg{worktrees: worktrees})
+	if m.overlay.Selected != 1 || !strings.HasPrefix(m.overlay.Lines[1], "* ") {
+		t.Fatalf("the current worktree is not marked: %+v", m.overlay)
+	}
+	m = update(t, m, runeKeys("k")[0], tea.KeyMsg{Type: tea.KeyEnter})
+	if m.worktree != "" {
+		t.Fatalf("the starting worktree is %q, want \"\"", m.worktree)
+	}
+	home := git.RepoInfo{Root: "/src/tdiff", Name: "tdiff", Branch: "main"}
+	m = update(t, m, filesLoadedMsg{req: m.filesReq, mode: m.mode, files: []string{"a.go", "b.go", "c.go"}, statuses: map[string]string{}, repo: home, repoOK: true})
+	if m.selectedFile() != "b.go" || m.cursors[key].cursor != 4 || !m.collapsed["dir"] {
+		t.Fatalf("place not restored: selected %s, cursors %v, collapsed %v", m.selectedFile(), m.cursors, m.collapsed)
+	}
+	if got := m.repoLabel(); got != "tdiff@main" {
+		t.Fatalf("label %q", got)
+	}
+}
+
+func TestWorktrees_NoOtherWorktree(t *testing.T) {
+	m := reviewModel()
+	m = update(t, m, worktreesLoadedMsg{worktrees: []git.WorktreeInfo{{Path: "/src/tdiff", Branch: "main"}}})
+	if m.overlay != nil || !strings.HasPrefix(m.flash, "no other worktrees") {
+		t.Fatalf("overlay %v, flash %q", m.overlay, m.flash)
+	}
+}
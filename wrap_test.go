@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/PedroElizalde01/tdiff/diff"
+	"github.com/PedroElizalde01/tdiff/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// wrapModel shows 60 lines of which every fifth is long enough to wrap over
+// several lines.
+func wrapModel() model {
+	m := reviewModel()
+	m.rows = nil
+	for i := 1; i <= 60; i++ {
+		no := i
+		line := fmt.Sprintf("line %d", i)
+		if i%5 == 0 {
+			line += " " + strings.Repeat("long ", 60)
+		}
+		m.rows = append(m.rows, diff.Row{OldNo: &no, NewNo: &no, Old: line, New: line, Kind: diff.Context})
+	}
+	m.focus = ui.FocusNew
+	return m
+}
+
+// cursorShown fails t unless the whole cursor row is between the top of the
+// panes and their last line.
+func cursorShown(t *testing.T, m model) {
+	t.Helper()
+	metrics := ui.NewRowMetrics(m.renderModel())
+	if m.diffScroll > m.cursor || !rowsFit(metrics, m.diffScroll, m.cursor, metrics.Lines()) {
+		t.Fatalf("cursor %d (%d lines) is off screen from row %d with %d lines", m.cursor, metrics.Height(m.cursor), m.diffScroll, metrics.Lines())
+	}
+}
+
+func TestWrap_CursorStaysOnScreen(t *testing.T) {
+	m := wrapModel()
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyCtrlW})
+	if !m.wrap {
+		t.Fatal("ctrl+w did not wrap")
+	}
+	metrics := ui.NewRowMetrics(m.renderModel())
+	if metrics.Height(4) < 3 || metrics.Height(3) != 1 {
+		t.Fatalf("row heights %d and %d, want the long row wrapped", metrics.Height(3), metrics.Height(4))
+	}
+	for i := 1; i < len(m.rows); i++ {
+		m = update(t, m, runeKeys("j")...)
+		cursorShown(t, m)
+	}
+	if m.cursor != len(m.rows)-1 || m.diffScroll != metrics.MaxScroll() {
+		t.Fatalf("end: cursor %d, scroll %d, want %d and %d", m.cursor, m.diffScroll, len(m.rows)-1, metrics.MaxScroll())
+	}
+	unwrapped := m.renderModel()
+	unwrapped.Wrap = false
+	if m.diffScroll <= ui.NewRowMetrics(unwrapped).MaxScroll() {
+		t.Fatalf("scroll %d does not count the wrapped lines", m.diffScroll)
+	}
+	for i := 1; i < len(m.rows); i++ {
+		m = update(t, m, runeKeys("k")...)
+		cursorShown(t, m)
+	}
+	if m.cursor != 0 || m.diffScroll != 0 {
+		t.Fatalf("top: cursor %d, scroll %d", m.cursor, m.diffScroll)
+	}
+}
+
+func TestWrap_TogglingKeepsTheCursorOnScreen(t *testing.T) {
+	m := wrapModel()
+	m = update(t, m, runeKeys("50j")...)
+	if m.cursor != 50 {
+		t.Fatalf("cursor %d", m.cursor)
+	}
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyCtrlW})
+	cursorShown(t, m)
+	m = typeKeys(t, m, tea.KeyMsg{Type: tea.KeyCtrlW})
+	cursorShown(t, m)
+}